@@ -41,6 +41,7 @@ type Host struct {
 	HType        int    `json:"htype" binding:"required"`
 	VCPUNum      int    `json:"vcpu_num"`
 	MemTotal     int    `json:"mem_total"`
+	NICNum       int    `json:"nic_num"`
 	ExtraInfo    string `json:"extra_info"`
 	AZLcuuid     string `json:"az_lcuuid" binding:"required"`
 	RegionLcuuid string `json:"region_lcuuid" binding:"required"`
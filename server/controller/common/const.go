@@ -96,7 +96,8 @@ const (
 	VTAP_STATE_NOT_CONNECTED = iota
 	VTAP_STATE_NORMAL
 	VTAP_STATE_DISABLE
-	VTAP_STATE_PENDING
+	VTAP_STATE_PENDING // 未开启自动注册时，新采集器等待审批
+	VTAP_STATE_REJECTED
 )
 
 var (
@@ -105,6 +106,7 @@ var (
 		VTAP_STATE_NORMAL:        "运行",
 		VTAP_STATE_DISABLE:       "禁用",
 		VTAP_STATE_PENDING:       "未注册",
+		VTAP_STATE_REJECTED:      "已拒绝",
 	}
 )
 
@@ -113,6 +115,7 @@ const (
 	VTAP_STATE_NORMAL_STR        = "RUNNING"
 	VTAP_STATE_DISABLE_STR       = "DISABLE"
 	VTAP_STATE_PENDING_STR       = "PENDING"
+	VTAP_STATE_REJECTED_STR      = "REJECTED"
 )
 
 const (
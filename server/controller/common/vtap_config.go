@@ -71,6 +71,7 @@ var DefaultVTapGroupConfig = &mysql.VTapGroupConfiguration{
 	PodClusterInternalIP:          &DefaultPodClusterInternalIP,
 	Domains:                       &DefaultDomains,
 	DecapType:                     &DefaultDecapType,
+	SegmentDeviceTypes:            &DefaultSegmentDeviceTypes,
 	HTTPLogSpanID:                 &DefaultHTTPLogSpanID,
 	SysFreeMemoryLimit:            &DefaultSysFreeMemoryLimit,
 	LogFileSize:                   &DefaultLogFileSize,
@@ -136,6 +137,7 @@ var (
 	DefaultPodClusterInternalIP          = 0
 	DefaultDomains                       = "0"
 	DefaultDecapType                     = "1,2"
+	DefaultSegmentDeviceTypes            = "" // 为空时下发所有类型接口的segment
 	DefaultHTTPLogSpanID                 = "traceparent, sw8"
 	DefaultSysFreeMemoryLimit            = 0
 	DefaultLogFileSize                   = 1000
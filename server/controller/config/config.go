@@ -40,8 +40,9 @@ import (
 var log = logging.MustGetLogger("config")
 
 type Roze struct {
-	Port    int `default:"20106" yaml:"port"`
-	Timeout int `default:"60" yaml:"timeout"`
+	Port             int `default:"20106" yaml:"port"`
+	Timeout          int `default:"60" yaml:"timeout"`
+	SyslogBundlePort int `default:"20107" yaml:"syslog_bundle_port"`
 }
 
 type Specification struct {
@@ -135,6 +136,7 @@ func (c *Config) Load(path string) {
 	c.ControllerConfig.TrisolarisCfg.SetBillingMethod(c.ControllerConfig.BillingMethod)
 	c.ControllerConfig.TrisolarisCfg.SetPodClusterInternalIPToIngester(c.ControllerConfig.PodClusterInternalIPToIngester)
 	c.ControllerConfig.TrisolarisCfg.SetGrpcMaxMessageLength(c.ControllerConfig.GrpcMaxMessageLength)
+	c.ControllerConfig.TrisolarisCfg.SetMonitorConfig(c.ControllerConfig.MonitorCfg)
 	grpcPort, err := strconv.Atoi(c.ControllerConfig.GrpcPort)
 	if err == nil {
 		c.ControllerConfig.TrisolarisCfg.SetGrpcPort(grpcPort)
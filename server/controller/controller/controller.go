@@ -50,6 +50,7 @@ import (
 	_ "github.com/deepflowio/deepflow/server/controller/trisolaris/services/grpc/debug"
 	_ "github.com/deepflowio/deepflow/server/controller/trisolaris/services/grpc/healthcheck"
 	_ "github.com/deepflowio/deepflow/server/controller/trisolaris/services/http/cache"
+	_ "github.com/deepflowio/deepflow/server/controller/trisolaris/services/http/segment"
 	_ "github.com/deepflowio/deepflow/server/controller/trisolaris/services/http/upgrade"
 )
 
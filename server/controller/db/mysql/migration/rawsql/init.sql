@@ -101,6 +101,7 @@ CREATE TABLE IF NOT EXISTS host_device (
     user_passwd         VARCHAR(64) DEFAULT '',
     vcpu_num            INTEGER DEFAULT 0,
     mem_total           INTEGER DEFAULT 0 COMMENT 'unit: M',
+    nic_num             INTEGER DEFAULT 0,
     rack                VARCHAR(64),
     rackid              INTEGER,
     topped              INTEGER DEFAULT 0,
@@ -1028,10 +1029,44 @@ CREATE TABLE IF NOT EXISTS vtap (
     tap_mode                INTEGER,
     expected_revision       TEXT,
     upgrade_package         TEXT,
+    row_version             INTEGER DEFAULT 0 COMMENT 'increased on each update, used for conditional update',
+    maintenance             TINYINT(1) DEFAULT 0 COMMENT '0: normal 1: in maintenance, lost state is not alarmed',
+    config_revision         INTEGER DEFAULT 0 COMMENT 'increased when the config pushed to the vtap changes',
+    acked_config_revision   INTEGER DEFAULT 0 COMMENT 'config revision reported by the vtap',
+    data_quota              BIGINT DEFAULT 0 COMMENT 'unit: bps, 0 means unlimited',
     lcuuid                  CHAR(64)
 ) ENGINE=InnoDB AUTO_INCREMENT=1 DEFAULT CHARSET=utf8;
 TRUNCATE TABLE vtap;
 
+CREATE TABLE IF NOT EXISTS vtap_tag (
+    `vtap_id`       INTEGER NOT NULL,
+    `key`           VARCHAR(256) NOT NULL,
+    `value`         VARCHAR(256),
+    PRIMARY KEY (`vtap_id`, `key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+TRUNCATE TABLE vtap_tag;
+
+CREATE TABLE IF NOT EXISTS vtap_rebalance_history (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    type                    CHAR(16) NOT NULL COMMENT 'controller/analyzer',
+    actor                   VARCHAR(64) DEFAULT '',
+    switch_vtap_num         INTEGER DEFAULT 0,
+    created_at              DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX created_at_index(`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+TRUNCATE TABLE vtap_rebalance_history;
+
+CREATE TABLE IF NOT EXISTS vtap_webhook (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                    VARCHAR(64) NOT NULL,
+    url                     VARCHAR(512) NOT NULL,
+    secret                  VARCHAR(256) DEFAULT '' COMMENT 'used to sign the event body with HMAC-SHA256',
+    lcuuid                  CHAR(64) NOT NULL,
+    created_at              DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX lcuuid_index(`lcuuid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+TRUNCATE TABLE vtap_webhook;
+
 CREATE TABLE IF NOT EXISTS vtap_group (
     id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
     name                    VARCHAR(64) NOT NULL,
@@ -1622,6 +1657,7 @@ CREATE TABLE IF NOT EXISTS vtap_group_configuration(
     l4_log_ignore_tap_sides   TEXT COMMENT 'separate by ","',
     l7_log_ignore_tap_sides   TEXT COMMENT 'separate by ","',
     decap_type                TEXT COMMENT 'separate by ","',
+    segment_device_types      TEXT COMMENT 'vinterface device types of local segments, separate by ","',
     capture_socket_type       INTEGER,
     capture_bpf               VARCHAR(512),
     tap_mode                  INTEGER COMMENT '0: local 1: virtual mirror 2: physical mirror',
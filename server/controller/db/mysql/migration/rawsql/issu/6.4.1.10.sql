@@ -0,0 +1,6 @@
+ALTER TABLE vtap ADD COLUMN config_revision INTEGER DEFAULT 0 COMMENT 'increased when the config pushed to the vtap changes' AFTER maintenance;
+ALTER TABLE vtap ADD COLUMN acked_config_revision INTEGER DEFAULT 0 COMMENT 'config revision reported by the vtap' AFTER config_revision;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.10';
+-- modify end
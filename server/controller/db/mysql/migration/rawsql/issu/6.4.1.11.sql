@@ -0,0 +1,5 @@
+ALTER TABLE vtap ADD COLUMN data_quota BIGINT DEFAULT 0 COMMENT 'unit: bps, 0 means unlimited' AFTER acked_config_revision;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.11';
+-- modify end
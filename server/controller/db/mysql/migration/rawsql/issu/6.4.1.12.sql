@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS vtap_rebalance_history (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    type                    CHAR(16) NOT NULL COMMENT 'controller/analyzer',
+    actor                   VARCHAR(64) DEFAULT '',
+    switch_vtap_num         INTEGER DEFAULT 0,
+    created_at              DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    INDEX created_at_index(`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.12';
+-- modify end
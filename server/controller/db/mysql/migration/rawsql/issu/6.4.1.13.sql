@@ -0,0 +1,5 @@
+ALTER TABLE host_device ADD COLUMN nic_num INTEGER DEFAULT 0 AFTER mem_total;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.13';
+-- modify end
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS vtap_webhook (
+    id                      INTEGER NOT NULL AUTO_INCREMENT PRIMARY KEY,
+    name                    VARCHAR(64) NOT NULL,
+    url                     VARCHAR(512) NOT NULL,
+    secret                  VARCHAR(256) DEFAULT '' COMMENT 'used to sign the event body with HMAC-SHA256',
+    lcuuid                  CHAR(64) NOT NULL,
+    created_at              DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE INDEX lcuuid_index(`lcuuid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.14';
+-- modify end
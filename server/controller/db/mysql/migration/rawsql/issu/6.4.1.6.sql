@@ -0,0 +1,5 @@
+ALTER TABLE vtap ADD COLUMN row_version INTEGER DEFAULT 0 AFTER upgrade_package;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.6';
+-- modify end
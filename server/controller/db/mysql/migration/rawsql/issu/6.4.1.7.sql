@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS vtap_tag (
+    `vtap_id`       INTEGER NOT NULL,
+    `key`           VARCHAR(256) NOT NULL,
+    `value`         VARCHAR(256),
+    PRIMARY KEY (`vtap_id`, `key`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.7';
+-- modify end
@@ -0,0 +1,5 @@
+ALTER TABLE vtap_group_configuration ADD COLUMN segment_device_types TEXT COMMENT 'vinterface device types of local segments, separate by ","' AFTER decap_type;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.8';
+-- modify end
@@ -0,0 +1,5 @@
+ALTER TABLE vtap ADD COLUMN maintenance TINYINT(1) DEFAULT 0 COMMENT '0: normal 1: in maintenance, lost state is not alarmed' AFTER row_version;
+
+-- update db_version to latest, remeber update DB_VERSION_EXPECT in migrate/version.go
+UPDATE db_version SET version='6.4.1.9';
+-- modify end
@@ -160,48 +160,88 @@ func (AZAnalyzerConnection) TableName() string {
 }
 
 type VTap struct {
-	ID                 int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
-	Name               string    `gorm:"column:name;type:varchar(256);not null" json:"NAME"`
-	State              int       `gorm:"column:state;type:int;default:1" json:"STATE"`   // 0.not-connected 1.normal
-	Enable             int       `gorm:"column:enable;type:int;default:1" json:"ENABLE"` // 0: stop 1: running
-	Type               int       `gorm:"column:type;type:int;default:0" json:"TYPE"`     // 1: process 2: vm 3: public cloud 4: analyzer 5: physical machine 6: dedicated physical machine 7: host pod 8: vm pod
-	CtrlIP             string    `gorm:"column:ctrl_ip;type:char(64);not null" json:"CTRL_IP"`
-	CtrlMac            string    `gorm:"column:ctrl_mac;type:char(64);default:null" json:"CTRL_MAC"`
-	TapMac             string    `gorm:"column:tap_mac;type:char(64);default:null" json:"TAP_MAC"`
-	AnalyzerIP         string    `gorm:"column:analyzer_ip;type:char(64);not null" json:"ANALYZER_IP"`
-	CurAnalyzerIP      string    `gorm:"column:cur_analyzer_ip;type:char(64);not null" json:"CUR_ANALYZER_IP"`
-	ControllerIP       string    `gorm:"column:controller_ip;type:char(64);not null" json:"CONTROLLER_IP"`
-	CurControllerIP    string    `gorm:"column:cur_controller_ip;type:char(64);not null" json:"CUR_CONTROLLER_IP"`
-	LaunchServer       string    `gorm:"column:launch_server;type:char(64);not null" json:"LAUNCH_SERVER"`
-	LaunchServerID     int       `gorm:"column:launch_server_id;type:int;default:null" json:"LAUNCH_SERVER_ID"`
-	AZ                 string    `gorm:"column:az;type:char(64);default:''" json:"AZ"`
-	Region             string    `gorm:"column:region;type:char(64);default:''" json:"REGION"`
-	Revision           string    `gorm:"column:revision;type:varchar(256);default:null" json:"REVISION"`
-	SyncedControllerAt time.Time `gorm:"column:synced_controller_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"SYNCED_CONTROLLER_AT"`
-	SyncedAnalyzerAt   time.Time `gorm:"column:synced_analyzer_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"SYNCED_ANALYZER_AT"`
-	CreatedAt          time.Time `gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
-	BootTime           int       `gorm:"column:boot_time;type:int;default:0" json:"BOOT_TIME"`
-	Exceptions         int64     `gorm:"column:exceptions;type:int unsigned;default:0" json:"EXCEPTIONS"`
-	VTapLcuuid         string    `gorm:"column:vtap_lcuuid;type:char(64);default:null" json:"VTAP_LCUUID"`
-	VtapGroupLcuuid    string    `gorm:"column:vtap_group_lcuuid;type:char(64);default:null" json:"VTAP_GROUP_LCUUID"`
-	CPUNum             int       `gorm:"column:cpu_num;type:int;default:0" json:"CPU_NUM"` // logical number of cpu
-	MemorySize         int64     `gorm:"column:memory_size;type:bigint;default:0" json:"MEMORY_SIZE"`
-	Arch               string    `gorm:"column:arch;type:varchar(256);default:null" json:"ARCH"`
-	Os                 string    `gorm:"column:os;type:varchar(256);default:null" json:"OS"`
-	KernelVersion      string    `gorm:"column:kernel_version;type:varchar(256);default:null" json:"KERNEL_VERSION"`
-	ProcessName        string    `gorm:"column:process_name;type:varchar(256);default:null" json:"PROCESS_NAME"`
-	LicenseType        int       `gorm:"column:license_type;type:int;default:null" json:"LICENSE_TYPE"`   // 1: A类 2: B类 3: C类
-	LicenseFunctions   string    `gorm:"column:license_functions;type:char(64)" json:"LICENSE_FUNCTIONS"` // separated by ,; 1: 流量分发 2: 网络监控 3: 应用监控
-	TapMode            int       `gorm:"column:tap_mode;type:int;default:null" json:"TAP_MODE"`
-	ExpectedRevision   string    `gorm:"column:expected_revision;type:text;default null" json:"EXPECTED_REVISION"`
-	UpgradePackage     string    `gorm:"column:upgrade_package;type:text;default null" json:"UPGRADE_PACKAGE"`
-	Lcuuid             string    `gorm:"column:lcuuid;type:char(64);not null" json:"LCUUID"`
+	ID                  int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	Name                string    `gorm:"column:name;type:varchar(256);not null" json:"NAME"`
+	State               int       `gorm:"column:state;type:int;default:1" json:"STATE"`   // 0.not-connected 1.normal 3.pending 4.rejected
+	Enable              int       `gorm:"column:enable;type:int;default:1" json:"ENABLE"` // 0: stop 1: running
+	Type                int       `gorm:"column:type;type:int;default:0" json:"TYPE"`     // 1: process 2: vm 3: public cloud 4: analyzer 5: physical machine 6: dedicated physical machine 7: host pod 8: vm pod
+	CtrlIP              string    `gorm:"column:ctrl_ip;type:char(64);not null" json:"CTRL_IP"`
+	CtrlMac             string    `gorm:"column:ctrl_mac;type:char(64);default:null" json:"CTRL_MAC"`
+	TapMac              string    `gorm:"column:tap_mac;type:char(64);default:null" json:"TAP_MAC"`
+	AnalyzerIP          string    `gorm:"column:analyzer_ip;type:char(64);not null" json:"ANALYZER_IP"`
+	CurAnalyzerIP       string    `gorm:"column:cur_analyzer_ip;type:char(64);not null" json:"CUR_ANALYZER_IP"`
+	ControllerIP        string    `gorm:"column:controller_ip;type:char(64);not null" json:"CONTROLLER_IP"`
+	CurControllerIP     string    `gorm:"column:cur_controller_ip;type:char(64);not null" json:"CUR_CONTROLLER_IP"`
+	LaunchServer        string    `gorm:"column:launch_server;type:char(64);not null" json:"LAUNCH_SERVER"`
+	LaunchServerID      int       `gorm:"column:launch_server_id;type:int;default:null" json:"LAUNCH_SERVER_ID"`
+	AZ                  string    `gorm:"column:az;type:char(64);default:''" json:"AZ"`
+	Region              string    `gorm:"column:region;type:char(64);default:''" json:"REGION"`
+	Revision            string    `gorm:"column:revision;type:varchar(256);default:null" json:"REVISION"`
+	SyncedControllerAt  time.Time `gorm:"column:synced_controller_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"SYNCED_CONTROLLER_AT"`
+	SyncedAnalyzerAt    time.Time `gorm:"column:synced_analyzer_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"SYNCED_ANALYZER_AT"`
+	CreatedAt           time.Time `gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+	BootTime            int       `gorm:"column:boot_time;type:int;default:0" json:"BOOT_TIME"`
+	Exceptions          int64     `gorm:"column:exceptions;type:int unsigned;default:0" json:"EXCEPTIONS"`
+	VTapLcuuid          string    `gorm:"column:vtap_lcuuid;type:char(64);default:null" json:"VTAP_LCUUID"`
+	VtapGroupLcuuid     string    `gorm:"column:vtap_group_lcuuid;type:char(64);default:null" json:"VTAP_GROUP_LCUUID"`
+	CPUNum              int       `gorm:"column:cpu_num;type:int;default:0" json:"CPU_NUM"` // logical number of cpu
+	MemorySize          int64     `gorm:"column:memory_size;type:bigint;default:0" json:"MEMORY_SIZE"`
+	Arch                string    `gorm:"column:arch;type:varchar(256);default:null" json:"ARCH"`
+	Os                  string    `gorm:"column:os;type:varchar(256);default:null" json:"OS"`
+	KernelVersion       string    `gorm:"column:kernel_version;type:varchar(256);default:null" json:"KERNEL_VERSION"`
+	ProcessName         string    `gorm:"column:process_name;type:varchar(256);default:null" json:"PROCESS_NAME"`
+	LicenseType         int       `gorm:"column:license_type;type:int;default:null" json:"LICENSE_TYPE"`   // 1: A类 2: B类 3: C类
+	LicenseFunctions    string    `gorm:"column:license_functions;type:char(64)" json:"LICENSE_FUNCTIONS"` // separated by ,; 1: 流量分发 2: 网络监控 3: 应用监控
+	TapMode             int       `gorm:"column:tap_mode;type:int;default:null" json:"TAP_MODE"`
+	ExpectedRevision    string    `gorm:"column:expected_revision;type:text;default null" json:"EXPECTED_REVISION"`
+	UpgradePackage      string    `gorm:"column:upgrade_package;type:text;default null" json:"UPGRADE_PACKAGE"`
+	RowVersion          int       `gorm:"column:row_version;type:int;default:0" json:"ROW_VERSION"`                     // increased on each update
+	Maintenance         bool      `gorm:"column:maintenance;type:tinyint(1);default:0" json:"MAINTENANCE"`              // lost state is not alarmed in maintenance
+	ConfigRevision      int       `gorm:"column:config_revision;type:int;default:0" json:"CONFIG_REVISION"`             // increased when the config pushed to the vtap changes
+	AckedConfigRevision int       `gorm:"column:acked_config_revision;type:int;default:0" json:"ACKED_CONFIG_REVISION"` // reported by the vtap
+	DataQuota           int64     `gorm:"column:data_quota;type:bigint;default:0" json:"DATA_QUOTA"`                    // unit: bps, 0 means unlimited
+	Lcuuid              string    `gorm:"column:lcuuid;type:char(64);not null" json:"LCUUID"`
 }
 
 func (VTap) TableName() string {
 	return "vtap"
 }
 
+type VTapTag struct {
+	VTapID int    `gorm:"primaryKey;column:vtap_id;type:int;not null" json:"VTAP_ID"`
+	Key    string `gorm:"primaryKey;column:key;type:varchar(256);not null" json:"KEY"`
+	Value  string `gorm:"column:value;type:varchar(256);default:null" json:"VALUE"`
+}
+
+func (VTapTag) TableName() string {
+	return "vtap_tag"
+}
+
+type VTapRebalanceHistory struct {
+	ID            int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	Type          string    `gorm:"column:type;type:char(16);not null" json:"TYPE"` // controller/analyzer
+	Actor         string    `gorm:"column:actor;type:varchar(64);default:''" json:"ACTOR"`
+	SwitchVTapNum int       `gorm:"column:switch_vtap_num;type:int;default:0" json:"SWITCH_VTAP_NUM"`
+	CreatedAt     time.Time `gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+}
+
+func (VTapRebalanceHistory) TableName() string {
+	return "vtap_rebalance_history"
+}
+
+type VTapWebhook struct {
+	ID        int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
+	Name      string    `gorm:"column:name;type:varchar(64);not null" json:"NAME"`
+	URL       string    `gorm:"column:url;type:varchar(512);not null" json:"URL"`
+	Secret    string    `gorm:"column:secret;type:varchar(256);default:''" json:"-"` // 非空时使用HMAC-SHA256签名事件内容
+	Lcuuid    string    `gorm:"column:lcuuid;type:char(64);not null" json:"LCUUID"`
+	CreatedAt time.Time `gorm:"column:created_at;type:datetime;not null;default:CURRENT_TIMESTAMP" json:"CREATED_AT"`
+}
+
+func (VTapWebhook) TableName() string {
+	return "vtap_webhook"
+}
+
 type VTapGroup struct {
 	ID        int       `gorm:"primaryKey;column:id;type:int;not null" json:"ID"`
 	Name      string    `gorm:"column:name;type:varchar(64);not null" json:"NAME"`
@@ -284,6 +324,7 @@ type VTapGroupConfiguration struct {
 	PodClusterInternalIP          *int    `gorm:"column:pod_cluster_internal_ip;type:tinyint(1);default:null" json:"POD_CLUSTER_INTERNAL_IP"` // 0:  1:
 	Domains                       *string `gorm:"column:domains;type:text;default:null" json:"DOMAINS"`                                       // domains info, separate by ","
 	DecapType                     *string `gorm:"column:decap_type;type:text;default:null" json:"DECAP_TYPE"`                                 // separate by ","
+	SegmentDeviceTypes            *string `gorm:"column:segment_device_types;type:text;default:null" json:"SEGMENT_DEVICE_TYPES"`             // separate by ","
 	HTTPLogSpanID                 *string `gorm:"column:http_log_span_id;type:text;default:null" json:"HTTP_LOG_SPAN_ID"`
 	SysFreeMemoryLimit            *int    `gorm:"column:sys_free_memory_limit;type:int;default:null" json:"SYS_FREE_MEMORY_LIMIT"` // unit: %
 	LogFileSize                   *int    `gorm:"column:log_file_size;type:int;default:null" json:"LOG_FILE_SIZE"`                 // unit: MB
@@ -358,6 +399,7 @@ type RVTapGroupConfiguration struct {
 	PodClusterInternalIP          int    `gorm:"column:pod_cluster_internal_ip;type:tinyint(1);default:null" json:"POD_CLUSTER_INTERNAL_IP"` // 0:  1:
 	Domains                       string `gorm:"column:domains;type:text;default:null" json:"DOMAINS"`                                       // domains info, separate by ","
 	DecapType                     string `gorm:"column:decap_type;type:text;default:null" json:"DECAP_TYPE"`                                 // separate by ","
+	SegmentDeviceTypes            string `gorm:"column:segment_device_types;type:text;default:null" json:"SEGMENT_DEVICE_TYPES"`             // separate by ","
 	HTTPLogSpanID                 string `gorm:"column:http_log_span_id;type:text;default:null" json:"HTTP_LOG_SPAN_ID"`
 	SysFreeMemoryLimit            int    `gorm:"column:sys_free_memory_limit;type:int;default:null" json:"SYS_FREE_MEMORY_LIMIT"` // unit: %
 	LogFileSize                   int    `gorm:"column:log_file_size;type:int;default:null" json:"LOG_FILE_SIZE"`                 // unit: MB
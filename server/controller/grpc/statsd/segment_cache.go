@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statsd
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	segmentCacheCounterOnce sync.Once
+	segmentCacheCounter     *GetSegmentCacheCounter
+)
+
+func GetSegmentCacheCounterSingleton() *GetSegmentCacheCounter {
+	segmentCacheCounterOnce.Do(func() {
+		segmentCacheCounter = NewGetSegmentCacheCounter()
+	})
+	return segmentCacheCounter
+}
+
+type GetSegmentCacheCounter struct {
+	*SegmentCacheCounter
+}
+
+func NewGetSegmentCacheCounter() *GetSegmentCacheCounter {
+	return &GetSegmentCacheCounter{
+		SegmentCacheCounter: &SegmentCacheCounter{},
+	}
+}
+
+func (g *GetSegmentCacheCounter) GetCounter() interface{} {
+	counter := &SegmentCacheCounter{}
+	counter, g.SegmentCacheCounter = g.SegmentCacheCounter, counter
+	return counter
+}
+
+func (g *GetSegmentCacheCounter) Closed() bool {
+	return false
+}
+
+// 采集器local segment缓存的命中情况，eviction为平台数据刷新时失效的缓存条目数
+type SegmentCacheCounter struct {
+	Hit      uint64 `statsd:"hit_count"`
+	Miss     uint64 `statsd:"miss_count"`
+	Eviction uint64 `statsd:"eviction_count"`
+}
+
+func (c *SegmentCacheCounter) AddHitCount(count uint64) {
+	atomic.AddUint64(&c.Hit, count)
+}
+
+func (c *SegmentCacheCounter) AddMissCount(count uint64) {
+	atomic.AddUint64(&c.Miss, count)
+}
+
+func (c *SegmentCacheCounter) AddEvictionCount(count uint64) {
+	atomic.AddUint64(&c.Eviction, count)
+}
@@ -133,4 +133,8 @@ func Start() {
 	if err != nil {
 		log.Error(err)
 	}
+	err = stats.RegisterCountableWithModulePrefix("controller_", "trisolaris", GetSegmentCacheCounterSingleton(), stats.OptionStatTags{"grpc_type": "SegmentCache"})
+	if err != nil {
+		log.Error(err)
+	}
 }
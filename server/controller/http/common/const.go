@@ -30,4 +30,13 @@ const (
 	SELECTED_RESOURCES_NUM_EXCEEDED = "SELECTED_RESOURCES_NUM_EXCEEDED"
 	SERVICE_UNAVAILABLE             = "SERVICE_UNAVAILABLE"
 	K8S_SET_VTAP_FAIL               = "K8S_SET_VTAP_FAIL"
+	RESOURCE_VERSION_CONFLICT       = "RESOURCE_VERSION_CONFLICT"
+	FORBIDDEN                       = "FORBIDDEN"
+)
+
+// 错误子码，便于调用方区分同一OPT_STATUS下的具体错误
+const (
+	VTAP_NOT_FOUND     = "VTAP_NOT_FOUND"
+	VTAP_GROUP_INVALID = "VTAP_GROUP_INVALID"
+	LICENSE_EXHAUSTED  = "LICENSE_EXHAUSTED"
 )
@@ -17,6 +17,14 @@
 package config
 
 type Config struct {
-	RedisRefreshInterval int      `default:"3600" yaml:"redis_refresh_interval"`
-	AdditionalDomains    []string `yaml:"additional_domains"`
+	RedisRefreshInterval int         `default:"3600" yaml:"redis_refresh_interval"`
+	AdditionalDomains    []string    `yaml:"additional_domains"`
+	VTapDBRetry          VTapDBRetry `yaml:"vtap_db_retry"`
+}
+
+type VTapDBRetry struct {
+	RetryCount       int `default:"2" yaml:"retry_count"`
+	RetryInterval    int `default:"100" yaml:"retry_interval"` // unit: ms
+	BreakerThreshold int `default:"5" yaml:"breaker_threshold"`
+	BreakerCooldown  int `default:"30" yaml:"breaker_cooldown"` // unit: s
 }
@@ -17,7 +17,9 @@
 package common
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
@@ -25,10 +27,46 @@ import (
 	servicecommon "github.com/deepflowio/deepflow/server/controller/http/service/common"
 )
 
+const (
+	API_VERSION_V1 = "v1"
+	API_VERSION_V2 = "v2"
+
+	API_VERSION_HEADER = "Accept-Version"
+	// 路由协商出的响应版本保存在gin.Context中
+	API_VERSION_CONTEXT_KEY = "api_version"
+)
+
 type Response struct {
 	OptStatus   string      `json:"OPT_STATUS"`
 	Description string      `json:"DESCRIPTION"`
 	Data        interface{} `json:"DATA"`
+	ErrorCode   string      `json:"ERROR_CODE,omitempty"`
+	APIVersion  string      `json:"API_VERSION"`
+}
+
+// NegotiateAPIVersion 按请求头Accept-Version选择路由支持的响应版本，未指定时为v1，
+// 支持v2、2两种写法，协商结果记录在gin.Context中，由返回的Response携带
+func NegotiateAPIVersion(c *gin.Context, supported ...string) (string, error) {
+	version := strings.ToLower(strings.TrimSpace(c.GetHeader(API_VERSION_HEADER)))
+	if version == "" {
+		version = API_VERSION_V1
+	} else if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	for _, s := range supported {
+		if s == version {
+			c.Set(API_VERSION_CONTEXT_KEY, version)
+			return version, nil
+		}
+	}
+	return "", fmt.Errorf("api version (%s) not supported, supported versions: %v", c.GetHeader(API_VERSION_HEADER), supported)
+}
+
+func getAPIVersion(c *gin.Context) string {
+	if version := c.GetString(API_VERSION_CONTEXT_KEY); version != "" {
+		return version
+	}
+	return API_VERSION_V1
 }
 
 func HttpResponse(c *gin.Context, httpCode int, data interface{}, optStatus string, description string) {
@@ -36,6 +74,7 @@ func HttpResponse(c *gin.Context, httpCode int, data interface{}, optStatus stri
 		OptStatus:   optStatus,
 		Description: description,
 		Data:        data,
+		APIVersion:  getAPIVersion(c),
 	})
 }
 
@@ -43,6 +82,7 @@ func BadRequestResponse(c *gin.Context, optStatus string, description string) {
 	c.JSON(http.StatusBadRequest, Response{
 		OptStatus:   optStatus,
 		Description: description,
+		APIVersion:  getAPIVersion(c),
 	})
 }
 
@@ -51,6 +91,7 @@ func InternalErrorResponse(c *gin.Context, data interface{}, optStatus string, d
 		OptStatus:   optStatus,
 		Description: description,
 		Data:        data,
+		APIVersion:  getAPIVersion(c),
 	})
 }
 
@@ -59,6 +100,24 @@ func ServiceUnavailableResponse(c *gin.Context, data interface{}, optStatus stri
 		OptStatus:   optStatus,
 		Description: description,
 		Data:        data,
+		APIVersion:  getAPIVersion(c),
+	})
+}
+
+func ConflictResponse(c *gin.Context, data interface{}, optStatus string, description string) {
+	c.JSON(http.StatusConflict, Response{
+		OptStatus:   optStatus,
+		Description: description,
+		Data:        data,
+		APIVersion:  getAPIVersion(c),
+	})
+}
+
+func ForbiddenResponse(c *gin.Context, optStatus string, description string) {
+	c.JSON(http.StatusForbidden, Response{
+		OptStatus:   optStatus,
+		Description: description,
+		APIVersion:  getAPIVersion(c),
 	})
 }
 
@@ -66,16 +125,30 @@ func JsonResponse(c *gin.Context, data interface{}, err error) {
 	if err != nil {
 		switch t := err.(type) {
 		case *servicecommon.ServiceError:
+			var httpCode int
 			switch t.Status {
 			case httpcommon.RESOURCE_NOT_FOUND, httpcommon.INVALID_POST_DATA, httpcommon.RESOURCE_NUM_EXCEEDED,
 				httpcommon.SELECTED_RESOURCES_NUM_EXCEEDED, httpcommon.RESOURCE_ALREADY_EXIST,
 				httpcommon.PARAMETER_ILLEGAL, httpcommon.INVALID_PARAMETERS:
-				BadRequestResponse(c, t.Status, t.Message)
+				httpCode, data = http.StatusBadRequest, nil
 			case httpcommon.SERVER_ERROR, httpcommon.CONFIG_PENDING:
-				InternalErrorResponse(c, data, t.Status, t.Message)
+				httpCode = http.StatusInternalServerError
 			case httpcommon.SERVICE_UNAVAILABLE:
-				ServiceUnavailableResponse(c, data, t.Status, t.Message)
+				httpCode = http.StatusServiceUnavailable
+			case httpcommon.RESOURCE_VERSION_CONFLICT:
+				httpCode = http.StatusConflict
+			case httpcommon.FORBIDDEN:
+				httpCode = http.StatusForbidden
+			default:
+				return
 			}
+			c.JSON(httpCode, Response{
+				OptStatus:   t.Status,
+				Description: t.Message,
+				Data:        data,
+				ErrorCode:   t.ErrorCode,
+				APIVersion:  getAPIVersion(c),
+			})
 		default:
 			InternalErrorResponse(c, data, httpcommon.FAIL, err.Error())
 		}
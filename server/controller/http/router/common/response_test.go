@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	servicecommon "github.com/deepflowio/deepflow/server/controller/http/service/common"
+)
+
+func TestJsonResponseErrorCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		err       error
+		httpCode  int
+		errorCode string
+	}{
+		{
+			err: servicecommon.NewErrorWithCode(
+				httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, "vtap (x) not found"),
+			httpCode:  http.StatusBadRequest,
+			errorCode: httpcommon.VTAP_NOT_FOUND,
+		},
+		{
+			err:      servicecommon.NewError(httpcommon.SERVER_ERROR, "db error"),
+			httpCode: http.StatusInternalServerError,
+		},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		JsonResponse(c, nil, tc.err)
+
+		assert.Equal(t, tc.httpCode, w.Code)
+		var body map[string]interface{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, tc.err.(*servicecommon.ServiceError).Message, body["DESCRIPTION"])
+		if tc.errorCode == "" {
+			assert.NotContains(t, body, "ERROR_CODE")
+		} else {
+			assert.Equal(t, tc.errorCode, body["ERROR_CODE"])
+		}
+	}
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		header  string
+		version string
+		wantErr bool
+	}{
+		{header: "", version: API_VERSION_V1},
+		{header: "v2", version: API_VERSION_V2},
+		{header: " V2 ", version: API_VERSION_V2},
+		{header: "1", version: API_VERSION_V1},
+		{header: "v3", wantErr: true},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			c.Request.Header.Set(API_VERSION_HEADER, tc.header)
+		}
+		version, err := NegotiateAPIVersion(c, API_VERSION_V1, API_VERSION_V2)
+		if tc.wantErr {
+			assert.NotNil(t, err)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.version, version)
+
+		// 响应中携带协商的版本
+		JsonResponse(c, nil, nil)
+		var body map[string]interface{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, tc.version, body["API_VERSION"])
+	}
+}
@@ -54,6 +54,7 @@ func (d *Debug) RegisterTo(e *gin.Engine) {
 	e.GET("/v1/recorders/:domainLcuuid/:subDomainLcuuid/cache/diff-bases/:resourceType/", getRecorderDiffBaseDataSetByResourceType(d.m))
 	e.GET("/v1/recorders/:domainLcuuid/:subDomainLcuuid/cache/diff-bases/:resourceType/:resourceLcuuid/", getRecorderDiffBase(d.m))
 	e.GET("/v1/recorders/:domainLcuuid/:subDomainLcuuid/cache/tool-maps/:field/", getRecorderCacheToolMap(d.m))
+	e.GET("/v1/recorders/:domainLcuuid/:subDomainLcuuid/cache/consistency/:resourceType/", checkRecorderCacheConsistency(d.m))
 }
 
 func getCloudBasicInfo(m *manager.Manager) gin.HandlerFunc {
@@ -152,6 +153,16 @@ func getRecorderCacheToolMap(m *manager.Manager) gin.HandlerFunc {
 	})
 }
 
+func checkRecorderCacheConsistency(m *manager.Manager) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		domainLcuuid := c.Param("domainLcuuid")
+		subDomainLcuuid := c.Param("subDomainLcuuid")
+		resourceType := c.Param("resourceType")
+		data, err := service.CheckRecorderCacheConsistency(domainLcuuid, subDomainLcuuid, resourceType, m)
+		JsonResponse(c, data, err)
+	})
+}
+
 func getAgentStats(g *genesis.Genesis) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		data, err := service.GetAgentStats(g, c.Param("ipOrID"))
@@ -22,8 +22,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,42 +41,108 @@ import (
 )
 
 type Vtap struct {
-	cfg *config.ControllerConfig
+	cfg        *config.ControllerConfig
+	authorizer VtapAuthorizer
 }
 
 func NewVtap(cfg *config.ControllerConfig) *Vtap {
-	return &Vtap{cfg: cfg}
+	return &Vtap{cfg: cfg, authorizer: allowAllVtapAuthorizer{}}
 }
 
-func (v *Vtap) RegisterTo(e *gin.Engine) {
+// SetAuthorizer 设置采集器接口的鉴权，未设置时允许所有请求
+func (v *Vtap) SetAuthorizer(authorizer VtapAuthorizer) *Vtap {
+	if authorizer == nil {
+		authorizer = allowAllVtapAuthorizer{}
+	}
+	v.authorizer = authorizer
+	return v
+}
+
+func (v *Vtap) RegisterTo(engine *gin.Engine) {
+	e := engine.Group("", v.authorize)
 	e.GET("/v1/vtaps/:lcuuid/", getVtap)
 	e.GET("/v1/vtaps/", getVtaps)
-	e.POST("/v1/vtaps/", createVtap)
+	e.POST("/v1/vtaps/", createVtap(v.cfg))
+	e.POST("/v1/vtaps/query/", queryVtaps)
 	e.PATCH("/v1/vtaps/:lcuuid/", updateVtap)
 	e.PATCH("/v1/vtaps-by-name/:name/", updateVtap)
 	e.DELETE("/v1/vtaps/:lcuuid/", deleteVtap)
 	e.POST("/v1/vtaps/batch/", batchUpdateVtap)
 	e.DELETE("/v1/vtaps/batch/", batchDeleteVtap)
 
+	e.POST("/v1/vtaps/:lcuuid/reassign/", reassignVtap)
+	e.POST("/v1/vtaps/batch/reassign/", batchReassignVtap)
+	e.POST("/v1/vtaps/:lcuuid/approve/", approveVtap)
+	e.POST("/v1/vtaps/:lcuuid/reject/", rejectVtap)
+	e.GET("/v1/vtaps/:lcuuid/syslog-bundle/", getVtapSyslogBundle(v.cfg))
+	e.PATCH("/v1/vtaps/:lcuuid/config-ack/", ackVtapConfig)
 	e.POST("/v1/rebalance-vtap/", rebalanceVtap(v.cfg))
+	e.GET("/v1/rebalance-vtap/predict/", predictVTapAssignment(v.cfg))
+	e.GET("/v1/rebalance-history/", getRebalanceHistory)
+
+	e.POST("/v1/vtap-webhooks/", createVtapWebhook)
+	e.GET("/v1/vtap-webhooks/", getVtapWebhooks)
+	e.DELETE("/v1/vtap-webhooks/:lcuuid/", deleteVtapWebhook)
 
 	e.PATCH("/v1/vtaps-license-type/:lcuuid/", updateVtapLicenseType)
-	e.PATCH("/v1/vtaps-license-type/", batchUpdateVtapLicenseType)
+	e.PATCH("/v1/vtaps-license-type/", batchUpdateVtapLicenseType(v.cfg))
+	e.GET("/v1/vtaps-license-usage/", getVtapLicenseUsage(v.cfg))
 	e.PATCH("/v1/vtaps-tap-mode/", batchUpdateVtapTapMode)
+	e.PATCH("/v1/vtaps/maintenance/", batchUpdateVtapMaintenance)
 
 	e.POST("/v1/vtaps-csv/", getVtapCSV)
 
 	e.GET("/v1/vtap-ports/", getVTapPorts)
+
+	e.GET("/v1/data-nodes/:ip/vtaps/", getDataNodeVtaps)
+	e.POST("/v1/data-nodes/migrate/", migrateDataNodeVtaps)
+}
+
+// v1版本的采集器不包含TAGS及ACKED_CONFIG_REVISION，同名字段覆盖model.Vtap中的字段并省略
+type vtapV1 struct {
+	model.Vtap
+	AckedConfigRevision *struct{} `json:"ACKED_CONFIG_REVISION,omitempty"`
+	Tags                *struct{} `json:"TAGS,omitempty"`
+}
+
+func negotiateVtapAPIVersion(c *gin.Context) (string, bool) {
+	version, err := NegotiateAPIVersion(c, API_VERSION_V1, API_VERSION_V2)
+	if err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return "", false
+	}
+	return version, true
+}
+
+// 按协商的版本返回采集器，v2返回完整的model.Vtap
+func vtapJsonResponse(c *gin.Context, version string, data []model.Vtap, err error) {
+	if err != nil || version == API_VERSION_V2 {
+		JsonResponse(c, data, err)
+		return
+	}
+	vtaps := make([]vtapV1, 0, len(data))
+	for _, vtap := range data {
+		vtaps = append(vtaps, vtapV1{Vtap: vtap})
+	}
+	JsonResponse(c, vtaps, nil)
 }
 
 func getVtap(c *gin.Context) {
+	version, ok := negotiateVtapAPIVersion(c)
+	if !ok {
+		return
+	}
 	args := make(map[string]interface{})
 	args["lcuuid"] = c.Param("lcuuid")
 	data, err := service.GetVtaps(args)
-	JsonResponse(c, data, err)
+	vtapJsonResponse(c, version, data, err)
 }
 
 func getVtaps(c *gin.Context) {
+	version, ok := negotiateVtapAPIVersion(c)
+	if !ok {
+		return
+	}
 	args := make(map[string]interface{})
 	args["names"] = c.QueryArray("name")
 	if value, ok := c.GetQuery("type"); ok {
@@ -89,25 +157,106 @@ func getVtaps(c *gin.Context) {
 	if value, ok := c.GetQuery("analyzer_ip"); ok {
 		args["analyzer_ip"] = value
 	}
+	if value, ok := c.GetQuery("controller_cidr"); ok {
+		args["controller_cidr"] = value
+	}
+	if value, ok := c.GetQuery("analyzer_cidr"); ok {
+		args["analyzer_cidr"] = value
+	}
+	// region/az为lcuuid，按采集器launch server的区域、可用区过滤
+	if value, ok := c.GetQuery("region"); ok {
+		args["region"] = value
+	}
+	if value, ok := c.GetQuery("az"); ok {
+		args["az"] = value
+	}
+	if value, ok := c.GetQuery("maintenance"); ok {
+		maintenance, err := strconv.ParseBool(value)
+		if err != nil {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid maintenance (%s)", value))
+			return
+		}
+		args["maintenance"] = maintenance
+	}
+	// state=3可查询待审批的采集器
+	if value, ok := c.GetQuery("state"); ok {
+		state, err := strconv.Atoi(value)
+		if err != nil {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid state (%s)", value))
+			return
+		}
+		args["state"] = state
+	}
+	// tags=key=value，可指定多个，返回包含全部tag的采集器
+	if values := c.QueryArray("tags"); len(values) > 0 {
+		tags := make(map[string]string, len(values))
+		for _, value := range values {
+			kv := strings.SplitN(value, "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid tag (%s), format: key=value", value))
+				return
+			}
+			tags[kv[0]] = kv[1]
+		}
+		args["tags"] = tags
+	}
+	args["data_usage"] = true
 	data, err := service.GetVtaps(args)
+	vtapJsonResponse(c, version, data, err)
+}
+
+func queryVtaps(c *gin.Context) {
+	var err error
+	var vtapQuery model.VtapQuery
+
+	// 参数校验
+	err = c.ShouldBindBodyWith(&vtapQuery, binding.JSON)
+	if err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return
+	}
+
+	data, err := service.QueryVtapsByLcuuids(vtapQuery.Lcuuids)
+	JsonResponse(c, data, err)
+}
+
+func getDataNodeVtaps(c *gin.Context) {
+	data, err := service.GetDataNodeVtaps(c.Param("ip"))
 	JsonResponse(c, data, err)
 }
 
-func createVtap(c *gin.Context) {
+func migrateDataNodeVtaps(c *gin.Context) {
 	var err error
-	var vtapCreate model.VtapCreate
+	var dataNodeMigrate model.DataNodeMigrate
 
 	// 参数校验
-	err = c.ShouldBindBodyWith(&vtapCreate, binding.JSON)
+	err = c.ShouldBindBodyWith(&dataNodeMigrate, binding.JSON)
 	if err != nil {
 		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
 		return
 	}
 
-	data, err := service.CreateVtap(vtapCreate)
+	data, err := service.MigrateDataNodeVtaps(dataNodeMigrate)
 	JsonResponse(c, data, err)
 }
 
+func createVtap(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var err error
+		var vtapCreate model.VtapCreate
+
+		// 参数校验
+		err = c.ShouldBindBodyWith(&vtapCreate, binding.JSON)
+		if err != nil {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+			return
+		}
+
+		data, err := service.CreateVtap(vtapCreate, cfg.MonitorCfg)
+		JsonResponse(c, data, err)
+	})
+}
+
 func updateVtap(c *gin.Context) {
 	var err error
 	var vtapUpdate model.VtapUpdate
@@ -124,33 +273,118 @@ func updateVtap(c *gin.Context) {
 	patchMap := map[string]interface{}{}
 	c.ShouldBindBodyWith(&patchMap, binding.JSON)
 
+	// If-Match 携带期望的 row version，用于条件更新
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		if _, ok := patchMap["ROW_VERSION"]; !ok {
+			rowVersion, err := strconv.Atoi(strings.Trim(ifMatch, `"`))
+			if err != nil {
+				BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("If-Match (%s) is invalid", ifMatch))
+				return
+			}
+			patchMap["ROW_VERSION"] = float64(rowVersion)
+		}
+	}
+
 	lcuuid := c.Param("lcuuid")
 	name := c.Param("name")
 	data, err := service.UpdateVtap(lcuuid, name, patchMap)
 	JsonResponse(c, data, err)
 }
 
+func reassignVtap(c *gin.Context) {
+	var err error
+	var vtapReassign model.VtapReassign
+
+	// 参数校验
+	err = c.ShouldBindBodyWith(&vtapReassign, binding.JSON)
+	if err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return
+	}
+
+	data, err := service.ReassignVtap(c.Param("lcuuid"), vtapReassign)
+	JsonResponse(c, data, err)
+}
+
+func batchReassignVtap(c *gin.Context) {
+	var vtapBatchReassign model.VtapBatchReassign
+
+	// 参数校验
+	err := c.ShouldBindBodyWith(&vtapBatchReassign, binding.JSON)
+	if err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return
+	}
+
+	data, err := service.BatchReassignVtapByTags(vtapBatchReassign)
+	JsonResponse(c, data, err)
+}
+
+func approveVtap(c *gin.Context) {
+	data, err := service.ApproveVtap(c.Param("lcuuid"))
+	JsonResponse(c, data, err)
+}
+
+func rejectVtap(c *gin.Context) {
+	data, err := service.RejectVtap(c.Param("lcuuid"))
+	JsonResponse(c, data, err)
+}
+
+// days为打包最近几天的日志文件(含今天)，默认为1
+func getVtapSyslogBundle(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days := 1
+		if value, ok := c.GetQuery("days"); ok {
+			var err error
+			if days, err = strconv.Atoi(value); err != nil || days < 1 {
+				BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid days (%s)", value))
+				return
+			}
+		}
+		body, fileName, err := service.GetVtapSyslogBundle(c.Param("lcuuid"), days, cfg.Roze)
+		if err != nil {
+			JsonResponse(c, nil, err)
+			return
+		}
+		defer body.Close()
+		c.DataFromReader(http.StatusOK, -1, "application/gzip", body, map[string]string{
+			"Content-Disposition": fmt.Sprintf("attachment; filename*=utf-8''%s", url.QueryEscape(fileName)),
+		})
+	}
+}
+
 func batchUpdateVtap(c *gin.Context) {
 	var err error
 
 	// 参数校验
-	vtapUpdateList := make(map[string][]model.VtapUpdate)
-	err = c.ShouldBindBodyWith(&vtapUpdateList, binding.JSON)
+	var vtapBatchUpdate model.VtapBatchUpdate
+	err = c.ShouldBindBodyWith(&vtapBatchUpdate, binding.JSON)
 	if err != nil {
 		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
 		return
 	}
 
 	// 接收参数
-	updateMap := make(map[string]([]map[string]interface{}))
+	updateMap := struct {
+		Common map[string]interface{}   `json:"COMMON"`
+		Data   []map[string]interface{} `json:"DATA"`
+	}{}
 	c.ShouldBindBodyWith(&updateMap, binding.JSON)
 
+	// 按tag选择采集器
+	if vtapBatchUpdate.TagSelector != nil {
+		data, err := service.BatchUpdateVtapByTags(*vtapBatchUpdate.TagSelector, updateMap.Common)
+		JsonResponse(c, data, err)
+		return
+	}
+
 	// 参数校验
-	if _, ok := updateMap["DATA"]; !ok {
+	if updateMap.Data == nil {
 		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "No DATA in request body")
+		return
 	}
 
-	data, err := service.BatchUpdateVtap(updateMap["DATA"])
+	data, err := service.BatchUpdateVtap(updateMap.Common, updateMap.Data)
 	JsonResponse(c, data, err)
 }
 
@@ -175,28 +409,38 @@ func updateVtapLicenseType(c *gin.Context) {
 	JsonResponse(c, data, err)
 }
 
-func batchUpdateVtapLicenseType(c *gin.Context) {
-	var err error
+func getVtapLicenseUsage(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		data, err := service.GetVtapLicenseUsage(cfg.MonitorCfg.VTapLicenseLimit)
+		JsonResponse(c, data, err)
+	})
+}
 
-	// 参数校验
-	vtapUpdateList := make(map[string][]model.VtapUpdate)
-	err = c.ShouldBindBodyWith(&vtapUpdateList, binding.JSON)
-	if err != nil {
-		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
-		return
-	}
+func batchUpdateVtapLicenseType(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		var err error
 
-	// 接收参数
-	updateMap := make(map[string]([]map[string]interface{}))
-	c.ShouldBindBodyWith(&updateMap, binding.JSON)
+		// 参数校验
+		vtapUpdateList := make(map[string][]model.VtapUpdate)
+		err = c.ShouldBindBodyWith(&vtapUpdateList, binding.JSON)
+		if err != nil {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+			return
+		}
 
-	// 参数校验
-	if _, ok := updateMap["DATA"]; !ok {
-		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "No DATA in request body")
-	}
+		// 接收参数
+		updateMap := make(map[string]([]map[string]interface{}))
+		c.ShouldBindBodyWith(&updateMap, binding.JSON)
 
-	data, err := service.BatchUpdateVtapLicenseType(updateMap["DATA"])
-	JsonResponse(c, data, err)
+		// 参数校验
+		if _, ok := updateMap["DATA"]; !ok {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "No DATA in request body")
+			return
+		}
+
+		data, err := service.BatchUpdateVtapLicenseType(updateMap["DATA"], cfg.MonitorCfg.VTapLicenseLimit)
+		JsonResponse(c, data, err)
+	})
 }
 
 func deleteVtap(c *gin.Context) {
@@ -211,16 +455,26 @@ func batchDeleteVtap(c *gin.Context) {
 	var err error
 
 	// 接收参数
-	deleteMap := make(map[string][](map[string]string))
+	deleteMap := struct {
+		Data        []map[string]string    `json:"DATA"`
+		TagSelector *model.VtapTagSelector `json:"TAG_SELECTOR"`
+	}{}
 	c.ShouldBindBodyWith(&deleteMap, binding.JSON)
 
+	// 按tag选择采集器
+	if deleteMap.TagSelector != nil {
+		data, err := service.BatchDeleteVtapByTags(*deleteMap.TagSelector)
+		JsonResponse(c, data, err)
+		return
+	}
+
 	// 参数校验
-	if _, ok := deleteMap["DATA"]; !ok {
+	if deleteMap.Data == nil {
 		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "No DATA in request body")
 		return
 	}
 
-	data, err := service.BatchDeleteVtap(deleteMap["DATA"])
+	data, err := service.BatchDeleteVtap(deleteMap.Data)
 	JsonResponse(c, data, err)
 }
 
@@ -231,6 +485,14 @@ func rebalanceVtap(cfg *config.ControllerConfig) gin.HandlerFunc {
 		if value, ok := c.GetQuery("check"); ok {
 			args["check"] = (strings.ToLower(value) == "true")
 		}
+		if value, ok := c.GetQuery("seed"); ok {
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid seed (%s)", value))
+				return
+			}
+			args["seed"] = seed
+		}
 		if value, ok := c.GetQuery("type"); ok {
 			args["type"] = value
 			if args["type"] != "controller" && args["type"] != "analyzer" {
@@ -244,11 +506,100 @@ func rebalanceVtap(cfg *config.ControllerConfig) gin.HandlerFunc {
 			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "must specify type")
 			return
 		}
+		// 记录均衡的发起者，未携带用户名时记录请求来源IP
+		if user := c.GetHeader("X-User-Name"); user != "" {
+			args["actor"] = user
+		} else {
+			args["actor"] = c.ClientIP()
+		}
 		data, err := service.VTapRebalance(args, cfg.MonitorCfg.IngesterLoadBalancingConfig)
 		JsonResponse(c, data, err)
 	})
 }
 
+func predictVTapAssignment(cfg *config.ControllerConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		args := make(map[string]interface{})
+		value, ok := c.GetQuery("type")
+		if !ok {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "must specify type")
+			return
+		}
+		if value != "controller" && value != "analyzer" {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("type (%s) is not supported", value))
+			return
+		}
+		args["type"] = value
+		for _, param := range []string{"launch_server", "region", "az"} {
+			if value, ok := c.GetQuery(param); ok {
+				args[param] = value
+			}
+		}
+		if value, ok := c.GetQuery("seed"); ok {
+			seed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid seed (%s)", value))
+				return
+			}
+			args["seed"] = seed
+		}
+		data, err := service.PredictVTapAssignment(args, cfg.MonitorCfg.IngesterLoadBalancingConfig)
+		JsonResponse(c, data, err)
+	})
+}
+
+func getRebalanceHistory(c *gin.Context) {
+	args := make(map[string]interface{})
+	if value, ok := c.GetQuery("type"); ok {
+		if value != "controller" && value != "analyzer" {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("type (%s) is not supported", value))
+			return
+		}
+		args["type"] = value
+	}
+	// start_time/end_time为unix时间戳(秒)
+	for _, key := range []string{"start_time", "end_time"} {
+		if value, ok := c.GetQuery(key); ok {
+			timestamp, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid %s (%s)", key, value))
+				return
+			}
+			args[key] = timestamp
+		}
+	}
+	if value, ok := c.GetQuery("limit"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid limit (%s)", value))
+			return
+		}
+		args["limit"] = limit
+	}
+	data, err := service.GetVTapRebalanceHistory(args)
+	JsonResponse(c, data, err)
+}
+
+func createVtapWebhook(c *gin.Context) {
+	var webhookCreate model.VTapWebhookCreate
+	if err := c.ShouldBindBodyWith(&webhookCreate, binding.JSON); err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return
+	}
+	data, err := service.CreateVTapWebhook(webhookCreate)
+	JsonResponse(c, data, err)
+}
+
+func getVtapWebhooks(c *gin.Context) {
+	data, err := service.GetVTapWebhooks()
+	JsonResponse(c, data, err)
+}
+
+func deleteVtapWebhook(c *gin.Context) {
+	data, err := service.DeleteVTapWebhook(c.Param("lcuuid"))
+	JsonResponse(c, data, err)
+}
+
 func batchUpdateVtapTapMode(c *gin.Context) {
 	var err error
 	var vtapUpdateTapMode model.VtapUpdateTapMode
@@ -267,6 +618,37 @@ func batchUpdateVtapTapMode(c *gin.Context) {
 	JsonResponse(c, data, err)
 }
 
+func ackVtapConfig(c *gin.Context) {
+	var err error
+	var vtapConfigAck model.VtapConfigAck
+
+	err = c.ShouldBindBodyWith(&vtapConfigAck, binding.JSON)
+	if err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return
+	}
+	data, err := service.AckVtapConfigRevision(c.Param("lcuuid"), *vtapConfigAck.ConfigRevision)
+	JsonResponse(c, data, err)
+}
+
+func batchUpdateVtapMaintenance(c *gin.Context) {
+	var err error
+	var vtapUpdateMaintenance model.VtapUpdateMaintenance
+
+	err = c.ShouldBindBodyWith(&vtapUpdateMaintenance, binding.JSON)
+	if err != nil {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, err.Error())
+		return
+	}
+
+	if len(vtapUpdateMaintenance.VTapLcuuids) == 0 {
+		BadRequestResponse(c, httpcommon.INVALID_PARAMETERS, "VTAP_LCUUIDS cannot be empty")
+		return
+	}
+	data, err := service.BatchUpdateVtapMaintenance(vtapUpdateMaintenance.VTapLcuuids, *vtapUpdateMaintenance.Maintenance)
+	JsonResponse(c, data, err)
+}
+
 func getVtapCSV(c *gin.Context) {
 	value, ok := c.GetPostForm("CSV_HEADERS")
 	if !ok {
@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/router/common"
+)
+
+// VtapIdentity 请求者身份，来自网关透传的用户信息
+type VtapIdentity struct {
+	UserID   string
+	UserType string
+	UserName string
+	ClientIP string
+}
+
+// VtapAction 请求的接口，Route为注册时的路由(如/v1/vtaps/:lcuuid/)
+type VtapAction struct {
+	Method string
+	Route  string
+}
+
+// VtapAuthorizer 判断请求者能否执行采集器接口的操作，返回error时拒绝请求
+type VtapAuthorizer interface {
+	Authorize(identity VtapIdentity, action VtapAction) error
+}
+
+type allowAllVtapAuthorizer struct{}
+
+func (allowAllVtapAuthorizer) Authorize(VtapIdentity, VtapAction) error {
+	return nil
+}
+
+func (v *Vtap) authorize(c *gin.Context) {
+	identity := VtapIdentity{
+		UserID:   c.GetHeader("X-User-Id"),
+		UserType: c.GetHeader("X-User-Type"),
+		UserName: c.GetHeader("X-User-Name"),
+		ClientIP: c.ClientIP(),
+	}
+	action := VtapAction{Method: c.Request.Method, Route: c.FullPath()}
+	if err := v.authorizer.Authorize(identity, action); err != nil {
+		log.Warningf("deny %s %s from user(id: %s, name: %s, ip: %s): %s",
+			action.Method, action.Route, identity.UserID, identity.UserName, identity.ClientIP, err.Error())
+		ForbiddenResponse(c, httpcommon.FORBIDDEN, err.Error())
+		c.Abort()
+		return
+	}
+	c.Next()
+}
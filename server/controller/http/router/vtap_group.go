@@ -41,6 +41,7 @@ func (v *VtapGroup) RegisterTo(e *gin.Engine) {
 	e.POST("/v1/vtap-groups/", createVtapGroup(v.cfg))
 	e.PATCH("/v1/vtap-groups/:lcuuid/", updateVtapGroup(v.cfg))
 	e.DELETE("/v1/vtap-groups/:lcuuid/", deleteVtapGroup)
+	e.GET("/v1/vtap-groups/:lcuuid/config/", getVtapGroupEffectiveConfig)
 }
 
 func getVtapGroup(c *gin.Context) {
@@ -50,6 +51,11 @@ func getVtapGroup(c *gin.Context) {
 	JsonResponse(c, data, err)
 }
 
+func getVtapGroupEffectiveConfig(c *gin.Context) {
+	data, err := service.GetVTapGroupEffectiveConfig(c.Param("lcuuid"))
+	JsonResponse(c, data, err)
+}
+
 func getVtapGroups(c *gin.Context) {
 	args := make(map[string]interface{})
 	if value, ok := c.GetQuery("name"); ok {
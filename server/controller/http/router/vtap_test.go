@@ -17,9 +17,18 @@
 package router
 
 import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/controller/config"
+	. "github.com/deepflowio/deepflow/server/controller/http/router/common"
 	"github.com/deepflowio/deepflow/server/controller/model"
 )
 
@@ -84,3 +93,93 @@ func Test_getVtapCSVData(t *testing.T) {
 		})
 	}
 }
+
+type denyDeleteVtapAuthorizer struct {
+	actions []VtapAction
+}
+
+func (a *denyDeleteVtapAuthorizer) Authorize(identity VtapIdentity, action VtapAction) error {
+	a.actions = append(a.actions, action)
+	if action.Method == http.MethodDelete && identity.UserType != "1" {
+		return errors.New("user can not delete vtaps")
+	}
+	return nil
+}
+
+func TestVtapAuthorizer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newEngine := func(v *Vtap) *gin.Engine {
+		e := gin.New()
+		g := e.Group("", v.authorize)
+		g.GET("/v1/vtaps/:lcuuid/", func(c *gin.Context) { c.Status(http.StatusOK) })
+		g.DELETE("/v1/vtaps/:lcuuid/", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return e
+	}
+	serve := func(e *gin.Engine, method string, userType string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/v1/vtaps/vtap-lcuuid/", nil)
+		req.Header.Set("X-User-Type", userType)
+		e.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 默认允许所有请求
+	e := newEngine(NewVtap(&config.ControllerConfig{}))
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodDelete, "2"))
+
+	authorizer := &denyDeleteVtapAuthorizer{}
+	e = newEngine(NewVtap(&config.ControllerConfig{}).SetAuthorizer(authorizer))
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodGet, "2"))
+	assert.Equal(t, http.StatusForbidden, serve(e, http.MethodDelete, "2"))
+	assert.Equal(t, http.StatusOK, serve(e, http.MethodDelete, "1"))
+	assert.Equal(t, VtapAction{Method: http.MethodDelete, Route: "/v1/vtaps/:lcuuid/"}, authorizer.actions[1])
+
+	// 注册的采集器路由经过鉴权，被拒绝时不会执行处理函数
+	e = gin.New()
+	NewVtap(&config.ControllerConfig{}).SetAuthorizer(authorizer).RegisterTo(e)
+	assert.Equal(t, http.StatusForbidden, serve(e, http.MethodDelete, "2"))
+}
+
+func TestVtapAPIVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	vtaps := []model.Vtap{{Name: "vtap", AckedConfigRevision: 1, Tags: map[string]string{"env": "prod"}}}
+	serve := func(header string) (int, map[string]interface{}) {
+		e := gin.New()
+		e.GET("/v1/vtaps/", func(c *gin.Context) {
+			version, ok := negotiateVtapAPIVersion(c)
+			if !ok {
+				return
+			}
+			vtapJsonResponse(c, version, vtaps, nil)
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/v1/vtaps/", nil)
+		if header != "" {
+			req.Header.Set(API_VERSION_HEADER, header)
+		}
+		e.ServeHTTP(w, req)
+		var body map[string]interface{}
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	// 默认返回v1，不包含TAGS及ACKED_CONFIG_REVISION
+	code, body := serve("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, API_VERSION_V1, body["API_VERSION"])
+	vtap := body["DATA"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "vtap", vtap["NAME"])
+	assert.NotContains(t, vtap, "TAGS")
+	assert.NotContains(t, vtap, "ACKED_CONFIG_REVISION")
+
+	code, body = serve("v2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, API_VERSION_V2, body["API_VERSION"])
+	vtap = body["DATA"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "vtap", vtap["NAME"])
+	assert.Equal(t, map[string]interface{}{"env": "prod"}, vtap["TAGS"])
+	assert.Equal(t, float64(1), vtap["ACKED_CONFIG_REVISION"])
+
+	code, _ = serve("v3")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/http/common/registrant"
 	"github.com/deepflowio/deepflow/server/controller/http/router"
 	"github.com/deepflowio/deepflow/server/controller/http/router/resource"
+	"github.com/deepflowio/deepflow/server/controller/http/service"
 	"github.com/deepflowio/deepflow/server/controller/manager"
 	"github.com/deepflowio/deepflow/server/controller/monitor"
 	trouter "github.com/deepflowio/deepflow/server/controller/trisolaris/server/http"
@@ -51,6 +52,7 @@ type Server struct {
 
 func NewServer(logFile string, cfg *config.ControllerConfig) *Server {
 	s := &Server{controllerConfig: cfg}
+	service.InitVTapDBRetry(cfg.HTTPCfg.VTapDBRetry)
 
 	ginLogFile, _ := os.OpenFile(logFile, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
 	gin.DefaultWriter = io.MultiWriter(ginLogFile, os.Stdout)
@@ -21,8 +21,9 @@ import (
 )
 
 type ServiceError struct {
-	Status  string
-	Message string
+	Status    string
+	Message   string
+	ErrorCode string `json:",omitempty"`
 }
 
 func (e *ServiceError) Error() string {
@@ -36,3 +37,11 @@ func NewError(status string, message string) error {
 		Message: message,
 	}
 }
+
+func NewErrorWithCode(status string, errorCode string, message string) error {
+	return &ServiceError{
+		Status:    status,
+		Message:   message,
+		ErrorCode: errorCode,
+	}
+}
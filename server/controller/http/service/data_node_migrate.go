@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+// MigrateDataNodeVtaps 将源控制器/数据节点上的全部采集器迁移到目标节点，
+// 目标节点剩余容量不足以容纳全部采集器时不做任何迁移，并返回放不下的采集器
+func MigrateDataNodeVtaps(migrate model.DataNodeMigrate) (resp model.DataNodeMigrateResult, err error) {
+	var column string
+	var target reassignHost
+	switch migrate.Type {
+	case common.HOST_TYPE_CONTROLLER:
+		column = "controller_ip"
+		var controller mysql.Controller
+		if err := mysql.Db.Where("ip = ?", migrate.TargetIP).First(&controller).Error; err != nil {
+			return resp, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("controller (%s) not found", migrate.TargetIP))
+		}
+		target = reassignHost{ip: controller.IP, state: controller.State, vtapMax: controller.VTapMax}
+	case common.HOST_TYPE_ANALYZER:
+		column = "analyzer_ip"
+		var analyzer mysql.Analyzer
+		if err := mysql.Db.Where("ip = ?", migrate.TargetIP).First(&analyzer).Error; err != nil {
+			return resp, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("analyzer (%s) not found", migrate.TargetIP))
+		}
+		target = reassignHost{ip: analyzer.IP, state: analyzer.State, vtapMax: analyzer.VTapMax}
+	default:
+		return resp, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("type (%s) not supported", migrate.Type))
+	}
+	if migrate.SourceIP == migrate.TargetIP {
+		return resp, NewError(httpcommon.INVALID_PARAMETERS, "source ip and target ip must be different")
+	}
+	if target.state != common.HOST_STATE_COMPLETE {
+		return resp, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("%s (%s) is not available", migrate.Type, migrate.TargetIP))
+	}
+
+	resp.Type = migrate.Type
+	resp.SourceIP = migrate.SourceIP
+	resp.TargetIP = migrate.TargetIP
+	resp.Migrated = []string{}
+	err = mysql.Db.Transaction(func(tx *gorm.DB) error {
+		var vtaps []mysql.VTap
+		if err := tx.Where(column+" = ?", migrate.SourceIP).Order("id").Find(&vtaps).Error; err != nil {
+			return NewError(httpcommon.SERVER_ERROR, err.Error())
+		}
+		if len(vtaps) == 0 {
+			return nil
+		}
+		var targetVTapNum int64
+		if err := tx.Model(&mysql.VTap{}).Where(column+" = ?", migrate.TargetIP).Count(&targetVTapNum).Error; err != nil {
+			return NewError(httpcommon.SERVER_ERROR, err.Error())
+		}
+		available := target.vtapMax - int(targetVTapNum)
+		if available < 0 {
+			available = 0
+		}
+		if len(vtaps) > available {
+			notFit := make([]string, 0, len(vtaps)-available)
+			for _, vtap := range vtaps[available:] {
+				notFit = append(notFit, vtap.Name)
+			}
+			return NewError(
+				httpcommon.RESOURCE_NUM_EXCEEDED,
+				fmt.Sprintf(
+					"%s (%s) available vtap num (%d) less than vtap num (%d) to migrate, vtaps not fit: %s",
+					migrate.Type, migrate.TargetIP, available, len(vtaps), strings.Join(notFit, ", "),
+				),
+			)
+		}
+
+		lcuuids := make([]string, 0, len(vtaps))
+		for _, vtap := range vtaps {
+			lcuuids = append(lcuuids, vtap.Lcuuid)
+		}
+		// 递增row_version及config_revision，采集器同步时感知到配置变化后重连新的控制器/数据节点
+		if err := tx.Model(&mysql.VTap{}).Where("lcuuid IN ?", lcuuids).Updates(map[string]interface{}{
+			column:            migrate.TargetIP,
+			"row_version":     gorm.Expr("row_version + 1"),
+			"config_revision": gorm.Expr("config_revision + 1"),
+		}).Error; err != nil {
+			return NewError(httpcommon.SERVER_ERROR, err.Error())
+		}
+		for _, vtap := range vtaps {
+			resp.Migrated = append(resp.Migrated, vtap.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return model.DataNodeMigrateResult{Migrated: []string{}}, err
+	}
+
+	log.Infof("migrate %d vtaps %s from (%s) to (%s)", len(resp.Migrated), column, migrate.SourceIP, migrate.TargetIP)
+	if len(resp.Migrated) > 0 {
+		refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
+	}
+	return resp, nil
+}
@@ -158,3 +158,21 @@ func GetGenesisAgentStorage(vtapIDString string) (model.GenesisStorage, error) {
 	err = mysql.Db.Where("vtap_id = ?", vtapID).First(&gStorage).Error
 	return gStorage, err
 }
+
+func CheckRecorderCacheConsistency(domainLcuuid, subDomainLcuuid, resourceType string, m *manager.Manager) (resp *cache.ConsistencyReport, err error) {
+	if !cache.IsConsistencyCheckSupported(resourceType) {
+		return nil, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("resource type %s does not support consistency check", resourceType))
+	}
+	recorder, err := m.GetRecorder(domainLcuuid)
+	if err != nil {
+		return nil, NewError(httpcommon.RESOURCE_NOT_FOUND, err.Error())
+	}
+	resp, err = recorder.CheckCacheConsistency(domainLcuuid, subDomainLcuuid, resourceType)
+	if err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if resp == nil {
+		return nil, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("recorder cache of sub_domain %s not found", subDomainLcuuid))
+	}
+	return resp, nil
+}
@@ -19,6 +19,8 @@ package service
 import (
 	"fmt"
 	"math"
+	"math/rand"
+	"net"
 	"sort"
 	"strconv"
 	"strings"
@@ -26,6 +28,7 @@ import (
 
 	mapset "github.com/deckarep/golang-set"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 
 	"github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/controller/db/mysql"
@@ -42,33 +45,119 @@ import (
 
 const (
 	VTAP_LICENSE_CHECK_EXCEPTION = "采集器(%s)不支持修改为指定授权类型"
+	VTAP_LICENSE_EXHAUSTED       = "采集器(%s)修改授权类型失败，授权类型(%d)已达到上限(%d)"
 )
 
+// 写入后按lcuuid重新读取采集器，数据库不可用(含熔断)或记录不存在时返回错误
+func getVtapByLcuuid(lcuuid string) (model.Vtap, error) {
+	response, err := GetVtaps(map[string]interface{}{"lcuuid": lcuuid})
+	if err != nil {
+		return model.Vtap{}, err
+	}
+	if len(response) == 0 {
+		return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+	}
+	return response[0], nil
+}
+
+// 按采集器类型关联launch_server_id对应的资源，返回launch server位于指定区域/可用区的采集器ID子查询
+func vtapIDsByLaunchServer(column, value string) *gorm.DB {
+	return mysql.Db.Model(&mysql.VTap{}).Select("vtap.id").
+		Joins("LEFT JOIN host_device ON host_device.id = vtap.launch_server_id AND host_device.deleted_at IS NULL AND vtap.type IN (?)",
+			[]int{common.VTAP_TYPE_KVM, common.VTAP_TYPE_ESXI, common.VTAP_TYPE_HYPER_V}).
+		Joins("LEFT JOIN vm ON vm.id = vtap.launch_server_id AND vm.deleted_at IS NULL AND vtap.type IN (?)",
+			[]int{common.VTAP_TYPE_WORKLOAD_V, common.VTAP_TYPE_WORKLOAD_P}).
+		Joins("LEFT JOIN pod_node ON pod_node.id = vtap.launch_server_id AND pod_node.deleted_at IS NULL AND vtap.type IN (?)",
+			[]int{common.VTAP_TYPE_POD_HOST, common.VTAP_TYPE_POD_VM}).
+		Joins("LEFT JOIN pod ON pod.id = vtap.launch_server_id AND pod.deleted_at IS NULL AND vtap.type = ?",
+			common.VTAP_TYPE_K8S_SIDECAR).
+		Where(fmt.Sprintf("COALESCE(host_device.%[1]s, vm.%[1]s, pod_node.%[1]s, pod.%[1]s) = ?", column), value)
+}
+
 func GetVtaps(filter map[string]interface{}) (resp []model.Vtap, err error) {
 	var response []model.Vtap
 	var vtaps []mysql.VTap
 	var vtapGroups []mysql.VTapGroup
 	var regions []mysql.Region
 	var azs []mysql.AZ
+	var vtapIDToTags map[int]map[string]string
 
-	Db := mysql.Db
-	for _, param := range []string{
-		"lcuuid", "name", "type", "vtap_group_lcuuid", "controller_ip", "analyzer_ip",
-	} {
-		where := fmt.Sprintf("%s = ?", param)
-		if _, ok := filter[param]; ok {
-			Db = Db.Where(where, filter[param])
+	ipNets := make(map[string]*net.IPNet)
+	for _, param := range []string{"controller_cidr", "analyzer_cidr"} {
+		cidr, ok := filter[param].(string)
+		if !ok {
+			continue
 		}
-	}
-	if _, ok := filter["names"]; ok {
-		if len(filter["names"].([]string)) > 0 {
-			Db = Db.Where("name IN (?)", filter["names"].([]string))
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid %s (%s)", param, cidr))
+		}
+		ipNets[param] = ipNet
+	}
+
+	err = vtapDBBreaker.execute(func() error {
+		vtaps, vtapGroups, regions, azs = nil, nil, nil, nil
+		Db := mysql.Db
+		for _, param := range []string{
+			"lcuuid", "name", "type", "vtap_group_lcuuid", "controller_ip", "analyzer_ip",
+		} {
+			where := fmt.Sprintf("%s = ?", param)
+			if _, ok := filter[param]; ok {
+				Db = Db.Where(where, filter[param])
+			}
+		}
+		if _, ok := filter["names"]; ok {
+			if len(filter["names"].([]string)) > 0 {
+				Db = Db.Where("name IN (?)", filter["names"].([]string))
+			}
+		}
+		if _, ok := filter["lcuuids"]; ok {
+			Db = Db.Where("lcuuid IN (?)", filter["lcuuids"].([]string))
+		}
+		if tags, ok := filter["tags"].(map[string]string); ok && len(tags) > 0 {
+			Db = Db.Where("id IN (?)", vtapIDsWithTags(tags))
 		}
+		if maintenance, ok := filter["maintenance"].(bool); ok {
+			Db = Db.Where("maintenance = ?", maintenance)
+		}
+		if state, ok := filter["state"].(int); ok {
+			Db = Db.Where("state = ?", state)
+		}
+		// 按采集器launch server(宿主机/云服务器/容器节点/POD)的区域、可用区过滤
+		for _, param := range []string{"region", "az"} {
+			if value, ok := filter[param].(string); ok {
+				Db = Db.Where("id IN (?)", vtapIDsByLaunchServer(param, value))
+			}
+		}
+		if err := Db.Find(&vtaps).Error; err != nil {
+			return err
+		}
+		// IP字段为字符串，CIDR匹配在查询后过滤
+		if len(ipNets) > 0 {
+			vtaps = filterVtapsByCIDR(vtaps, ipNets["controller_cidr"], ipNets["analyzer_cidr"])
+		}
+		vtapIDs := make([]int, 0, len(vtaps))
+		for _, vtap := range vtaps {
+			vtapIDs = append(vtapIDs, vtap.ID)
+		}
+		var err error
+		if vtapIDToTags, err = getVtapIDToTags(vtapIDs); err != nil {
+			return err
+		}
+		if err := mysql.Db.Find(&vtapGroups).Error; err != nil {
+			return err
+		}
+		if err := mysql.Db.Find(&regions).Error; err != nil {
+			return err
+		}
+		return mysql.Db.Find(&azs).Error
+	})
+	if err != nil {
+		if _, ok := err.(*ServiceError); ok {
+			return nil, err
+		}
+		return nil, NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("fail to query vtaps, error: %s", err))
 	}
-	Db.Find(&vtaps)
-	mysql.Db.Find(&vtapGroups)
-	mysql.Db.Find(&regions)
-	mysql.Db.Find(&azs)
 
 	lcuuidToRegion := make(map[string]string)
 	for _, region := range regions {
@@ -89,33 +178,42 @@ func GetVtaps(filter map[string]interface{}) (resp []model.Vtap, err error) {
 
 	for _, vtap := range vtaps {
 		vtapResp := model.Vtap{
-			ID:               vtap.ID,
-			Name:             vtap.Name,
-			Lcuuid:           vtap.Lcuuid,
-			Enable:           vtap.Enable,
-			Type:             vtap.Type,
-			CtrlIP:           vtap.CtrlIP,
-			CtrlMac:          vtap.CtrlMac,
-			ControllerIP:     vtap.ControllerIP,
-			AnalyzerIP:       vtap.AnalyzerIP,
-			CurControllerIP:  vtap.CurControllerIP,
-			CurAnalyzerIP:    vtap.CurAnalyzerIP,
-			BootTime:         vtap.BootTime,
-			CPUNum:           vtap.CPUNum,
-			MemorySize:       vtap.MemorySize,
-			Arch:             vtap.Arch,
-			ArchType:         common.GetArchType(vtap.Arch),
-			Os:               vtap.Os,
-			OsType:           common.GetOsType(vtap.Os),
-			KernelVersion:    vtap.KernelVersion,
-			ProcessName:      vtap.ProcessName,
-			LicenseType:      vtap.LicenseType,
-			ExpectedRevision: vtap.ExpectedRevision,
-			UpgradePackage:   vtap.UpgradePackage,
-			TapMode:          vtap.TapMode,
+			ID:                  vtap.ID,
+			Name:                vtap.Name,
+			Lcuuid:              vtap.Lcuuid,
+			Enable:              vtap.Enable,
+			Type:                vtap.Type,
+			CtrlIP:              vtap.CtrlIP,
+			CtrlMac:             vtap.CtrlMac,
+			ControllerIP:        vtap.ControllerIP,
+			AnalyzerIP:          vtap.AnalyzerIP,
+			CurControllerIP:     vtap.CurControllerIP,
+			CurAnalyzerIP:       vtap.CurAnalyzerIP,
+			BootTime:            vtap.BootTime,
+			CPUNum:              vtap.CPUNum,
+			MemorySize:          vtap.MemorySize,
+			Arch:                vtap.Arch,
+			ArchType:            common.GetArchType(vtap.Arch),
+			Os:                  vtap.Os,
+			OsType:              common.GetOsType(vtap.Os),
+			KernelVersion:       vtap.KernelVersion,
+			ProcessName:         vtap.ProcessName,
+			LicenseType:         vtap.LicenseType,
+			ExpectedRevision:    vtap.ExpectedRevision,
+			UpgradePackage:      vtap.UpgradePackage,
+			TapMode:             vtap.TapMode,
+			RowVersion:          vtap.RowVersion,
+			Maintenance:         vtap.Maintenance,
+			ConfigRevision:      vtap.ConfigRevision,
+			AckedConfigRevision: vtap.AckedConfigRevision,
+			DataQuota:           vtap.DataQuota,
+			Tags:                vtapIDToTags[vtap.ID],
+		}
+		if vtapResp.Tags == nil {
+			vtapResp.Tags = map[string]string{}
 		}
 		// state
-		if vtap.Enable == common.VTAP_ENABLE_FALSE {
+		if vtap.Enable == common.VTAP_ENABLE_FALSE && vtap.State != common.VTAP_STATE_REJECTED {
 			vtapResp.State = common.VTAP_STATE_DISABLE
 		} else {
 			vtapResp.State = vtap.State
@@ -188,12 +286,101 @@ func GetVtaps(filter map[string]interface{}) (resp []model.Vtap, err error) {
 
 		response = append(response, vtapResp)
 	}
+	if withDataUsage, _ := filter["data_usage"].(bool); withDataUsage {
+		fillVtapDataUsage(response)
+	}
 	return response, nil
 }
 
-func CreateVtap(vtapCreate model.VtapCreate) (model.Vtap, error) {
+func filterVtapsByCIDR(vtaps []mysql.VTap, controllerNet, analyzerNet *net.IPNet) []mysql.VTap {
+	contains := func(ipNet *net.IPNet, ip string) bool {
+		if ipNet == nil {
+			return true
+		}
+		parsedIP := net.ParseIP(ip)
+		return parsedIP != nil && ipNet.Contains(parsedIP)
+	}
+	result := make([]mysql.VTap, 0, len(vtaps))
+	for _, vtap := range vtaps {
+		if contains(controllerNet, vtap.ControllerIP) && contains(analyzerNet, vtap.AnalyzerIP) {
+			result = append(result, vtap)
+		}
+	}
+	return result
+}
+
+// 按请求中lcuuid的顺序返回采集器，未找到的lcuuid放入NotFound
+func QueryVtapsByLcuuids(lcuuids []string) (resp model.VtapQueryResult, err error) {
+	vtaps, err := GetVtaps(map[string]interface{}{"lcuuids": lcuuids})
+	if err != nil {
+		return resp, err
+	}
+	lcuuidToVtap := make(map[string]model.Vtap, len(vtaps))
+	for _, vtap := range vtaps {
+		lcuuidToVtap[vtap.Lcuuid] = vtap
+	}
+
+	resp.Vtaps = []model.Vtap{}
+	resp.NotFound = []string{}
+	seen := make(map[string]bool, len(lcuuids))
+	for _, lcuuid := range lcuuids {
+		if seen[lcuuid] {
+			continue
+		}
+		seen[lcuuid] = true
+		if vtap, ok := lcuuidToVtap[lcuuid]; ok {
+			resp.Vtaps = append(resp.Vtaps, vtap)
+		} else {
+			resp.NotFound = append(resp.NotFound, lcuuid)
+		}
+	}
+	return resp, nil
+}
+
+// 获取数据节点(控制器/数据节点)上的采集器及容量信息
+func GetDataNodeVtaps(ip string) (resp model.DataNodeVtaps, err error) {
+	var controller mysql.Controller
+	var analyzer mysql.Analyzer
+	isController := mysql.Db.Where("ip = ?", ip).First(&controller).Error == nil
+	isAnalyzer := mysql.Db.Where("ip = ?", ip).First(&analyzer).Error == nil
+	if !isController && !isAnalyzer {
+		return resp, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("data node (%s) not found", ip))
+	}
+
+	var vtaps []mysql.VTap
+	mysql.Db.Where("controller_ip = ? OR analyzer_ip = ?", ip, ip).Find(&vtaps)
+	lcuuids := make([]string, 0, len(vtaps))
+	for _, vtap := range vtaps {
+		lcuuids = append(lcuuids, vtap.Lcuuid)
+	}
+	resp.Vtaps = []model.Vtap{}
+	if len(lcuuids) > 0 {
+		if resp.Vtaps, err = GetVtaps(map[string]interface{}{"lcuuids": lcuuids}); err != nil {
+			return resp, err
+		}
+	}
+
+	resp.IP = ip
+	resp.VtapCount = len(resp.Vtaps)
+	if isController {
+		resp.Controller = &model.DataNodeCapacity{VtapMax: controller.VTapMax}
+	}
+	if isAnalyzer {
+		resp.Analyzer = &model.DataNodeCapacity{VtapMax: analyzer.VTapMax}
+	}
+	for _, vtap := range resp.Vtaps {
+		if resp.Controller != nil && vtap.ControllerIP == ip {
+			resp.Controller.VtapCount++
+		}
+		if resp.Analyzer != nil && vtap.AnalyzerIP == ip {
+			resp.Analyzer.VtapCount++
+		}
+	}
+	return resp, nil
+}
+
+func CreateVtap(vtapCreate model.VtapCreate, monitorCfg config.MonitorConfig) (model.Vtap, error) {
 	var vtap mysql.VTap
-	var err error
 
 	if ret := mysql.Db.Where("ctrl_ip = ?", vtapCreate.CtrlIP).First(&vtap); ret.Error == nil {
 		return model.Vtap{}, NewError(
@@ -209,6 +396,10 @@ func CreateVtap(vtapCreate model.VtapCreate) (model.Vtap, error) {
 		)
 	}
 
+	if err := checkVtapGroupLcuuid(vtapCreate.VtapGroupLcuuid); err != nil {
+		return model.Vtap{}, err
+	}
+
 	// vtap name not support space && :
 	vtapName := vtapCreate.Name
 	strings.Replace(vtapName, ":", "-", -1)
@@ -232,23 +423,149 @@ func CreateVtap(vtapCreate model.VtapCreate) (model.Vtap, error) {
 	case common.VTAP_TYPE_TUNNEL_DECAPSULATION:
 		vtap.TapMode = common.TAPMODE_DECAP
 	}
+	vtap.LicenseType = vtapop.GetVTapDefaultLicenseType(mysql.Db, &vtap, monitorCfg)
 	mysql.Db.Create(&vtap)
 
-	response, _ := GetVtaps(map[string]interface{}{"lcuuid": lcuuid})
-	return response[0], err
+	return getVtapByLcuuid(lcuuid)
+}
+
+func checkVtapGroupLcuuid(lcuuid string) error {
+	var count int64
+	if err := mysql.Db.Model(&mysql.VTapGroup{}).Where("lcuuid = ?", lcuuid).Count(&count).Error; err != nil {
+		return NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("fail to query vtap_group (%s), error: %s", lcuuid, err))
+	}
+	if count == 0 {
+		return NewErrorWithCode(
+			httpcommon.INVALID_POST_DATA, httpcommon.VTAP_GROUP_INVALID,
+			fmt.Sprintf("vtap_group (%s) not found", lcuuid),
+		)
+	}
+	return nil
+}
+
+// 校验整数枚举字段，取值需在[min, max)内
+func parseVtapEnumField(vtapUpdate map[string]interface{}, key string, min, max int) (int, bool, error) {
+	value, ok := vtapUpdate[key]
+	if !ok {
+		return 0, false, nil
+	}
+	number, ok := value.(float64)
+	if !ok || number != float64(int(number)) || int(number) < min || int(number) >= max {
+		return 0, true, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid %s (%v)", key, value))
+	}
+	return int(number), true, nil
+}
+
+// 校验采集器的全部更新字段并生成数据库更新内容，多个字段非法时合并返回所有错误
+func validateVtapUpdate(vtap *mysql.VTap, vtapUpdate map[string]interface{}) (map[string]interface{}, *vtapTagsUpdate, error) {
+	dbUpdateMap := make(map[string]interface{})
+	var errs []error
+
+	tagsUpdate, err := parseVtapTagsUpdate(vtapUpdate)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if value, ok := vtapUpdate["VTAP_GROUP_LCUUID"]; ok {
+		vtapGroupLcuuid, _ := value.(string)
+		if err := checkVtapGroupLcuuid(vtapGroupLcuuid); err != nil {
+			if err.(*ServiceError).Status == httpcommon.SERVER_ERROR {
+				return nil, nil, err
+			}
+			errs = append(errs, err)
+		} else {
+			dbUpdateMap["vtap_group_lcuuid"] = vtapGroupLcuuid
+			// 切换采集器组后下发的配置随之变化
+			if vtapGroupLcuuid != vtap.VtapGroupLcuuid {
+				dbUpdateMap["config_revision"] = gorm.Expr("config_revision + 1")
+			}
+		}
+	}
+
+	if value, ok := vtapUpdate["DATA_QUOTA"]; ok {
+		if dataQuota, err := parseVtapDataQuota(value); err != nil {
+			errs = append(errs, err)
+		} else {
+			dbUpdateMap["data_quota"] = dataQuota
+			// 配额会限制下发给采集器的发送带宽
+			if dataQuota != vtap.DataQuota {
+				dbUpdateMap["config_revision"] = gorm.Expr("config_revision + 1")
+			}
+		}
+	}
+
+	for _, field := range []struct {
+		key      string
+		min, max int
+	}{
+		{"ENABLE", 0, 2},
+		{"LICENSE_TYPE", common.VTAP_LICENSE_TYPE_NONE, common.VTAP_LICENSE_TYPE_MAX},
+	} {
+		if value, ok, err := parseVtapEnumField(vtapUpdate, field.key, field.min, field.max); err != nil {
+			errs = append(errs, err)
+		} else if ok {
+			dbUpdateMap[strings.ToLower(field.key)] = value
+		}
+	}
+
+	if value, ok, err := parseVtapEnumField(vtapUpdate, "STATE", common.VTAP_STATE_NOT_CONNECTED, common.VTAP_STATE_REJECTED+1); err != nil {
+		errs = append(errs, err)
+	} else if ok {
+		// 待审批/已拒绝状态只能通过审批接口变更
+		if value == common.VTAP_STATE_PENDING || value == common.VTAP_STATE_REJECTED {
+			errs = append(errs, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf(
+				"invalid STATE (%d), use /v1/vtaps/:lcuuid/approve/ or /v1/vtaps/:lcuuid/reject/ instead", value)))
+		} else {
+			dbUpdateMap["state"] = value
+		}
+	}
+
+	if value, ok := vtapUpdate["LICENSE_FUNCTIONS"]; ok {
+		licenseFunctions, ok := value.([]interface{})
+		licenseFunctionStrs := []string{}
+		for _, licenseFunction := range licenseFunctions {
+			number, isNumber := licenseFunction.(float64)
+			if !isNumber || number != float64(int(number)) ||
+				int(number) <= common.VTAP_LICENSE_FUNCTION_NONE || int(number) >= common.VTAP_LICENSE_FUNCTION_MAX {
+				ok = false
+				break
+			}
+			licenseFunctionStrs = append(licenseFunctionStrs, strconv.Itoa(int(number)))
+		}
+		if !ok {
+			errs = append(errs, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid LICENSE_FUNCTIONS (%v)", value)))
+		} else {
+			dbUpdateMap["license_functions"] = strings.Join(licenseFunctionStrs, ",")
+		}
+	}
+
+	switch len(errs) {
+	case 0:
+		return dbUpdateMap, tagsUpdate, nil
+	case 1:
+		return nil, nil, errs[0]
+	}
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		if serviceErr, ok := err.(*ServiceError); ok {
+			messages = append(messages, serviceErr.Message)
+		} else {
+			messages = append(messages, err.Error())
+		}
+	}
+	return nil, nil, NewError(httpcommon.INVALID_PARAMETERS, strings.Join(messages, "; "))
 }
 
 func UpdateVtap(lcuuid, name string, vtapUpdate map[string]interface{}) (resp model.Vtap, err error) {
 	var vtap mysql.VTap
-	var dbUpdateMap = make(map[string]interface{})
 
 	if lcuuid != "" {
 		if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
-			return model.Vtap{}, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+			return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
 		}
 	} else if name != "" {
 		if ret := mysql.Db.Where("name = ?", name).First(&vtap); ret.Error != nil {
-			return model.Vtap{}, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", name))
+			return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", name))
 		}
 	} else {
 		return model.Vtap{}, NewError(httpcommon.INVALID_PARAMETERS, "must specify name or lcuuid")
@@ -256,43 +573,80 @@ func UpdateVtap(lcuuid, name string, vtapUpdate map[string]interface{}) (resp mo
 
 	log.Infof("update vtap (%s) config %v", vtap.Name, vtapUpdate)
 
-	// enable/state/vtap_group_lcuuid
-	for _, key := range []string{"ENABLE", "STATE", "VTAP_GROUP_LCUUID", "LICENSE_TYPE"} {
-		if _, ok := vtapUpdate[key]; ok {
-			dbUpdateMap[strings.ToLower(key)] = vtapUpdate[key]
-		}
+	// 校验全部字段后再更新，任一字段非法时不更新任何字段
+	dbUpdateMap, tagsUpdate, err := validateVtapUpdate(&vtap, vtapUpdate)
+	if err != nil {
+		return model.Vtap{}, err
 	}
 
-	if licenseFunctions, ok := vtapUpdate["LICENSE_FUNCTIONS"].([]interface{}); ok {
-		licenseFunctionStrs := []string{}
-		for _, licenseFunction := range licenseFunctions {
-			licenseFunctionStrs = append(licenseFunctionStrs, strconv.Itoa(int(licenseFunction.(float64))))
+	// 每次更新递增row_version，若指定了ROW_VERSION则仅在版本一致时更新
+	dbUpdateMap["row_version"] = gorm.Expr("row_version + 1")
+	err = mysql.Db.Transaction(func(tx *gorm.DB) error {
+		db := tx.Model(&vtap)
+		if rowVersion, ok := vtapUpdate["ROW_VERSION"].(float64); ok {
+			db = db.Where("row_version = ?", int(rowVersion))
+		}
+		if ret := db.Updates(dbUpdateMap); ret.Error != nil {
+			return NewError(httpcommon.SERVER_ERROR, ret.Error.Error())
+		} else if ret.RowsAffected == 0 {
+			return NewError(
+				httpcommon.RESOURCE_VERSION_CONFLICT,
+				fmt.Sprintf("vtap (%s) row version (%v) is stale", vtap.Name, vtapUpdate["ROW_VERSION"]),
+			)
 		}
-		dbUpdateMap["license_functions"] = strings.Join(licenseFunctionStrs, ",")
-	}
 
-	mysql.Db.Model(&vtap).Updates(dbUpdateMap)
+		if tagsUpdate != nil {
+			if err := updateVtapTags(tx, vtap.ID, tagsUpdate); err != nil {
+				return NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("update vtap (%s) tags failed: %s", vtap.Name, err))
+			}
+		}
 
-	if value, ok := vtapUpdate["ENABLE"]; ok && value == float64(0) {
-		key := vtap.CtrlIP + "-" + vtap.CtrlMac
-		if err := mysql.Db.Delete(&mysql.KubernetesCluster{}, "value = ?", key).Error; err != nil {
-			log.Error(err)
+		if value, ok := vtapUpdate["ENABLE"]; ok && value == float64(0) {
+			key := vtap.CtrlIP + "-" + vtap.CtrlMac
+			if err := tx.Delete(&mysql.KubernetesCluster{}, "value = ?", key).Error; err != nil {
+				return NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("delete vtap (%s) kubernetes cluster failed: %s", vtap.Name, err))
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return model.Vtap{}, err
 	}
 
-	response, _ := GetVtaps(map[string]interface{}{"lcuuid": vtap.Lcuuid})
 	refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
-	return response[0], nil
+	return getVtapByLcuuid(vtap.Lcuuid)
+}
+
+// 逐个采集器标识的字段，不能通过公共部分批量设置
+var vtapUpdateEntryOnlyKeys = []string{"LCUUID", "ROW_VERSION"}
+
+// 将公共部分合并到单个采集器的更新中，同名字段以单个采集器的为准(TAGS等字段整体覆盖，不做深度合并)
+func mergeVtapUpdate(common, vtapUpdate map[string]interface{}) map[string]interface{} {
+	if len(common) == 0 {
+		return vtapUpdate
+	}
+	merged := make(map[string]interface{}, len(common)+len(vtapUpdate))
+	for key, value := range common {
+		merged[key] = value
+	}
+	for _, key := range vtapUpdateEntryOnlyKeys {
+		delete(merged, key)
+	}
+	for key, value := range vtapUpdate {
+		merged[key] = value
+	}
+	return merged
 }
 
-func BatchUpdateVtap(updateMap []map[string]interface{}) (resp map[string][]string, err error) {
+// BatchUpdateVtap 批量更新采集器，common中的字段应用于updateMap中的每一项，同名字段以updateMap中的为准
+func BatchUpdateVtap(common map[string]interface{}, updateMap []map[string]interface{}) (resp map[string][]string, err error) {
 	var description string
 	var succeedLcuuids []string
 	var failedLcuuids []string
 
 	for _, vtapUpdate := range updateMap {
 		if lcuuid, ok := vtapUpdate["LCUUID"].(string); ok {
-			_, _err := UpdateVtap(lcuuid, "", vtapUpdate)
+			_, _err := UpdateVtap(lcuuid, "", mergeVtapUpdate(common, vtapUpdate))
 			if _err != nil {
 				description += _err.Error()
 				failedLcuuids = append(failedLcuuids, lcuuid)
@@ -334,7 +688,7 @@ func UpdateVtapLicenseType(lcuuid string, vtapUpdate map[string]interface{}) (re
 	var dbUpdateMap = make(map[string]interface{})
 
 	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
-		return model.Vtap{}, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+		return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
 	}
 
 	log.Infof("update vtap (%s) license %v", vtap.Name, vtapUpdate)
@@ -361,14 +715,89 @@ func UpdateVtapLicenseType(lcuuid string, vtapUpdate map[string]interface{}) (re
 	// 更新vtap DB
 	mysql.Db.Model(&vtap).Updates(dbUpdateMap)
 
-	response, _ := GetVtaps(map[string]interface{}{"lcuuid": vtap.Lcuuid})
-	return response[0], nil
+	return getVtapByLcuuid(vtap.Lcuuid)
+}
+
+// 获取各授权类型的限制数量，0表示不限制
+func getVTapLicenseLimits(licenseLimit config.VTapLicenseLimit) map[int]int {
+	return map[int]int{
+		common.VTAP_LICENSE_TYPE_A: licenseLimit.TypeA,
+		common.VTAP_LICENSE_TYPE_B: licenseLimit.TypeB,
+		common.VTAP_LICENSE_TYPE_C: licenseLimit.TypeC,
+	}
 }
 
-func BatchUpdateVtapLicenseType(updateMap []map[string]interface{}) (resp map[string][]string, err error) {
+// 统计各授权类型已分配的采集器数量
+func getVTapLicenseTypeCounts() (map[int]int, error) {
+	var rows []struct {
+		LicenseType int
+		Count       int
+	}
+	err := mysql.Db.Model(&mysql.VTap{}).Select("license_type, COUNT(*) AS count").
+		Where("license_type IS NOT NULL").Group("license_type").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int, len(rows))
+	for _, row := range rows {
+		counts[row.LicenseType] = row.Count
+	}
+	return counts, nil
+}
+
+// GetVtapLicenseUsage 按授权类型统计已使用及剩余的采集器数量
+func GetVtapLicenseUsage(licenseLimit config.VTapLicenseLimit) (*model.VtapLicenseUsage, error) {
+	usedCounts, err := getVTapLicenseTypeCounts()
+	if err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	var total int64
+	if err := mysql.Db.Model(&mysql.VTap{}).Count(&total).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	// 未分配授权(license_type为空)的采集器计入NONE
+	assignedCount := 0
+	for licenseType, count := range usedCounts {
+		if licenseType != common.VTAP_LICENSE_TYPE_NONE {
+			assignedCount += count
+		}
+	}
+	usedCounts[common.VTAP_LICENSE_TYPE_NONE] = int(total) - assignedCount
+	limits := getVTapLicenseLimits(licenseLimit)
+
+	response := &model.VtapLicenseUsage{Total: int(total), Details: []*model.VtapLicenseTypeUsage{}}
+	for licenseType := common.VTAP_LICENSE_TYPE_NONE; licenseType < common.VTAP_LICENSE_TYPE_MAX; licenseType++ {
+		usage := &model.VtapLicenseTypeUsage{
+			LicenseType: licenseType,
+			Used:        usedCounts[licenseType],
+			Limit:       limits[licenseType],
+			Available:   -1,
+		}
+		if usage.Limit > 0 {
+			usage.Available = usage.Limit - usage.Used
+			if usage.Available < 0 {
+				usage.Available = 0
+			}
+		}
+		response.Details = append(response.Details, usage)
+	}
+	return response, nil
+}
+
+func BatchUpdateVtapLicenseType(updateMap []map[string]interface{}, licenseLimit config.VTapLicenseLimit) (resp *model.VtapLicenseTypeBatchUpdateResult, err error) {
 	var description string
-	var succeedLcuuids []string
-	var failedLcuuids []string
+	response := &model.VtapLicenseTypeBatchUpdateResult{
+		SucceedLcuuids: []string{},
+		FailedLcuuids:  []string{},
+		Errors:         map[string]string{},
+		Remaining:      map[int]int{},
+	}
+
+	usedCounts, err := getVTapLicenseTypeCounts()
+	if err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	limits := getVTapLicenseLimits(licenseLimit)
 
 	for _, vtapUpdate := range updateMap {
 		if lcuuid, ok := vtapUpdate["LCUUID"].(string); ok {
@@ -376,12 +805,24 @@ func BatchUpdateVtapLicenseType(updateMap []map[string]interface{}) (resp map[st
 			var vtap mysql.VTap
 			var dbUpdateMap = make(map[string]interface{})
 
-			if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
-				_err = NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+			licenseTypeValue, ok := vtapUpdate["LICENSE_TYPE"].(float64)
+			if !ok {
+				_err = NewError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("vtap (%s) LICENSE_TYPE is required", lcuuid))
+			} else if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
+				_err = NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
 			} else {
 				// 检查是否可以修改
-				licenseType := int(vtapUpdate["LICENSE_TYPE"].(float64))
+				licenseType := int(licenseTypeValue)
 				_err = checkLicenseType(vtap, licenseType)
+				// 修改授权类型前检查目标类型剩余数量
+				if _err == nil && licenseType != vtap.LicenseType {
+					if limit := limits[licenseType]; limit > 0 && usedCounts[licenseType] >= limit {
+						_err = NewErrorWithCode(
+							httpcommon.INVALID_POST_DATA, httpcommon.LICENSE_EXHAUSTED,
+							fmt.Sprintf(VTAP_LICENSE_EXHAUSTED, vtap.Name, licenseType, limit),
+						)
+					}
+				}
 				if _err == nil {
 					// 更新vtap DB
 					dbUpdateMap["license_type"] = vtapUpdate["LICENSE_TYPE"]
@@ -396,21 +837,31 @@ func BatchUpdateVtapLicenseType(updateMap []map[string]interface{}) (resp map[st
 						}
 						dbUpdateMap["license_functions"] = strings.Join(licenseFunctionStrs, ",")
 					}
-					mysql.Db.Model(&vtap).Updates(dbUpdateMap)
+					if ret := mysql.Db.Model(&vtap).Updates(dbUpdateMap); ret.Error != nil {
+						_err = NewError(httpcommon.SERVER_ERROR, ret.Error.Error())
+					} else if licenseType != vtap.LicenseType {
+						usedCounts[licenseType]++
+						if vtap.LicenseType != common.VTAP_LICENSE_TYPE_NONE {
+							usedCounts[vtap.LicenseType]--
+						}
+					}
 				}
 			}
 			if _err != nil {
 				description += _err.Error()
-				failedLcuuids = append(failedLcuuids, lcuuid)
+				response.FailedLcuuids = append(response.FailedLcuuids, lcuuid)
+				response.Errors[lcuuid] = _err.Error()
 			} else {
-				succeedLcuuids = append(succeedLcuuids, lcuuid)
+				response.SucceedLcuuids = append(response.SucceedLcuuids, lcuuid)
 			}
 		}
 	}
 
-	response := map[string][]string{
-		"SUCCEED_LCUUID": succeedLcuuids,
-		"FAILED_LCUUID":  failedLcuuids,
+	// 仅返回有数量限制的授权类型
+	for licenseType, limit := range limits {
+		if limit > 0 {
+			response.Remaining[licenseType] = limit - usedCounts[licenseType]
+		}
 	}
 
 	if description != "" {
@@ -424,12 +875,13 @@ func DeleteVtap(lcuuid string) (resp map[string]string, err error) {
 	var vtap mysql.VTap
 
 	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
-		return map[string]string{}, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+		return map[string]string{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
 	}
 
 	log.Infof("delete vtap (%s)", vtap.Name)
 
 	mysql.Db.Delete(&vtap)
+	mysql.Db.Where("vtap_id = ?", vtap.ID).Delete(&mysql.VTapTag{})
 	return map[string]string{"LCUUID": lcuuid}, nil
 }
 
@@ -462,17 +914,58 @@ func BatchDeleteVtap(deleteMap []map[string]string) (resp map[string][]string, e
 	}
 }
 
+// 剩余可分配采集器个数相同时按此顺序选择节点，默认按IP排序，指定seed时按seed打乱
+// 相同的输入(及seed)得到相同的均衡结果
+func hostTieBreakRanks(hostIPs []string, seed *int64) map[string]int {
+	sortedIPs := append([]string{}, hostIPs...)
+	sort.Strings(sortedIPs)
+	if seed != nil {
+		r := rand.New(rand.NewSource(*seed))
+		r.Shuffle(len(sortedIPs), func(i, j int) {
+			sortedIPs[i], sortedIPs[j] = sortedIPs[j], sortedIPs[i]
+		})
+	}
+	ranks := make(map[string]int, len(sortedIPs))
+	for i, hostIP := range sortedIPs {
+		ranks[hostIP] = i
+	}
+	return ranks
+}
+
+func sortedHostIPs[T any](hostIPToValue map[string]T) []string {
+	hostIPs := make([]string, 0, len(hostIPToValue))
+	for hostIP := range hostIPToValue {
+		hostIPs = append(hostIPs, hostIP)
+	}
+	sort.Strings(hostIPs)
+	return hostIPs
+}
+
+// 优先分配剩余采集器个数最多的控制器/数据节点，个数相同时按hostIPToRank选择，并扣减所选节点的剩余个数
+func selectRebalanceHost(hostAvailableVTapNum []common.KVPair, hostIPToRank map[string]int) string {
+	sort.Slice(hostAvailableVTapNum, func(m, n int) bool {
+		if hostAvailableVTapNum[m].Value != hostAvailableVTapNum[n].Value {
+			return hostAvailableVTapNum[m].Value > hostAvailableVTapNum[n].Value
+		}
+		return hostIPToRank[hostAvailableVTapNum[m].Key] < hostIPToRank[hostAvailableVTapNum[n].Key]
+	})
+	hostAvailableVTapNum[0].Value -= 1
+	return hostAvailableVTapNum[0].Key
+}
+
 func execAZRebalance(
 	azLcuuid string, vtapNum int, hostType string, hostIPToVTaps map[string][]*mysql.VTap,
 	hostIPToAvailableVTapNum map[string]int, hostIPToUsedVTapNum map[string]int,
-	hostIPToState map[string]int, ifCheck bool,
+	hostIPToState map[string]int, ifCheck bool, seed *int64,
 ) model.AZVTapRebalanceResult {
 
 	// 生成可分配的控制器/数据节点列表
 	availableHostNum := 0
 	hostAvailableVTapNum := []common.KVPair{}
 	hostIPToRebalanceResult := make(map[string]*model.HostVTapRebalanceResult)
-	for hostIP, availableVTapNum := range hostIPToAvailableVTapNum {
+	hostIPs := sortedHostIPs(hostIPToAvailableVTapNum)
+	for _, hostIP := range hostIPs {
+		availableVTapNum := hostIPToAvailableVTapNum[hostIP]
 		state, ok := hostIPToState[hostIP]
 		if !ok {
 			continue
@@ -504,7 +997,9 @@ func execAZRebalance(
 
 	// 超出平均个数的控制器，对其上采集器进行重新分配
 	response := model.AZVTapRebalanceResult{}
-	for hostIP, vtaps := range hostIPToVTaps {
+	hostIPToRank := hostTieBreakRanks(hostIPs, seed)
+	for _, hostIP := range sortedHostIPs(hostIPToVTaps) {
+		vtaps := hostIPToVTaps[hostIP]
 		hostVTapRebalanceResult, ok := hostIPToRebalanceResult[hostIP]
 		if !ok {
 			continue
@@ -519,14 +1014,8 @@ func execAZRebalance(
 		for i := avgVTapNum; i < len(vtaps); i++ {
 			vtap := vtaps[i]
 
-			// 优先分配剩余采集器个数最多的控制器/数据节点
-			sort.Slice(hostAvailableVTapNum, func(m, n int) bool {
-				return hostAvailableVTapNum[m].Value > hostAvailableVTapNum[n].Value
-			})
-			hostAvailableVTapNum[0].Value -= 1
-
 			// 判断当前分配的控制器/数据节点是否与原有一致，如果不一致更新result数据
-			reallocHostIP := hostAvailableVTapNum[0].Key
+			reallocHostIP := selectRebalanceHost(hostAvailableVTapNum, hostIPToRank)
 			if hostType == "controller" {
 				log.Infof(
 					"rebalance vtap (%s) controller_ip from (%s) to (%s)",
@@ -561,13 +1050,39 @@ func execAZRebalance(
 		}
 	}
 
-	for _, hostRebalanceResult := range hostIPToRebalanceResult {
-		response.Details = append(response.Details, hostRebalanceResult)
+	for _, hostIP := range hostIPs {
+		if hostRebalanceResult, ok := hostIPToRebalanceResult[hostIP]; ok {
+			response.Details = append(response.Details, hostRebalanceResult)
+		}
 	}
 	return response
 }
 
-func vtapControllerRebalance(azs []mysql.AZ, ifCheck bool) (*model.VTapRebalanceResult, error) {
+func getAZToControllers(azControllerConns []mysql.AZControllerConnection, regionToAZLcuuids map[string][]string,
+	ipToController map[string]*mysql.Controller) map[string][]*mysql.Controller {
+
+	azToControllers := make(map[string][]*mysql.Controller)
+	for _, conn := range azControllerConns {
+		if conn.AZ == "ALL" {
+			if azLcuuids, ok := regionToAZLcuuids[conn.Region]; ok {
+				for _, azLcuuid := range azLcuuids {
+					if controller, ok := ipToController[conn.ControllerIP]; ok {
+						azToControllers[azLcuuid] = append(
+							azToControllers[azLcuuid], controller,
+						)
+					}
+				}
+			}
+		} else {
+			if controller, ok := ipToController[conn.ControllerIP]; ok {
+				azToControllers[conn.AZ] = append(azToControllers[conn.AZ], controller)
+			}
+		}
+	}
+	return azToControllers
+}
+
+func vtapControllerRebalance(azs []mysql.AZ, ifCheck bool, seed *int64) (*model.VTapRebalanceResult, error) {
 	var controllers []mysql.Controller
 	var azControllerConns []mysql.AZControllerConnection
 	var vtaps []mysql.VTap
@@ -601,24 +1116,7 @@ func vtapControllerRebalance(azs []mysql.AZ, ifCheck bool) (*model.VTapRebalance
 	}
 
 	// 获取各可用区中的控制列表
-	azToControllers := make(map[string][]*mysql.Controller)
-	for _, conn := range azControllerConns {
-		if conn.AZ == "ALL" {
-			if azLcuuids, ok := regionToAZLcuuids[conn.Region]; ok {
-				for _, azLcuuid := range azLcuuids {
-					if controller, ok := ipToController[conn.ControllerIP]; ok {
-						azToControllers[azLcuuid] = append(
-							azToControllers[azLcuuid], controller,
-						)
-					}
-				}
-			}
-		} else {
-			if controller, ok := ipToController[conn.ControllerIP]; ok {
-				azToControllers[conn.AZ] = append(azToControllers[conn.AZ], controller)
-			}
-		}
-	}
+	azToControllers := getAZToControllers(azControllerConns, regionToAZLcuuids, ipToController)
 
 	// 遍历可用区，进行控制器均衡
 	for _, az := range azs {
@@ -656,7 +1154,7 @@ func vtapControllerRebalance(azs []mysql.AZ, ifCheck bool) (*model.VTapRebalance
 		azVTapRebalanceResult := execAZRebalance(
 			az.Lcuuid, len(azVTaps), "controller", controllerIPToVTaps,
 			controllerIPToAvailableVTapNum, controllerIPToUsedVTapNum,
-			controllerIPToState, ifCheck,
+			controllerIPToState, ifCheck, seed,
 		)
 		response.TotalSwitchVTapNum += azVTapRebalanceResult.TotalSwitchVTapNum
 		response.Details = append(response.Details, azVTapRebalanceResult.Details...)
@@ -664,7 +1162,7 @@ func vtapControllerRebalance(azs []mysql.AZ, ifCheck bool) (*model.VTapRebalance
 	return response, nil
 }
 
-func vtapAnalyzerRebalance(azs []mysql.AZ, ifCheck bool) (*model.VTapRebalanceResult, error) {
+func vtapAnalyzerRebalance(azs []mysql.AZ, ifCheck bool, seed *int64) (*model.VTapRebalanceResult, error) {
 	var analyzers []mysql.Analyzer
 	var azAnalyzerConns []mysql.AZAnalyzerConnection
 	var vtaps []mysql.VTap
@@ -734,7 +1232,7 @@ func vtapAnalyzerRebalance(azs []mysql.AZ, ifCheck bool) (*model.VTapRebalanceRe
 		azVTapRebalanceResult := execAZRebalance(
 			az.Lcuuid, len(azVTaps), "analyzer", analyzerIPToVTaps,
 			analyzerIPToAvailableVTapNum, analyzerIPToUsedVTapNum,
-			analyzerIPToState, ifCheck,
+			analyzerIPToState, ifCheck, seed,
 		)
 		response.TotalSwitchVTapNum += azVTapRebalanceResult.TotalSwitchVTapNum
 		response.Details = append(response.Details, azVTapRebalanceResult.Details...)
@@ -755,26 +1253,103 @@ func VTapRebalance(args map[string]interface{}, cfg config.IngesterLoadBalancing
 		ifCheck = argsCheck.(bool)
 	}
 
+	// 仅用于按采集器个数均衡时的节点选择
+	var seed *int64
+	if argsSeed, ok := args["seed"].(int64); ok {
+		seed = &argsSeed
+	}
+
 	mysql.Db.Find(&azs)
+	var result *model.VTapRebalanceResult
+	var err error
 	if hostType == "controller" {
-		return vtapControllerRebalance(azs, ifCheck)
+		result, err = vtapControllerRebalance(azs, ifCheck, seed)
+		if err != nil {
+			return nil, err
+		}
+		addRebalanceSoftLimitWarnings(result, hostType, cfg.ControllerSoftLimitPercent)
 	} else {
 		if cfg.Algorithm == common.ANALYZER_ALLOC_BY_INGESTED_DATA {
-			return rebalance.NewAnalyzerInfo().RebalanceAnalyzerByTraffic(ifCheck, cfg.DataDuration)
+			result, err = rebalance.NewAnalyzerInfo().RebalanceAnalyzerByTraffic(ifCheck, cfg.DataDuration)
 		} else if cfg.Algorithm == common.ANALYZER_ALLOC_BY_AGENT_COUNT {
-			result, err := vtapAnalyzerRebalance(azs, ifCheck)
-			if err != nil {
-				return nil, err
-			}
-			for _, detail := range result.Details {
-				detail.BeforeVTapWeights = 1
-				detail.AfterVTapWeights = 1
+			result, err = vtapAnalyzerRebalance(azs, ifCheck, seed)
+			if err == nil {
+				for _, detail := range result.Details {
+					detail.BeforeVTapWeights = 1
+					detail.AfterVTapWeights = 1
+				}
 			}
-			return result, nil
 		} else {
 			return nil, fmt.Errorf("algorithm(%s) is not supported, only supports: %s, %s", cfg.Algorithm,
 				common.ANALYZER_ALLOC_BY_INGESTED_DATA, common.ANALYZER_ALLOC_BY_AGENT_COUNT)
 		}
+		if err != nil {
+			return nil, err
+		}
+		addRebalanceSoftLimitWarnings(result, hostType, cfg.AnalyzerSoftLimitPercent)
+	}
+
+	if !ifCheck {
+		actor, _ := args["actor"].(string)
+		recordVTapRebalanceHistory(hostType, actor, result)
+	}
+	return result, nil
+}
+
+// 均衡后控制器/数据节点上的采集器个数超过vtap_max的软限制比例时给出告警，不影响均衡结果
+func addRebalanceSoftLimitWarnings(result *model.VTapRebalanceResult, hostType string, softLimitPercent int) {
+	if result == nil || softLimitPercent <= 0 {
+		return
+	}
+
+	ipToVTapMax := make(map[string]int)
+	if hostType == "controller" {
+		var controllers []mysql.Controller
+		mysql.Db.Find(&controllers)
+		for _, controller := range controllers {
+			ipToVTapMax[controller.IP] = controller.VTapMax
+		}
+	} else {
+		var analyzers []mysql.Analyzer
+		mysql.Db.Find(&analyzers)
+		for _, analyzer := range analyzers {
+			ipToVTapMax[analyzer.IP] = analyzer.VTapMax
+		}
+	}
+
+	// 同一节点可能服务多个可用区，按节点汇总
+	ips := []string{}
+	ipToAfterVTapNum := make(map[string]int)
+	for _, detail := range result.Details {
+		if _, ok := ipToAfterVTapNum[detail.IP]; !ok {
+			ips = append(ips, detail.IP)
+		}
+		ipToAfterVTapNum[detail.IP] += detail.AfterVTapNum
+	}
+	sort.Strings(ips)
+
+	for _, ip := range ips {
+		vtapMax, ok := ipToVTapMax[ip]
+		if !ok || vtapMax <= 0 {
+			continue
+		}
+		softLimit := vtapMax * softLimitPercent / 100
+		afterVTapNum := ipToAfterVTapNum[ip]
+		if afterVTapNum <= softLimit {
+			continue
+		}
+		message := fmt.Sprintf(
+			"%s (%s) vtap num (%d) exceeds soft limit (%d, %d%% of vtap_max %d)",
+			hostType, ip, afterVTapNum, softLimit, softLimitPercent, vtapMax,
+		)
+		log.Warning(message)
+		result.Warnings = append(result.Warnings, &model.HostVTapRebalanceWarning{
+			IP:           ip,
+			AfterVTapNum: afterVTapNum,
+			VTapMax:      vtapMax,
+			SoftLimit:    softLimit,
+			Message:      message,
+		})
 	}
 }
 
@@ -887,6 +1462,80 @@ func BatchUpdateVtapTapMode(vtapUpdate *model.VtapUpdateTapMode) (interface{}, e
 	return nil, nil
 }
 
+// 批量设置采集器的维护状态，维护中的采集器失联时不告警也不会被自动删除
+func BatchUpdateVtapMaintenance(lcuuids []string, maintenance bool) (resp model.VtapUpdateMaintenanceResult, err error) {
+	resp.Updated = []string{}
+	resp.NotFound = []string{}
+	if len(lcuuids) == 0 {
+		return resp, nil
+	}
+
+	var vtaps []mysql.VTap
+	if err = mysql.Db.Where("lcuuid IN (?)", lcuuids).Find(&vtaps).Error; err != nil {
+		return resp, NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("fail to query vtaps, error: %s", err))
+	}
+	existLcuuids := make(map[string]bool, len(vtaps))
+	for _, vtap := range vtaps {
+		existLcuuids[vtap.Lcuuid] = true
+	}
+	seen := make(map[string]bool, len(lcuuids))
+	for _, lcuuid := range lcuuids {
+		if seen[lcuuid] {
+			continue
+		}
+		seen[lcuuid] = true
+		if existLcuuids[lcuuid] {
+			resp.Updated = append(resp.Updated, lcuuid)
+		} else {
+			resp.NotFound = append(resp.NotFound, lcuuid)
+		}
+	}
+	if len(resp.Updated) == 0 {
+		return resp, nil
+	}
+
+	err = mysql.Db.Model(&mysql.VTap{}).Where("lcuuid IN (?)", resp.Updated).Updates(map[string]interface{}{
+		"maintenance": maintenance,
+		"row_version": gorm.Expr("row_version + 1"),
+	}).Error
+	if err != nil {
+		return resp, NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("fail to update vtaps maintenance, error: %s", err))
+	}
+	log.Infof("set %d vtap(s) maintenance to %t: %v", len(resp.Updated), maintenance, resp.Updated)
+	return resp, nil
+}
+
+// 采集器组配置变化时递增组内采集器的config_revision
+func increaseVtapConfigRevision(vtapGroupLcuuid string) {
+	err := mysql.Db.Model(&mysql.VTap{}).Where("vtap_group_lcuuid = ?", vtapGroupLcuuid).
+		Update("config_revision", gorm.Expr("config_revision + 1")).Error
+	if err != nil {
+		log.Errorf("increase config revision of vtap group (%s) failed: %s", vtapGroupLcuuid, err)
+	}
+}
+
+// 采集器上报当前已应用的配置版本，与CONFIG_REVISION不一致说明采集器未应用最新配置
+func AckVtapConfigRevision(lcuuid string, configRevision int) (resp model.Vtap, err error) {
+	var vtap mysql.VTap
+	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
+		return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+	}
+	if configRevision < 0 || configRevision > vtap.ConfigRevision {
+		return model.Vtap{}, NewError(
+			httpcommon.INVALID_PARAMETERS,
+			fmt.Sprintf("vtap (%s) config revision (%d) is invalid, latest is %d", vtap.Name, configRevision, vtap.ConfigRevision),
+		)
+	}
+	if err = mysql.Db.Model(&vtap).Update("acked_config_revision", configRevision).Error; err != nil {
+		return model.Vtap{}, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if configRevision != vtap.ConfigRevision {
+		log.Warningf("vtap (%s) acked config revision %d, latest is %d", vtap.Name, configRevision, vtap.ConfigRevision)
+	}
+
+	return getVtapByLcuuid(vtap.Lcuuid)
+}
+
 // GetVTapPortsCount gets the number of virtual network cards covered by the deployed vtap,
 // and virtual network type is VIF_DEVICE_TYPE_VM or VIF_DEVICE_TYPE_POD.
 func GetVTapPortsCount() (int, error) {
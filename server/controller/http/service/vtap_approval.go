@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+// ApproveVtap 审批通过待审批(或已拒绝)的采集器，采集器下次同步时获取完整配置
+func ApproveVtap(lcuuid string) (resp model.Vtap, err error) {
+	return transitVtapApprovalState(lcuuid, common.VTAP_STATE_NORMAL, common.VTAP_ENABLE_TRUE)
+}
+
+// RejectVtap 拒绝待审批的采集器，采集器仅获取禁用状态的配置
+func RejectVtap(lcuuid string) (resp model.Vtap, err error) {
+	return transitVtapApprovalState(lcuuid, common.VTAP_STATE_REJECTED, common.VTAP_ENABLE_FALSE)
+}
+
+func transitVtapApprovalState(lcuuid string, state, enable int) (resp model.Vtap, err error) {
+	var vtap mysql.VTap
+	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
+		return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+	}
+	// 仅待审批的采集器可审批/拒绝，已拒绝的采集器可重新审批通过
+	if vtap.State != common.VTAP_STATE_PENDING &&
+		!(vtap.State == common.VTAP_STATE_REJECTED && state == common.VTAP_STATE_NORMAL) {
+		return model.Vtap{}, NewError(
+			httpcommon.INVALID_PARAMETERS,
+			fmt.Sprintf("vtap (%s) state (%s) does not allow transition to (%s)",
+				vtap.Name, common.VTapStateToChinese[vtap.State], common.VTapStateToChinese[state]),
+		)
+	}
+
+	log.Infof("vtap (%s) state change from (%d) to (%d) by approval", vtap.Name, vtap.State, state)
+	dbUpdateMap := map[string]interface{}{
+		"state":           state,
+		"enable":          enable,
+		"config_revision": gorm.Expr("config_revision + 1"),
+		"row_version":     gorm.Expr("row_version + 1"),
+	}
+	if err := mysql.Db.Model(&vtap).Updates(dbUpdateMap).Error; err != nil {
+		return model.Vtap{}, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+
+	refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
+	return getVtapByLcuuid(vtap.Lcuuid)
+}
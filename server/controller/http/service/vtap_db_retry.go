@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/config"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+)
+
+var vtapDBBreaker = newDBCircuitBreaker(config.VTapDBRetry{
+	RetryCount: 2, RetryInterval: 100, BreakerThreshold: 5, BreakerCooldown: 30,
+})
+
+// 根据配置初始化采集器接口的数据库重试及熔断
+func InitVTapDBRetry(cfg config.VTapDBRetry) {
+	vtapDBBreaker = newDBCircuitBreaker(cfg)
+}
+
+// 数据库切换等导致的连接类错误视为可重试
+func isTransientDBError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysqldriver.ErrInvalidConn) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// 连接类错误按间隔重试，连续失败达到阈值后熔断，冷却期内直接返回错误，冷却结束后仅放行一次探测请求
+type dbCircuitBreaker struct {
+	mutex     sync.Mutex
+	cfg       config.VTapDBRetry
+	failures  int
+	openUntil time.Time
+	probing   bool // 半开状态下探测请求执行中，其他请求直接返回错误
+	now       func() time.Time
+}
+
+func newDBCircuitBreaker(cfg config.VTapDBRetry) *dbCircuitBreaker {
+	return &dbCircuitBreaker{cfg: cfg, now: time.Now}
+}
+
+// probe为true表示本次请求为半开状态的探测请求，结束后需通过record上报
+func (b *dbCircuitBreaker) allow() (probe bool, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.probing {
+		return false, NewError(httpcommon.SERVICE_UNAVAILABLE,
+			"mysql is unavailable, circuit breaker is half-open, waiting for probe request")
+	}
+	if b.openUntil.IsZero() {
+		return false, nil
+	}
+	if now := b.now(); now.Before(b.openUntil) {
+		return false, NewError(httpcommon.SERVICE_UNAVAILABLE, fmt.Sprintf(
+			"mysql is unavailable, circuit breaker is open, retry after %ds",
+			int(b.openUntil.Sub(now).Seconds())+1))
+	}
+	// 半开状态，探测失败时重新熔断
+	b.failures = b.cfg.BreakerThreshold - 1
+	b.openUntil = time.Time{}
+	b.probing = true
+	return true, nil
+}
+
+func (b *dbCircuitBreaker) record(err error, probe bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if probe {
+		b.probing = false
+	}
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.cfg.BreakerThreshold > 0 && b.failures >= b.cfg.BreakerThreshold {
+		log.Errorf("mysql failed %d times in a row, open circuit breaker for %ds: %v",
+			b.failures, b.cfg.BreakerCooldown, err)
+		b.openUntil = b.now().Add(time.Duration(b.cfg.BreakerCooldown) * time.Second)
+	}
+}
+
+func (b *dbCircuitBreaker) execute(fn func() error) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	for i := 0; i <= b.cfg.RetryCount; i++ {
+		if i > 0 {
+			log.Warningf("mysql query failed, retry %d time(s): %v", i, err)
+			time.Sleep(time.Duration(b.cfg.RetryInterval) * time.Millisecond)
+		}
+		err = fn()
+		if err == nil || !isTransientDBError(err) {
+			b.record(nil, probe)
+			return err
+		}
+	}
+	b.record(err, probe)
+	return err
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"database/sql/driver"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	"github.com/deepflowio/deepflow/server/controller/http/config"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+)
+
+const TEST_DB_FAILURE_CALLBACK = "test:db_failure"
+
+// 模拟数据库故障，前failures次查询返回连接错误，failures<0时持续失败
+func (t *SuiteTest) mockDBFailures(failures int) *int {
+	queries := 0
+	t.db.Callback().Query().Before("gorm:query").Register(TEST_DB_FAILURE_CALLBACK, func(db *gorm.DB) {
+		queries++
+		if failures < 0 || queries <= failures {
+			db.AddError(driver.ErrBadConn)
+		}
+	})
+	return &queries
+}
+
+func (t *SuiteTest) clearDBFailures() {
+	t.db.Callback().Query().Remove(TEST_DB_FAILURE_CALLBACK)
+	InitVTapDBRetry(config.VTapDBRetry{})
+}
+
+func (t *SuiteTest) TestGetVtapsRetryTransientDBError() {
+	t.createVtap("vtap-1")
+	InitVTapDBRetry(config.VTapDBRetry{RetryCount: 2, BreakerThreshold: 3, BreakerCooldown: 30})
+	t.mockDBFailures(2)
+	defer t.clearDBFailures()
+
+	vtaps, err := GetVtaps(nil)
+	assert.Nil(t.T(), err)
+	if assert.Len(t.T(), vtaps, 1) {
+		assert.Equal(t.T(), "vtap-1", vtaps[0].Name)
+	}
+	assert.Equal(t.T(), 0, vtapDBBreaker.failures)
+}
+
+func (t *SuiteTest) TestGetVtapsCircuitBreakerOpen() {
+	t.createVtap("vtap-1")
+	InitVTapDBRetry(config.VTapDBRetry{RetryCount: 1, BreakerThreshold: 2, BreakerCooldown: 30})
+	now := time.Now()
+	vtapDBBreaker.now = func() time.Time { return now }
+	queries := t.mockDBFailures(-1)
+	defer t.clearDBFailures()
+
+	for i := 0; i < 2; i++ {
+		_, err := GetVtaps(nil)
+		if assert.IsType(t.T(), &ServiceError{}, err) {
+			assert.Equal(t.T(), httpcommon.SERVER_ERROR, err.(*ServiceError).Status)
+		}
+	}
+	assert.Equal(t.T(), 4, *queries)
+
+	// 熔断后不再访问数据库
+	_, err := GetVtaps(nil)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.SERVICE_UNAVAILABLE, err.(*ServiceError).Status)
+	}
+	assert.Equal(t.T(), 4, *queries)
+
+	// 冷却结束后数据库恢复，探测请求成功关闭熔断
+	t.db.Callback().Query().Remove(TEST_DB_FAILURE_CALLBACK)
+	now = now.Add(31 * time.Second)
+	vtaps, err := GetVtaps(nil)
+	assert.Nil(t.T(), err)
+	assert.Len(t.T(), vtaps, 1)
+	assert.True(t.T(), vtapDBBreaker.openUntil.IsZero())
+}
+
+func TestDBCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	breaker := newDBCircuitBreaker(config.VTapDBRetry{BreakerThreshold: 1, BreakerCooldown: 30})
+	now := time.Now()
+	breaker.now = func() time.Time { return now }
+	assert.Equal(t, driver.ErrBadConn, breaker.execute(func() error { return driver.ErrBadConn }))
+	now = now.Add(31 * time.Second)
+
+	// 冷却结束后并发请求，仅一个探测请求访问数据库，其余直接返回错误
+	const requests = 10
+	var calls int32
+	release := make(chan struct{})
+	results := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			results <- breaker.execute(func() error {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return nil
+			})
+		}()
+	}
+	for i := 0; i < requests-1; i++ {
+		select {
+		case err := <-results:
+			if assert.IsType(t, &ServiceError{}, err) {
+				assert.Equal(t, httpcommon.SERVICE_UNAVAILABLE, err.(*ServiceError).Status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("concurrent requests are not rejected while probing")
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// 探测成功后关闭熔断
+	close(release)
+	assert.Nil(t, <-results)
+	assert.Nil(t, breaker.execute(func() error { atomic.AddInt32(&calls, 1); return nil }))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func (t *SuiteTest) TestUpdateVtapCircuitBreakerOpen() {
+	vtap := t.createVtap("vtap-1")
+	InitVTapDBRetry(config.VTapDBRetry{BreakerThreshold: 1, BreakerCooldown: 30})
+	defer t.clearDBFailures()
+	vtapDBBreaker.openUntil = time.Now().Add(time.Minute)
+
+	// 写入后读取采集器失败时返回错误，不访问空结果
+	_, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"ENABLE": float64(0)})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.SERVICE_UNAVAILABLE, err.(*ServiceError).Status)
+	}
+}
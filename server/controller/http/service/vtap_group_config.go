@@ -29,6 +29,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/db/mysql"
 	"github.com/deepflowio/deepflow/server/controller/model"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+	vtapop "github.com/deepflowio/deepflow/server/controller/trisolaris/vtap"
 )
 
 func convertStrToIntList(convertStr string) ([]int, error) {
@@ -139,7 +140,7 @@ func convertDBToJson(
 	lcuuidToDomain map[string]string) {
 
 	ignoreName := []string{"ID", "YamlConfig", "L4LogTapTypes", "L4LogIgnoreTapSides", "L7LogIgnoreTapSides",
-		"L7LogStoreTapTypes", "DecapType", "Domains", "MaxCollectPps", "MaxNpbBps", "MaxTxBandwidth"}
+		"L7LogStoreTapTypes", "DecapType", "SegmentDeviceTypes", "Domains", "MaxCollectPps", "MaxNpbBps", "MaxTxBandwidth"}
 	copyStruct(sData, tData, ignoreName)
 	tData.L4LogTapTypes = []*model.TypeInfo{}
 	tData.L7LogStoreTapTypes = []*model.TypeInfo{}
@@ -210,6 +211,14 @@ func convertDBToJson(
 			log.Error(err)
 		}
 	}
+	if sData.SegmentDeviceTypes != nil {
+		cSegmentDeviceTypes, err := convertStrToIntList(*sData.SegmentDeviceTypes)
+		if err == nil {
+			tData.SegmentDeviceTypes = cSegmentDeviceTypes
+		} else {
+			log.Error(err)
+		}
+	}
 	if sData.Domains != nil {
 		cDomains := strings.Split(*sData.Domains, ",")
 		for _, domain := range cDomains {
@@ -248,7 +257,7 @@ func convertDBToJson(
 func convertDBToYaml(sData *mysql.VTapGroupConfiguration, tData *model.VTapGroupConfiguration) {
 	ignoreName := []string{"ID", "VTapGroupLcuuid", "VTapGroupID", "Lcuuid", "YamlConfig",
 		"L4LogTapTypes", "L4LogIgnoreTapSides", "L7LogIgnoreTapSides",
-		"L7LogStoreTapTypes", "DecapType", "Domains", "MaxCollectPps", "MaxNpbBps", "MaxTxBandwidth",
+		"L7LogStoreTapTypes", "DecapType", "SegmentDeviceTypes", "Domains", "MaxCollectPps", "MaxNpbBps", "MaxTxBandwidth",
 		"PrometheusHttpAPIAddresses",
 	}
 	copyStruct(sData, tData, ignoreName)
@@ -311,6 +320,14 @@ func convertDBToYaml(sData *mysql.VTapGroupConfiguration, tData *model.VTapGroup
 			log.Error(err)
 		}
 	}
+	if sData.SegmentDeviceTypes != nil {
+		cSegmentDeviceTypes, err := convertStrToIntList(*sData.SegmentDeviceTypes)
+		if err == nil {
+			tData.SegmentDeviceTypes = cSegmentDeviceTypes
+		} else {
+			log.Error(err)
+		}
+	}
 	if sData.Domains != nil {
 		cDomains := strings.Split(*sData.Domains, ",")
 		for _, domain := range cDomains {
@@ -359,7 +376,7 @@ func convertYamlToDb(sData *model.VTapGroupConfiguration, tData *mysql.VTapGroup
 func convertToDb(sData *model.VTapGroupConfiguration, tData *mysql.VTapGroupConfiguration) {
 	ignoreName := []string{"ID", "YamlConfig", "Lcuuid", "VTapGroupLcuuid", "VTapGroupID",
 		"L4LogTapTypes", "L4LogIgnoreTapSides", "L7LogIgnoreTapSides",
-		"L7LogStoreTapTypes", "DecapType", "Domains", "MaxCollectPps", "MaxNpbBps", "MaxTxBandwidth",
+		"L7LogStoreTapTypes", "DecapType", "SegmentDeviceTypes", "Domains", "MaxCollectPps", "MaxNpbBps", "MaxTxBandwidth",
 		"PrometheusHttpAPIAddresses",
 	}
 	copyStruct(sData, tData, ignoreName)
@@ -393,6 +410,12 @@ func convertToDb(sData *model.VTapGroupConfiguration, tData *mysql.VTapGroupConf
 	} else {
 		tData.DecapType = nil
 	}
+	if len(sData.SegmentDeviceTypes) > 0 {
+		cSegmentDeviceTypes := convertIntSliceToString(sData.SegmentDeviceTypes)
+		tData.SegmentDeviceTypes = &cSegmentDeviceTypes
+	} else {
+		tData.SegmentDeviceTypes = nil
+	}
 	if len(sData.Domains) > 0 {
 		cDomains := strings.Join(sData.Domains, ",")
 		tData.Domains = &cDomains
@@ -425,6 +448,19 @@ func convertToDb(sData *model.VTapGroupConfiguration, tData *mysql.VTapGroupConf
 	}
 }
 
+// 校验采集器组配置中的模板字段只引用支持的变量
+func checkVTapGroupConfigTemplate(config *mysql.VTapGroupConfiguration) error {
+	for _, field := range []*string{config.YamlConfig, config.AnalyzerIP, config.ProxyControllerIP} {
+		if field == nil {
+			continue
+		}
+		if err := vtapop.CheckConfigTemplate(*field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func CreateVTapGroupConfig(createData *model.VTapGroupConfiguration) (*mysql.VTapGroupConfiguration, error) {
 	if createData.VTapGroupLcuuid == nil {
 		return nil, fmt.Errorf("vtap_group_lcuuid is emty")
@@ -444,10 +480,14 @@ func CreateVTapGroupConfig(createData *model.VTapGroupConfiguration) (*mysql.VTa
 	}
 	dbData := &mysql.VTapGroupConfiguration{}
 	convertJsonToDb(createData, dbData)
+	if err := checkVTapGroupConfigTemplate(dbData); err != nil {
+		return nil, err
+	}
 	dbData.VTapGroupLcuuid = createData.VTapGroupLcuuid
 	lcuuid := uuid.New().String()
 	dbData.Lcuuid = &lcuuid
 	mysql.Db.Create(dbData)
+	increaseVtapConfigRevision(vTapGroupLcuuid)
 	refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
 	return dbData, nil
 }
@@ -464,6 +504,9 @@ func DeleteVTapGroupConfig(lcuuid string) (*mysql.VTapGroupConfiguration, error)
 		return nil, fmt.Errorf("vtap group configuration(%s) not found", lcuuid)
 	}
 	db.Delete(dbConfig)
+	if dbConfig.VTapGroupLcuuid != nil {
+		increaseVtapConfigRevision(*dbConfig.VTapGroupLcuuid)
+	}
 	refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
 	return dbConfig, nil
 }
@@ -480,10 +523,16 @@ func UpdateVTapGroupConfig(lcuuid string, updateData *model.VTapGroupConfigurati
 		return nil, fmt.Errorf("vtap group configuration(%s) not found", lcuuid)
 	}
 	convertJsonToDb(updateData, dbConfig)
+	if err := checkVTapGroupConfigTemplate(dbConfig); err != nil {
+		return nil, err
+	}
 	ret = db.Save(dbConfig)
 	if ret.Error != nil {
 		return nil, fmt.Errorf("save config failed, %s", ret.Error)
 	}
+	if dbConfig.VTapGroupLcuuid != nil {
+		increaseVtapConfigRevision(*dbConfig.VTapGroupLcuuid)
+	}
 	refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
 	return dbConfig, nil
 }
@@ -683,10 +732,16 @@ func UpdateVTapGroupAdvancedConfig(lcuuid string, updateData *model.VTapGroupCon
 		return "", fmt.Errorf("vtap group configuration(%s) not found", lcuuid)
 	}
 	convertYamlToDb(updateData, dbConfig)
+	if err := checkVTapGroupConfigTemplate(dbConfig); err != nil {
+		return "", err
+	}
 	ret = db.Save(dbConfig)
 	if ret.Error != nil {
 		return "", fmt.Errorf("save config failed, %s", ret.Error)
 	}
+	if dbConfig.VTapGroupLcuuid != nil {
+		increaseVtapConfigRevision(*dbConfig.VTapGroupLcuuid)
+	}
 	response := &model.VTapGroupConfiguration{}
 	convertDBToYaml(dbConfig, response)
 	b, err := yaml.Marshal(response)
@@ -717,6 +772,9 @@ func CreateVTapGroupAdvancedConfig(createData *model.VTapGroupConfiguration) (st
 		return "", fmt.Errorf("vtap group(short_uuid=%s) configuration already exist", *shortUUID)
 	}
 	convertYamlToDb(createData, dbConfig)
+	if err := checkVTapGroupConfigTemplate(dbConfig); err != nil {
+		return "", err
+	}
 	dbConfig.VTapGroupLcuuid = &vtapGroup.Lcuuid
 	lcuuid := uuid.New().String()
 	dbConfig.Lcuuid = &lcuuid
@@ -724,6 +782,9 @@ func CreateVTapGroupAdvancedConfig(createData *model.VTapGroupConfiguration) (st
 	if ret.Error != nil {
 		return "", fmt.Errorf("save config failed, %s", ret.Error)
 	}
+	if dbConfig.VTapGroupLcuuid != nil {
+		increaseVtapConfigRevision(*dbConfig.VTapGroupLcuuid)
+	}
 	response := &model.VTapGroupConfiguration{}
 	convertDBToYaml(dbConfig, response)
 	response.VTapGroupID = shortUUID
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	vtapop "github.com/deepflowio/deepflow/server/controller/trisolaris/vtap"
+)
+
+// 可被单个采集器覆盖的采集器组配置项，ok为false表示该采集器未覆盖
+type vtapConfigOverrider struct {
+	name     string
+	override func(config *mysql.VTapGroupConfiguration, vtap *mysql.VTap) (value interface{}, ok bool)
+}
+
+// 引用了模板变量的配置项，按采集器的区域、可用区及启动服务器渲染，渲染结果与组配置不同时视为覆盖
+func templateConfigOverrider(name string, field func(config *mysql.VTapGroupConfiguration) *string) vtapConfigOverrider {
+	return vtapConfigOverrider{
+		name: name,
+		override: func(config *mysql.VTapGroupConfiguration, vtap *mysql.VTap) (interface{}, bool) {
+			template := field(config)
+			if template == nil {
+				return nil, false
+			}
+			value := vtapop.RenderConfigTemplate(*template, vtapop.VTapConfigTemplateVars(vtap.Region, vtap.AZ, vtap.LaunchServer))
+			if value == *template {
+				return nil, false
+			}
+			return value, true
+		},
+	}
+}
+
+var vtapConfigOverriders = []vtapConfigOverrider{
+	{
+		// 采集器数据配额小于组配置时，下发的发送带宽阈值取配额，与CONFIG中一致单位为Mbps
+		name: "MAX_TX_BANDWIDTH",
+		override: func(config *mysql.VTapGroupConfiguration, vtap *mysql.VTap) (interface{}, bool) {
+			var maxTxBandwidth int64
+			if config.MaxTxBandwidth != nil {
+				maxTxBandwidth = *config.MaxTxBandwidth
+			}
+			threshold := vtapop.TxBandwidthThreshold(maxTxBandwidth, vtap.DataQuota)
+			if threshold == maxTxBandwidth {
+				return nil, false
+			}
+			return threshold / 1000000, true
+		},
+	},
+	templateConfigOverrider("YAML_CONFIG", func(config *mysql.VTapGroupConfiguration) *string { return config.YamlConfig }),
+	templateConfigOverrider("ANALYZER_IP", func(config *mysql.VTapGroupConfiguration) *string { return config.AnalyzerIP }),
+	templateConfigOverrider("PROXY_CONTROLLER_IP", func(config *mysql.VTapGroupConfiguration) *string { return config.ProxyControllerIP }),
+}
+
+// GetVTapGroupEffectiveConfig 返回采集器组合并默认配置后的生效配置，及每个配置项被覆盖的采集器
+func GetVTapGroupEffectiveConfig(lcuuid string) (*model.VTapGroupEffectiveConfig, error) {
+	db := mysql.Db
+	var vtapGroup mysql.VTapGroup
+	if ret := db.Where("lcuuid = ?", lcuuid).First(&vtapGroup); ret.Error != nil {
+		return nil, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("vtap_group (%s) not found", lcuuid))
+	}
+	groupConfig := &mysql.VTapGroupConfiguration{}
+	if ret := db.Where("vtap_group_lcuuid = ?", lcuuid).First(groupConfig); ret.Error != nil {
+		groupConfig = &mysql.VTapGroupConfiguration{}
+	}
+	realConfig := getRealVTapGroupConfig(groupConfig)
+
+	var tapTypes []*mysql.TapType
+	var domains []*mysql.Domain
+	idToTapTypeName := make(map[int]string)
+	lcuuidToDomain := make(map[string]string)
+	db.Find(&tapTypes)
+	db.Find(&domains)
+	for _, tapType := range tapTypes {
+		idToTapTypeName[tapType.Value] = tapType.Name
+	}
+	for _, domain := range domains {
+		lcuuidToDomain[domain.Lcuuid] = domain.Name
+	}
+	configData := &model.VTapGroupConfigurationResponse{}
+	convertDBToJson(realConfig, configData, idToTapTypeName, lcuuidToDomain)
+
+	var vtaps []*mysql.VTap
+	if err := db.Where("vtap_group_lcuuid = ?", lcuuid).Order("id").Find(&vtaps).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	overrides := make(map[string][]model.VTapConfigOverride, len(vtapConfigOverriders))
+	for _, overrider := range vtapConfigOverriders {
+		fieldOverrides := []model.VTapConfigOverride{}
+		for _, vtap := range vtaps {
+			if value, ok := overrider.override(realConfig, vtap); ok {
+				fieldOverrides = append(fieldOverrides, model.VTapConfigOverride{
+					VTapLcuuid: vtap.Lcuuid,
+					VTapName:   vtap.Name,
+					Value:      value,
+				})
+			}
+		}
+		overrides[overrider.name] = fieldOverrides
+	}
+
+	return &model.VTapGroupEffectiveConfig{
+		Config:        configData,
+		VTapOverrides: overrides,
+	}, nil
+}
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/http/service/rebalance"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+// 统计采集器数据使用量的时间范围(秒)
+const VTAP_DATA_USAGE_DURATION = 60
+
+var dataQuotaUnits = map[string]int64{
+	"":  1,
+	"K": 1000,
+	"M": 1000 * 1000,
+	"G": 1000 * 1000 * 1000,
+}
+
+// 采集器数据配额，单位bps，支持数字或带单位的字符串(如100M、1Gbps)，0表示不限制
+func parseVtapDataQuota(value interface{}) (int64, error) {
+	switch quota := value.(type) {
+	case float64:
+		if quota < 0 || quota != float64(int64(quota)) {
+			return 0, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid DATA_QUOTA (%v), must be a non-negative integer", value))
+		}
+		return int64(quota), nil
+	case string:
+		text := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(quota)), "BPS")
+		number, unit := text, ""
+		if n := len(text); n > 0 && (text[n-1] < '0' || text[n-1] > '9') {
+			number, unit = text[:n-1], text[n-1:]
+		}
+		multiplier, ok := dataQuotaUnits[unit]
+		if !ok {
+			return 0, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid DATA_QUOTA (%s), supported units: K, M, G", quota))
+		}
+		n, err := strconv.ParseInt(number, 10, 64)
+		if err != nil || n < 0 {
+			return 0, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid DATA_QUOTA (%s), must be a non-negative integer", quota))
+		}
+		return n * multiplier, nil
+	default:
+		return 0, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid DATA_QUOTA (%v)", value))
+	}
+}
+
+// 返回采集器最近发送数据的速率(bps)，key为采集器名称
+var vtapDataUsageGetter = func() (map[string]int64, error) {
+	vtapNameToBytes, err := (&rebalance.Query{}).GetAgentDispatcher("", VTAP_DATA_USAGE_DURATION)
+	if err != nil {
+		return nil, err
+	}
+	vtapNameToUsage := make(map[string]int64, len(vtapNameToBytes))
+	for name, bytes := range vtapNameToBytes {
+		vtapNameToUsage[name] = bytes * 8 / VTAP_DATA_USAGE_DURATION
+	}
+	return vtapNameToUsage, nil
+}
+
+// 为设置了数据配额的采集器填充当前使用量，查询失败时不返回使用量
+func fillVtapDataUsage(vtaps []model.Vtap) {
+	hasQuota := false
+	for _, vtap := range vtaps {
+		if vtap.DataQuota > 0 {
+			hasQuota = true
+			break
+		}
+	}
+	if !hasQuota {
+		return
+	}
+	vtapNameToUsage, err := vtapDataUsageGetter()
+	if err != nil {
+		log.Warningf("get vtap data usage failed: %s", err)
+		return
+	}
+	for i := range vtaps {
+		if vtaps[i].DataQuota <= 0 {
+			continue
+		}
+		usage := vtapNameToUsage[vtaps[i].Name]
+		vtaps[i].DataUsage = &usage
+	}
+}
@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
+)
+
+const (
+	VTAP_REASSIGN_AUTO = "auto"
+)
+
+// reassignHost 控制器/数据节点当前的采集器分配情况
+type reassignHost struct {
+	ip      string
+	state   int
+	vtapMax int
+	vtapNum int
+	// 与采集器所在可用区存在连接关系
+	connected bool
+}
+
+// ReassignVtap 将采集器立即迁移到指定（或自动选择）的控制器/数据节点
+func ReassignVtap(lcuuid string, vtapReassign model.VtapReassign) (resp model.Vtap, err error) {
+	if vtapReassign.ControllerIP == "" && vtapReassign.AnalyzerIP == "" {
+		return model.Vtap{}, NewError(httpcommon.INVALID_PARAMETERS, "must specify CONTROLLER_IP or ANALYZER_IP")
+	}
+
+	var vtap mysql.VTap
+	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
+		return model.Vtap{}, NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+	}
+
+	dbUpdateMap := make(map[string]interface{})
+	if vtapReassign.ControllerIP != "" {
+		hosts, err := getControllerReassignHosts(vtap)
+		if err != nil {
+			return model.Vtap{}, err
+		}
+		controllerIP, err := selectReassignHost("controller", vtap.ControllerIP, vtapReassign.ControllerIP, hosts)
+		if err != nil {
+			return model.Vtap{}, err
+		}
+		dbUpdateMap["controller_ip"] = controllerIP
+	}
+	if vtapReassign.AnalyzerIP != "" {
+		hosts, err := getAnalyzerReassignHosts(vtap)
+		if err != nil {
+			return model.Vtap{}, err
+		}
+		analyzerIP, err := selectReassignHost("analyzer", vtap.AnalyzerIP, vtapReassign.AnalyzerIP, hosts)
+		if err != nil {
+			return model.Vtap{}, err
+		}
+		dbUpdateMap["analyzer_ip"] = analyzerIP
+	}
+
+	log.Infof(
+		"reassign vtap (%s) controller_ip from (%s) to (%v), analyzer_ip from (%s) to (%v)",
+		vtap.Name, vtap.ControllerIP, dbUpdateMap["controller_ip"], vtap.AnalyzerIP, dbUpdateMap["analyzer_ip"],
+	)
+	// 递增row_version及config_revision，采集器同步时感知到配置变化后重连新的控制器/数据节点
+	dbUpdateMap["row_version"] = gorm.Expr("row_version + 1")
+	dbUpdateMap["config_revision"] = gorm.Expr("config_revision + 1")
+	if err := mysql.Db.Model(&vtap).Updates(dbUpdateMap).Error; err != nil {
+		return model.Vtap{}, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+
+	refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_VTAP})
+	return getVtapByLcuuid(vtap.Lcuuid)
+}
+
+// selectReassignHost 校验指定节点的容量，targetIP为auto时选择剩余容量最多的可用节点
+func selectReassignHost(hostType, currentIP, targetIP string, hosts []*reassignHost) (string, error) {
+	if targetIP != VTAP_REASSIGN_AUTO {
+		for _, host := range hosts {
+			if host.ip != targetIP {
+				continue
+			}
+			if host.ip == currentIP {
+				return host.ip, nil
+			}
+			if host.state != common.HOST_STATE_COMPLETE {
+				return "", NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("%s (%s) is not available", hostType, targetIP))
+			}
+			if host.vtapNum >= host.vtapMax {
+				return "", NewError(
+					httpcommon.RESOURCE_NUM_EXCEEDED,
+					fmt.Sprintf("%s (%s) vtap num (%d) reached vtap_max (%d)", hostType, targetIP, host.vtapNum, host.vtapMax),
+				)
+			}
+			return host.ip, nil
+		}
+		return "", NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("%s (%s) not found", hostType, targetIP))
+	}
+
+	var candidates []*reassignHost
+	for _, host := range hosts {
+		if !host.connected || host.ip == currentIP || host.state != common.HOST_STATE_COMPLETE {
+			continue
+		}
+		if host.vtapNum >= host.vtapMax {
+			continue
+		}
+		candidates = append(candidates, host)
+	}
+	if len(candidates) == 0 {
+		return "", NewError(httpcommon.RESOURCE_NUM_EXCEEDED, fmt.Sprintf("no available %s to reassign", hostType))
+	}
+	// 剩余容量相同时按IP排序，保证结果稳定
+	sort.Slice(candidates, func(i, j int) bool {
+		iAvailable := candidates[i].vtapMax - candidates[i].vtapNum
+		jAvailable := candidates[j].vtapMax - candidates[j].vtapNum
+		if iAvailable != jAvailable {
+			return iAvailable > jAvailable
+		}
+		return candidates[i].ip < candidates[j].ip
+	})
+	return candidates[0].ip, nil
+}
+
+func getReassignHostVTapNums(column string) (map[string]int, error) {
+	var vtaps []mysql.VTap
+	if err := mysql.Db.Select(column).Where(column + " != ''").Find(&vtaps).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	ipToVTapNum := make(map[string]int)
+	for _, vtap := range vtaps {
+		if column == "controller_ip" {
+			ipToVTapNum[vtap.ControllerIP] += 1
+		} else {
+			ipToVTapNum[vtap.AnalyzerIP] += 1
+		}
+	}
+	return ipToVTapNum, nil
+}
+
+func getControllerReassignHosts(vtap mysql.VTap) ([]*reassignHost, error) {
+	var controllers []mysql.Controller
+	var azControllerConns []mysql.AZControllerConnection
+	if err := mysql.Db.Find(&controllers).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if err := mysql.Db.Where(
+		"az = ? OR (az = ? AND region = ?)", vtap.AZ, "ALL", vtap.Region,
+	).Find(&azControllerConns).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	ipToVTapNum, err := getReassignHostVTapNums("controller_ip")
+	if err != nil {
+		return nil, err
+	}
+
+	connectedIPs := make(map[string]bool)
+	for _, conn := range azControllerConns {
+		connectedIPs[conn.ControllerIP] = true
+	}
+	hosts := make([]*reassignHost, 0, len(controllers))
+	for _, controller := range controllers {
+		hosts = append(hosts, &reassignHost{
+			ip:        controller.IP,
+			state:     controller.State,
+			vtapMax:   controller.VTapMax,
+			vtapNum:   ipToVTapNum[controller.IP],
+			connected: connectedIPs[controller.IP],
+		})
+	}
+	return hosts, nil
+}
+
+func getAnalyzerReassignHosts(vtap mysql.VTap) ([]*reassignHost, error) {
+	var analyzers []mysql.Analyzer
+	var azAnalyzerConns []mysql.AZAnalyzerConnection
+	if err := mysql.Db.Find(&analyzers).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if err := mysql.Db.Where(
+		"az = ? OR (az = ? AND region = ?)", vtap.AZ, "ALL", vtap.Region,
+	).Find(&azAnalyzerConns).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	ipToVTapNum, err := getReassignHostVTapNums("analyzer_ip")
+	if err != nil {
+		return nil, err
+	}
+
+	connectedIPs := make(map[string]bool)
+	for _, conn := range azAnalyzerConns {
+		connectedIPs[conn.AnalyzerIP] = true
+	}
+	hosts := make([]*reassignHost, 0, len(analyzers))
+	for _, analyzer := range analyzers {
+		hosts = append(hosts, &reassignHost{
+			ip:        analyzer.IP,
+			state:     analyzer.State,
+			vtapMax:   analyzer.VTapMax,
+			vtapNum:   ipToVTapNum[analyzer.IP],
+			connected: connectedIPs[analyzer.IP],
+		})
+	}
+	return hosts, nil
+}
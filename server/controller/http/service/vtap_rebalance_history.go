@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"time"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+const (
+	// 未指定发起者时(如定时检查触发的均衡)记录的actor
+	REBALANCE_ACTOR_SYSTEM = "system"
+
+	DEFAULT_REBALANCE_HISTORY_LIMIT = 100
+)
+
+// 记录一次实际执行(非check模式)的采集器均衡，记录失败不影响均衡结果
+func recordVTapRebalanceHistory(hostType, actor string, result *model.VTapRebalanceResult) {
+	if result == nil {
+		return
+	}
+	if actor == "" {
+		actor = REBALANCE_ACTOR_SYSTEM
+	}
+	history := mysql.VTapRebalanceHistory{
+		Type:          hostType,
+		Actor:         actor,
+		SwitchVTapNum: result.TotalSwitchVTapNum,
+	}
+	if err := mysql.Db.Create(&history).Error; err != nil {
+		log.Errorf("record %s rebalance history failed: %s", hostType, err.Error())
+	}
+}
+
+// GetVTapRebalanceHistory 按时间倒序返回均衡记录，filter支持type、start_time、end_time(unix秒)及limit
+func GetVTapRebalanceHistory(filter map[string]interface{}) ([]model.VTapRebalanceHistory, error) {
+	db := mysql.Db
+	if hostType, ok := filter["type"]; ok {
+		db = db.Where("type = ?", hostType)
+	}
+	if startTime, ok := filter["start_time"].(int64); ok {
+		db = db.Where("created_at >= ?", time.Unix(startTime, 0))
+	}
+	if endTime, ok := filter["end_time"].(int64); ok {
+		db = db.Where("created_at <= ?", time.Unix(endTime, 0))
+	}
+	limit := DEFAULT_REBALANCE_HISTORY_LIMIT
+	if value, ok := filter["limit"].(int); ok && value > 0 {
+		limit = value
+	}
+
+	var histories []mysql.VTapRebalanceHistory
+	if err := db.Order("created_at DESC, id DESC").Limit(limit).Find(&histories).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	response := make([]model.VTapRebalanceHistory, 0, len(histories))
+	for _, history := range histories {
+		response = append(response, model.VTapRebalanceHistory{
+			ID:            history.ID,
+			Type:          history.Type,
+			Actor:         history.Actor,
+			SwitchVTapNum: history.SwitchVTapNum,
+			CreatedAt:     history.CreatedAt.Format(common.GO_BIRTHDAY),
+		})
+	}
+	return response, nil
+}
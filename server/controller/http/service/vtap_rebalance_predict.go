@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/http/service/rebalance"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/controller/monitor/config"
+)
+
+// PredictVTapAssignment 按当前的均衡策略预测指定可用区(或launch_server所在可用区)中新增的采集器
+// 会分配到的控制器/数据节点及分配后的负载，不修改任何数据
+func PredictVTapAssignment(args map[string]interface{}, cfg config.IngesterLoadBalancingStrategy) (resp model.VTapAssignmentPrediction, err error) {
+	hostType, _ := args["type"].(string)
+	if hostType == common.HOST_TYPE_ANALYZER && cfg.Algorithm == common.ANALYZER_ALLOC_BY_INGESTED_DATA {
+		return resp, NewError(
+			httpcommon.INVALID_PARAMETERS,
+			fmt.Sprintf("predict analyzer is not supported with algorithm (%s)", cfg.Algorithm),
+		)
+	}
+	var seed *int64
+	if argsSeed, ok := args["seed"].(int64); ok {
+		seed = &argsSeed
+	}
+
+	azLcuuid, _ := args["az"].(string)
+	if launchServer, ok := args["launch_server"].(string); ok && azLcuuid == "" {
+		var host mysql.Host
+		if err := mysql.Db.Where("ip = ?", launchServer).First(&host).Error; err != nil {
+			return resp, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("launch server (%s) not found", launchServer))
+		}
+		azLcuuid = host.AZ
+	}
+	if azLcuuid == "" {
+		return resp, NewError(httpcommon.INVALID_PARAMETERS, "must specify az or launch_server")
+	}
+	var az mysql.AZ
+	if err := mysql.Db.Where("lcuuid = ?", azLcuuid).First(&az).Error; err != nil {
+		return resp, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("az (%s) not found", azLcuuid))
+	}
+	if region, ok := args["region"].(string); ok && region != "" && region != az.Region {
+		return resp, NewError(
+			httpcommon.INVALID_PARAMETERS,
+			fmt.Sprintf("az (%s) is not in region (%s)", azLcuuid, region),
+		)
+	}
+
+	var hosts []*reassignHost
+	switch hostType {
+	case common.HOST_TYPE_CONTROLLER:
+		hosts, err = getAZControllerLoads(az)
+	case common.HOST_TYPE_ANALYZER:
+		hosts, err = getAZAnalyzerLoads(az)
+	default:
+		return resp, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("type (%s) is not supported", hostType))
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	// 与execAZRebalance相同的选择方式：仅考虑状态正常的节点，优先剩余个数最多的节点
+	hostIPToAvailableVTapNum := make(map[string]int, len(hosts))
+	ipToHost := make(map[string]*reassignHost, len(hosts))
+	hostAvailableVTapNum := []common.KVPair{}
+	for _, host := range hosts {
+		hostIPToAvailableVTapNum[host.ip] = host.vtapMax - host.vtapNum
+		ipToHost[host.ip] = host
+	}
+	hostIPs := sortedHostIPs(hostIPToAvailableVTapNum)
+	for _, hostIP := range hostIPs {
+		if ipToHost[hostIP].state == common.HOST_STATE_COMPLETE {
+			hostAvailableVTapNum = append(
+				hostAvailableVTapNum, common.KVPair{Key: hostIP, Value: hostIPToAvailableVTapNum[hostIP]},
+			)
+		}
+	}
+	if len(hostAvailableVTapNum) == 0 {
+		return resp, NewError(
+			httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("no available %s in az (%s)", hostType, azLcuuid),
+		)
+	}
+	host := ipToHost[selectRebalanceHost(hostAvailableVTapNum, hostTieBreakRanks(hostIPs, seed))]
+
+	resp = model.VTapAssignmentPrediction{
+		Type:          hostType,
+		Region:        az.Region,
+		AZ:            az.Lcuuid,
+		IP:            host.ip,
+		BeforeVTapNum: host.vtapNum,
+		AfterVTapNum:  host.vtapNum + 1,
+		VTapMax:       host.vtapMax,
+	}
+	return resp, nil
+}
+
+// 可用区中可分配的控制器及其上属于该可用区的采集器个数，与vtapControllerRebalance的统计方式一致
+func getAZControllerLoads(az mysql.AZ) ([]*reassignHost, error) {
+	var controllers []mysql.Controller
+	var azControllerConns []mysql.AZControllerConnection
+	var vtaps []mysql.VTap
+	if err := mysql.Db.Find(&controllers).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if err := mysql.Db.Find(&azControllerConns).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if err := mysql.Db.Where("az = ? AND controller_ip != ''", az.Lcuuid).Find(&vtaps).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	ipToController := make(map[string]*mysql.Controller)
+	for i, controller := range controllers {
+		ipToController[controller.IP] = &controllers[i]
+	}
+	ipToVTapNum := make(map[string]int)
+	for _, vtap := range vtaps {
+		ipToVTapNum[vtap.ControllerIP] += 1
+	}
+	azToControllers := getAZToControllers(
+		azControllerConns, map[string][]string{az.Region: {az.Lcuuid}}, ipToController,
+	)
+	hosts := []*reassignHost{}
+	for _, controller := range azToControllers[az.Lcuuid] {
+		hosts = append(hosts, &reassignHost{
+			ip:      controller.IP,
+			state:   controller.State,
+			vtapMax: controller.VTapMax,
+			vtapNum: ipToVTapNum[controller.IP],
+		})
+	}
+	return hosts, nil
+}
+
+func getAZAnalyzerLoads(az mysql.AZ) ([]*reassignHost, error) {
+	var analyzers []mysql.Analyzer
+	var azAnalyzerConns []mysql.AZAnalyzerConnection
+	var vtaps []mysql.VTap
+	if err := mysql.Db.Find(&analyzers).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if err := mysql.Db.Find(&azAnalyzerConns).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	if err := mysql.Db.Where("az = ? AND analyzer_ip != ''", az.Lcuuid).Find(&vtaps).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	ipToAnalyzer := make(map[string]*mysql.Analyzer)
+	for i, analyzer := range analyzers {
+		ipToAnalyzer[analyzer.IP] = &analyzers[i]
+	}
+	ipToVTapNum := make(map[string]int)
+	for _, vtap := range vtaps {
+		ipToVTapNum[vtap.AnalyzerIP] += 1
+	}
+	azToAnalyzers := rebalance.GetAZToAnalyzers(
+		azAnalyzerConns, map[string][]string{az.Region: {az.Lcuuid}}, ipToAnalyzer,
+	)
+	hosts := []*reassignHost{}
+	for _, analyzer := range azToAnalyzers[az.Lcuuid] {
+		hosts = append(hosts, &reassignHost{
+			ip:      analyzer.IP,
+			state:   analyzer.State,
+			vtapMax: analyzer.VTapMax,
+			vtapNum: ipToVTapNum[analyzer.IP],
+		})
+	}
+	return hosts, nil
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/config"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+)
+
+// GetVtapSyslogBundle 从采集器对应的数据节点获取其最近days天日志文件的tar.gz，返回内容及下载文件名
+func GetVtapSyslogBundle(lcuuid string, days int, rozeCfg config.Roze) (io.ReadCloser, string, error) {
+	var vtap mysql.VTap
+	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&vtap); ret.Error != nil {
+		return nil, "", NewErrorWithCode(httpcommon.RESOURCE_NOT_FOUND, httpcommon.VTAP_NOT_FOUND, fmt.Sprintf("vtap (%s) not found", lcuuid))
+	}
+	if vtap.AnalyzerIP == "" {
+		return nil, "", NewError(httpcommon.SERVICE_UNAVAILABLE, fmt.Sprintf("vtap (%s) has no analyzer", vtap.Name))
+	}
+
+	// 采集器日志以其控制器IP为文件名写入数据节点
+	bundleURL := fmt.Sprintf(
+		"http://%s:%d/v1/syslog/bundle/?ip=%s&days=%d",
+		common.GetCURLIP(vtap.AnalyzerIP), rozeCfg.SyslogBundlePort, url.QueryEscape(vtap.CtrlIP), days,
+	)
+	log.Infof("get vtap (%s) syslog bundle, url: %s", vtap.Name, bundleURL)
+	client := &http.Client{Timeout: time.Duration(rozeCfg.Timeout) * time.Second}
+	resp, err := client.Get(bundleURL)
+	if err != nil {
+		return nil, "", NewError(httpcommon.SERVICE_UNAVAILABLE, fmt.Sprintf("get syslog bundle from analyzer (%s) failed: %s", vtap.AnalyzerIP, err.Error()))
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		status := httpcommon.SERVER_ERROR
+		switch resp.StatusCode {
+		case http.StatusServiceUnavailable: // 数据节点未开启日志写文件
+			status = httpcommon.SERVICE_UNAVAILABLE
+		case http.StatusNotFound:
+			status = httpcommon.RESOURCE_NOT_FOUND
+		case http.StatusBadRequest:
+			status = httpcommon.INVALID_PARAMETERS
+		}
+		return nil, "", NewError(status, fmt.Sprintf("get vtap (%s) syslog bundle from analyzer (%s) failed: %s", vtap.Name, vtap.AnalyzerIP, strings.TrimSpace(string(message))))
+	}
+	return resp.Body, fmt.Sprintf("%s-syslog-%s.tar.gz", vtap.Name, time.Now().Format("2006-01-02")), nil
+}
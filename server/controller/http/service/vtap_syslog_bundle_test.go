@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/controller/config"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+)
+
+// 模拟数据节点的日志打包接口
+func newStubSyslogBundleServer(files map[string]string, fileLoggingEnabled bool) (*httptest.Server, chan *url.URL) {
+	requests := make(chan *url.URL, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL
+		if !fileLoggingEnabled {
+			http.Error(w, "syslog file logging is disabled", http.StatusServiceUnavailable)
+			return
+		}
+		gw := gzip.NewWriter(w)
+		tw := tar.NewWriter(gw)
+		for name, content := range files {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+			tw.Write([]byte(content))
+		}
+		tw.Close()
+		gw.Close()
+	}))
+	return server, requests
+}
+
+func stubRozeConfig(server *httptest.Server) config.Roze {
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	bundlePort, _ := strconv.Atoi(port)
+	return config.Roze{Timeout: 5, SyslogBundlePort: bundlePort}
+}
+
+func (t *SuiteTest) TestGetVtapSyslogBundle() {
+	vtap := t.createVtap("10.1.1.1")
+	t.db.Model(&vtap).Update("analyzer_ip", "127.0.0.1")
+	files := map[string]string{
+		"10.1.1.1.log":               "today\n",
+		"10.1.1.1.log.2023-05-09.gz": "yesterday\n",
+	}
+	server, requests := newStubSyslogBundleServer(files, true)
+	defer server.Close()
+
+	body, fileName, err := GetVtapSyslogBundle(vtap.Lcuuid, 2, stubRozeConfig(server))
+	if !assert.Nil(t.T(), err) {
+		return
+	}
+	defer body.Close()
+	assert.Contains(t.T(), fileName, "10.1.1.1-syslog-")
+	request := <-requests
+	assert.Equal(t.T(), "/v1/syslog/bundle/", request.Path)
+	assert.Equal(t.T(), "10.1.1.1", request.Query().Get("ip"))
+	assert.Equal(t.T(), "2", request.Query().Get("days"))
+
+	gr, err := gzip.NewReader(body)
+	assert.Nil(t.T(), err)
+	tr := tar.NewReader(gr)
+	contents := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t.T(), err)
+		var buf bytes.Buffer
+		io.Copy(&buf, tr)
+		contents[header.Name] = buf.String()
+	}
+	assert.Equal(t.T(), files, contents)
+}
+
+func (t *SuiteTest) TestGetVtapSyslogBundleFileLoggingDisabled() {
+	vtap := t.createVtap("10.1.1.2")
+	t.db.Model(&vtap).Update("analyzer_ip", "127.0.0.1")
+	server, _ := newStubSyslogBundleServer(nil, false)
+	defer server.Close()
+
+	_, _, err := GetVtapSyslogBundle(vtap.Lcuuid, 1, stubRozeConfig(server))
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.SERVICE_UNAVAILABLE, err.(*ServiceError).Status)
+		assert.Contains(t.T(), err.(*ServiceError).Message, "syslog file logging is disabled")
+	}
+}
+
+func (t *SuiteTest) TestGetVtapSyslogBundleVtapNotFound() {
+	_, _, err := GetVtapSyslogBundle("not-exist", 1, config.Roze{})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.VTAP_NOT_FOUND, err.(*ServiceError).ErrorCode)
+	}
+}
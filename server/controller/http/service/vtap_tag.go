@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+const (
+	VTAP_TAG_MAX_LENGTH = 256
+)
+
+type vtapTagsUpdate struct {
+	// value为nil时删除该tag
+	tags map[string]*string
+	// 为true时先清空已有tag
+	replace bool
+}
+
+// 解析PATCH请求中的TAGS，按merge patch语义合并，value为null时删除该tag, TAGS为null时清空全部tag
+// REPLACE_TAGS为true时用TAGS替换全部tag
+func parseVtapTagsUpdate(vtapUpdate map[string]interface{}) (*vtapTagsUpdate, error) {
+	tagsValue, ok := vtapUpdate["TAGS"]
+	if !ok {
+		return nil, nil
+	}
+	update := &vtapTagsUpdate{tags: make(map[string]*string)}
+	if replace, ok := vtapUpdate["REPLACE_TAGS"].(bool); ok {
+		update.replace = replace
+	}
+	if tagsValue == nil {
+		update.replace = true
+		return update, nil
+	}
+	tags, ok := tagsValue.(map[string]interface{})
+	if !ok {
+		return nil, NewError(httpcommon.INVALID_POST_DATA, "TAGS must be an object")
+	}
+	for key, value := range tags {
+		if key == "" || len(key) > VTAP_TAG_MAX_LENGTH || strings.ContainsAny(key, "=,") {
+			return nil, NewError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("invalid tag key (%s)", key))
+		}
+		if value == nil {
+			update.tags[key] = nil
+			continue
+		}
+		tagValue, ok := value.(string)
+		if !ok || len(tagValue) > VTAP_TAG_MAX_LENGTH {
+			return nil, NewError(httpcommon.INVALID_POST_DATA, fmt.Sprintf("invalid value of tag (%s)", key))
+		}
+		update.tags[key] = &tagValue
+	}
+	return update, nil
+}
+
+func updateVtapTags(db *gorm.DB, vtapID int, update *vtapTagsUpdate) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var keys []string
+		var vtapTags []mysql.VTapTag
+		for key, value := range update.tags {
+			keys = append(keys, key)
+			if value != nil {
+				vtapTags = append(vtapTags, mysql.VTapTag{VTapID: vtapID, Key: key, Value: *value})
+			}
+		}
+		db := tx.Where("vtap_id = ?", vtapID)
+		if !update.replace {
+			if len(keys) == 0 {
+				return nil
+			}
+			db = db.Where("`key` IN (?)", keys)
+		}
+		if err := db.Delete(&mysql.VTapTag{}).Error; err != nil {
+			return err
+		}
+		if len(vtapTags) == 0 {
+			return nil
+		}
+		return tx.Create(&vtapTags).Error
+	})
+}
+
+// 返回包含全部指定tag的采集器ID子查询
+func vtapIDsWithTags(tags map[string]string) *gorm.DB {
+	conditions := make([]string, 0, len(tags))
+	args := make([]interface{}, 0, len(tags)*2)
+	for key, value := range tags {
+		conditions = append(conditions, "(`key` = ? AND `value` = ?)")
+		args = append(args, key, value)
+	}
+	return mysql.Db.Model(&mysql.VTapTag{}).Select("vtap_id").
+		Where(strings.Join(conditions, " OR "), args...).
+		Group("vtap_id").Having("COUNT(*) = ?", len(tags))
+}
+
+func getVtapIDToTags(vtapIDs []int) (map[int]map[string]string, error) {
+	var vtapTags []mysql.VTapTag
+	if err := mysql.Db.Where("vtap_id IN (?)", vtapIDs).Find(&vtapTags).Error; err != nil {
+		return nil, err
+	}
+	vtapIDToTags := make(map[int]map[string]string)
+	for _, vtapTag := range vtapTags {
+		if _, ok := vtapIDToTags[vtapTag.VTapID]; !ok {
+			vtapIDToTags[vtapTag.VTapID] = make(map[string]string)
+		}
+		vtapIDToTags[vtapTag.VTapID][vtapTag.Key] = vtapTag.Value
+	}
+	return vtapIDToTags, nil
+}
+
+// 返回按tag选中的采集器lcuuid，选中个数与EXPECTED_COUNT不一致时拒绝执行，错误信息中返回选中个数
+func resolveVtapLcuuidsByTagSelector(selector model.VtapTagSelector) ([]string, error) {
+	if len(selector.Tags) == 0 {
+		return nil, NewError(httpcommon.INVALID_PARAMETERS, "TAG_SELECTOR must specify TAGS")
+	}
+	var lcuuids []string
+	if err := mysql.Db.Model(&mysql.VTap{}).Where("id IN (?)", vtapIDsWithTags(selector.Tags)).
+		Order("id").Pluck("lcuuid", &lcuuids).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, fmt.Sprintf("get vtaps by tags failed: %s", err))
+	}
+	if selector.ExpectedCount == nil || *selector.ExpectedCount != len(lcuuids) {
+		return nil, NewError(
+			httpcommon.INVALID_PARAMETERS,
+			fmt.Sprintf("TAG_SELECTOR matched %d vtaps, set EXPECTED_COUNT to %d to confirm", len(lcuuids), len(lcuuids)),
+		)
+	}
+	log.Infof("tag selector (%v) matched vtaps: %v", selector.Tags, lcuuids)
+	return lcuuids, nil
+}
+
+// BatchUpdateVtapByTags 将common应用于按tag选中的全部采集器
+func BatchUpdateVtapByTags(selector model.VtapTagSelector, common map[string]interface{}) (resp map[string][]string, err error) {
+	lcuuids, err := resolveVtapLcuuidsByTagSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	updateMap := make([]map[string]interface{}, 0, len(lcuuids))
+	for _, lcuuid := range lcuuids {
+		updateMap = append(updateMap, map[string]interface{}{"LCUUID": lcuuid})
+	}
+	return BatchUpdateVtap(common, updateMap)
+}
+
+// BatchDeleteVtapByTags 删除按tag选中的全部采集器
+func BatchDeleteVtapByTags(selector model.VtapTagSelector) (resp map[string][]string, err error) {
+	lcuuids, err := resolveVtapLcuuidsByTagSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	deleteMap := make([]map[string]string, 0, len(lcuuids))
+	for _, lcuuid := range lcuuids {
+		deleteMap = append(deleteMap, map[string]string{"LCUUID": lcuuid})
+	}
+	return BatchDeleteVtap(deleteMap)
+}
+
+// BatchReassignVtapByTags 将按tag选中的全部采集器迁移到指定的控制器/数据节点
+func BatchReassignVtapByTags(vtapReassign model.VtapBatchReassign) (resp map[string][]string, err error) {
+	lcuuids, err := resolveVtapLcuuidsByTagSelector(vtapReassign.TagSelector)
+	if err != nil {
+		return nil, err
+	}
+	var description string
+	succeedLcuuids := []string{}
+	failedLcuuids := []string{}
+	for _, lcuuid := range lcuuids {
+		if _, _err := ReassignVtap(lcuuid, vtapReassign.VtapReassign); _err != nil {
+			description += _err.Error()
+			failedLcuuids = append(failedLcuuids, lcuuid)
+		} else {
+			succeedLcuuids = append(succeedLcuuids, lcuuid)
+		}
+	}
+
+	response := map[string][]string{
+		"SUCCEED_LCUUID": succeedLcuuids,
+		"FAILED_LCUUID":  failedLcuuids,
+	}
+	if description != "" {
+		return response, NewError(httpcommon.SERVER_ERROR, description)
+	}
+	return response, nil
+}
@@ -0,0 +1,1203 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+	"github.com/deepflowio/deepflow/server/controller/monitor/config"
+)
+
+var testVtapID int
+
+func (t *SuiteTest) createVtap(name string) mysql.VTap {
+	testVtapID++
+	vtap := mysql.VTap{ID: testVtapID, Name: name, Lcuuid: uuid.New().String(), CtrlIP: name}
+	t.db.Create(&vtap)
+	return vtap
+}
+
+func (t *SuiteTest) TestCreateVtapDefaultLicenseType() {
+	vtapGroup := mysql.VTapGroup{Name: "group-1", Lcuuid: uuid.New().String()}
+	t.db.Create(&vtapGroup)
+	monitorCfg := config.MonitorConfig{
+		VTapDefaultLicenseTypes: map[int]int{common.VTAP_TYPE_KVM: common.VTAP_LICENSE_TYPE_A},
+		VTapLicenseLimit:        config.VTapLicenseLimit{TypeA: 1},
+	}
+	newVtapCreate := func(name string, vtapType int) model.VtapCreate {
+		return model.VtapCreate{Name: name, Type: vtapType, CtrlIP: name, VtapGroupLcuuid: vtapGroup.Lcuuid}
+	}
+
+	resp, err := CreateVtap(newVtapCreate("vtap-1", common.VTAP_TYPE_KVM), monitorCfg)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_LICENSE_TYPE_A, resp.LicenseType)
+
+	// 未配置默认授权的采集器类型不分配
+	resp, err = CreateVtap(newVtapCreate("vtap-2", common.VTAP_TYPE_DEDICATED), monitorCfg)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_LICENSE_TYPE_NONE, resp.LicenseType)
+
+	// 授权已达到上限时仍创建采集器，但不分配授权
+	resp, err = CreateVtap(newVtapCreate("vtap-3", common.VTAP_TYPE_KVM), monitorCfg)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_LICENSE_TYPE_NONE, resp.LicenseType)
+	usage, err := GetVtapLicenseUsage(monitorCfg.VTapLicenseLimit)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 1, usage.Details[common.VTAP_LICENSE_TYPE_A].Used)
+	assert.Equal(t.T(), 2, usage.Details[common.VTAP_LICENSE_TYPE_NONE].Used)
+}
+
+func (t *SuiteTest) TestUpdateVtapWithRowVersion() {
+	vtap := t.createVtap("vtap-1")
+
+	resp, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"STATE": float64(0), "ROW_VERSION": float64(vtap.RowVersion),
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 0, resp.State)
+	assert.Equal(t.T(), vtap.RowVersion+1, resp.RowVersion)
+
+	resp, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"STATE": float64(1)})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), vtap.RowVersion+2, resp.RowVersion)
+}
+
+func (t *SuiteTest) TestUpdateVtapWithStaleRowVersion() {
+	vtap := t.createVtap("vtap-1")
+	_, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"STATE": float64(0)})
+	assert.Nil(t.T(), err)
+
+	_, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"STATE": float64(1), "ROW_VERSION": float64(vtap.RowVersion),
+	})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_VERSION_CONFLICT, err.(*ServiceError).Status)
+	}
+
+	var dbVtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+	assert.Equal(t.T(), 0, dbVtap.State)
+	assert.Equal(t.T(), vtap.RowVersion+1, dbVtap.RowVersion)
+}
+
+func (t *SuiteTest) TestQueryVtapsByLcuuids() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.createVtap("vtap-3")
+	missing := uuid.New().String()
+
+	resp, err := QueryVtapsByLcuuids([]string{vtap2.Lcuuid, missing, vtap1.Lcuuid, vtap2.Lcuuid})
+	assert.Nil(t.T(), err)
+	if assert.Equal(t.T(), 2, len(resp.Vtaps)) {
+		assert.Equal(t.T(), vtap2.Lcuuid, resp.Vtaps[0].Lcuuid)
+		assert.Equal(t.T(), vtap1.Lcuuid, resp.Vtaps[1].Lcuuid)
+	}
+	assert.Equal(t.T(), []string{missing}, resp.NotFound)
+}
+
+func (t *SuiteTest) TestGetDataNodeVtaps() {
+	nodeIP := "192.168.0.1"
+	t.db.Create(&mysql.Controller{ID: 1, IP: nodeIP, VTapMax: 100, Lcuuid: uuid.New().String()})
+	t.db.Create(&mysql.Analyzer{ID: 1, IP: nodeIP, VTapMax: 50, Lcuuid: uuid.New().String()})
+
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	vtap3 := t.createVtap("vtap-3")
+	t.db.Model(&vtap1).Updates(map[string]interface{}{"controller_ip": nodeIP, "analyzer_ip": nodeIP})
+	t.db.Model(&vtap2).Updates(map[string]interface{}{"controller_ip": nodeIP, "analyzer_ip": "192.168.0.2"})
+	t.db.Model(&vtap3).Updates(map[string]interface{}{"controller_ip": "192.168.0.2", "analyzer_ip": "192.168.0.2"})
+
+	resp, err := GetDataNodeVtaps(nodeIP)
+	assert.Nil(t.T(), err)
+	lcuuids := []string{}
+	for _, vtap := range resp.Vtaps {
+		lcuuids = append(lcuuids, vtap.Lcuuid)
+	}
+	assert.ElementsMatch(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid}, lcuuids)
+	assert.Equal(t.T(), 2, resp.VtapCount)
+	assert.Equal(t.T(), &model.DataNodeCapacity{VtapCount: 2, VtapMax: 100}, resp.Controller)
+	assert.Equal(t.T(), &model.DataNodeCapacity{VtapCount: 1, VtapMax: 50}, resp.Analyzer)
+
+	_, err = GetDataNodeVtaps("192.168.0.3")
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NOT_FOUND, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestVTapRebalanceSoftLimitWarnings() {
+	azLcuuid := uuid.New().String()
+	t.db.Create(&mysql.AZ{Base: mysql.Base{ID: 1, Lcuuid: azLcuuid}, Name: "az-1"})
+	controllerIPs := []string{"192.168.0.1", "192.168.0.2"}
+	t.db.Create(&mysql.Controller{ID: 1, IP: controllerIPs[0], VTapMax: 10, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	t.db.Create(&mysql.Controller{ID: 2, IP: controllerIPs[1], VTapMax: 20, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	for i, ip := range controllerIPs {
+		t.db.Create(&mysql.AZControllerConnection{ID: i + 1, AZ: azLcuuid, ControllerIP: ip, Lcuuid: uuid.New().String()})
+	}
+	// 均衡前: 控制器1上9个采集器，控制器2上5个采集器；均衡后各7个
+	for i := 0; i < 14; i++ {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i))
+		controllerIP := controllerIPs[0]
+		if i >= 9 {
+			controllerIP = controllerIPs[1]
+		}
+		t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": controllerIP})
+	}
+
+	args := map[string]interface{}{"type": "controller", "check": true}
+	result, err := VTapRebalance(args, config.IngesterLoadBalancingStrategy{ControllerSoftLimitPercent: 60})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 2, result.TotalSwitchVTapNum)
+	// 控制器1: 7 > 10*60%，控制器2: 7 <= 20*60%
+	if assert.Equal(t.T(), 1, len(result.Warnings)) {
+		assert.Equal(t.T(), controllerIPs[0], result.Warnings[0].IP)
+		assert.Equal(t.T(), 7, result.Warnings[0].AfterVTapNum)
+		assert.Equal(t.T(), 6, result.Warnings[0].SoftLimit)
+	}
+
+	result, err = VTapRebalance(args, config.IngesterLoadBalancingStrategy{})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 0, len(result.Warnings))
+}
+
+func (t *SuiteTest) TestPredictVTapAssignment() {
+	azLcuuid := uuid.New().String()
+	t.db.Create(&mysql.AZ{Base: mysql.Base{ID: 1, Lcuuid: azLcuuid}, Name: "az-1", Region: "region-1"})
+	t.db.Create(&mysql.Host{Base: mysql.Base{ID: 1, Lcuuid: uuid.New().String()}, IP: "10.0.0.1", AZ: azLcuuid, Region: "region-1"})
+	controllerIPs := []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"}
+	for i, vtapMax := range []int{10, 10, 3} {
+		t.db.Create(&mysql.Controller{ID: i + 1, IP: controllerIPs[i], VTapMax: vtapMax, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+		t.db.Create(&mysql.AZControllerConnection{ID: i + 1, AZ: azLcuuid, ControllerIP: controllerIPs[i], Lcuuid: uuid.New().String()})
+	}
+	// 控制器1上1个采集器，控制器2上3个采集器，控制器3上没有采集器
+	for i := 0; i < 4; i++ {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i))
+		controllerIP := controllerIPs[1]
+		if i == 0 {
+			controllerIP = controllerIPs[0]
+		}
+		t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": controllerIP})
+	}
+
+	args := map[string]interface{}{"type": "controller", "launch_server": "10.0.0.1"}
+	predicted, err := PredictVTapAssignment(args, config.IngesterLoadBalancingStrategy{})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), controllerIPs[0], predicted.IP)
+	assert.Equal(t.T(), azLcuuid, predicted.AZ)
+	assert.Equal(t.T(), 1, predicted.BeforeVTapNum)
+	assert.Equal(t.T(), 2, predicted.AfterVTapNum)
+	var count int64
+	t.db.Model(&mysql.VTap{}).Count(&count)
+	assert.Equal(t.T(), int64(4), count)
+
+	// 新增同可用区的采集器后执行均衡，新采集器分配到预测的控制器
+	vtap := t.createVtap("vtap-new")
+	t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": controllerIPs[1]})
+	_, err = VTapRebalance(map[string]interface{}{"type": "controller"}, config.IngesterLoadBalancingStrategy{})
+	assert.Nil(t.T(), err)
+	t.db.Where("id = ?", vtap.ID).First(&vtap)
+	assert.Equal(t.T(), predicted.IP, vtap.ControllerIP)
+
+	_, err = PredictVTapAssignment(map[string]interface{}{"type": "controller"}, config.IngesterLoadBalancingStrategy{})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+	}
+	_, err = PredictVTapAssignment(
+		map[string]interface{}{"type": "controller", "az": azLcuuid, "region": "region-2"}, config.IngesterLoadBalancingStrategy{},
+	)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+	}
+	_, err = PredictVTapAssignment(
+		map[string]interface{}{"type": "analyzer", "az": azLcuuid},
+		config.IngesterLoadBalancingStrategy{Algorithm: common.ANALYZER_ALLOC_BY_INGESTED_DATA},
+	)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestPredictVTapAssignmentAnalyzer() {
+	azLcuuid := uuid.New().String()
+	t.db.Create(&mysql.AZ{Base: mysql.Base{ID: 1, Lcuuid: azLcuuid}, Name: "az-1"})
+	t.createReassignHosts(azLcuuid)
+	vtap := t.createVtap("vtap-1")
+	t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "analyzer_ip": "192.168.1.1"})
+
+	// 数据节点1剩余9，数据节点2剩余10
+	predicted, err := PredictVTapAssignment(
+		map[string]interface{}{"type": "analyzer", "az": azLcuuid},
+		config.IngesterLoadBalancingStrategy{Algorithm: common.ANALYZER_ALLOC_BY_AGENT_COUNT},
+	)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "192.168.1.2", predicted.IP)
+	assert.Equal(t.T(), 0, predicted.BeforeVTapNum)
+	assert.Equal(t.T(), 10, predicted.VTapMax)
+}
+
+func (t *SuiteTest) TestVTapRebalanceDeterministic() {
+	azLcuuid := uuid.New().String()
+	t.db.Create(&mysql.AZ{Base: mysql.Base{ID: 1, Lcuuid: azLcuuid}, Name: "az-1"})
+	controllerIPs := []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"}
+	for i, ip := range controllerIPs {
+		t.db.Create(&mysql.Controller{ID: i + 1, IP: ip, VTapMax: 10, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+		t.db.Create(&mysql.AZControllerConnection{ID: i + 1, AZ: azLcuuid, ControllerIP: ip, Lcuuid: uuid.New().String()})
+	}
+	// 全部采集器位于控制器1，控制器2、3剩余个数相同
+	vtaps := []mysql.VTap{}
+	for i := 0; i < 6; i++ {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i))
+		t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": controllerIPs[0]})
+		vtaps = append(vtaps, vtap)
+	}
+	rebalance := func(args map[string]interface{}) map[string]string {
+		for _, vtap := range vtaps {
+			t.db.Model(&mysql.VTap{}).Where("id = ?", vtap.ID).Update("controller_ip", controllerIPs[0])
+		}
+		_, err := VTapRebalance(args, config.IngesterLoadBalancingStrategy{})
+		assert.Nil(t.T(), err)
+		var result []mysql.VTap
+		t.db.Find(&result)
+		nameToControllerIP := make(map[string]string)
+		for _, vtap := range result {
+			nameToControllerIP[vtap.Name] = vtap.ControllerIP
+		}
+		return nameToControllerIP
+	}
+
+	args := map[string]interface{}{"type": "controller", "check": false}
+	assignments := rebalance(args)
+	assert.Equal(t.T(), assignments, rebalance(args))
+	// 剩余个数相同时按IP顺序选择
+	assert.Equal(t.T(), map[string]string{
+		"vtap-0": controllerIPs[0], "vtap-1": controllerIPs[0],
+		"vtap-2": controllerIPs[1], "vtap-3": controllerIPs[2],
+		"vtap-4": controllerIPs[1], "vtap-5": controllerIPs[2],
+	}, assignments)
+
+	args["seed"] = int64(7)
+	assignments = rebalance(args)
+	assert.Equal(t.T(), assignments, rebalance(args))
+}
+
+func (t *SuiteTest) TestBatchUpdateVtapCommon() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	vtap3 := t.createVtap("vtap-3")
+
+	// COMMON中的LCUUID不会应用到未指定LCUUID的项
+	resp, err := BatchUpdateVtap(
+		map[string]interface{}{"LCUUID": vtap1.Lcuuid, "ENABLE": float64(0), "DATA_QUOTA": "10M"},
+		[]map[string]interface{}{
+			{"LCUUID": vtap1.Lcuuid},
+			{"LCUUID": vtap2.Lcuuid},
+			{"LCUUID": vtap3.Lcuuid, "ENABLE": float64(1)},
+			{"DATA_QUOTA": "20M"},
+		},
+	)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid, vtap3.Lcuuid}, resp["SUCCEED_LCUUID"])
+	assert.Empty(t.T(), resp["FAILED_LCUUID"])
+
+	expectedEnable := map[string]int{vtap1.Lcuuid: 0, vtap2.Lcuuid: 0, vtap3.Lcuuid: 1}
+	for lcuuid, enable := range expectedEnable {
+		var vtap mysql.VTap
+		t.db.Where("lcuuid = ?", lcuuid).First(&vtap)
+		assert.Equal(t.T(), enable, vtap.Enable, lcuuid)
+		assert.Equal(t.T(), int64(10*1000*1000), vtap.DataQuota, lcuuid)
+	}
+}
+
+func (t *SuiteTest) TestBatchUpdateVtapLicenseTypeWithinLimit() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	limit := config.VTapLicenseLimit{TypeA: 3}
+
+	resp, err := BatchUpdateVtapLicenseType([]map[string]interface{}{
+		{"LCUUID": vtap1.Lcuuid, "LICENSE_TYPE": float64(common.VTAP_LICENSE_TYPE_A)},
+		{"LCUUID": vtap2.Lcuuid, "LICENSE_TYPE": float64(common.VTAP_LICENSE_TYPE_A)},
+	}, limit)
+	assert.Nil(t.T(), err)
+	assert.ElementsMatch(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid}, resp.SucceedLcuuids)
+	assert.Empty(t.T(), resp.FailedLcuuids)
+	assert.Equal(t.T(), map[int]int{common.VTAP_LICENSE_TYPE_A: 1}, resp.Remaining)
+
+	// 授权类型未变化时不占用新的授权
+	resp, err = BatchUpdateVtapLicenseType([]map[string]interface{}{
+		{"LCUUID": vtap1.Lcuuid, "LICENSE_TYPE": float64(common.VTAP_LICENSE_TYPE_A)},
+	}, limit)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), map[int]int{common.VTAP_LICENSE_TYPE_A: 1}, resp.Remaining)
+}
+
+func (t *SuiteTest) TestBatchUpdateVtapLicenseTypeExceedLimit() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	vtap3 := t.createVtap("vtap-3")
+
+	resp, err := BatchUpdateVtapLicenseType([]map[string]interface{}{
+		{"LCUUID": vtap1.Lcuuid, "LICENSE_TYPE": float64(common.VTAP_LICENSE_TYPE_A)},
+		{"LCUUID": vtap2.Lcuuid, "LICENSE_TYPE": float64(common.VTAP_LICENSE_TYPE_A)},
+		{"LCUUID": vtap3.Lcuuid, "LICENSE_TYPE": float64(common.VTAP_LICENSE_TYPE_A)},
+	}, config.VTapLicenseLimit{TypeA: 2})
+	assert.NotNil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid}, resp.SucceedLcuuids)
+	assert.Equal(t.T(), []string{vtap3.Lcuuid}, resp.FailedLcuuids)
+	assert.Contains(t.T(), resp.Errors, vtap3.Lcuuid)
+	assert.Contains(t.T(), resp.Errors[vtap3.Lcuuid], httpcommon.LICENSE_EXHAUSTED)
+	assert.Equal(t.T(), map[int]int{common.VTAP_LICENSE_TYPE_A: 0}, resp.Remaining)
+
+	var vtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap3.Lcuuid).First(&vtap)
+	assert.Equal(t.T(), common.VTAP_LICENSE_TYPE_NONE, vtap.LicenseType)
+}
+
+func (t *SuiteTest) TestGetVtapLicenseUsage() {
+	licenseTypes := []int{common.VTAP_LICENSE_TYPE_A, common.VTAP_LICENSE_TYPE_A, common.VTAP_LICENSE_TYPE_B}
+	for i, licenseType := range licenseTypes {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i))
+		t.db.Model(&vtap).Update("license_type", licenseType)
+	}
+	t.createVtap("vtap-none")
+
+	resp, err := GetVtapLicenseUsage(config.VTapLicenseLimit{TypeA: 3, TypeB: 1})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 4, resp.Total)
+	assert.Equal(t.T(), []*model.VtapLicenseTypeUsage{
+		{LicenseType: common.VTAP_LICENSE_TYPE_NONE, Used: 1, Available: -1},
+		{LicenseType: common.VTAP_LICENSE_TYPE_A, Used: 2, Limit: 3, Available: 1},
+		{LicenseType: common.VTAP_LICENSE_TYPE_B, Used: 1, Limit: 1, Available: 0},
+		{LicenseType: common.VTAP_LICENSE_TYPE_C, Used: 0, Available: -1},
+		{LicenseType: common.VTAP_LICENSE_TYPE_DEDICATED, Used: 0, Available: -1},
+	}, resp.Details)
+}
+
+func (t *SuiteTest) TestUpdateVtapNotFoundErrorCode() {
+	_, err := UpdateVtap(uuid.New().String(), "", map[string]interface{}{"STATE": float64(0)})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NOT_FOUND, err.(*ServiceError).Status)
+		assert.Equal(t.T(), httpcommon.VTAP_NOT_FOUND, err.(*ServiceError).ErrorCode)
+	}
+
+	_, err = DeleteVtap(uuid.New().String())
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.VTAP_NOT_FOUND, err.(*ServiceError).ErrorCode)
+	}
+}
+
+func (t *SuiteTest) TestUpdateVtapInvalidGroupErrorCode() {
+	vtap := t.createVtap("vtap-1")
+	vtapGroup := mysql.VTapGroup{Name: "group-1", Lcuuid: uuid.New().String()}
+	t.db.Create(&vtapGroup)
+
+	_, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"VTAP_GROUP_LCUUID": uuid.New().String()})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_POST_DATA, err.(*ServiceError).Status)
+		assert.Equal(t.T(), httpcommon.VTAP_GROUP_INVALID, err.(*ServiceError).ErrorCode)
+	}
+
+	resp, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"VTAP_GROUP_LCUUID": vtapGroup.Lcuuid})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), vtapGroup.Lcuuid, resp.VtapGroupLcuuid)
+}
+
+func (t *SuiteTest) TestUpdateVtapTags() {
+	vtap := t.createVtap("vtap-1")
+
+	resp, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"TAGS": map[string]interface{}{"team": "networking", "env": "prod"},
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), map[string]string{"team": "networking", "env": "prod"}, resp.Tags)
+
+	// 合并：null删除tag，其余新增或覆盖
+	resp, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"TAGS": map[string]interface{}{"env": nil, "owner": "alice", "team": "ops"},
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), map[string]string{"team": "ops", "owner": "alice"}, resp.Tags)
+
+	resp, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"TAGS": map[string]interface{}{"env": "test"}, "REPLACE_TAGS": true,
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), map[string]string{"env": "test"}, resp.Tags)
+
+	resp, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"TAGS": nil})
+	assert.Nil(t.T(), err)
+	assert.Empty(t.T(), resp.Tags)
+
+	_, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"TAGS": map[string]interface{}{"a=b": "c"},
+	})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_POST_DATA, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestUpdateVtapStateApprovalOnly() {
+	vtap := t.createVtap("vtap-1")
+
+	// 待审批/已拒绝状态不能通过更新接口设置
+	for _, state := range []int{common.VTAP_STATE_PENDING, common.VTAP_STATE_REJECTED} {
+		_, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"STATE": float64(state)})
+		if assert.IsType(t.T(), &ServiceError{}, err) {
+			assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+			assert.Contains(t.T(), err.(*ServiceError).Message, "approve")
+		}
+	}
+	var dbVtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+	assert.Equal(t.T(), vtap.State, dbVtap.State)
+
+	resp, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"STATE": float64(common.VTAP_STATE_DISABLE)})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_STATE_DISABLE, resp.State)
+}
+
+func (t *SuiteTest) TestUpdateVtapPartialInvalidRollback() {
+	vtap := t.createVtap("vtap-1")
+	t.db.Create(&mysql.VTapTag{VTapID: vtap.ID, Key: "team", Value: "networking"})
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&vtap)
+
+	// 合法字段与非法字段混合时不更新任何字段
+	_, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"STATE":      float64(common.VTAP_STATE_DISABLE),
+		"DATA_QUOTA": "10M",
+		"TAGS":       map[string]interface{}{"team": "ops"},
+		"ENABLE":     float64(5),
+	})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+		assert.Contains(t.T(), err.(*ServiceError).Message, "ENABLE")
+	}
+
+	// 多个字段非法时返回所有错误
+	_, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"STATE":             float64(99),
+		"LICENSE_TYPE":      float64(common.VTAP_LICENSE_TYPE_MAX),
+		"LICENSE_FUNCTIONS": []interface{}{float64(common.VTAP_LICENSE_FUNCTION_TRAFFIC_DISTRIBUTION), "x"},
+		"DATA_QUOTA":        "abc",
+	})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+		for _, key := range []string{"STATE", "LICENSE_TYPE", "LICENSE_FUNCTIONS", "DATA_QUOTA"} {
+			assert.Contains(t.T(), err.(*ServiceError).Message, key)
+		}
+	}
+
+	var dbVtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+	assert.Equal(t.T(), vtap.State, dbVtap.State)
+	assert.Equal(t.T(), vtap.DataQuota, dbVtap.DataQuota)
+	assert.Equal(t.T(), vtap.RowVersion, dbVtap.RowVersion)
+	assert.Equal(t.T(), vtap.ConfigRevision, dbVtap.ConfigRevision)
+	var tags []mysql.VTapTag
+	t.db.Where("vtap_id = ?", vtap.ID).Find(&tags)
+	if assert.Len(t.T(), tags, 1) {
+		assert.Equal(t.T(), "networking", tags[0].Value)
+	}
+
+	resp, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{
+		"STATE":             float64(common.VTAP_STATE_DISABLE),
+		"DATA_QUOTA":        "10M",
+		"TAGS":              map[string]interface{}{"team": "ops"},
+		"LICENSE_FUNCTIONS": []interface{}{float64(common.VTAP_LICENSE_FUNCTION_TRAFFIC_DISTRIBUTION)},
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_STATE_DISABLE, resp.State)
+	assert.Equal(t.T(), int64(10*1000*1000), resp.DataQuota)
+	assert.Equal(t.T(), map[string]string{"team": "ops"}, resp.Tags)
+	assert.Equal(t.T(), vtap.RowVersion+1, resp.RowVersion)
+}
+
+func (t *SuiteTest) TestGetVtapsFilterByTags() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.createVtap("vtap-3")
+	t.db.Create(&[]mysql.VTapTag{
+		{VTapID: vtap1.ID, Key: "team", Value: "networking"},
+		{VTapID: vtap1.ID, Key: "env", Value: "prod"},
+		{VTapID: vtap2.ID, Key: "team", Value: "networking"},
+		{VTapID: vtap2.ID, Key: "env", Value: "test"},
+	})
+	vtapNames := func(vtaps []model.Vtap) []string {
+		names := []string{}
+		for _, vtap := range vtaps {
+			names = append(names, vtap.Name)
+		}
+		return names
+	}
+
+	vtaps, err := GetVtaps(map[string]interface{}{"tags": map[string]string{"team": "networking"}})
+	assert.Nil(t.T(), err)
+	assert.ElementsMatch(t.T(), []string{"vtap-1", "vtap-2"}, vtapNames(vtaps))
+
+	vtaps, err = GetVtaps(map[string]interface{}{"tags": map[string]string{"team": "networking", "env": "prod"}})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{"vtap-1"}, vtapNames(vtaps))
+	assert.Equal(t.T(), map[string]string{"team": "networking", "env": "prod"}, vtaps[0].Tags)
+
+	vtaps, err = GetVtaps(map[string]interface{}{"tags": map[string]string{"env": "dev"}})
+	assert.Nil(t.T(), err)
+	assert.Empty(t.T(), vtaps)
+}
+
+func (t *SuiteTest) TestBatchUpdateVtapByTags() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	vtap3 := t.createVtap("vtap-3")
+	t.db.Create(&[]mysql.VTapTag{
+		{VTapID: vtap1.ID, Key: "team", Value: "networking"},
+		{VTapID: vtap2.ID, Key: "team", Value: "networking"},
+		{VTapID: vtap3.ID, Key: "team", Value: "ops"},
+	})
+	selector := model.VtapTagSelector{Tags: map[string]string{"team": "networking"}}
+	common := map[string]interface{}{"ENABLE": float64(0)}
+
+	// 未确认或确认的个数与选中的不一致时不执行
+	_, err := BatchUpdateVtapByTags(selector, common)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+		assert.Contains(t.T(), err.(*ServiceError).Message, "matched 2 vtaps")
+	}
+	expectedCount := 3
+	selector.ExpectedCount = &expectedCount
+	_, err = BatchUpdateVtapByTags(selector, common)
+	assert.NotNil(t.T(), err)
+	for _, vtap := range []mysql.VTap{vtap1, vtap2, vtap3} {
+		var dbVtap mysql.VTap
+		t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+		assert.Equal(t.T(), 1, dbVtap.Enable, vtap.Name)
+	}
+
+	expectedCount = 2
+	resp, err := BatchUpdateVtapByTags(selector, common)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid}, resp["SUCCEED_LCUUID"])
+	expectedEnable := map[string]int{vtap1.Lcuuid: 0, vtap2.Lcuuid: 0, vtap3.Lcuuid: 1}
+	for lcuuid, enable := range expectedEnable {
+		var dbVtap mysql.VTap
+		t.db.Where("lcuuid = ?", lcuuid).First(&dbVtap)
+		assert.Equal(t.T(), enable, dbVtap.Enable, lcuuid)
+	}
+}
+
+func (t *SuiteTest) TestBatchDeleteVtapByTags() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.db.Create(&[]mysql.VTapTag{
+		{VTapID: vtap1.ID, Key: "env", Value: "test"},
+		{VTapID: vtap2.ID, Key: "env", Value: "prod"},
+	})
+	expectedCount := 1
+	resp, err := BatchDeleteVtapByTags(model.VtapTagSelector{
+		Tags: map[string]string{"env": "test"}, ExpectedCount: &expectedCount,
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap1.Lcuuid}, resp["DELETE_LCUUID"])
+
+	var lcuuids []string
+	t.db.Model(&mysql.VTap{}).Pluck("lcuuid", &lcuuids)
+	assert.Equal(t.T(), []string{vtap2.Lcuuid}, lcuuids)
+}
+
+func (t *SuiteTest) createReassignHosts(azLcuuid string) {
+	t.db.Create(&mysql.Controller{ID: 1, IP: "192.168.0.1", VTapMax: 10, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	t.db.Create(&mysql.Controller{ID: 2, IP: "192.168.0.2", VTapMax: 1, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	t.db.Create(&mysql.Controller{ID: 3, IP: "192.168.0.3", VTapMax: 5, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	t.db.Create(&mysql.Analyzer{ID: 1, IP: "192.168.1.1", VTapMax: 10, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	t.db.Create(&mysql.Analyzer{ID: 2, IP: "192.168.1.2", VTapMax: 10, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+	for i, ip := range []string{"192.168.0.1", "192.168.0.2", "192.168.0.3"} {
+		t.db.Create(&mysql.AZControllerConnection{ID: i + 1, AZ: azLcuuid, ControllerIP: ip, Lcuuid: uuid.New().String()})
+	}
+	for i, ip := range []string{"192.168.1.1", "192.168.1.2"} {
+		t.db.Create(&mysql.AZAnalyzerConnection{ID: i + 1, AZ: azLcuuid, AnalyzerIP: ip, Lcuuid: uuid.New().String()})
+	}
+}
+
+func (t *SuiteTest) TestReassignVtap() {
+	azLcuuid := uuid.New().String()
+	t.createReassignHosts(azLcuuid)
+	vtap := t.createVtap("vtap-1")
+	t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": "192.168.0.1", "analyzer_ip": "192.168.1.1"})
+
+	resp, err := ReassignVtap(vtap.Lcuuid, model.VtapReassign{ControllerIP: "192.168.0.3", AnalyzerIP: "192.168.1.2"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "192.168.0.3", resp.ControllerIP)
+	assert.Equal(t.T(), "192.168.1.2", resp.AnalyzerIP)
+	assert.Equal(t.T(), vtap.RowVersion+1, resp.RowVersion)
+	assert.Equal(t.T(), vtap.ConfigRevision+1, resp.ConfigRevision)
+
+	_, err = ReassignVtap(uuid.New().String(), model.VtapReassign{ControllerIP: "192.168.0.3"})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.VTAP_NOT_FOUND, err.(*ServiceError).ErrorCode)
+	}
+	_, err = ReassignVtap(vtap.Lcuuid, model.VtapReassign{ControllerIP: "192.168.0.9"})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NOT_FOUND, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestBatchReassignVtapByTags() {
+	azLcuuid := uuid.New().String()
+	t.createReassignHosts(azLcuuid)
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	for _, vtap := range []mysql.VTap{vtap1, vtap2} {
+		t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": "192.168.0.1"})
+	}
+	t.db.Create(&[]mysql.VTapTag{
+		{VTapID: vtap1.ID, Key: "env", Value: "test"},
+		{VTapID: vtap2.ID, Key: "env", Value: "test"},
+	})
+	expectedCount := 2
+	resp, err := BatchReassignVtapByTags(model.VtapBatchReassign{
+		TagSelector:  model.VtapTagSelector{Tags: map[string]string{"env": "test"}, ExpectedCount: &expectedCount},
+		VtapReassign: model.VtapReassign{ControllerIP: "192.168.0.3"},
+	})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid}, resp["SUCCEED_LCUUID"])
+	// 迁移后递增config_revision，采集器同步时重连新的控制器
+	for _, vtap := range []mysql.VTap{vtap1, vtap2} {
+		var dbVtap mysql.VTap
+		t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+		assert.Equal(t.T(), "192.168.0.3", dbVtap.ControllerIP, vtap.Name)
+		assert.Equal(t.T(), vtap.ConfigRevision+1, dbVtap.ConfigRevision, vtap.Name)
+	}
+}
+
+func (t *SuiteTest) TestReassignVtapOverCapacity() {
+	azLcuuid := uuid.New().String()
+	t.createReassignHosts(azLcuuid)
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.db.Model(&vtap1).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": "192.168.0.1"})
+	t.db.Model(&vtap2).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": "192.168.0.2"})
+
+	// 控制器2已达到vtap_max，拒绝迁移且不修改原有分配
+	_, err := ReassignVtap(vtap1.Lcuuid, model.VtapReassign{ControllerIP: "192.168.0.2"})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NUM_EXCEEDED, err.(*ServiceError).Status)
+	}
+	var vtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap1.Lcuuid).First(&vtap)
+	assert.Equal(t.T(), "192.168.0.1", vtap.ControllerIP)
+	assert.Equal(t.T(), vtap1.RowVersion, vtap.RowVersion)
+}
+
+func (t *SuiteTest) TestReassignVtapAuto() {
+	azLcuuid := uuid.New().String()
+	t.createReassignHosts(azLcuuid)
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.db.Model(&vtap1).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": "192.168.0.1", "analyzer_ip": "192.168.1.1"})
+	t.db.Model(&vtap2).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": "192.168.0.3", "analyzer_ip": "192.168.1.1"})
+
+	// 排除当前节点，控制器2剩余1、控制器3剩余4，选择控制器3
+	resp, err := ReassignVtap(vtap1.Lcuuid, model.VtapReassign{ControllerIP: VTAP_REASSIGN_AUTO, AnalyzerIP: VTAP_REASSIGN_AUTO})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), "192.168.0.3", resp.ControllerIP)
+	assert.Equal(t.T(), "192.168.1.2", resp.AnalyzerIP)
+
+	// 未与采集器所在可用区连接的节点不参与自动选择
+	vtap3 := t.createVtap("vtap-3")
+	t.db.Model(&vtap3).Updates(map[string]interface{}{"az": uuid.New().String(), "controller_ip": "192.168.0.1"})
+	_, err = ReassignVtap(vtap3.Lcuuid, model.VtapReassign{ControllerIP: VTAP_REASSIGN_AUTO})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NUM_EXCEEDED, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestMigrateDataNodeVtaps() {
+	azLcuuid := uuid.New().String()
+	t.createReassignHosts(azLcuuid)
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	vtap3 := t.createVtap("vtap-3")
+	t.db.Model(&vtap1).Updates(map[string]interface{}{"controller_ip": "192.168.0.1", "analyzer_ip": "192.168.1.1"})
+	t.db.Model(&vtap2).Updates(map[string]interface{}{"controller_ip": "192.168.0.1", "analyzer_ip": "192.168.1.1"})
+	t.db.Model(&vtap3).Updates(map[string]interface{}{"controller_ip": "192.168.0.3", "analyzer_ip": "192.168.1.2"})
+
+	resp, err := MigrateDataNodeVtaps(model.DataNodeMigrate{
+		SourceIP: "192.168.0.1", TargetIP: "192.168.0.3", Type: common.HOST_TYPE_CONTROLLER,
+	})
+	assert.Nil(t.T(), err)
+	assert.ElementsMatch(t.T(), []string{"vtap-1", "vtap-2"}, resp.Migrated)
+
+	var vtaps []mysql.VTap
+	t.db.Where("lcuuid IN ?", []string{vtap1.Lcuuid, vtap2.Lcuuid}).Find(&vtaps)
+	for _, vtap := range vtaps {
+		assert.Equal(t.T(), "192.168.0.3", vtap.ControllerIP)
+		assert.Equal(t.T(), "192.168.1.1", vtap.AnalyzerIP)
+		assert.Equal(t.T(), vtap1.RowVersion+1, vtap.RowVersion)
+		assert.Equal(t.T(), vtap1.ConfigRevision+1, vtap.ConfigRevision)
+	}
+
+	// 源节点上已无采集器
+	resp, err = MigrateDataNodeVtaps(model.DataNodeMigrate{
+		SourceIP: "192.168.0.1", TargetIP: "192.168.0.3", Type: common.HOST_TYPE_CONTROLLER,
+	})
+	assert.Nil(t.T(), err)
+	assert.Empty(t.T(), resp.Migrated)
+
+	_, err = MigrateDataNodeVtaps(model.DataNodeMigrate{
+		SourceIP: "192.168.1.1", TargetIP: "192.168.1.9", Type: common.HOST_TYPE_ANALYZER,
+	})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NOT_FOUND, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestMigrateDataNodeVtapsOverCapacity() {
+	azLcuuid := uuid.New().String()
+	t.createReassignHosts(azLcuuid)
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.db.Model(&vtap1).Updates(map[string]interface{}{"controller_ip": "192.168.0.1"})
+	t.db.Model(&vtap2).Updates(map[string]interface{}{"controller_ip": "192.168.0.1"})
+
+	// 控制器2仅能容纳1个采集器，拒绝迁移且不修改任何采集器
+	_, err := MigrateDataNodeVtaps(model.DataNodeMigrate{
+		SourceIP: "192.168.0.1", TargetIP: "192.168.0.2", Type: common.HOST_TYPE_CONTROLLER,
+	})
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NUM_EXCEEDED, err.(*ServiceError).Status)
+		assert.Contains(t.T(), err.Error(), "vtap-2")
+	}
+	var vtaps []mysql.VTap
+	t.db.Where("lcuuid IN ?", []string{vtap1.Lcuuid, vtap2.Lcuuid}).Find(&vtaps)
+	for _, vtap := range vtaps {
+		assert.Equal(t.T(), "192.168.0.1", vtap.ControllerIP)
+		assert.Equal(t.T(), vtap1.RowVersion, vtap.RowVersion)
+	}
+}
+
+func (t *SuiteTest) TestBatchUpdateVtapMaintenance() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.createVtap("vtap-3")
+
+	resp, err := BatchUpdateVtapMaintenance([]string{vtap1.Lcuuid, vtap2.Lcuuid, "not-exist"}, true)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap1.Lcuuid, vtap2.Lcuuid}, resp.Updated)
+	assert.Equal(t.T(), []string{"not-exist"}, resp.NotFound)
+
+	vtaps, err := GetVtaps(map[string]interface{}{"lcuuid": vtap1.Lcuuid})
+	assert.Nil(t.T(), err)
+	assert.True(t.T(), vtaps[0].Maintenance)
+	assert.Equal(t.T(), vtap1.RowVersion+1, vtaps[0].RowVersion)
+
+	resp, err = BatchUpdateVtapMaintenance([]string{vtap2.Lcuuid}, false)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{vtap2.Lcuuid}, resp.Updated)
+	assert.Empty(t.T(), resp.NotFound)
+}
+
+func (t *SuiteTest) TestGetVtapsFilterByMaintenance() {
+	vtap1 := t.createVtap("vtap-1")
+	t.createVtap("vtap-2")
+	t.createVtap("vtap-3")
+	_, err := BatchUpdateVtapMaintenance([]string{vtap1.Lcuuid}, true)
+	assert.Nil(t.T(), err)
+	vtapNames := func(vtaps []model.Vtap) []string {
+		names := []string{}
+		for _, vtap := range vtaps {
+			names = append(names, vtap.Name)
+		}
+		return names
+	}
+
+	vtaps, err := GetVtaps(map[string]interface{}{"maintenance": true})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{"vtap-1"}, vtapNames(vtaps))
+
+	vtaps, err = GetVtaps(map[string]interface{}{"maintenance": false})
+	assert.Nil(t.T(), err)
+	assert.ElementsMatch(t.T(), []string{"vtap-2", "vtap-3"}, vtapNames(vtaps))
+
+	vtaps, err = GetVtaps(map[string]interface{}{})
+	assert.Nil(t.T(), err)
+	assert.Len(t.T(), vtaps, 3)
+}
+
+func (t *SuiteTest) TestGetVtapsFilterByCIDR() {
+	for name, ips := range map[string][2]string{
+		"vtap-1": {"10.1.0.1", "10.2.0.1"},
+		"vtap-2": {"10.1.0.2", "10.2.1.1"},
+		"vtap-3": {"192.168.0.1", "192.168.1.1"},
+	} {
+		vtap := t.createVtap(name)
+		t.db.Model(&vtap).Updates(map[string]interface{}{"controller_ip": ips[0], "analyzer_ip": ips[1]})
+	}
+	vtapNames := func(vtaps []model.Vtap) []string {
+		names := []string{}
+		for _, vtap := range vtaps {
+			names = append(names, vtap.Name)
+		}
+		return names
+	}
+
+	vtaps, err := GetVtaps(map[string]interface{}{"controller_cidr": "10.1.0.0/16"})
+	assert.Nil(t.T(), err)
+	assert.ElementsMatch(t.T(), []string{"vtap-1", "vtap-2"}, vtapNames(vtaps))
+
+	vtaps, err = GetVtaps(map[string]interface{}{"analyzer_cidr": "192.168.0.0/16"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{"vtap-3"}, vtapNames(vtaps))
+
+	vtaps, err = GetVtaps(map[string]interface{}{"controller_cidr": "10.1.0.0/16", "analyzer_cidr": "10.2.1.0/24"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), []string{"vtap-2"}, vtapNames(vtaps))
+
+	_, err = GetVtaps(map[string]interface{}{"controller_cidr": "10.1.0.0"})
+	assert.NotNil(t.T(), err)
+}
+
+func (t *SuiteTest) TestUpdateVtapDataQuota() {
+	vtap := t.createVtap("vtap-1")
+	t.createVtap("vtap-2")
+
+	resp, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"DATA_QUOTA": float64(1000)})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), int64(1000), resp.DataQuota)
+	assert.Equal(t.T(), 1, resp.ConfigRevision)
+
+	resp, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"DATA_QUOTA": "100Mbps"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), int64(100*1000*1000), resp.DataQuota)
+
+	for _, quota := range []interface{}{float64(-1), float64(1.5), "-1M", "10T", "abc", true} {
+		_, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"DATA_QUOTA": quota})
+		if assert.IsType(t.T(), &ServiceError{}, err, quota) {
+			assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+		}
+	}
+	var dbVtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+	assert.Equal(t.T(), int64(100*1000*1000), dbVtap.DataQuota)
+
+	// 仅设置了配额的采集器返回使用量
+	defer func(getter func() (map[string]int64, error)) { vtapDataUsageGetter = getter }(vtapDataUsageGetter)
+	vtapDataUsageGetter = func() (map[string]int64, error) {
+		return map[string]int64{"vtap-1": 2000, "vtap-2": 3000}, nil
+	}
+	vtaps, err := GetVtaps(map[string]interface{}{"data_usage": true})
+	assert.Nil(t.T(), err)
+	for _, v := range vtaps {
+		if v.Name == "vtap-1" {
+			if assert.NotNil(t.T(), v.DataUsage) {
+				assert.Equal(t.T(), int64(2000), *v.DataUsage)
+			}
+		} else {
+			assert.Nil(t.T(), v.DataUsage)
+		}
+	}
+}
+
+func (t *SuiteTest) TestAckVtapConfigRevision() {
+	vtap := t.createVtap("vtap-1")
+	t.db.Model(&vtap).Update("vtap_group_lcuuid", "group-1")
+	t.createVtap("vtap-2")
+	increaseVtapConfigRevision("group-1")
+	increaseVtapConfigRevision("group-1")
+
+	resp, err := AckVtapConfigRevision(vtap.Lcuuid, 1)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 2, resp.ConfigRevision)
+	assert.Equal(t.T(), 1, resp.AckedConfigRevision)
+
+	// 未应用最新配置的采集器在列表中可见
+	vtaps, err := GetVtaps(map[string]interface{}{})
+	assert.Nil(t.T(), err)
+	revisions := map[string][2]int{}
+	for _, v := range vtaps {
+		revisions[v.Name] = [2]int{v.ConfigRevision, v.AckedConfigRevision}
+	}
+	assert.Equal(t.T(), map[string][2]int{"vtap-1": {2, 1}, "vtap-2": {0, 0}}, revisions)
+
+	resp, err = AckVtapConfigRevision(vtap.Lcuuid, 2)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), resp.ConfigRevision, resp.AckedConfigRevision)
+
+	_, err = AckVtapConfigRevision(vtap.Lcuuid, 3)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+	}
+	_, err = AckVtapConfigRevision(uuid.New().String(), 0)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.VTAP_NOT_FOUND, err.(*ServiceError).ErrorCode)
+	}
+}
+
+func (t *SuiteTest) TestVTapRebalanceHistory() {
+	azLcuuid := uuid.New().String()
+	t.db.Create(&mysql.AZ{Base: mysql.Base{ID: 1, Lcuuid: azLcuuid}, Name: "az-1"})
+	controllerIPs := []string{"192.168.0.1", "192.168.0.2"}
+	for i, ip := range controllerIPs {
+		t.db.Create(&mysql.Controller{ID: i + 1, IP: ip, VTapMax: 10, State: common.HOST_STATE_COMPLETE, Lcuuid: uuid.New().String()})
+		t.db.Create(&mysql.AZControllerConnection{ID: i + 1, AZ: azLcuuid, ControllerIP: ip, Lcuuid: uuid.New().String()})
+	}
+	for i := 0; i < 4; i++ {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i))
+		t.db.Model(&vtap).Updates(map[string]interface{}{"az": azLcuuid, "controller_ip": controllerIPs[0]})
+	}
+
+	// check模式不记录
+	_, err := VTapRebalance(map[string]interface{}{"type": "controller", "check": true}, config.IngesterLoadBalancingStrategy{})
+	assert.Nil(t.T(), err)
+	histories, err := GetVTapRebalanceHistory(map[string]interface{}{})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 0, len(histories))
+
+	result, err := VTapRebalance(map[string]interface{}{"type": "controller", "actor": "alice"}, config.IngesterLoadBalancingStrategy{})
+	assert.Nil(t.T(), err)
+	histories, err = GetVTapRebalanceHistory(map[string]interface{}{"type": "controller"})
+	assert.Nil(t.T(), err)
+	if assert.Equal(t.T(), 1, len(histories)) {
+		assert.Equal(t.T(), "controller", histories[0].Type)
+		assert.Equal(t.T(), "alice", histories[0].Actor)
+		assert.Equal(t.T(), result.TotalSwitchVTapNum, histories[0].SwitchVTapNum)
+	}
+
+	histories, err = GetVTapRebalanceHistory(map[string]interface{}{"type": "analyzer"})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 0, len(histories))
+
+	now := time.Now().Unix()
+	histories, err = GetVTapRebalanceHistory(map[string]interface{}{"start_time": now - 60, "end_time": now + 60})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 1, len(histories))
+	histories, err = GetVTapRebalanceHistory(map[string]interface{}{"start_time": now + 3600})
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), 0, len(histories))
+}
+
+func (t *SuiteTest) TestGetVTapGroupEffectiveConfig() {
+	vtapGroup := mysql.VTapGroup{Name: "group-1", Lcuuid: uuid.New().String()}
+	t.db.Create(&vtapGroup)
+	maxTxBandwidth := int64(100000000)
+	configLcuuid := uuid.New().String()
+	t.db.Create(&mysql.VTapGroupConfiguration{VTapGroupLcuuid: &vtapGroup.Lcuuid, MaxTxBandwidth: &maxTxBandwidth, Lcuuid: &configLcuuid})
+	// vtap-1配额小于组配置，vtap-2配额大于组配置，vtap-3未设置配额
+	quotas := []int64{50000000, 200000000, 0}
+	vtaps := []mysql.VTap{}
+	for i, quota := range quotas {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i+1))
+		t.db.Model(&vtap).Updates(map[string]interface{}{"vtap_group_lcuuid": vtapGroup.Lcuuid, "data_quota": quota})
+		vtaps = append(vtaps, vtap)
+	}
+	otherVtap := t.createVtap("vtap-other")
+	t.db.Model(&otherVtap).Update("data_quota", 1000000)
+
+	resp, err := GetVTapGroupEffectiveConfig(vtapGroup.Lcuuid)
+	assert.Nil(t.T(), err)
+	// 组配置覆盖默认值，未配置的项使用默认值
+	assert.Equal(t.T(), int64(100), *resp.Config.MaxTxBandwidth)
+	assert.Equal(t.T(), *common.DefaultVTapGroupConfig.MaxCollectPps, *resp.Config.MaxCollectPps)
+	if assert.Equal(t.T(), 1, len(resp.VTapOverrides["MAX_TX_BANDWIDTH"])) {
+		override := resp.VTapOverrides["MAX_TX_BANDWIDTH"][0]
+		assert.Equal(t.T(), vtaps[0].Lcuuid, override.VTapLcuuid)
+		assert.Equal(t.T(), "vtap-1", override.VTapName)
+		assert.Equal(t.T(), int64(50), override.Value)
+	}
+
+	// 组未配置发送带宽时，设置了配额的采集器都覆盖该项
+	t.db.Model(&mysql.VTapGroupConfiguration{}).Where("vtap_group_lcuuid = ?", vtapGroup.Lcuuid).Update("max_tx_bandwidth", nil)
+	resp, err = GetVTapGroupEffectiveConfig(vtapGroup.Lcuuid)
+	assert.Nil(t.T(), err)
+	overrideLcuuids := []string{}
+	for _, override := range resp.VTapOverrides["MAX_TX_BANDWIDTH"] {
+		overrideLcuuids = append(overrideLcuuids, override.VTapLcuuid)
+	}
+	assert.Equal(t.T(), []string{vtaps[0].Lcuuid, vtaps[1].Lcuuid}, overrideLcuuids)
+
+	_, err = GetVTapGroupEffectiveConfig(uuid.New().String())
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.RESOURCE_NOT_FOUND, err.(*ServiceError).Status)
+	}
+}
+
+func (t *SuiteTest) TestGetVTapGroupEffectiveConfigTemplate() {
+	vtapGroup := mysql.VTapGroup{Name: "group-1", Lcuuid: uuid.New().String()}
+	t.db.Create(&vtapGroup)
+	analyzerIP := "collector.${region}.example.com"
+	configLcuuid := uuid.New().String()
+	t.db.Create(&mysql.VTapGroupConfiguration{VTapGroupLcuuid: &vtapGroup.Lcuuid, AnalyzerIP: &analyzerIP, Lcuuid: &configLcuuid})
+	for i, region := range []string{"region-1", "region-2"} {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i+1))
+		t.db.Model(&vtap).Updates(map[string]interface{}{"vtap_group_lcuuid": vtapGroup.Lcuuid, "region": region})
+	}
+
+	resp, err := GetVTapGroupEffectiveConfig(vtapGroup.Lcuuid)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), analyzerIP, *resp.Config.AnalyzerIP)
+	values := []interface{}{}
+	for _, override := range resp.VTapOverrides["ANALYZER_IP"] {
+		values = append(values, override.Value)
+	}
+	assert.Equal(t.T(), []interface{}{"collector.region-1.example.com", "collector.region-2.example.com"}, values)
+	assert.Empty(t.T(), resp.VTapOverrides["PROXY_CONTROLLER_IP"])
+}
+
+func (t *SuiteTest) TestVTapGroupConfigRejectUnsupportedTemplate() {
+	vtapGroup := mysql.VTapGroup{Name: "group-1", Lcuuid: uuid.New().String()}
+	t.db.Create(&vtapGroup)
+	analyzerIP := "collector.${hostname}.example.com"
+	_, err := CreateVTapGroupConfig(&model.VTapGroupConfiguration{VTapGroupLcuuid: &vtapGroup.Lcuuid, AnalyzerIP: &analyzerIP})
+	assert.EqualError(t.T(), err, "config template variables [hostname] unsupported")
+	var count int64
+	t.db.Model(&mysql.VTapGroupConfiguration{}).Where("vtap_group_lcuuid = ?", vtapGroup.Lcuuid).Count(&count)
+	assert.Equal(t.T(), int64(0), count)
+
+	analyzerIP = "collector.${region}.example.com"
+	dbConfig, err := CreateVTapGroupConfig(&model.VTapGroupConfiguration{VTapGroupLcuuid: &vtapGroup.Lcuuid, AnalyzerIP: &analyzerIP})
+	assert.Nil(t.T(), err)
+	proxyControllerIP := "${controller}"
+	_, err = UpdateVTapGroupConfig(*dbConfig.Lcuuid, &model.VTapGroupConfiguration{ProxyControllerIP: &proxyControllerIP})
+	assert.EqualError(t.T(), err, "config template variables [controller] unsupported")
+	var saved mysql.VTapGroupConfiguration
+	t.db.Where("lcuuid = ?", *dbConfig.Lcuuid).First(&saved)
+	assert.Nil(t.T(), saved.ProxyControllerIP)
+}
+
+func (t *SuiteTest) TestGetVtapsByRegionAndAZ() {
+	regionLcuuids := []string{uuid.New().String(), uuid.New().String()}
+	azLcuuids := []string{uuid.New().String(), uuid.New().String(), uuid.New().String()}
+	// 宿主机、云服务器位于区域1的不同可用区，容器节点位于区域2
+	t.db.Create(&mysql.Host{Base: mysql.Base{ID: 1, Lcuuid: uuid.New().String()}, IP: "10.0.0.1", Region: regionLcuuids[0], AZ: azLcuuids[0]})
+	t.db.Create(&mysql.VM{Base: mysql.Base{ID: 1, Lcuuid: uuid.New().String()}, Region: regionLcuuids[0], AZ: azLcuuids[1]})
+	t.db.Create(&mysql.PodNode{Base: mysql.Base{ID: 1, Lcuuid: uuid.New().String()}, IP: "10.0.0.3", Region: regionLcuuids[1], AZ: azLcuuids[2]})
+	vtapNames := []string{}
+	for i, vtapType := range []int{common.VTAP_TYPE_KVM, common.VTAP_TYPE_WORKLOAD_V, common.VTAP_TYPE_POD_VM} {
+		vtap := t.createVtap(fmt.Sprintf("vtap-%d", i+1))
+		// launch server ID相同，按采集器类型关联不同的资源
+		t.db.Model(&vtap).Updates(map[string]interface{}{"type": vtapType, "launch_server_id": 1})
+		vtapNames = append(vtapNames, vtap.Name)
+	}
+	getNames := func(filter map[string]interface{}) []string {
+		vtaps, err := GetVtaps(filter)
+		assert.Nil(t.T(), err)
+		names := []string{}
+		for _, vtap := range vtaps {
+			names = append(names, vtap.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t.T(), vtapNames[:2], getNames(map[string]interface{}{"region": regionLcuuids[0]}))
+	assert.ElementsMatch(t.T(), vtapNames[2:], getNames(map[string]interface{}{"region": regionLcuuids[1]}))
+	assert.ElementsMatch(t.T(), vtapNames[1:2], getNames(map[string]interface{}{"region": regionLcuuids[0], "az": azLcuuids[1]}))
+	assert.Empty(t.T(), getNames(map[string]interface{}{"region": regionLcuuids[1], "az": azLcuuids[0]}))
+}
+
+func (t *SuiteTest) TestApproveVtap() {
+	vtap := t.createVtap("vtap-1")
+	t.db.Model(&vtap).Updates(map[string]interface{}{"state": common.VTAP_STATE_PENDING})
+
+	resp, err := ApproveVtap(vtap.Lcuuid)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_STATE_NORMAL, resp.State)
+	var dbVtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+	assert.Equal(t.T(), common.VTAP_ENABLE_TRUE, dbVtap.Enable)
+	assert.Equal(t.T(), vtap.ConfigRevision+1, dbVtap.ConfigRevision)
+	assert.Equal(t.T(), vtap.RowVersion+1, dbVtap.RowVersion)
+
+	// 已审批通过的采集器不能重复审批
+	_, err = ApproveVtap(vtap.Lcuuid)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+	}
+
+	_, err = ApproveVtap(uuid.New().String())
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.VTAP_NOT_FOUND, err.(*ServiceError).ErrorCode)
+	}
+}
+
+func (t *SuiteTest) TestRejectVtap() {
+	vtap := t.createVtap("vtap-1")
+	t.db.Model(&vtap).Updates(map[string]interface{}{"state": common.VTAP_STATE_PENDING})
+
+	resp, err := RejectVtap(vtap.Lcuuid)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_STATE_REJECTED, resp.State)
+	var dbVtap mysql.VTap
+	t.db.Where("lcuuid = ?", vtap.Lcuuid).First(&dbVtap)
+	assert.Equal(t.T(), common.VTAP_ENABLE_FALSE, dbVtap.Enable)
+
+	_, err = RejectVtap(vtap.Lcuuid)
+	if assert.IsType(t.T(), &ServiceError{}, err) {
+		assert.Equal(t.T(), httpcommon.INVALID_PARAMETERS, err.(*ServiceError).Status)
+	}
+
+	// 已拒绝的采集器可重新审批通过
+	resp, err = ApproveVtap(vtap.Lcuuid)
+	assert.Nil(t.T(), err)
+	assert.Equal(t.T(), common.VTAP_STATE_NORMAL, resp.State)
+}
+
+func (t *SuiteTest) TestGetVtapsFilterByPendingState() {
+	vtap1 := t.createVtap("vtap-1")
+	vtap2 := t.createVtap("vtap-2")
+	t.createVtap("vtap-3")
+	t.db.Model(&vtap1).Updates(map[string]interface{}{"state": common.VTAP_STATE_PENDING})
+	t.db.Model(&vtap2).Updates(map[string]interface{}{"state": common.VTAP_STATE_PENDING})
+
+	vtaps, err := GetVtaps(map[string]interface{}{"state": common.VTAP_STATE_PENDING})
+	assert.Nil(t.T(), err)
+	names := []string{}
+	for _, vtap := range vtaps {
+		names = append(names, vtap.Name)
+	}
+	assert.ElementsMatch(t.T(), []string{"vtap-1", "vtap-2"}, names)
+
+	_, err = ApproveVtap(vtap1.Lcuuid)
+	assert.Nil(t.T(), err)
+	vtaps, err = GetVtaps(map[string]interface{}{"state": common.VTAP_STATE_PENDING})
+	assert.Nil(t.T(), err)
+	if assert.Len(t.T(), vtaps, 1) {
+		assert.Equal(t.T(), "vtap-2", vtaps[0].Name)
+	}
+}
+
+func (t *SuiteTest) TestUpdateVtapDisableDeletesKubernetesClusterInTransaction() {
+	vtap := t.createVtap("vtap-1")
+	key := vtap.CtrlIP + "-" + vtap.CtrlMac
+	t.db.Create(&mysql.KubernetesCluster{ClusterID: "cluster-1", Value: key})
+
+	// 版本冲突时整体回滚，不删除kubernetes cluster
+	_, err := UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"ENABLE": float64(0), "ROW_VERSION": float64(100)})
+	assert.NotNil(t.T(), err)
+	var count int64
+	t.db.Model(&mysql.KubernetesCluster{}).Where("value = ?", key).Count(&count)
+	assert.Equal(t.T(), int64(1), count)
+
+	_, err = UpdateVtap(vtap.Lcuuid, "", map[string]interface{}{"ENABLE": float64(0)})
+	assert.Nil(t.T(), err)
+	t.db.Model(&mysql.KubernetesCluster{}).Where("value = ?", key).Count(&count)
+	assert.Equal(t.T(), int64(0), count)
+}
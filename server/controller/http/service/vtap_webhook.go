@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+
+	"github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	httpcommon "github.com/deepflowio/deepflow/server/controller/http/common"
+	. "github.com/deepflowio/deepflow/server/controller/http/service/common"
+	"github.com/deepflowio/deepflow/server/controller/model"
+)
+
+func convertVTapWebhook(webhook *mysql.VTapWebhook) model.VTapWebhook {
+	return model.VTapWebhook{
+		ID:        webhook.ID,
+		Name:      webhook.Name,
+		URL:       webhook.URL,
+		Signed:    webhook.Secret != "",
+		Lcuuid:    webhook.Lcuuid,
+		CreatedAt: webhook.CreatedAt.Format(common.GO_BIRTHDAY),
+	}
+}
+
+// CreateVTapWebhook 注册采集器连接状态变化的webhook，url仅支持http/https
+func CreateVTapWebhook(webhookCreate model.VTapWebhookCreate) (model.VTapWebhook, error) {
+	u, err := url.Parse(webhookCreate.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return model.VTapWebhook{}, NewError(httpcommon.INVALID_PARAMETERS, fmt.Sprintf("invalid webhook url (%s)", webhookCreate.URL))
+	}
+	var count int64
+	mysql.Db.Model(&mysql.VTapWebhook{}).Where("name = ?", webhookCreate.Name).Count(&count)
+	if count > 0 {
+		return model.VTapWebhook{}, NewError(httpcommon.RESOURCE_ALREADY_EXIST, fmt.Sprintf("webhook (%s) already exist", webhookCreate.Name))
+	}
+
+	webhook := mysql.VTapWebhook{
+		Name:   webhookCreate.Name,
+		URL:    webhookCreate.URL,
+		Secret: webhookCreate.Secret,
+		Lcuuid: uuid.New().String(),
+	}
+	if err := mysql.Db.Create(&webhook).Error; err != nil {
+		return model.VTapWebhook{}, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	log.Infof("create vtap webhook (%s) to %s", webhook.Name, webhook.URL)
+	return convertVTapWebhook(&webhook), nil
+}
+
+func GetVTapWebhooks() ([]model.VTapWebhook, error) {
+	var webhooks []mysql.VTapWebhook
+	if err := mysql.Db.Order("id").Find(&webhooks).Error; err != nil {
+		return nil, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	response := make([]model.VTapWebhook, 0, len(webhooks))
+	for i := range webhooks {
+		response = append(response, convertVTapWebhook(&webhooks[i]))
+	}
+	return response, nil
+}
+
+func DeleteVTapWebhook(lcuuid string) (map[string]string, error) {
+	var webhook mysql.VTapWebhook
+	if ret := mysql.Db.Where("lcuuid = ?", lcuuid).First(&webhook); ret.Error != nil {
+		return map[string]string{}, NewError(httpcommon.RESOURCE_NOT_FOUND, fmt.Sprintf("webhook (%s) not found", lcuuid))
+	}
+	log.Infof("delete vtap webhook (%s)", webhook.Name)
+	if err := mysql.Db.Delete(&webhook).Error; err != nil {
+		return map[string]string{}, NewError(httpcommon.SERVER_ERROR, err.Error())
+	}
+	return map[string]string{"LCUUID": lcuuid}, nil
+}
@@ -116,57 +116,124 @@ type VtapCreate struct {
 }
 
 type VtapUpdate struct {
-	Lcuuid           string `json:"LCUUID"`
-	Enable           int    `json:"ENABLE"`
-	State            int    `json:"STATE"`
-	VtapGroupLcuuid  string `json:"VTAP_GROUP_LCUUID"`
-	LicenseType      int    `json:"LICENSE_TYPE"`
-	LicenseFunctions []int  `json:"LICENSE_FUNCTIONS"`
+	Lcuuid           string             `json:"LCUUID"`
+	Enable           int                `json:"ENABLE"`
+	State            int                `json:"STATE"`
+	VtapGroupLcuuid  string             `json:"VTAP_GROUP_LCUUID"`
+	LicenseType      int                `json:"LICENSE_TYPE"`
+	LicenseFunctions []int              `json:"LICENSE_FUNCTIONS"`
+	RowVersion       int                `json:"ROW_VERSION"`
+	Tags             map[string]*string `json:"TAGS"` // null value deletes the tag
+	ReplaceTags      bool               `json:"REPLACE_TAGS"`
+}
+
+// 批量更新采集器，COMMON中的字段应用于DATA中的每一项，同名字段以DATA中的为准
+// 指定TAG_SELECTOR时不需要DATA，COMMON应用于选中的全部采集器
+type VtapBatchUpdate struct {
+	Common      *VtapUpdate      `json:"COMMON"`
+	Data        []VtapUpdate     `json:"DATA"`
+	TagSelector *VtapTagSelector `json:"TAG_SELECTOR"`
+}
+
+// 按tag选择批量操作的采集器，需包含全部TAGS
+// EXPECTED_COUNT需与选中的采集器个数一致才会执行，避免误操作大量采集器
+type VtapTagSelector struct {
+	Tags          map[string]string `json:"TAGS"`
+	ExpectedCount *int              `json:"EXPECTED_COUNT"`
 }
 
 type Vtap struct {
-	ID                 int     `json:"ID"`
-	Name               string  `json:"NAME"`
-	State              int     `json:"STATE"`
-	Enable             int     `json:"ENABLE"`
-	LaunchServer       string  `json:"LAUNCH_SERVER"`
-	LaunchServerID     int     `json:"LAUNCH_SERVER_ID"`
-	Type               int     `json:"TYPE"`
-	CtrlIP             string  `json:"CTRL_IP"`
-	CtrlMac            string  `json:"CTRL_MAC"`
-	ControllerIP       string  `json:"CONTROLLER_IP"`
-	AnalyzerIP         string  `json:"ANALYZER_IP"`
-	CurControllerIP    string  `json:"CUR_CONTROLLER_IP"`
-	CurAnalyzerIP      string  `json:"CUR_ANALYZER_IP"`
-	SyncedControllerAt string  `json:"SYNCED_CONTROLLER_AT"`
-	SyncedAnalyzerAt   string  `json:"SYNCED_ANALYZER_AT"`
-	BootTime           int     `json:"BOOT_TIME"`
-	Revision           string  `json:"REVISION"`
-	CompleteRevision   string  `json:"COMPLETE_REVISION"`
-	Exceptions         []int64 `json:"EXCEPTIONS"`
-	VtapGroupLcuuid    string  `json:"VTAP_GROUP_LCUUID"`
-	VtapGroupName      string  `json:"VTAP_GROUP_NAME"`
-	AZ                 string  `json:"AZ"`
-	AZName             string  `json:"AZ_NAME"`
-	Region             string  `json:"REGION"`
-	RegionName         string  `json:"REGION_NAME"`
-	CPUNum             int     `json:"CPU_NUM"`
-	MemorySize         int64   `json:"MEMORY_SIZE"`
-	Arch               string  `json:"ARCH"`
-	ArchType           int     `json:"ARCH_TYPE"`
-	Os                 string  `json:"OS"`
-	OsType             int     `json:"OS_TYPE"`
-	KernelVersion      string  `json:"KERNEL_VERSION"`
-	ProcessName        string  `json:"PROCESS_NAME"`
-	LicenseType        int     `json:"LICENSE_TYPE"`
-	LicenseFunctions   []int   `json:"LICENSE_FUNCTIONS"`
-	ExpectedRevision   string  `json:"EXPECTED_REVISION"`
-	UpgradePackage     string  `json:"UPGRADE_PACKAGE"`
-	TapMode            int     `json:"TAP_MODE"`
-	Lcuuid             string  `json:"LCUUID"`
+	ID                  int     `json:"ID"`
+	Name                string  `json:"NAME"`
+	State               int     `json:"STATE"`
+	Enable              int     `json:"ENABLE"`
+	LaunchServer        string  `json:"LAUNCH_SERVER"`
+	LaunchServerID      int     `json:"LAUNCH_SERVER_ID"`
+	Type                int     `json:"TYPE"`
+	CtrlIP              string  `json:"CTRL_IP"`
+	CtrlMac             string  `json:"CTRL_MAC"`
+	ControllerIP        string  `json:"CONTROLLER_IP"`
+	AnalyzerIP          string  `json:"ANALYZER_IP"`
+	CurControllerIP     string  `json:"CUR_CONTROLLER_IP"`
+	CurAnalyzerIP       string  `json:"CUR_ANALYZER_IP"`
+	SyncedControllerAt  string  `json:"SYNCED_CONTROLLER_AT"`
+	SyncedAnalyzerAt    string  `json:"SYNCED_ANALYZER_AT"`
+	BootTime            int     `json:"BOOT_TIME"`
+	Revision            string  `json:"REVISION"`
+	CompleteRevision    string  `json:"COMPLETE_REVISION"`
+	Exceptions          []int64 `json:"EXCEPTIONS"`
+	VtapGroupLcuuid     string  `json:"VTAP_GROUP_LCUUID"`
+	VtapGroupName       string  `json:"VTAP_GROUP_NAME"`
+	AZ                  string  `json:"AZ"`
+	AZName              string  `json:"AZ_NAME"`
+	Region              string  `json:"REGION"`
+	RegionName          string  `json:"REGION_NAME"`
+	CPUNum              int     `json:"CPU_NUM"`
+	MemorySize          int64   `json:"MEMORY_SIZE"`
+	Arch                string  `json:"ARCH"`
+	ArchType            int     `json:"ARCH_TYPE"`
+	Os                  string  `json:"OS"`
+	OsType              int     `json:"OS_TYPE"`
+	KernelVersion       string  `json:"KERNEL_VERSION"`
+	ProcessName         string  `json:"PROCESS_NAME"`
+	LicenseType         int     `json:"LICENSE_TYPE"`
+	LicenseFunctions    []int   `json:"LICENSE_FUNCTIONS"`
+	ExpectedRevision    string  `json:"EXPECTED_REVISION"`
+	UpgradePackage      string  `json:"UPGRADE_PACKAGE"`
+	TapMode             int     `json:"TAP_MODE"`
+	RowVersion          int     `json:"ROW_VERSION"`
+	Maintenance         bool    `json:"MAINTENANCE"`
+	ConfigRevision      int     `json:"CONFIG_REVISION"`
+	AckedConfigRevision int     `json:"ACKED_CONFIG_REVISION"` // 与CONFIG_REVISION不一致时说明采集器尚未应用最新配置
+	DataQuota           int64   `json:"DATA_QUOTA"`            // 单位bps，0表示不限制
+	DataUsage           *int64  `json:"DATA_USAGE,omitempty"`  // 单位bps，仅设置了配额的采集器返回
+	Lcuuid              string  `json:"LCUUID"`
 	// TODO: format_state
 	// TODO: format_type
 	// TODO: format_exceptions
+
+	Tags map[string]string `json:"TAGS"`
+}
+
+type VtapQuery struct {
+	Lcuuids []string `json:"LCUUIDS" binding:"required"`
+}
+
+type VtapQueryResult struct {
+	Vtaps    []Vtap   `json:"VTAPS"`
+	NotFound []string `json:"NOT_FOUND"`
+}
+
+type VtapLicenseTypeBatchUpdateResult struct {
+	SucceedLcuuids []string          `json:"SUCCEED_LCUUID"`
+	FailedLcuuids  []string          `json:"FAILED_LCUUID"`
+	Errors         map[string]string `json:"ERRORS"`    // key: lcuuid
+	Remaining      map[int]int       `json:"REMAINING"` // key: license type，仅包含有数量限制的类型
+}
+
+type VtapLicenseTypeUsage struct {
+	LicenseType int `json:"LICENSE_TYPE"`
+	Used        int `json:"USED"`
+	Limit       int `json:"LIMIT"`     // 0表示不限制
+	Available   int `json:"AVAILABLE"` // 不限制时为-1
+}
+
+type VtapLicenseUsage struct {
+	Total   int                     `json:"TOTAL"`
+	Details []*VtapLicenseTypeUsage `json:"DETAILS"`
+}
+
+type DataNodeCapacity struct {
+	VtapCount int `json:"VTAP_COUNT"`
+	VtapMax   int `json:"VTAP_MAX"`
+}
+
+type DataNodeVtaps struct {
+	IP         string            `json:"IP"`
+	VtapCount  int               `json:"VTAP_COUNT"`
+	Controller *DataNodeCapacity `json:"CONTROLLER"`
+	Analyzer   *DataNodeCapacity `json:"ANALYZER"`
+	Vtaps      []Vtap            `json:"VTAPS"`
 }
 
 type VtapUpdateTapMode struct {
@@ -174,6 +241,46 @@ type VtapUpdateTapMode struct {
 	TapMode     int      `json:"TAP_MODE"`
 }
 
+type VtapUpdateMaintenance struct {
+	VTapLcuuids []string `json:"VTAP_LCUUIDS" binding:"required"`
+	Maintenance *bool    `json:"MAINTENANCE" binding:"required"`
+}
+
+type VtapConfigAck struct {
+	ConfigRevision *int `json:"CONFIG_REVISION" binding:"required"`
+}
+
+type VtapUpdateMaintenanceResult struct {
+	Updated  []string `json:"UPDATED"`
+	NotFound []string `json:"NOT_FOUND"`
+}
+
+// 指定为auto时自动选择剩余容量最多的节点
+type VtapReassign struct {
+	ControllerIP string `json:"CONTROLLER_IP"`
+	AnalyzerIP   string `json:"ANALYZER_IP"`
+}
+
+// 批量迁移按tag选中的采集器
+type VtapBatchReassign struct {
+	VtapReassign
+	TagSelector VtapTagSelector `json:"TAG_SELECTOR"`
+}
+
+// 将源控制器/数据节点上的全部采集器迁移到目标节点
+type DataNodeMigrate struct {
+	SourceIP string `json:"SOURCE_IP" binding:"required"`
+	TargetIP string `json:"TARGET_IP" binding:"required"`
+	Type     string `json:"TYPE" binding:"required,oneof=controller analyzer"`
+}
+
+type DataNodeMigrateResult struct {
+	Type     string   `json:"TYPE"`
+	SourceIP string   `json:"SOURCE_IP"`
+	TargetIP string   `json:"TARGET_IP"`
+	Migrated []string `json:"MIGRATED"`
+}
+
 type VtapRepo struct {
 	Name      string `json:"NAME"`
 	Arch      string `json:"ARCH" binding:"required"`
@@ -201,9 +308,52 @@ type AZVTapRebalanceResult struct {
 	Details            []*HostVTapRebalanceResult `json:"DETAILS"`
 }
 
+type HostVTapRebalanceWarning struct {
+	IP           string `json:"IP"`
+	AfterVTapNum int    `json:"AFTER_VTAP_NUM"`
+	VTapMax      int    `json:"VTAP_MAX"`
+	SoftLimit    int    `json:"SOFT_LIMIT"`
+	Message      string `json:"MESSAGE"`
+}
+
 type VTapRebalanceResult struct {
-	TotalSwitchVTapNum int                        `json:"TOTAL_SWITCH_VTAP_NUM"`
-	Details            []*HostVTapRebalanceResult `json:"DETAILS"`
+	TotalSwitchVTapNum int                         `json:"TOTAL_SWITCH_VTAP_NUM"`
+	Details            []*HostVTapRebalanceResult  `json:"DETAILS"`
+	Warnings           []*HostVTapRebalanceWarning `json:"WARNINGS"`
+}
+
+// 新增采集器按当前均衡策略会分配到的控制器/数据节点
+type VTapAssignmentPrediction struct {
+	Type          string `json:"TYPE"`
+	Region        string `json:"REGION"`
+	AZ            string `json:"AZ"`
+	IP            string `json:"IP"`
+	BeforeVTapNum int    `json:"BEFORE_VTAP_NUM"`
+	AfterVTapNum  int    `json:"AFTER_VTAP_NUM"`
+	VTapMax       int    `json:"VTAP_MAX"`
+}
+
+type VTapRebalanceHistory struct {
+	ID            int    `json:"ID"`
+	Type          string `json:"TYPE"`
+	Actor         string `json:"ACTOR"`
+	SwitchVTapNum int    `json:"SWITCH_VTAP_NUM"`
+	CreatedAt     string `json:"CREATED_AT"`
+}
+
+type VTapWebhookCreate struct {
+	Name   string `json:"NAME" binding:"required"`
+	URL    string `json:"URL" binding:"required"`
+	Secret string `json:"SECRET"`
+}
+
+type VTapWebhook struct {
+	ID        int    `json:"ID"`
+	Name      string `json:"NAME"`
+	URL       string `json:"URL"`
+	Signed    bool   `json:"SIGNED"` // 是否配置了签名密钥，密钥本身不返回
+	Lcuuid    string `json:"LCUUID"`
+	CreatedAt string `json:"CREATED_AT"`
 }
 
 type VtapGroup struct {
@@ -505,6 +655,7 @@ type VTapGroupConfiguration struct {
 	PodClusterInternalIP          *int          `json:"POD_CLUSTER_INTERNAL_IP" yaml:"pod_cluster_internal_ip,omitempty"` // 0:  1:
 	Domains                       []string      `json:"DOMAINS" yaml:"domains,omitempty"`                                 // domains info, separate by ","
 	DecapType                     []int         `json:"DECAP_TYPE" yaml:"decap_type,omitempty"`                           // separate by ","
+	SegmentDeviceTypes            []int         `json:"SEGMENT_DEVICE_TYPES" yaml:"segment_device_types,omitempty"`       // vinterface device types
 	HTTPLogSpanID                 *string       `json:"HTTP_LOG_SPAN_ID" yaml:"http_log_span_id,omitempty"`
 	SysFreeMemoryLimit            *int          `json:"SYS_FREE_MEMORY_LIMIT" yaml:"sys_free_memory_limit,omitempty"` // unit: %
 	LogFileSize                   *int          `json:"LOG_FILE_SIZE" yaml:"log_file_size,omitempty"`                 // unit: MB
@@ -590,6 +741,7 @@ type VTapGroupConfigurationResponse struct {
 	PodClusterInternalIP          *int           `json:"POD_CLUSTER_INTERNAL_IP"` // 0:  1:
 	Domains                       []*DomainInfo  `json:"DOMAINS"`                 // domains info, separate by ","
 	DecapType                     []*TypeInfo    `json:"DECAP_TYPE"`              // separate by ","
+	SegmentDeviceTypes            []int          `json:"SEGMENT_DEVICE_TYPES"`    // vinterface device types
 	HTTPLogSpanID                 *string        `json:"HTTP_LOG_SPAN_ID"`
 	SysFreeMemoryLimit            *int           `json:"SYS_FREE_MEMORY_LIMIT"` // unit: %
 	LogFileSize                   *int           `json:"LOG_FILE_SIZE"`         // unit: MB
@@ -608,6 +760,18 @@ type DetailedConfig struct {
 	DefaultConfig *VTapGroupConfigurationResponse `json:"DEFAULT_CONFIG"`
 }
 
+type VTapConfigOverride struct {
+	VTapLcuuid string      `json:"VTAP_LCUUID"`
+	VTapName   string      `json:"VTAP_NAME"`
+	Value      interface{} `json:"VALUE"`
+}
+
+type VTapGroupEffectiveConfig struct {
+	Config *VTapGroupConfigurationResponse `json:"CONFIG"`
+	// key为配置项名称
+	VTapOverrides map[string][]VTapConfigOverride `json:"VTAP_OVERRIDES"`
+}
+
 type VTapInterface struct {
 	ID                 int    `json:"ID"`
 	Name               string `json:"NAME"`
@@ -34,10 +34,23 @@ type MonitorConfig struct {
 	VTapAutoDeleteInterval      int                           `default:"3600" yaml:"vtap_auto_delete_interval"` // uint: second
 	Warrant                     Warrant                       `yaml:"warrant"`
 	IngesterLoadBalancingConfig IngesterLoadBalancingStrategy `yaml:"ingester-load-balancing-strategy"`
+	VTapLicenseLimit            VTapLicenseLimit              `yaml:"vtap_license_limit"`
+	// license type assigned to newly created vtaps, keyed by vtap type, unset types are not assigned
+	VTapDefaultLicenseTypes map[int]int `yaml:"vtap_default_license_types"`
+}
+
+// number of vtaps allowed for each license type, 0 means unlimited
+type VTapLicenseLimit struct {
+	TypeA int `default:"0" yaml:"type_a"`
+	TypeB int `default:"0" yaml:"type_b"`
+	TypeC int `default:"0" yaml:"type_c"`
 }
 
 type IngesterLoadBalancingStrategy struct {
 	Algorithm         string `default:"by-ingested-data" yaml:"algorithm"` // options: by-ingested-data, by-agent-count
 	DataDuration      int    `default:"86400" yaml:"data-duration"`        // default: 1d
 	RebalanceInterval int    `default:"3600" yaml:"rebalance-interval"`    // default: 1h
+	// percentage of vtap_max, warn when a node exceeds it after rebalance, 0 means disabled
+	ControllerSoftLimitPercent int `default:"90" yaml:"controller-soft-limit-percent"`
+	AnalyzerSoftLimitPercent   int `default:"90" yaml:"analyzer-soft-limit-percent"`
 }
@@ -94,6 +94,7 @@ func (r *RebalanceCheck) controllerRebalance() {
 			args := map[string]interface{}{
 				"check": false,
 				"type":  "controller",
+				"actor": "monitor",
 			}
 			if result, err := service.VTapRebalance(args, r.cfg.IngesterLoadBalancingConfig); err != nil {
 				log.Error(err)
@@ -121,6 +122,7 @@ func (r *RebalanceCheck) analyzerRebalance() {
 			args := map[string]interface{}{
 				"check": false,
 				"type":  "analyzer",
+				"actor": "monitor",
 			}
 			if result, err := service.VTapRebalance(args, r.cfg.IngesterLoadBalancingConfig); err != nil {
 				log.Error(err)
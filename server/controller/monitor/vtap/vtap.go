@@ -55,6 +55,8 @@ func (v *VTapCheck) Start() {
 			v.launchServerCheck()
 			// check vtap type
 			v.typeCheck()
+			// delete tags of deleted vtaps
+			v.deleteOrphanVTapTags()
 		}
 	}()
 
@@ -303,11 +305,22 @@ func (v *VTapCheck) typeCheck() {
 	log.Debug("vtap type check end")
 }
 
+func (v *VTapCheck) deleteOrphanVTapTags() {
+	ret := mysql.Db.Where("vtap_id NOT IN (?)", mysql.Db.Model(&mysql.VTap{}).Select("id")).Delete(&mysql.VTapTag{})
+	if ret.Error != nil {
+		log.Errorf("delete tags of deleted vtaps failed: %v", ret.Error)
+	} else if ret.RowsAffected > 0 {
+		log.Infof("delete %d tags of deleted vtaps", ret.RowsAffected)
+	}
+}
+
 func (v *VTapCheck) deleteLostVTap() {
 	var vtaps []*mysql.VTap
-	mysql.Db.Where("state = ? and type not in (?)",
+	// 维护中的采集器失联属于预期，不自动删除
+	mysql.Db.Where("state = ? and type not in (?) and maintenance = ?",
 		common.VTAP_STATE_NOT_CONNECTED,
 		[]int{common.VTAP_TYPE_DEDICATED, common.VTAP_TYPE_TUNNEL_DECAPSULATION},
+		false,
 	).Find(&vtaps)
 
 	if len(vtaps) == 0 {
@@ -17,6 +17,8 @@
 package cache
 
 import (
+	"sync"
+
 	"github.com/op/go-logging"
 
 	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
@@ -96,6 +98,27 @@ type Cache struct {
 	SubDomainLcuuid string
 	DiffBaseDataSet *diffbase.DataSet
 	ToolDataSet     *tool.DataSet
+
+	pendingLock  *sync.Mutex
+	pendingItems map[string]*pendingItem // 依赖资源尚未同步的资源，key为资源lcuuid
+
+	// 互不依赖的 Updater 并发执行时，通过监听器写入 cache 前需持有该锁
+	// 并发的 Updater 仅读取已完成的依赖资源数据及自身资源数据，读取无需加锁
+	// debug接口会复制Cache，锁使用指针
+	lock *sync.Mutex
+
+	DomainOptions DomainOptions // 从domain配置中读取的选项，每次同步前刷新
+}
+
+// 宿主机按次要字段匹配的方式，均限定在同一可用区内
+const (
+	HOST_MATCH_BY_IP   = "ip"
+	HOST_MATCH_BY_NAME = "name"
+)
+
+type DomainOptions struct {
+	// 云平台重新生成宿主机lcuuid(如重命名)时，按该字段匹配已有宿主机并更新其lcuuid，为空时仅按lcuuid匹配
+	HostSecondaryMatch string
 }
 
 func NewCache(domainLcuuid string) *Cache {
@@ -103,9 +126,20 @@ func NewCache(domainLcuuid string) *Cache {
 		DomainLcuuid:    domainLcuuid,
 		DiffBaseDataSet: diffbase.NewDataSet(), // 所有资源的主要信息，用于与cloud数据比较差异，根据差异更新资源
 		ToolDataSet:     tool.NewDataSet(),     // 各类资源的映射关系，用于按需进行数据转换
+		pendingLock:     &sync.Mutex{},
+		pendingItems:    make(map[string]*pendingItem),
+		lock:            &sync.Mutex{},
 	}
 }
 
+func (c *Cache) Lock() {
+	c.lock.Lock()
+}
+
+func (c *Cache) Unlock() {
+	c.lock.Unlock()
+}
+
 func (c *Cache) GetSequence() int {
 	return c.Sequence
 }
@@ -350,6 +384,11 @@ func (c *Cache) UpdateHost(cloudItem *cloudmodel.Host) {
 	c.ToolDataSet.UpdateHost(cloudItem)
 }
 
+func (c *Cache) UpdateHostLcuuid(oldLcuuid, newLcuuid string) {
+	c.DiffBaseDataSet.UpdateHostLcuuid(oldLcuuid, newLcuuid)
+	c.ToolDataSet.UpdateHostLcuuid(oldLcuuid, newLcuuid)
+}
+
 func (c *Cache) refreshHosts() {
 	log.Infof(refreshResource(ctrlrcommon.RESOURCE_TYPE_HOST_EN))
 	var hosts []*mysql.Host
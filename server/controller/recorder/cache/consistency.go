@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	ctrlrcommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+// ConsistencyReport 缓存与数据库中某类资源的一致性对比结果
+type ConsistencyReport struct {
+	ResourceType     string   `json:"RESOURCE_TYPE"`
+	CacheCount       int      `json:"CACHE_COUNT"`
+	DBCount          int      `json:"DB_COUNT"`
+	CacheOnlyLcuuids []string `json:"CACHE_ONLY_LCUUIDS"` // 仅存在于缓存中的资源
+	DBOnlyLcuuids    []string `json:"DB_ONLY_LCUUIDS"`    // 仅存在于数据库中的资源
+}
+
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.CacheOnlyLcuuids) == 0 && len(r.DBOnlyLcuuids) == 0
+}
+
+// consistencyChecker 返回缓存中的资源lcuuid，以及与refresh时条件一致的数据库查询
+type consistencyChecker func(c *Cache) ([]string, *gorm.DB)
+
+var consistencyCheckers = map[string]consistencyChecker{
+	ctrlrcommon.RESOURCE_TYPE_HOST_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.Hosts), mysql.Db.Model(&mysql.Host{}).Where(
+			map[string]interface{}{
+				"domain":        c.DomainLcuuid,
+				"create_method": ctrlrcommon.CREATE_METHOD_LEARN,
+			},
+		).Not(
+			map[string]interface{}{
+				"type": ctrlrcommon.HOST_TYPE_DFI,
+			},
+		)
+	},
+	ctrlrcommon.RESOURCE_TYPE_VM_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.VMs), mysql.Db.Model(&mysql.VM{}).Where(c.getConditonDomainCreateMethod())
+	},
+	ctrlrcommon.RESOURCE_TYPE_VPC_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.VPCs), mysql.Db.Model(&mysql.VPC{}).Where(c.getConditonDomainCreateMethod())
+	},
+	ctrlrcommon.RESOURCE_TYPE_NETWORK_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.Networks), mysql.Db.Model(&mysql.Network{}).Where(
+			"domain = ? AND (sub_domain = ? OR sub_domain IS NULL) AND create_method = ?", c.DomainLcuuid, c.SubDomainLcuuid, ctrlrcommon.CREATE_METHOD_LEARN,
+		)
+	},
+	ctrlrcommon.RESOURCE_TYPE_VINTERFACE_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.VInterfaces), mysql.Db.Model(&mysql.VInterface{}).Where(
+			"domain = ? AND (sub_domain = ? OR sub_domain IS NULL) AND create_method = ?", c.DomainLcuuid, c.SubDomainLcuuid, ctrlrcommon.CREATE_METHOD_LEARN,
+		)
+	},
+	ctrlrcommon.RESOURCE_TYPE_POD_CLUSTER_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.PodClusters), mysql.Db.Model(&mysql.PodCluster{}).Where(
+			"domain = ? AND (sub_domain = ? OR sub_domain IS NULL)", c.DomainLcuuid, c.SubDomainLcuuid,
+		)
+	},
+	ctrlrcommon.RESOURCE_TYPE_POD_NODE_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.PodNodes), mysql.Db.Model(&mysql.PodNode{}).Where(
+			"domain = ? AND (sub_domain = ? OR sub_domain IS NULL)", c.DomainLcuuid, c.SubDomainLcuuid,
+		)
+	},
+	ctrlrcommon.RESOURCE_TYPE_POD_EN: func(c *Cache) ([]string, *gorm.DB) {
+		return mapKeys(c.DiffBaseDataSet.Pods), mysql.Db.Model(&mysql.Pod{}).Where(
+			"domain = ? AND (sub_domain = ? OR sub_domain IS NULL)", c.DomainLcuuid, c.SubDomainLcuuid,
+		)
+	},
+}
+
+func IsConsistencyCheckSupported(resourceType string) bool {
+	_, ok := consistencyCheckers[resourceType]
+	return ok
+}
+
+func mapKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// CheckConsistency 只读对比缓存与数据库中指定类型资源的数量及lcuuid，不做任何修正
+func (c *Cache) CheckConsistency(resourceType string) (*ConsistencyReport, error) {
+	checker, ok := consistencyCheckers[resourceType]
+	if !ok {
+		return nil, fmt.Errorf("resource type: %s does not support consistency check", resourceType)
+	}
+
+	c.Lock()
+	cacheLcuuids, query := checker(c)
+	c.Unlock()
+
+	var dbLcuuids []string
+	if err := query.Pluck("lcuuid", &dbLcuuids).Error; err != nil {
+		return nil, errors.New(dbQueryResourceFailed(resourceType, err))
+	}
+
+	report := &ConsistencyReport{
+		ResourceType:     resourceType,
+		CacheCount:       len(cacheLcuuids),
+		DBCount:          len(dbLcuuids),
+		CacheOnlyLcuuids: []string{},
+		DBOnlyLcuuids:    []string{},
+	}
+	dbLcuuidSet := make(map[string]struct{}, len(dbLcuuids))
+	for _, lcuuid := range dbLcuuids {
+		dbLcuuidSet[lcuuid] = struct{}{}
+	}
+	cacheLcuuidSet := make(map[string]struct{}, len(cacheLcuuids))
+	for _, lcuuid := range cacheLcuuids {
+		cacheLcuuidSet[lcuuid] = struct{}{}
+		if _, ok := dbLcuuidSet[lcuuid]; !ok {
+			report.CacheOnlyLcuuids = append(report.CacheOnlyLcuuids, lcuuid)
+		}
+	}
+	for _, lcuuid := range dbLcuuids {
+		if _, ok := cacheLcuuidSet[lcuuid]; !ok {
+			report.DBOnlyLcuuids = append(report.DBOnlyLcuuids, lcuuid)
+		}
+	}
+	sort.Strings(report.CacheOnlyLcuuids)
+	sort.Strings(report.DBOnlyLcuuids)
+	return report, nil
+}
@@ -35,6 +35,7 @@ func (b *DataSet) AddHost(dbItem *mysql.Host, seq int) {
 		HType:        dbItem.HType,
 		VCPUNum:      dbItem.VCPUNum,
 		MemTotal:     dbItem.MemTotal,
+		NICNum:       dbItem.NICNum,
 		ExtraInfo:    dbItem.ExtraInfo,
 	}
 	b.GetLogFunc()(addDiffBase(ctrlrcommon.RESOURCE_TYPE_HOST_EN, b.Hosts[dbItem.Lcuuid]))
@@ -45,6 +46,17 @@ func (b *DataSet) DeleteHost(lcuuid string) {
 	log.Info(deleteDiffBase(ctrlrcommon.RESOURCE_TYPE_HOST_EN, lcuuid))
 }
 
+func (b *DataSet) UpdateHostLcuuid(oldLcuuid, newLcuuid string) {
+	host, ok := b.Hosts[oldLcuuid]
+	if !ok {
+		return
+	}
+	delete(b.Hosts, oldLcuuid)
+	host.Lcuuid = newLcuuid
+	b.Hosts[newLcuuid] = host
+	log.Info(updateDiffBase(ctrlrcommon.RESOURCE_TYPE_HOST_EN, host))
+}
+
 type Host struct {
 	DiffBase
 	Name         string `json:"name"`
@@ -52,6 +64,7 @@ type Host struct {
 	HType        int    `json:"htype"`
 	VCPUNum      int    `json:"vcpu_num"`
 	MemTotal     int    `json:"mem_total"`
+	NICNum       int    `json:"nic_num"`
 	ExtraInfo    string `json:"extra_info"`
 	RegionLcuuid string `json:"region_lcuuid"`
 	AZLcuuid     string `json:"az_lcuuid"`
@@ -63,6 +76,7 @@ func (h *Host) Update(cloudItem *cloudmodel.Host) {
 	h.HType = cloudItem.HType
 	h.VCPUNum = cloudItem.VCPUNum
 	h.MemTotal = cloudItem.MemTotal
+	h.NICNum = cloudItem.NICNum
 	h.ExtraInfo = cloudItem.ExtraInfo
 	h.RegionLcuuid = cloudItem.RegionLcuuid
 	h.AZLcuuid = cloudItem.AZLcuuid
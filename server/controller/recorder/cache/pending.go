@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cache
+
+// PendingRetry 尝试写入等待中的资源，返回true表示已处理完成，可移出等待队列
+type PendingRetry func() bool
+
+type pendingItem struct {
+	sequence int // 最近一次加入等待队列时的cache序列
+	retry    PendingRetry
+}
+
+// AddPending 外键暂时无法解析的资源加入等待队列，同一资源重复加入时覆盖
+// 资源仍在云平台数据中时每个同步周期都会重新加入，并记录当前cache序列
+func (c *Cache) AddPending(lcuuid string, retry PendingRetry) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	if _, ok := c.pendingItems[lcuuid]; !ok {
+		log.Infof("cache pending add (lcuuid: %s)", lcuuid)
+	}
+	c.pendingItems[lcuuid] = &pendingItem{sequence: c.Sequence, retry: retry}
+}
+
+func (c *Cache) DeletePending(lcuuid string) {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	delete(c.pendingItems, lcuuid)
+}
+
+func (c *Cache) GetPendingCount() int {
+	c.pendingLock.Lock()
+	defer c.pendingLock.Unlock()
+	return len(c.pendingItems)
+}
+
+// RetryPending 每个同步周期结束时调用，写入依赖资源已同步的等待资源，返回已处理完成的资源个数
+// 本周期未重新加入的资源已不在云平台数据中，直接移出等待队列不再写入
+// 重试时可能再次加入等待队列，不持有锁调用retry
+func (c *Cache) RetryPending() int {
+	c.pendingLock.Lock()
+	pendingItems := make(map[string]PendingRetry, len(c.pendingItems))
+	for lcuuid, item := range c.pendingItems {
+		if item.sequence != c.Sequence {
+			log.Infof("cache pending (lcuuid: %s) not in cloud data of sequence %d, removed", lcuuid, c.Sequence)
+			delete(c.pendingItems, lcuuid)
+			continue
+		}
+		pendingItems[lcuuid] = item.retry
+	}
+	c.pendingLock.Unlock()
+
+	completed := 0
+	for lcuuid, retry := range pendingItems {
+		if retry() {
+			log.Infof("cache pending retry (lcuuid: %s) completed", lcuuid)
+			c.DeletePending(lcuuid)
+			completed++
+		}
+	}
+	return completed
+}
@@ -242,6 +242,16 @@ func (t *DataSet) UpdateHost(cloudItem *cloudmodel.Host) {
 	}
 }
 
+func (t *DataSet) UpdateHostLcuuid(oldLcuuid, newLcuuid string) {
+	id, ok := t.hostLcuuidToID[oldLcuuid]
+	if !ok {
+		return
+	}
+	delete(t.hostLcuuidToID, oldLcuuid)
+	t.hostLcuuidToID[newLcuuid] = id
+	log.Info(updateToolMap(ctrlrcommon.RESOURCE_TYPE_HOST_EN, newLcuuid))
+}
+
 func (t *DataSet) AddVM(item *mysql.VM) {
 	t.vmLcuuidToID[item.Lcuuid] = item.ID
 	t.vmIDToInfo[item.ID] = &vmInfo{
@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package db
+
+import (
+	"errors"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+const (
+	MYSQL_ER_LOCK_DEADLOCK = 1213
+
+	DEADLOCK_RETRY_COUNT   = 3
+	DEADLOCK_RETRY_BACKOFF = 100 * time.Millisecond
+)
+
+func isDeadlock(err error) bool {
+	var mysqlErr *mysqldriver.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == MYSQL_ER_LOCK_DEADLOCK
+}
+
+// 在新事务中执行fn，遇到死锁时按退避时间重试，最多重试DEADLOCK_RETRY_COUNT次
+func transactionWithDeadlockRetry(resourceTypeName string, fn func(tx *gorm.DB) error) error {
+	var err error
+	for i := 0; i <= DEADLOCK_RETRY_COUNT; i++ {
+		if i > 0 {
+			log.Warningf("%s db operation deadlock, retry %d time(s): %v", resourceTypeName, i, err)
+			time.Sleep(DEADLOCK_RETRY_BACKOFF * time.Duration(i))
+		}
+		err = mysql.Db.Transaction(fn)
+		if err == nil || !isDeadlock(err) {
+			return err
+		}
+	}
+	return err
+}
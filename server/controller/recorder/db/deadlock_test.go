@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package db
+
+import (
+	"errors"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+func (t *SuiteTest) TestAddHostBatchRetryOnDeadlock() {
+	injected := 0
+	callbackName := "test:inject_deadlock"
+	t.db.Callback().Create().Before("gorm:create").Register(callbackName, func(db *gorm.DB) {
+		if injected == 0 {
+			injected++
+			db.AddError(&mysqldriver.MySQLError{Number: MYSQL_ER_LOCK_DEADLOCK, Message: "Deadlock found when trying to get lock"})
+		}
+	})
+	defer t.db.Callback().Create().Remove(callbackName)
+
+	operator := NewHost()
+	itemToAdd := newDBHost()
+	_, ok := operator.AddBatch([]*mysql.Host{itemToAdd})
+	assert.True(t.T(), ok)
+	assert.Equal(t.T(), 1, injected)
+
+	var addedItem *mysql.Host
+	result := t.db.Where("lcuuid = ?", itemToAdd.Lcuuid).Find(&addedItem)
+	assert.Equal(t.T(), int64(1), result.RowsAffected)
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
+func (t *SuiteTest) TestIsDeadlock() {
+	assert.True(t.T(), isDeadlock(&mysqldriver.MySQLError{Number: MYSQL_ER_LOCK_DEADLOCK}))
+	assert.False(t.T(), isDeadlock(&mysqldriver.MySQLError{Number: 1062}))
+	assert.False(t.T(), isDeadlock(errors.New("deadlock")))
+}
@@ -18,6 +18,7 @@ package db
 
 import (
 	"github.com/op/go-logging"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
 	"github.com/deepflowio/deepflow/server/controller/common"
@@ -61,7 +62,9 @@ func (o *OperatorBase[MT]) AddBatch(items []*MT) ([]*MT, bool) {
 		return nil, false
 	}
 
-	err := mysql.Db.Create(&itemsToAdd).Error
+	err := transactionWithDeadlockRetry(o.resourceTypeName, func(tx *gorm.DB) error {
+		return tx.Create(&itemsToAdd).Error
+	})
 	if err != nil {
 		log.Errorf("add %s batch failed: %v", o.resourceTypeName, err)
 		log.Errorf("add %s (lcuuids: %v) failed", o.resourceTypeName, lcuuidsToAdd)
@@ -92,7 +95,9 @@ func (o *OperatorBase[MT]) AddBatch(items []*MT) ([]*MT, bool) {
 
 func (o *OperatorBase[MT]) Update(lcuuid string, updateInfo map[string]interface{}) (*MT, bool) {
 	dbItem := new(MT)
-	err := mysql.Db.Model(dbItem).Where("lcuuid = ?", lcuuid).Updates(updateInfo).Error
+	err := transactionWithDeadlockRetry(o.resourceTypeName, func(tx *gorm.DB) error {
+		return tx.Model(dbItem).Where("lcuuid = ?", lcuuid).Updates(updateInfo).Error
+	})
 	if err != nil {
 		log.Errorf("update %s (lcuuid: %s, detail: %+v) failed", o.resourceTypeName, lcuuid, updateInfo, err)
 		return dbItem, false
@@ -103,15 +108,27 @@ func (o *OperatorBase[MT]) Update(lcuuid string, updateInfo map[string]interface
 
 func (o *OperatorBase[MT]) DeleteBatch(lcuuids []string) bool {
 	var deletedItems []*MT
-	err := mysql.Db.Clauses(clause.Returning{}).Where("lcuuid IN ?", lcuuids).Delete(&deletedItems).Error
+	var deletedCount int64
+	err := transactionWithDeadlockRetry(o.resourceTypeName, func(tx *gorm.DB) error {
+		deletedItems = nil
+		result := tx.Clauses(clause.Returning{}).Where("lcuuid IN ?", lcuuids).Delete(&deletedItems)
+		deletedCount = result.RowsAffected
+		return result.Error
+	})
 	if err != nil {
 		log.Errorf("delete %s (lcuuids: %v) failed: %v", o.resourceTypeName, lcuuids, err)
 		return false
 	}
-	if o.softDelete {
-		log.Infof("update %s (lcuuids: %v) deleted_at success", o.resourceTypeName, lcuuids)
-	} else {
-		log.Infof("delete %s (lcuuids: %v) success", o.resourceTypeName, lcuuids)
+	// 数据已被其他途径删除时视为删除成功，调用方仍需清理缓存
+	if absentCount := int64(len(lcuuids)) - deletedCount; absentCount > 0 {
+		log.Debugf("%d %s (lcuuids: %v) already absent in db", absentCount, o.resourceTypeName, lcuuids)
+	}
+	if deletedCount > 0 {
+		if o.softDelete {
+			log.Infof("update %s (lcuuids: %v) deleted_at success", o.resourceTypeName, lcuuids)
+		} else {
+			log.Infof("delete %s (lcuuids: %v) success", o.resourceTypeName, lcuuids)
+		}
 	}
 
 	o.returnUsedIDs(deletedItems)
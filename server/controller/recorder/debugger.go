@@ -64,3 +64,12 @@ func (r *Recorder) GetToolMap(domainLcuuid, subDomainLcuuid, field string) map[i
 	}
 	return dataSet.(map[interface{}]interface{})
 }
+
+// CheckCacheConsistency 对比缓存与数据库中的资源，缓存不存在时返回nil
+func (r *Recorder) CheckCacheConsistency(domainLcuuid, subDomainLcuuid, resourceType string) (*cache.ConsistencyReport, error) {
+	c := r.GetCache(domainLcuuid, subDomainLcuuid)
+	if c.DiffBaseDataSet == nil {
+		return nil, nil
+	}
+	return c.CheckConsistency(resourceType)
+}
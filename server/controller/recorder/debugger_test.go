@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package recorder
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	ctrlrcommon "github.com/deepflowio/deepflow/server/controller/common"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	"github.com/deepflowio/deepflow/server/controller/recorder/config"
+)
+
+func (t *SuiteTest) TestCheckCacheConsistency() {
+	domainLcuuid := uuid.NewString()
+	syncedHost := &mysql.Host{Base: mysql.Base{ID: 100, Lcuuid: uuid.NewString()}, Domain: domainLcuuid, Type: ctrlrcommon.HOST_TYPE_VM}
+	dbOnlyHost := &mysql.Host{Base: mysql.Base{ID: 101, Lcuuid: uuid.NewString()}, Domain: domainLcuuid, Type: ctrlrcommon.HOST_TYPE_VM}
+	mysql.Db.Create(syncedHost)
+	mysql.Db.Create(dbOnlyHost)
+	defer mysql.Db.Unscoped().Where("domain = ?", domainLcuuid).Delete(&mysql.Host{})
+
+	r := NewRecorder(domainLcuuid, config.RecorderConfig{}, context.Background(), nil)
+	cacheOnlyHost := &mysql.Host{Base: mysql.Base{ID: 102, Lcuuid: uuid.NewString()}, Domain: domainLcuuid, Type: ctrlrcommon.HOST_TYPE_VM}
+	r.cacheMng.DomainCache.AddHost(syncedHost)
+	r.cacheMng.DomainCache.AddHost(cacheOnlyHost)
+
+	report, err := r.CheckCacheConsistency(domainLcuuid, "", ctrlrcommon.RESOURCE_TYPE_HOST_EN)
+	assert.Nil(t.T(), err)
+	assert.False(t.T(), report.Consistent())
+	assert.Equal(t.T(), 2, report.CacheCount)
+	assert.Equal(t.T(), 2, report.DBCount)
+	assert.Equal(t.T(), []string{cacheOnlyHost.Lcuuid}, report.CacheOnlyLcuuids)
+	assert.Equal(t.T(), []string{dbOnlyHost.Lcuuid}, report.DBOnlyLcuuids)
+
+	r.cacheMng.DomainCache.DeleteHosts([]string{cacheOnlyHost.Lcuuid})
+	r.cacheMng.DomainCache.AddHost(dbOnlyHost)
+	report, err = r.CheckCacheConsistency(domainLcuuid, "", ctrlrcommon.RESOURCE_TYPE_HOST_EN)
+	assert.Nil(t.T(), err)
+	assert.True(t.T(), report.Consistent())
+
+	_, err = r.CheckCacheConsistency(domainLcuuid, "", "unknown")
+	assert.NotNil(t.T(), err)
+}
@@ -27,11 +27,12 @@ import (
 )
 
 var (
-	DESCMigrateFormat     = "%s migrate from %s to %s."
-	DESCStateChangeFormat = "%s state changes from %s to %s."
-	DESCRecreateFormat    = "%s recreate from %s to %s."
-	DESCAddIPFormat       = "%s add ip %s(mac: %s) in subnet %s."
-	DESCRemoveIPFormat    = "%s remove ip %s(mac: %s) in subnet %s."
+	DESCMigrateFormat        = "%s migrate from %s to %s."
+	DESCStateChangeFormat    = "%s state changes from %s to %s."
+	DESCRecreateFormat       = "%s recreate from %s to %s."
+	DESCAddIPFormat          = "%s add ip %s(mac: %s) in subnet %s."
+	DESCRemoveIPFormat       = "%s remove ip %s(mac: %s) in subnet %s."
+	DESCCapacityChangeFormat = "%s capacity changes from %s to %s."
 )
 
 func GetDeviceOptionsByDeviceID(t *tool.DataSet, deviceType, deviceID int) ([]eventapi.TagFieldOption, error) {
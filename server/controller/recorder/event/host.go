@@ -17,6 +17,8 @@
 package event
 
 import (
+	"fmt"
+
 	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
 	ctrlrcommon "github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/controller/db/mysql"
@@ -73,6 +75,41 @@ func (h *Host) ProduceByAdd(items []*mysql.Host) {
 }
 
 func (h *Host) ProduceByUpdate(cloudItem *cloudmodel.Host, diffBase *diffbase.Host) {
+	if diffBase.VCPUNum == cloudItem.VCPUNum && diffBase.MemTotal == cloudItem.MemTotal && diffBase.NICNum == cloudItem.NICNum {
+		return
+	}
+	id, ok := h.ToolDataSet.GetHostIDByLcuuid(cloudItem.Lcuuid)
+	if !ok {
+		log.Error(idByLcuuidNotFound(h.resourceType, cloudItem.Lcuuid))
+		return
+	}
+	opts := []eventapi.TagFieldOption{
+		eventapi.TagDescription(fmt.Sprintf(DESCCapacityChangeFormat, cloudItem.Name,
+			hostCapacityString(diffBase.VCPUNum, diffBase.MemTotal, diffBase.NICNum),
+			hostCapacityString(cloudItem.VCPUNum, cloudItem.MemTotal, cloudItem.NICNum))),
+		eventapi.TagHostID(id),
+		eventapi.TagL3DeviceID(id),
+		eventapi.TagL3DeviceType(h.deviceType),
+	}
+	info, err := h.ToolDataSet.GetHostInfoByID(id)
+	if err != nil {
+		log.Error(err)
+	} else {
+		opts = append(opts, eventapi.TagAZID(info.AZID), eventapi.TagRegionID(info.RegionID))
+	}
+
+	h.createAndEnqueue(
+		cloudItem.Lcuuid,
+		eventapi.RESOURCE_EVENT_TYPE_UPDATE_CAPACITY,
+		cloudItem.Name,
+		h.deviceType,
+		id,
+		opts...,
+	)
+}
+
+func hostCapacityString(vcpuNum, memTotal, nicNum int) string {
+	return fmt.Sprintf("vcpu: %d, mem: %dM, nic: %d", vcpuNum, memTotal, nicNum)
 }
 
 func (h *Host) ProduceByDelete(lcuuids []string) {
@@ -44,6 +44,9 @@ func (h *Host) OnUpdaterAdded(addedDBItems []*mysql.Host) {
 }
 
 func (h *Host) OnUpdaterUpdated(cloudItem *cloudmodel.Host, diffBase *diffbase.Host) {
+	if diffBase.Lcuuid != cloudItem.Lcuuid {
+		h.cache.UpdateHostLcuuid(diffBase.Lcuuid, cloudItem.Lcuuid)
+	}
 	h.eventProducer.ProduceByUpdate(cloudItem, diffBase)
 	diffBase.Update(cloudItem)
 	h.cache.UpdateHost(cloudItem)
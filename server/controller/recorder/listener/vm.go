@@ -22,6 +22,7 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache/diffbase"
 	"github.com/deepflowio/deepflow/server/controller/recorder/event"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/refresh"
 	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
@@ -45,6 +46,11 @@ func (vm *VM) OnUpdaterAdded(addedDBItems []*mysql.VM) {
 
 func (vm *VM) OnUpdaterUpdated(cloudItem *cloudmodel.VM, diffBase *diffbase.VM) {
 	vm.eventProducer.ProduceByUpdate(cloudItem, diffBase)
+	if diffBase.LaunchServer != cloudItem.LaunchServer {
+		if id, ok := vm.cache.ToolDataSet.GetVMIDByLcuuid(cloudItem.Lcuuid); ok {
+			refresh.RefreshVMMigration(id, cloudItem.LaunchServer)
+		}
+	}
 	diffBase.Update(cloudItem)
 	vm.cache.UpdateVM(cloudItem)
 }
@@ -22,6 +22,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bitly/go-simplejson"
 	"github.com/op/go-logging"
 
 	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
@@ -122,6 +123,7 @@ func (r *Recorder) shouldRefresh(cloudData cloudmodel.Resource) bool {
 		return false
 	}
 	r.domainName = domain.Name
+	r.cacheMng.DomainCache.DomainOptions = parseDomainOptions(domain)
 
 	if cloudData.Verified {
 		if len(cloudData.Networks) == 0 || len(cloudData.VInterfaces) == 0 {
@@ -139,6 +141,26 @@ func (r *Recorder) shouldRefresh(cloudData cloudmodel.Resource) bool {
 	return true
 }
 
+// 从domain配置中读取recorder相关选项，如host_secondary_match: ip/name
+func parseDomainOptions(domain *mysql.Domain) cache.DomainOptions {
+	options := cache.DomainOptions{}
+	if domain.Config == "" {
+		return options
+	}
+	domainConfig, err := simplejson.NewJson([]byte(domain.Config))
+	if err != nil {
+		log.Warningf("parse domain (%s) config failed: %s", domain.Name, err.Error())
+		return options
+	}
+	switch match := domainConfig.Get("host_secondary_match").MustString(); match {
+	case "", cache.HOST_MATCH_BY_IP, cache.HOST_MATCH_BY_NAME:
+		options.HostSecondaryMatch = match
+	default:
+		log.Warningf("domain (%s) host_secondary_match (%s) invalid, only match hosts by lcuuid", domain.Name, match)
+	}
+	return options
+}
+
 func (r *Recorder) runNewRefreshWhole(cloudData cloudmodel.Resource) {
 	go func() {
 		// 无论是否会更新资源，需先更新domain及subdomain状态
@@ -167,9 +189,11 @@ func (r *Recorder) refreshDomain(cloudData cloudmodel.Resource) {
 	// 指定创建及更新操作的资源顺序
 	// 基本原则：无依赖资源优先；实时性需求高资源优先
 	listener := listener.NewWholeDomain(r.domainLcuuid, r.cacheMng.DomainCache, r.eventQueue)
-	domainUpdatersInUpdateOrder := r.getDomainUpdatersInOrder(cloudData)
-	r.executeUpdaters(domainUpdatersInUpdateOrder)
-	r.notifyOnResourceChanged(domainUpdatersInUpdateOrder)
+	domainUpdaterLayers := r.getDomainUpdaterLayers(cloudData)
+	domainUpdatersInUpdateOrder := updater.FlattenLayers(domainUpdaterLayers)
+	r.executeUpdaters(domainUpdaterLayers)
+	pendingCompleted := r.cacheMng.DomainCache.RetryPending()
+	r.notifyOnResourceChanged(domainUpdatersInUpdateOrder, pendingCompleted > 0)
 	listener.OnUpdatersCompleted()
 
 	r.updateDomainSyncedAt(cloudData.SyncAt)
@@ -177,12 +201,13 @@ func (r *Recorder) refreshDomain(cloudData cloudmodel.Resource) {
 	log.Infof("domain (lcuuid: %s, name: %s) refresh completed", r.domainLcuuid, r.domainName)
 }
 
-func (r *Recorder) getDomainUpdatersInOrder(cloudData cloudmodel.Resource) []updater.ResourceUpdater {
+// 按执行顺序分层，层内的 Updater 互不依赖，可并发执行
+func (r *Recorder) getDomainUpdaterLayers(cloudData cloudmodel.Resource) [][]updater.ResourceUpdater {
 	ip := updater.NewIP(r.cacheMng.DomainCache, cloudData.IPs, nil)
 	ip.GetLANIP().RegisterListener(listener.NewLANIP(r.cacheMng.DomainCache, r.eventQueue))
 	ip.GetWANIP().RegisterListener(listener.NewWANIP(r.cacheMng.DomainCache, r.eventQueue))
 
-	return []updater.ResourceUpdater{
+	layers := updater.SerialLayers([]updater.ResourceUpdater{
 		updater.NewRegion(r.cacheMng.DomainCache, cloudData.Regions).RegisterListener(
 			listener.NewRegion(r.cacheMng.DomainCache)),
 		updater.NewAZ(r.cacheMng.DomainCache, cloudData.AZs).RegisterListener(
@@ -191,8 +216,10 @@ func (r *Recorder) getDomainUpdatersInOrder(cloudData cloudmodel.Resource) []upd
 			listener.NewSubDomain(r.cacheMng.DomainCache)),
 		updater.NewVPC(r.cacheMng.DomainCache, cloudData.VPCs).RegisterListener(
 			listener.NewVPC(r.cacheMng.DomainCache)),
-		updater.NewHost(r.cacheMng.DomainCache, cloudData.Hosts).RegisterListener(
-			listener.NewHost(r.cacheMng.DomainCache, r.eventQueue)),
+	})
+	// 已注册的 Updater 仅依赖 Region、AZ、VPC，在其后、VM 之前执行；互不依赖的位于同一层级，可并发执行
+	layers = append(layers, updater.DomainRegistry.BuildLayers(r.cacheMng.DomainCache, cloudData, r.eventQueue)...)
+	return append(layers, updater.SerialLayers([]updater.ResourceUpdater{
 		updater.NewVM(r.cacheMng.DomainCache, cloudData.VMs).RegisterListener(
 			listener.NewVM(r.cacheMng.DomainCache, r.eventQueue)),
 		updater.NewPodCluster(r.cacheMng.DomainCache, cloudData.PodClusters).RegisterListener(
@@ -231,30 +258,20 @@ func (r *Recorder) getDomainUpdatersInOrder(cloudData cloudmodel.Resource) []upd
 			listener.NewRoutingTable(r.cacheMng.DomainCache)),
 		updater.NewDHCPPort(r.cacheMng.DomainCache, cloudData.DHCPPorts).RegisterListener(
 			listener.NewDHCPPort(r.cacheMng.DomainCache, r.eventQueue)),
-		updater.NewSecurityGroup(r.cacheMng.DomainCache, cloudData.SecurityGroups).RegisterListener(
-			listener.NewSecurityGroup(r.cacheMng.DomainCache)),
 		updater.NewSecurityGroupRule(r.cacheMng.DomainCache, cloudData.SecurityGroupRules).RegisterListener(
 			listener.NewSecurityGroupRule(r.cacheMng.DomainCache)),
 		updater.NewVMSecurityGroup(r.cacheMng.DomainCache, cloudData.VMSecurityGroups).RegisterListener(
 			listener.NewVMSecurityGroup(r.cacheMng.DomainCache)),
-		updater.NewNATGateway(r.cacheMng.DomainCache, cloudData.NATGateways).RegisterListener(
-			listener.NewNATGateway(r.cacheMng.DomainCache, r.eventQueue)),
 		updater.NewNATVMConnection(r.cacheMng.DomainCache, cloudData.NATVMConnections).RegisterListener(
 			listener.NewNATVMConnection(r.cacheMng.DomainCache)),
 		updater.NewNATRule(r.cacheMng.DomainCache, cloudData.NATRules).RegisterListener(
 			listener.NewNATRule(r.cacheMng.DomainCache)),
-		updater.NewLB(r.cacheMng.DomainCache, cloudData.LBs).RegisterListener(
-			listener.NewLB(r.cacheMng.DomainCache, r.eventQueue)),
 		updater.NewLBVMConnection(r.cacheMng.DomainCache, cloudData.LBVMConnections).RegisterListener(
 			listener.NewLBVMConnection(r.cacheMng.DomainCache)),
 		updater.NewLBListener(r.cacheMng.DomainCache, cloudData.LBListeners).RegisterListener(
 			listener.NewLBListener(r.cacheMng.DomainCache)),
 		updater.NewLBTargetServer(r.cacheMng.DomainCache, cloudData.LBTargetServers).RegisterListener(
 			listener.NewLBTargetServer(r.cacheMng.DomainCache)),
-		updater.NewRDSInstance(r.cacheMng.DomainCache, cloudData.RDSInstances).RegisterListener(
-			listener.NewRDSInstance(r.cacheMng.DomainCache, r.eventQueue)),
-		updater.NewRedisInstance(r.cacheMng.DomainCache, cloudData.RedisInstances).RegisterListener(
-			listener.NewRedisInstance(r.cacheMng.DomainCache, r.eventQueue)),
 		updater.NewPeerConnection(r.cacheMng.DomainCache, cloudData.PeerConnections).RegisterListener(
 			listener.NewPeerConnection(r.cacheMng.DomainCache)),
 		updater.NewCEN(r.cacheMng.DomainCache, cloudData.CENs).RegisterListener(
@@ -270,7 +287,7 @@ func (r *Recorder) getDomainUpdatersInOrder(cloudData cloudmodel.Resource) []upd
 			listener.NewVMPodNodeConnection(r.cacheMng.DomainCache)),
 		updater.NewProcess(r.cacheMng.DomainCache, cloudData.Processes).RegisterListener(
 			listener.NewProcess(r.cacheMng.DomainCache, r.eventQueue)),
-	}
+	})...)
 }
 
 func (r *Recorder) shouldRefreshSubDomain(lcuuid string, cloudData cloudmodel.SubDomainResource) bool {
@@ -296,8 +313,9 @@ func (r *Recorder) refreshSubDomains(cloudSubDomainResourceMap map[string]cloudm
 
 		listener := listener.NewWholeSubDomain(r.domainLcuuid, subDomainLcuuid, r.cacheMng.DomainCache, r.eventQueue)
 		subDomainUpdatersInUpdateOrder := r.getSubDomainUpdatersInOrder(subDomainLcuuid, subDomainResource, nil, nil)
-		r.executeUpdaters(subDomainUpdatersInUpdateOrder)
-		r.notifyOnResourceChanged(subDomainUpdatersInUpdateOrder)
+		r.executeUpdaters(updater.SerialLayers(subDomainUpdatersInUpdateOrder))
+		pendingCompleted := r.cacheMng.SubDomainCacheMap[subDomainLcuuid].RetryPending()
+		r.notifyOnResourceChanged(subDomainUpdatersInUpdateOrder, pendingCompleted > 0)
 		listener.OnUpdatersCompleted()
 
 		r.updateSubDomainSyncedAt(subDomainLcuuid, subDomainResource.SyncAt)
@@ -311,7 +329,7 @@ func (r *Recorder) refreshSubDomains(cloudSubDomainResourceMap map[string]cloudm
 		if !ok {
 			log.Infof("sub_domain (lcuuid: %s) clean refresh started", subDomainLcuuid)
 			subDomainUpdatersInUpdateOrder := r.getSubDomainUpdatersInOrder(subDomainLcuuid, cloudmodel.SubDomainResource{}, subDomainCache, r.cacheMng.DomainCache.ToolDataSet)
-			r.executeUpdaters(subDomainUpdatersInUpdateOrder)
+			r.executeUpdaters(updater.SerialLayers(subDomainUpdatersInUpdateOrder))
 			log.Infof("sub_domain (lcuuid: %s) clean refresh completed", subDomainLcuuid)
 		}
 	}
@@ -368,10 +386,9 @@ func (r *Recorder) getSubDomainUpdatersInOrder(subDomainLcuuid string, cloudData
 	}
 }
 
-func (r *Recorder) executeUpdaters(updatersInUpdateOrder []updater.ResourceUpdater) {
-	for _, updater := range updatersInUpdateOrder {
-		updater.HandleAddAndUpdate()
-	}
+func (r *Recorder) executeUpdaters(updaterLayers [][]updater.ResourceUpdater) {
+	updater.RunAddAndUpdate(updaterLayers, r.cfg.UpdaterWorkerPoolSize)
+	updatersInUpdateOrder := updater.FlattenLayers(updaterLayers)
 
 	// 删除操作的顺序，是创建的逆序
 	// 特殊资源：VMPodNodeConnection虽然是末序创建，但需要末序删除，序号-1；
@@ -386,8 +403,9 @@ func (r *Recorder) executeUpdaters(updatersInUpdateOrder []updater.ResourceUpdat
 	vmPodNodeConnectionUpdater.HandleDelete()
 }
 
-func (r *Recorder) notifyOnResourceChanged(updatersInUpdateOrder []updater.ResourceUpdater) {
-	platformDataChanged := isPlatformDataChanged(updatersInUpdateOrder)
+// pendingChanged: 本周期有等待资源写入成功
+func (r *Recorder) notifyOnResourceChanged(updatersInUpdateOrder []updater.ResourceUpdater, pendingChanged bool) {
+	platformDataChanged := pendingChanged || isPlatformDataChanged(updatersInUpdateOrder)
 	if platformDataChanged {
 		log.Infof("domain(%v) data changed, refresh platform data", r.domainLcuuid)
 		refresh.RefreshCache([]common.DataChanged{common.DATA_CHANGED_PLATFORM_DATA})
@@ -23,15 +23,30 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache/diffbase"
 	"github.com/deepflowio/deepflow/server/controller/recorder/db"
+	"github.com/deepflowio/deepflow/server/controller/recorder/listener"
+	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
+func init() {
+	DomainRegistry.Register(
+		ctrlrcommon.RESOURCE_TYPE_HOST_EN,
+		[]string{ctrlrcommon.RESOURCE_TYPE_REGION_EN, ctrlrcommon.RESOURCE_TYPE_AZ_EN},
+		func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater {
+			return NewHost(wholeCache, cloudData.Hosts).RegisterListener(listener.NewHost(wholeCache, eventQueue))
+		},
+	)
+}
+
 type Host struct {
 	UpdaterBase[cloudmodel.Host, mysql.Host, *diffbase.Host]
+
+	// 开启次要字段匹配时，lcuuid不在本次云平台数据中的宿主机，key为次要匹配字段，多个宿主机冲突时为nil
+	secondaryMatchDiffBases map[string]*diffbase.Host
 }
 
 func NewHost(wholeCache *cache.Cache, cloudData []cloudmodel.Host) *Host {
 	updater := &Host{
-		UpdaterBase[cloudmodel.Host, mysql.Host, *diffbase.Host]{
+		UpdaterBase: UpdaterBase[cloudmodel.Host, mysql.Host, *diffbase.Host]{
 			resourceType: ctrlrcommon.RESOURCE_TYPE_HOST_EN,
 			cache:        wholeCache,
 			dbOperator:   db.NewHost(),
@@ -40,15 +55,104 @@ func NewHost(wholeCache *cache.Cache, cloudData []cloudmodel.Host) *Host {
 		},
 	}
 	updater.dataGenerator = updater
+	updater.initSecondaryMatch()
 	return updater
 }
 
+func (h *Host) secondaryMatchKey(name, ip, azLcuuid string) string {
+	var value string
+	switch h.cache.DomainOptions.HostSecondaryMatch {
+	case cache.HOST_MATCH_BY_IP:
+		value = ip
+	case cache.HOST_MATCH_BY_NAME:
+		value = name
+	}
+	if value == "" {
+		return ""
+	}
+	return azLcuuid + "/" + value
+}
+
+func (h *Host) initSecondaryMatch() {
+	if h.cache.DomainOptions.HostSecondaryMatch == "" {
+		return
+	}
+	cloudLcuuids := make(map[string]struct{}, len(h.cloudData))
+	for _, cloudItem := range h.cloudData {
+		cloudLcuuids[cloudItem.Lcuuid] = struct{}{}
+	}
+	h.secondaryMatchDiffBases = make(map[string]*diffbase.Host)
+	for lcuuid, diffBase := range h.diffBaseData {
+		if _, ok := cloudLcuuids[lcuuid]; ok {
+			continue
+		}
+		key := h.secondaryMatchKey(diffBase.Name, diffBase.IP, diffBase.AZLcuuid)
+		if key == "" {
+			continue
+		}
+		if _, ok := h.secondaryMatchDiffBases[key]; ok {
+			// 无法确定对应关系，不做匹配
+			h.secondaryMatchDiffBases[key] = nil
+			continue
+		}
+		h.secondaryMatchDiffBases[key] = diffBase
+	}
+}
+
 func (h *Host) getDiffBaseByCloudItem(cloudItem *cloudmodel.Host) (diffBase *diffbase.Host, exists bool) {
 	diffBase, exists = h.diffBaseData[cloudItem.Lcuuid]
-	return
+	if exists || h.secondaryMatchDiffBases == nil {
+		return
+	}
+	key := h.secondaryMatchKey(cloudItem.Name, cloudItem.IP, cloudItem.AZLcuuid)
+	diffBase = h.secondaryMatchDiffBases[key]
+	if diffBase == nil {
+		return nil, false
+	}
+	// 每个已有宿主机只匹配一次
+	delete(h.secondaryMatchDiffBases, key)
+	log.Infof("%s (lcuuid: %s) matched existing one (lcuuid: %s) by %s",
+		ctrlrcommon.RESOURCE_TYPE_HOST_EN, cloudItem.Lcuuid, diffBase.Lcuuid, h.cache.DomainOptions.HostSecondaryMatch)
+	return diffBase, true
 }
 
 func (h *Host) generateDBItemToAdd(cloudItem *cloudmodel.Host) (*mysql.Host, bool) {
+	// 可用区尚未同步时暂不写入，加入等待队列，由RetryPending重试
+	if !h.azSynced(cloudItem) {
+		pendingItem := *cloudItem
+		h.cache.AddPending(cloudItem.Lcuuid, func() bool { return h.retryAdd(&pendingItem) })
+		return nil, false
+	}
+	h.cache.DeletePending(cloudItem.Lcuuid)
+	return h.newDBItem(cloudItem), true
+}
+
+func (h *Host) azSynced(cloudItem *cloudmodel.Host) bool {
+	if cloudItem.AZLcuuid == "" {
+		return true
+	}
+	if _, exists := h.cache.ToolDataSet.GetAZIDByLcuuid(cloudItem.AZLcuuid); !exists {
+		log.Infof(resourceAForResourceBNotFound(
+			ctrlrcommon.RESOURCE_TYPE_AZ_EN, cloudItem.AZLcuuid,
+			ctrlrcommon.RESOURCE_TYPE_HOST_EN, cloudItem.Lcuuid,
+		))
+		return false
+	}
+	return true
+}
+
+func (h *Host) retryAdd(cloudItem *cloudmodel.Host) bool {
+	if _, exists := h.getDiffBaseByCloudItem(cloudItem); exists {
+		return true
+	}
+	if !h.azSynced(cloudItem) {
+		return false
+	}
+	h.add([]*mysql.Host{h.newDBItem(cloudItem)})
+	return true
+}
+
+func (h *Host) newDBItem(cloudItem *cloudmodel.Host) *mysql.Host {
 	dbItem := &mysql.Host{
 		Name:       cloudItem.Name,
 		IP:         cloudItem.IP,
@@ -56,6 +160,7 @@ func (h *Host) generateDBItemToAdd(cloudItem *cloudmodel.Host) (*mysql.Host, boo
 		HType:      cloudItem.HType,
 		VCPUNum:    cloudItem.VCPUNum,
 		MemTotal:   cloudItem.MemTotal,
+		NICNum:     cloudItem.NICNum,
 		ExtraInfo:  cloudItem.ExtraInfo,
 		UserName:   "root",
 		UserPasswd: "deepflow",
@@ -65,11 +170,15 @@ func (h *Host) generateDBItemToAdd(cloudItem *cloudmodel.Host) (*mysql.Host, boo
 		Domain:     h.cache.DomainLcuuid,
 	}
 	dbItem.Lcuuid = cloudItem.Lcuuid
-	return dbItem, true
+	return dbItem
 }
 
 func (h *Host) generateUpdateInfo(diffBase *diffbase.Host, cloudItem *cloudmodel.Host) (map[string]interface{}, bool) {
 	updateInfo := make(map[string]interface{})
+	// 按次要字段匹配到的宿主机，沿用原有记录并更新lcuuid
+	if diffBase.Lcuuid != cloudItem.Lcuuid {
+		updateInfo["lcuuid"] = cloudItem.Lcuuid
+	}
 	if diffBase.Name != cloudItem.Name {
 		updateInfo["name"] = cloudItem.Name
 	}
@@ -85,6 +194,9 @@ func (h *Host) generateUpdateInfo(diffBase *diffbase.Host, cloudItem *cloudmodel
 	if diffBase.MemTotal != cloudItem.MemTotal {
 		updateInfo["mem_total"] = cloudItem.MemTotal
 	}
+	if diffBase.NICNum != cloudItem.NICNum {
+		updateInfo["nic_num"] = cloudItem.NICNum
+	}
 	if diffBase.ExtraInfo != cloudItem.ExtraInfo {
 		updateInfo["extra_info"] = cloudItem.ExtraInfo
 	}
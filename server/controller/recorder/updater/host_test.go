@@ -18,15 +18,23 @@ package updater
 
 import (
 	"math/rand"
+	"os"
+	"strings"
+	"sync/atomic"
 
 	"github.com/google/uuid"
+	"github.com/op/go-logging"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 
 	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
+	ctrlrcommon "github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/controller/db/mysql"
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache/diffbase"
+	"github.com/deepflowio/deepflow/server/controller/recorder/event"
+	"github.com/deepflowio/deepflow/server/controller/recorder/listener"
+	"github.com/deepflowio/deepflow/server/libs/eventapi"
 )
 
 func newCloudHost() cloudmodel.Host {
@@ -44,6 +52,7 @@ func (t *SuiteTest) getHostMock(mockDB bool) (*cache.Cache, cloudmodel.Host) {
 	domainLcuuid := uuid.New().String()
 
 	cache_ := cache.NewCache(domainLcuuid)
+	cache_.ToolDataSet.AddAZ(&mysql.AZ{Base: mysql.Base{ID: randID(), Lcuuid: cloudItem.AZLcuuid}})
 	if mockDB {
 		t.db.Create(&mysql.Host{Name: cloudItem.Name, Base: mysql.Base{Lcuuid: cloudItem.Lcuuid}, Domain: domainLcuuid})
 		cache_.DiffBaseDataSet.Hosts[cloudItem.Lcuuid] = &diffbase.Host{DiffBase: diffbase.DiffBase{Lcuuid: cloudItem.Lcuuid}, Name: cloudItem.Name}
@@ -69,6 +78,52 @@ func (t *SuiteTest) TestHandleAddHostSucess() {
 	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
 }
 
+func (t *SuiteTest) TestHandleAddHostIncreasesAddCounter() {
+	cache, cloudItem := t.getHostMock(false)
+	counter := GetResourceCounter(ctrlrcommon.RESOURCE_TYPE_HOST_EN)
+	before := atomic.LoadUint64(&counter.ActionCounter.Add)
+
+	updater := NewHost(cache, []cloudmodel.Host{cloudItem})
+	updater.HandleAddAndUpdate()
+
+	assert.Equal(t.T(), before+1, atomic.LoadUint64(&counter.ActionCounter.Add))
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
+func (t *SuiteTest) TestHandleAddDuplicatedHosts() {
+	cache, cloudItem := t.getHostMock(false)
+	duplicatedItem := cloudItem
+	duplicatedItem.Name = cloudItem.Name + "new"
+	counter := GetResourceCounter(ctrlrcommon.RESOURCE_TYPE_HOST_EN)
+	before := atomic.LoadUint64(&counter.ActionCounter.Duplicate)
+
+	backend := logging.NewMemoryBackend(1024)
+	logging.SetBackend(backend)
+	defer logging.SetBackend(logging.NewLogBackend(os.Stderr, "", 0))
+
+	updater := NewHost(cache, []cloudmodel.Host{cloudItem, duplicatedItem})
+	updater.HandleAddAndUpdate()
+
+	var addedItems []*mysql.Host
+	result := t.db.Where("lcuuid = ?", cloudItem.Lcuuid).Find(&addedItems)
+	assert.Equal(t.T(), result.RowsAffected, int64(1))
+	assert.Equal(t.T(), addedItems[0].Name, duplicatedItem.Name)
+	assert.Equal(t.T(), len(cache.DiffBaseDataSet.Hosts), 1)
+	assert.Equal(t.T(), before+1, atomic.LoadUint64(&counter.ActionCounter.Duplicate))
+
+	logged := false
+	for node := backend.Head(); node != nil; node = node.Next() {
+		if strings.Contains(node.Record.Message(), "duplicated in cloud data (lcuuid: "+cloudItem.Lcuuid) {
+			logged = true
+			break
+		}
+	}
+	assert.True(t.T(), logged)
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
 func (t *SuiteTest) TestHandleUpdateHostSucess() {
 	cache, cloudItem := t.getHostMock(true)
 	cloudItem.Name = cloudItem.Name + "new"
@@ -89,6 +144,39 @@ func (t *SuiteTest) TestHandleUpdateHostSucess() {
 	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
 }
 
+func (t *SuiteTest) TestHandleUpdateHostCapacity() {
+	cache_, cloudItem := t.getHostMock(true)
+	hostID := randID()
+	cache_.ToolDataSet.AddHost(&mysql.Host{Base: mysql.Base{ID: hostID, Lcuuid: cloudItem.Lcuuid}, Name: cloudItem.Name})
+	cache_.DiffBaseDataSet.Hosts[cloudItem.Lcuuid].VCPUNum = cloudItem.VCPUNum
+	cloudItem.MemTotal = 16384
+	eventQueue := event.NewEventQueue()
+
+	updater := NewHost(cache_, []cloudmodel.Host{cloudItem})
+	updater.RegisterListener(listener.NewHost(cache_, eventQueue))
+	updater.HandleAddAndUpdate()
+
+	var updatedItem *mysql.Host
+	t.db.Where("lcuuid = ?", cloudItem.Lcuuid).Find(&updatedItem)
+	assert.Equal(t.T(), 16384, updatedItem.MemTotal)
+	assert.Equal(t.T(), 16384, cache_.DiffBaseDataSet.Hosts[cloudItem.Lcuuid].MemTotal)
+	if assert.Equal(t.T(), 1, eventQueue.Len()) {
+		e := eventQueue.Get().(*eventapi.ResourceEvent)
+		assert.Equal(t.T(), eventapi.RESOURCE_EVENT_TYPE_UPDATE_CAPACITY, e.Type)
+		assert.Equal(t.T(), uint32(hostID), e.InstanceID)
+		assert.Contains(t.T(), e.Description, "mem: 16384M")
+	}
+
+	// 容量未变化时不更新也不产生事件
+	updater = NewHost(cache_, []cloudmodel.Host{cloudItem})
+	updater.RegisterListener(listener.NewHost(cache_, eventQueue))
+	updater.HandleAddAndUpdate()
+	assert.False(t.T(), updater.GetChanged())
+	assert.Equal(t.T(), 0, eventQueue.Len())
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
 func (t *SuiteTest) TestHandleDeleteHostSucess() {
 	cache, cloudItem := t.getHostMock(true)
 	assert.Equal(t.T(), len(cache.DiffBaseDataSet.Hosts), 1)
@@ -101,3 +189,123 @@ func (t *SuiteTest) TestHandleDeleteHostSucess() {
 	assert.Equal(t.T(), result.RowsAffected, int64(0))
 	assert.Equal(t.T(), len(cache.DiffBaseDataSet.Hosts), 0)
 }
+
+func (t *SuiteTest) TestHandleDeleteHostAbsentInDB() {
+	cache_, cloudItem := t.getHostMock(false)
+	cache_.DiffBaseDataSet.Hosts[cloudItem.Lcuuid] = &diffbase.Host{DiffBase: diffbase.DiffBase{Lcuuid: cloudItem.Lcuuid}, Name: cloudItem.Name}
+	cache_.ToolDataSet.AddHost(&mysql.Host{Base: mysql.Base{ID: randID(), Lcuuid: cloudItem.Lcuuid}, Name: cloudItem.Name})
+
+	updater := NewHost(cache_, []cloudmodel.Host{})
+	updater.RegisterListener(listener.NewHost(cache_, nil))
+	updater.HandleDelete()
+
+	assert.True(t.T(), updater.GetChanged())
+	assert.Equal(t.T(), 0, len(cache_.DiffBaseDataSet.Hosts))
+	_, ok := cache_.ToolDataSet.GetHostIDByLcuuid(cloudItem.Lcuuid)
+	assert.False(t.T(), ok)
+}
+
+func (t *SuiteTest) TestHandleAddHostWithPendingAZ() {
+	cache_ := cache.NewCache(uuid.New().String())
+	cloudItem := newCloudHost()
+
+	// 第一个周期：可用区尚未同步，host进入等待队列
+	cache_.SetSequence(1)
+	NewHost(cache_, []cloudmodel.Host{cloudItem}).HandleAddAndUpdate()
+	assert.Equal(t.T(), 0, cache_.RetryPending())
+	var count int64
+	t.db.Model(&mysql.Host{}).Where("lcuuid = ?", cloudItem.Lcuuid).Count(&count)
+	assert.Equal(t.T(), int64(0), count)
+	assert.Equal(t.T(), 1, cache_.GetPendingCount())
+
+	// 第二个周期：host先于可用区处理，可用区同步后RetryPending写入host
+	cache_.SetSequence(2)
+	NewHost(cache_, []cloudmodel.Host{cloudItem}).HandleAddAndUpdate()
+	cache_.AddAZ(&mysql.AZ{Base: mysql.Base{ID: randID(), Lcuuid: cloudItem.AZLcuuid}})
+	assert.Equal(t.T(), 1, cache_.RetryPending())
+	var addedItem *mysql.Host
+	result := t.db.Where("lcuuid = ?", cloudItem.Lcuuid).Find(&addedItem)
+	assert.Equal(t.T(), int64(1), result.RowsAffected)
+	assert.Equal(t.T(), cloudItem.AZLcuuid, addedItem.AZ)
+	assert.Equal(t.T(), 0, cache_.GetPendingCount())
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
+func (t *SuiteTest) getRenamedHostMock(secondaryMatch string) (*cache.Cache, *mysql.Host, cloudmodel.Host) {
+	cache_, cloudItem := t.getHostMock(false)
+	cache_.DomainOptions.HostSecondaryMatch = secondaryMatch
+	oldItem := &mysql.Host{
+		Base: mysql.Base{ID: randID(), Lcuuid: cloudItem.Lcuuid}, Name: cloudItem.Name, IP: "10.0.0.1",
+		VCPUNum: cloudItem.VCPUNum, AZ: cloudItem.AZLcuuid, Domain: cache_.DomainLcuuid,
+	}
+	t.db.Create(oldItem)
+	cache_.AddHost(oldItem)
+
+	// 云平台重命名后重新生成了lcuuid
+	cloudItem.Lcuuid = uuid.New().String()
+	cloudItem.Name = cloudItem.Name + "-renamed"
+	cloudItem.IP = oldItem.IP
+	return cache_, oldItem, cloudItem
+}
+
+func (t *SuiteTest) TestHandleRenamedHostMatchedByIP() {
+	cache_, oldItem, cloudItem := t.getRenamedHostMock(cache.HOST_MATCH_BY_IP)
+	cache_.SetSequence(cache_.GetSequence() + 1)
+
+	updater := NewHost(cache_, []cloudmodel.Host{cloudItem})
+	updater.RegisterListener(listener.NewHost(cache_, nil))
+	updater.HandleAddAndUpdate()
+	updater.HandleDelete()
+
+	var hosts []*mysql.Host
+	t.db.Where("domain = ?", cache_.DomainLcuuid).Find(&hosts)
+	if assert.Equal(t.T(), 1, len(hosts)) {
+		assert.Equal(t.T(), oldItem.ID, hosts[0].ID)
+		assert.Equal(t.T(), cloudItem.Lcuuid, hosts[0].Lcuuid)
+		assert.Equal(t.T(), cloudItem.Name, hosts[0].Name)
+	}
+	assert.Equal(t.T(), 1, len(cache_.DiffBaseDataSet.Hosts))
+	assert.Contains(t.T(), cache_.DiffBaseDataSet.Hosts, cloudItem.Lcuuid)
+	id, ok := cache_.ToolDataSet.GetHostIDByLcuuid(cloudItem.Lcuuid)
+	assert.True(t.T(), ok)
+	assert.Equal(t.T(), oldItem.ID, id)
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
+func (t *SuiteTest) TestHandleRenamedHostWithoutSecondaryMatch() {
+	cache_, oldItem, cloudItem := t.getRenamedHostMock("")
+	cache_.SetSequence(cache_.GetSequence() + 1)
+
+	updater := NewHost(cache_, []cloudmodel.Host{cloudItem})
+	updater.HandleAddAndUpdate()
+
+	var count int64
+	t.db.Model(&mysql.Host{}).Where("lcuuid = ?", cloudItem.Lcuuid).Count(&count)
+	assert.Equal(t.T(), int64(1), count)
+	t.db.Model(&mysql.Host{}).Where("lcuuid = ?", oldItem.Lcuuid).Count(&count)
+	assert.Equal(t.T(), int64(1), count)
+
+	t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&mysql.Host{})
+}
+
+func (t *SuiteTest) TestHandleAddHostPendingDisappeared() {
+	cache_ := cache.NewCache(uuid.New().String())
+	cloudItem := newCloudHost()
+
+	cache_.SetSequence(1)
+	NewHost(cache_, []cloudmodel.Host{cloudItem}).HandleAddAndUpdate()
+	assert.Equal(t.T(), 0, cache_.RetryPending())
+	assert.Equal(t.T(), 1, cache_.GetPendingCount())
+
+	// 第二个周期：host已不在云平台数据中，即使可用区已同步也不再写入
+	cache_.SetSequence(2)
+	cache_.AddAZ(&mysql.AZ{Base: mysql.Base{ID: randID(), Lcuuid: cloudItem.AZLcuuid}})
+	NewHost(cache_, []cloudmodel.Host{}).HandleAddAndUpdate()
+	assert.Equal(t.T(), 0, cache_.RetryPending())
+	assert.Equal(t.T(), 0, cache_.GetPendingCount())
+	var count int64
+	t.db.Model(&mysql.Host{}).Where("lcuuid = ?", cloudItem.Lcuuid).Count(&count)
+	assert.Equal(t.T(), int64(0), count)
+}
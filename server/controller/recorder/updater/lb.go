@@ -23,8 +23,20 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache/diffbase"
 	"github.com/deepflowio/deepflow/server/controller/recorder/db"
+	"github.com/deepflowio/deepflow/server/controller/recorder/listener"
+	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
+func init() {
+	DomainRegistry.Register(
+		ctrlrcommon.RESOURCE_TYPE_LB_EN,
+		[]string{ctrlrcommon.RESOURCE_TYPE_REGION_EN, ctrlrcommon.RESOURCE_TYPE_VPC_EN},
+		func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater {
+			return NewLB(wholeCache, cloudData.LBs).RegisterListener(listener.NewLB(wholeCache, eventQueue))
+		},
+	)
+}
+
 type LB struct {
 	UpdaterBase[cloudmodel.LB, mysql.LB, *diffbase.LB]
 }
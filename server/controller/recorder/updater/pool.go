@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package updater
+
+import (
+	"sync"
+)
+
+// SerialLayers 将按顺序执行的 Updater 逐个作为一层
+func SerialLayers(updaters []ResourceUpdater) [][]ResourceUpdater {
+	layers := make([][]ResourceUpdater, 0, len(updaters))
+	for _, updater := range updaters {
+		layers = append(layers, []ResourceUpdater{updater})
+	}
+	return layers
+}
+
+// FlattenLayers 按层级顺序展开 Updater
+func FlattenLayers(layers [][]ResourceUpdater) []ResourceUpdater {
+	updaters := []ResourceUpdater{}
+	for _, layer := range layers {
+		updaters = append(updaters, layer...)
+	}
+	return updaters
+}
+
+// RunAddAndUpdate 逐层执行 HandleAddAndUpdate，上一层全部完成后再执行下一层
+// 同一层级内的 Updater 互不依赖，由最多 poolSize 个 goroutine 并发执行，poolSize <= 1 时按顺序执行
+func RunAddAndUpdate(layers [][]ResourceUpdater, poolSize int) {
+	for _, layer := range layers {
+		if poolSize <= 1 || len(layer) <= 1 {
+			for _, updater := range layer {
+				updater.HandleAddAndUpdate()
+			}
+			continue
+		}
+		workerNum := poolSize
+		if workerNum > len(layer) {
+			workerNum = len(layer)
+		}
+		updaters := make(chan ResourceUpdater, len(layer))
+		for _, updater := range layer {
+			updaters <- updater
+		}
+		close(updaters)
+		var wg sync.WaitGroup
+		wg.Add(workerNum)
+		for i := 0; i < workerNum; i++ {
+			go func() {
+				defer wg.Done()
+				for updater := range updaters {
+					updater.HandleAddAndUpdate()
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
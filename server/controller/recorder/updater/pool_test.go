@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package updater
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+
+	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/db/mysql"
+	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
+	"github.com/deepflowio/deepflow/server/controller/recorder/event"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+)
+
+// 模拟耗时的 Updater，记录完成情况及并发数，并通过 cache 写入等待队列
+type concurrentFakeUpdater struct {
+	fakeUpdater
+	cache     *cache.Cache
+	running   *int32
+	maxActive *int32
+	done      map[string]bool
+	doneLock  *sync.Mutex
+	// 执行时需已完成的依赖
+	dependencies []string
+	missingDeps  *int32
+	// 持有 cache 锁写入的共享数据
+	written *int
+}
+
+func (f *concurrentFakeUpdater) HandleAddAndUpdate() {
+	active := atomic.AddInt32(f.running, 1)
+	for {
+		max := atomic.LoadInt32(f.maxActive)
+		if active <= max || atomic.CompareAndSwapInt32(f.maxActive, max, active) {
+			break
+		}
+	}
+	f.doneLock.Lock()
+	for _, dependency := range f.dependencies {
+		if !f.done[dependency] {
+			atomic.AddInt32(f.missingDeps, 1)
+		}
+	}
+	f.doneLock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+	f.cache.AddPending(f.resourceType, func() bool { return true })
+	f.cache.Lock()
+	*f.written++
+	f.cache.Unlock()
+
+	f.doneLock.Lock()
+	f.done[f.resourceType] = true
+	f.doneLock.Unlock()
+	atomic.AddInt32(f.running, -1)
+}
+
+func TestRunAddAndUpdateConcurrently(t *testing.T) {
+	for _, poolSize := range []int{1, 3} {
+		wholeCache := cache.NewCache("domain")
+		var running, maxActive, missingDeps int32
+		var written int
+		done := make(map[string]bool)
+		doneLock := &sync.Mutex{}
+		newUpdater := func(resourceType string, dependencies ...string) ResourceUpdater {
+			return &concurrentFakeUpdater{
+				fakeUpdater:  fakeUpdater{resourceType: resourceType},
+				cache:        wholeCache,
+				running:      &running,
+				maxActive:    &maxActive,
+				done:         done,
+				doneLock:     doneLock,
+				dependencies: dependencies,
+				missingDeps:  &missingDeps,
+				written:      &written,
+			}
+		}
+		independent := []ResourceUpdater{}
+		for i := 0; i < 6; i++ {
+			independent = append(independent, newUpdater(fmt.Sprintf("independent_%d", i), "region"))
+		}
+		layers := [][]ResourceUpdater{
+			{newUpdater("region")},
+			independent,
+			{newUpdater("vm", "independent_0", "independent_5")},
+		}
+
+		RunAddAndUpdate(layers, poolSize)
+		assert.Len(t, done, 8)
+		assert.Equal(t, int32(0), missingDeps)
+		assert.Equal(t, int32(poolSize), maxActive)
+		assert.Equal(t, 8, wholeCache.GetPendingCount())
+		assert.Equal(t, 8, written)
+		assert.Equal(t, 8, wholeCache.RetryPending())
+	}
+}
+
+func TestRegistryBuildLayers(t *testing.T) {
+	calls := []string{}
+	fakeBuilder := func(resourceType string) Builder {
+		return func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater {
+			return &fakeUpdater{resourceType: resourceType, calls: &calls}
+		}
+	}
+	registry := NewRegistry()
+	registry.Register("pod_node", []string{"host", "pod_cluster"}, fakeBuilder("pod_node"))
+	registry.Register("host", []string{"az"}, fakeBuilder("host"))
+	registry.Register("vip", nil, fakeBuilder("vip"))
+	registry.Register("pod_cluster", []string{"vip"}, fakeBuilder("pod_cluster"))
+
+	layerTypes := [][]string{}
+	for _, layer := range registry.BuildLayers(cache.NewCache("domain"), cloudmodel.Resource{}, nil) {
+		resourceTypes := []string{}
+		for _, updater := range layer {
+			resourceTypes = append(resourceTypes, updater.GetMySQLModelString()[0])
+		}
+		layerTypes = append(layerTypes, resourceTypes)
+	}
+	assert.Equal(t, [][]string{{"host", "vip"}, {"pod_cluster"}, {"pod_node"}}, layerTypes)
+}
+
+// 已注册的 Updater 位于同一层级，共用一个 cache 并发执行，需配合 -race 运行
+func (t *SuiteTest) TestRunDomainRegistryUpdatersConcurrently() {
+	// sqlite 并发写入会返回 database is locked，串行访问数据库，Updater 仍并发读写 cache
+	sqlDB, _ := t.db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.SetMaxOpenConns(100)
+
+	domainLcuuid := uuid.New().String()
+	wholeCache := cache.NewCache(domainLcuuid)
+	wholeCache.SetSequence(1)
+	regionLcuuid, azLcuuid, vpcLcuuid := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	wholeCache.ToolDataSet.AddRegion(&mysql.Region{Base: mysql.Base{ID: 1, Lcuuid: regionLcuuid}})
+	wholeCache.ToolDataSet.AddAZ(&mysql.AZ{Base: mysql.Base{ID: 1, Lcuuid: azLcuuid}, Region: regionLcuuid})
+	wholeCache.ToolDataSet.AddVPC(&mysql.VPC{Base: mysql.Base{ID: 1, Lcuuid: vpcLcuuid}, Region: regionLcuuid})
+
+	// 已有资源改名触发更新，安全组没有已有资源触发添加
+	const count = 20
+	cloudData := cloudmodel.Resource{}
+	for i := 1; i <= count; i++ {
+		base := mysql.Base{ID: i, Lcuuid: uuid.New().String()}
+		host := &mysql.Host{Base: base, Name: "old", AZ: azLcuuid, Region: regionLcuuid, Domain: domainLcuuid}
+		t.db.Create(host)
+		wholeCache.AddHosts([]*mysql.Host{host})
+		cloudData.Hosts = append(cloudData.Hosts, cloudmodel.Host{Lcuuid: base.Lcuuid, Name: "new", AZLcuuid: azLcuuid, RegionLcuuid: regionLcuuid})
+
+		base.Lcuuid = uuid.New().String()
+		natGateway := &mysql.NATGateway{Base: base, Name: "old", VPCID: 1, Region: regionLcuuid, Domain: domainLcuuid}
+		t.db.Create(natGateway)
+		wholeCache.AddNATGateways([]*mysql.NATGateway{natGateway})
+		cloudData.NATGateways = append(cloudData.NATGateways, cloudmodel.NATGateway{Lcuuid: base.Lcuuid, Name: "new", VPCLcuuid: vpcLcuuid, RegionLcuuid: regionLcuuid})
+
+		base.Lcuuid = uuid.New().String()
+		lb := &mysql.LB{Base: base, Name: "old", VPCID: 1, Region: regionLcuuid, Domain: domainLcuuid}
+		t.db.Create(lb)
+		wholeCache.AddLBs([]*mysql.LB{lb})
+		cloudData.LBs = append(cloudData.LBs, cloudmodel.LB{Lcuuid: base.Lcuuid, Name: "new", VPCLcuuid: vpcLcuuid, RegionLcuuid: regionLcuuid})
+
+		base.Lcuuid = uuid.New().String()
+		rdsInstance := &mysql.RDSInstance{Base: base, Name: "old", VPCID: 1, AZ: azLcuuid, Region: regionLcuuid, Domain: domainLcuuid}
+		t.db.Create(rdsInstance)
+		wholeCache.AddRDSInstances([]*mysql.RDSInstance{rdsInstance})
+		cloudData.RDSInstances = append(cloudData.RDSInstances, cloudmodel.RDSInstance{Lcuuid: base.Lcuuid, Name: "new", VPCLcuuid: vpcLcuuid, AZLcuuid: azLcuuid, RegionLcuuid: regionLcuuid})
+
+		base.Lcuuid = uuid.New().String()
+		redisInstance := &mysql.RedisInstance{Base: base, Name: "old", VPCID: 1, AZ: azLcuuid, Region: regionLcuuid, Domain: domainLcuuid}
+		t.db.Create(redisInstance)
+		wholeCache.AddRedisInstances([]*mysql.RedisInstance{redisInstance})
+		cloudData.RedisInstances = append(cloudData.RedisInstances, cloudmodel.RedisInstance{Lcuuid: base.Lcuuid, Name: "new", VPCLcuuid: vpcLcuuid, AZLcuuid: azLcuuid, RegionLcuuid: regionLcuuid})
+
+		cloudData.SecurityGroups = append(cloudData.SecurityGroups, cloudmodel.SecurityGroup{Lcuuid: uuid.New().String(), Name: "new", VPCLcuuid: vpcLcuuid, RegionLcuuid: regionLcuuid})
+	}
+
+	layers := DomainRegistry.BuildLayers(wholeCache, cloudData, event.NewEventQueue())
+	if !assert.Len(t.T(), layers, 1) {
+		return
+	}
+	assert.Len(t.T(), layers[0], 6)
+	RunAddAndUpdate(layers, len(layers[0]))
+
+	for _, updater := range layers[0] {
+		assert.True(t.T(), updater.GetChanged(), updater.GetMySQLModelString())
+	}
+	for _, diffBase := range wholeCache.DiffBaseDataSet.Hosts {
+		assert.Equal(t.T(), "new", diffBase.Name)
+	}
+	for _, diffBase := range wholeCache.DiffBaseDataSet.NATGateways {
+		assert.Equal(t.T(), "new", diffBase.Name)
+	}
+	for _, diffBase := range wholeCache.DiffBaseDataSet.LBs {
+		assert.Equal(t.T(), "new", diffBase.Name)
+	}
+	for _, diffBase := range wholeCache.DiffBaseDataSet.RDSInstances {
+		assert.Equal(t.T(), "new", diffBase.Name)
+	}
+	for _, diffBase := range wholeCache.DiffBaseDataSet.RedisInstances {
+		assert.Equal(t.T(), "new", diffBase.Name)
+	}
+	assert.Len(t.T(), wholeCache.DiffBaseDataSet.SecurityGroups, count)
+	for _, model := range []interface{}{&mysql.Host{}, &mysql.NATGateway{}, &mysql.LB{}, &mysql.RDSInstance{}, &mysql.RedisInstance{}} {
+		var updated int64
+		t.db.Model(model).Where("domain = ? AND name = ?", domainLcuuid, "new").Count(&updated)
+		assert.Equal(t.T(), int64(count), updated)
+	}
+
+	for _, model := range []interface{}{&mysql.Host{}, &mysql.NATGateway{}, &mysql.LB{}, &mysql.RDSInstance{}, &mysql.RedisInstance{}, &mysql.SecurityGroup{}} {
+		t.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model)
+	}
+}
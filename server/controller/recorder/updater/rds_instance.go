@@ -23,8 +23,20 @@ import (
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
 	"github.com/deepflowio/deepflow/server/controller/recorder/cache/diffbase"
 	"github.com/deepflowio/deepflow/server/controller/recorder/db"
+	"github.com/deepflowio/deepflow/server/controller/recorder/listener"
+	"github.com/deepflowio/deepflow/server/libs/queue"
 )
 
+func init() {
+	DomainRegistry.Register(
+		ctrlrcommon.RESOURCE_TYPE_RDS_INSTANCE_EN,
+		[]string{ctrlrcommon.RESOURCE_TYPE_REGION_EN, ctrlrcommon.RESOURCE_TYPE_AZ_EN, ctrlrcommon.RESOURCE_TYPE_VPC_EN},
+		func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater {
+			return NewRDSInstance(wholeCache, cloudData.RDSInstances).RegisterListener(listener.NewRDSInstance(wholeCache, eventQueue))
+		},
+	)
+}
+
 type RDSInstance struct {
 	UpdaterBase[cloudmodel.RDSInstance, mysql.RDSInstance, *diffbase.RDSInstance]
 }
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package updater
+
+import (
+	"fmt"
+	"sort"
+
+	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+)
+
+// DomainRegistry 记录以 Domain 云数据构造的资源 Updater，各资源在 init 中注册
+var DomainRegistry = NewRegistry()
+
+// Builder 根据 cache 与云数据构造资源 Updater，并注册所需的监听器
+type Builder func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater
+
+type registration struct {
+	resourceType string
+	dependencies []string
+	build        Builder
+}
+
+// Registry 按依赖顺序构造已注册的资源 Updater
+// 依赖中未注册的资源类型由调用方自行保证先于 Registry 中的 Updater 执行
+type Registry struct {
+	registrations map[string]registration
+	orderedTypes  []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{registrations: make(map[string]registration)}
+}
+
+// Register 注册资源 Updater，重复注册或存在循环依赖时 panic
+func (r *Registry) Register(resourceType string, dependencies []string, build Builder) {
+	if _, ok := r.registrations[resourceType]; ok {
+		panic(fmt.Sprintf("updater of resource type (%s) already registered", resourceType))
+	}
+	r.registrations[resourceType] = registration{resourceType: resourceType, dependencies: dependencies, build: build}
+	orderedTypes, err := r.sortByDependency()
+	if err != nil {
+		delete(r.registrations, resourceType)
+		panic(err)
+	}
+	r.orderedTypes = orderedTypes
+}
+
+// ResourceTypes 返回依赖顺序下的资源类型，被依赖的资源在前
+func (r *Registry) ResourceTypes() []string {
+	return append([]string{}, r.orderedTypes...)
+}
+
+// Build 按依赖顺序构造全部已注册的资源 Updater
+func (r *Registry) Build(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) []ResourceUpdater {
+	updaters := make([]ResourceUpdater, 0, len(r.orderedTypes))
+	for _, resourceType := range r.orderedTypes {
+		updaters = append(updaters, r.registrations[resourceType].build(wholeCache, cloudData, eventQueue))
+	}
+	return updaters
+}
+
+// BuildLayers 按依赖层级构造全部已注册的资源 Updater，同一层级内的 Updater 互不依赖，可并发执行
+func (r *Registry) BuildLayers(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) [][]ResourceUpdater {
+	layers := [][]ResourceUpdater{}
+	for _, resourceTypes := range r.layeredTypes() {
+		layer := make([]ResourceUpdater, 0, len(resourceTypes))
+		for _, resourceType := range resourceTypes {
+			layer = append(layer, r.registrations[resourceType].build(wholeCache, cloudData, eventQueue))
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// 资源所在层级为其已注册依赖的最大层级+1，无已注册依赖的资源位于第0层
+func (r *Registry) layeredTypes() [][]string {
+	depths := make(map[string]int, len(r.orderedTypes))
+	layers := [][]string{}
+	for _, resourceType := range r.orderedTypes {
+		depth := 0
+		for _, dependency := range r.registrations[resourceType].dependencies {
+			if dependencyDepth, ok := depths[dependency]; ok && dependencyDepth+1 > depth {
+				depth = dependencyDepth + 1
+			}
+		}
+		depths[resourceType] = depth
+		if depth == len(layers) {
+			layers = append(layers, []string{})
+		}
+		layers[depth] = append(layers[depth], resourceType)
+	}
+	return layers
+}
+
+// 拓扑排序，同一层级的资源按类型名排序，保证顺序稳定
+func (r *Registry) sortByDependency() ([]string, error) {
+	resourceTypes := make([]string, 0, len(r.registrations))
+	for resourceType := range r.registrations {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	states := make(map[string]int, len(resourceTypes))
+	orderedTypes := make([]string, 0, len(resourceTypes))
+	var visit func(resourceType string) error
+	visit = func(resourceType string) error {
+		switch states[resourceType] {
+		case visiting:
+			return fmt.Errorf("updater of resource type (%s) has circular dependency", resourceType)
+		case visited:
+			return nil
+		}
+		states[resourceType] = visiting
+		for _, dependency := range r.registrations[resourceType].dependencies {
+			if _, ok := r.registrations[dependency]; !ok {
+				continue
+			}
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		states[resourceType] = visited
+		orderedTypes = append(orderedTypes, resourceType)
+		return nil
+	}
+	for _, resourceType := range resourceTypes {
+		if err := visit(resourceType); err != nil {
+			return nil, err
+		}
+	}
+	return orderedTypes, nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package updater
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	cloudmodel "github.com/deepflowio/deepflow/server/controller/cloud/model"
+	"github.com/deepflowio/deepflow/server/controller/recorder/cache"
+	"github.com/deepflowio/deepflow/server/libs/queue"
+)
+
+type fakeUpdater struct {
+	resourceType string
+	calls        *[]string
+}
+
+func (f *fakeUpdater) HandleAddAndUpdate() {
+	*f.calls = append(*f.calls, "add_and_update:"+f.resourceType)
+}
+
+func (f *fakeUpdater) HandleDelete() {
+	*f.calls = append(*f.calls, "delete:"+f.resourceType)
+}
+
+func (f *fakeUpdater) GetChanged() bool {
+	return false
+}
+
+func (f *fakeUpdater) GetMySQLModelString() []string {
+	return []string{f.resourceType}
+}
+
+func TestRegistryBuildInDependencyOrder(t *testing.T) {
+	calls := []string{}
+	fakeBuilder := func(resourceType string) Builder {
+		return func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater {
+			return &fakeUpdater{resourceType: resourceType, calls: &calls}
+		}
+	}
+	registry := NewRegistry()
+	registry.Register("pod_node", []string{"host", "pod_cluster"}, fakeBuilder("pod_node"))
+	registry.Register("host", []string{"az"}, fakeBuilder("host"))
+	registry.Register("vip", nil, fakeBuilder("vip"))
+	registry.Register("pod_cluster", []string{"vip"}, fakeBuilder("pod_cluster"))
+	assert.Equal(t, []string{"host", "vip", "pod_cluster", "pod_node"}, registry.ResourceTypes())
+
+	updaters := registry.Build(cache.NewCache("domain"), cloudmodel.Resource{}, nil)
+	for _, updater := range updaters {
+		updater.HandleAddAndUpdate()
+	}
+	for i := len(updaters) - 1; i >= 0; i-- {
+		updaters[i].HandleDelete()
+	}
+	assert.Equal(t, []string{
+		"add_and_update:host", "add_and_update:vip", "add_and_update:pod_cluster", "add_and_update:pod_node",
+		"delete:pod_node", "delete:pod_cluster", "delete:vip", "delete:host",
+	}, calls)
+}
+
+func TestRegistryRegisterInvalid(t *testing.T) {
+	builder := func(wholeCache *cache.Cache, cloudData cloudmodel.Resource, eventQueue *queue.OverwriteQueue) ResourceUpdater {
+		return nil
+	}
+	registry := NewRegistry()
+	registry.Register("a", []string{"b"}, builder)
+	assert.Panics(t, func() { registry.Register("a", nil, builder) })
+	assert.Panics(t, func() { registry.Register("b", []string{"a"}, builder) })
+}
+
+func TestDomainRegistryContainsHost(t *testing.T) {
+	updaters := DomainRegistry.Build(cache.NewCache("domain"), cloudmodel.Resource{}, nil)
+	assert.Contains(t, DomainRegistry.ResourceTypes(), "host")
+	assert.Len(t, updaters, len(DomainRegistry.ResourceTypes()))
+}
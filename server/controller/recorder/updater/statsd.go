@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package updater
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/deepflowio/deepflow/server/libs/stats"
+)
+
+type ActionCounter struct {
+	Add    uint64 `statsd:"add_count"`
+	Update uint64 `statsd:"update_count"`
+	Delete uint64 `statsd:"delete_count"`
+	// cloud 数据中按 lcuuid 重复的条目数
+	Duplicate uint64 `statsd:"duplicate_count"`
+}
+
+func (c *ActionCounter) AddAddCount(count uint64) {
+	atomic.AddUint64(&c.Add, count)
+}
+
+func (c *ActionCounter) AddUpdateCount(count uint64) {
+	atomic.AddUint64(&c.Update, count)
+}
+
+func (c *ActionCounter) AddDeleteCount(count uint64) {
+	atomic.AddUint64(&c.Delete, count)
+}
+
+func (c *ActionCounter) AddDuplicateCount(count uint64) {
+	atomic.AddUint64(&c.Duplicate, count)
+}
+
+// ResourceCounter 记录单个资源类型 updater 在一个统计周期内的增删改数量
+type ResourceCounter struct {
+	*ActionCounter
+}
+
+func NewResourceCounter() *ResourceCounter {
+	return &ResourceCounter{
+		ActionCounter: &ActionCounter{},
+	}
+}
+
+func (r *ResourceCounter) GetCounter() interface{} {
+	counter := &ActionCounter{}
+	counter, r.ActionCounter = r.ActionCounter, counter
+	return counter
+}
+
+func (r *ResourceCounter) Closed() bool {
+	return false
+}
+
+var (
+	resourceCountersLock sync.Mutex
+	resourceCounters     = make(map[string]*ResourceCounter)
+)
+
+// GetResourceCounter 获取资源类型对应的计数器，首次获取时注册到 controller 的统计模块
+func GetResourceCounter(resourceType string) *ResourceCounter {
+	resourceCountersLock.Lock()
+	defer resourceCountersLock.Unlock()
+	if counter, ok := resourceCounters[resourceType]; ok {
+		return counter
+	}
+	counter := NewResourceCounter()
+	err := stats.RegisterCountableWithModulePrefix("controller_", "recorder", counter, stats.OptionStatTags{"resource_type": resourceType})
+	if err != nil {
+		log.Error(err)
+	}
+	resourceCounters[resourceType] = counter
+	return counter
+}
@@ -72,7 +72,7 @@ func (u *UpdaterBase[CT, MT, BT]) RegisterListener(listener listener.Listener[CT
 func (u *UpdaterBase[CT, MT, BT]) HandleAddAndUpdate() {
 	dbItemsToAdd := []*MT{}
 	logDebug := logDebugResourceTypeEnabled(u.resourceType)
-	for _, cloudItem := range u.cloudData {
+	for _, cloudItem := range u.dedupCloudData() {
 		if logDebug {
 			log.Infof(debugCloudItem(u.resourceType, cloudItem))
 		}
@@ -97,6 +97,28 @@ func (u *UpdaterBase[CT, MT, BT]) HandleAddAndUpdate() {
 	}
 }
 
+// 按 lcuuid 对 cloud 数据去重，重复时保留最后一条，避免同一批次中对同一资源重复添加
+func (u *UpdaterBase[CT, MT, BT]) dedupCloudData() []CT {
+	dedupItems := make([]CT, 0, len(u.cloudData))
+	lcuuidToIndex := make(map[string]int, len(u.cloudData))
+	for _, cloudItem := range u.cloudData {
+		lcuuid := getCloudItemLcuuid(cloudItem)
+		if lcuuid == "" {
+			dedupItems = append(dedupItems, cloudItem)
+			continue
+		}
+		if index, ok := lcuuidToIndex[lcuuid]; ok {
+			log.Infof("%s data is duplicated in cloud data (lcuuid: %s), keep the last one", u.resourceType, lcuuid)
+			GetResourceCounter(u.resourceType).AddDuplicateCount(1)
+			dedupItems[index] = cloudItem
+			continue
+		}
+		lcuuidToIndex[lcuuid] = len(dedupItems)
+		dedupItems = append(dedupItems, cloudItem)
+	}
+	return dedupItems
+}
+
 func (u *UpdaterBase[CT, MT, BT]) HandleDelete() {
 	lcuuidsOfBatchToDelete := []string{}
 	for lcuuid, diffBase := range u.diffBaseData {
@@ -138,6 +160,7 @@ func (u *UpdaterBase[CT, MT, BT]) add(dbItemsToAdd []*MT) {
 
 func (u *UpdaterBase[CT, MT, BT]) addPage(dbItemsToAdd []*MT) {
 	if addedDBItems, ok := u.dbOperator.AddBatch(dbItemsToAdd); ok {
+		GetResourceCounter(u.resourceType).AddAddCount(uint64(len(addedDBItems)))
 		u.notifyOnAdded(addedDBItems)
 		u.Changed = true
 	}
@@ -145,6 +168,7 @@ func (u *UpdaterBase[CT, MT, BT]) addPage(dbItemsToAdd []*MT) {
 
 func (u *UpdaterBase[CT, MT, BT]) update(cloudItem *CT, diffBase BT, updateInfo map[string]interface{}) {
 	if _, ok := u.dbOperator.Update(diffBase.GetLcuuid(), updateInfo); ok {
+		GetResourceCounter(u.resourceType).AddUpdateCount(1)
 		u.notifyOnUpdated(cloudItem, diffBase)
 		u.Changed = true
 	}
@@ -169,24 +193,32 @@ func (u *UpdaterBase[CT, MT, BT]) delete(lcuuids []string) {
 
 func (u *UpdaterBase[CT, MT, BT]) deletePage(lcuuids []string) {
 	if u.dbOperator.DeleteBatch(lcuuids) {
+		GetResourceCounter(u.resourceType).AddDeleteCount(uint64(len(lcuuids)))
 		u.notifyOnDeleted(lcuuids)
 		u.Changed = true
 	}
 }
 
+// 监听器会写入 cache，并发执行的 Updater 之间需互斥
 func (u *UpdaterBase[CT, MT, BT]) notifyOnAdded(addedDBItems []*MT) {
+	u.cache.Lock()
+	defer u.cache.Unlock()
 	for _, l := range u.listeners {
 		l.OnUpdaterAdded(addedDBItems)
 	}
 }
 
 func (u *UpdaterBase[CT, MT, BT]) notifyOnUpdated(cloudItem *CT, diffBaseItem BT) {
+	u.cache.Lock()
+	defer u.cache.Unlock()
 	for _, l := range u.listeners {
 		l.OnUpdaterUpdated(cloudItem, diffBaseItem)
 	}
 }
 
 func (u *UpdaterBase[CT, MT, BT]) notifyOnDeleted(lcuuids []string) {
+	u.cache.Lock()
+	defer u.cache.Unlock()
 	for _, l := range u.listeners {
 		l.OnUpdaterDeleted(lcuuids)
 	}
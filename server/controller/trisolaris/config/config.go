@@ -23,6 +23,7 @@ import (
 	"github.com/op/go-logging"
 
 	"github.com/deepflowio/deepflow/server/controller/common"
+	monitorconfig "github.com/deepflowio/deepflow/server/controller/monitor/config"
 )
 
 var log = logging.MustGetLogger("trisolaris/config")
@@ -45,6 +46,10 @@ type Config struct {
 	NodeType                       string   `default:"master" yaml:"node-type"`
 	RegionDomainPrefix             string   `yaml:"region-domain-prefix"`
 	ClearKubernetesTime            int      `default:"600" yaml:"clear-kubernetes-time"`
+	SegmentStaleGracePeriod        int      `default:"0" yaml:"segment-stale-grace-period"`
+	GlobalSegmentNetworkIDs        []int    `yaml:"global-segment-network-ids"`
+	SegmentCompaction              bool     `default:"false" yaml:"segment-compaction"`
+	SegmentOrphanVMs               bool     `default:"false" yaml:"segment-orphan-vms"`
 	NodeIP                         string
 	VTapCacheRefreshInterval       int  `default:"300" yaml:"vtapcache-refresh-interval"`
 	MetaDataRefreshInterval        int  `default:"60" yaml:"metadata-refresh-interval"`
@@ -58,6 +63,8 @@ type Config struct {
 	IngesterPort                   int
 	PodClusterInternalIPToIngester int
 	GrpcMaxMessageLength           int
+	// 采集器自动注册时分配默认授权类型使用
+	MonitorCfg monitorconfig.MonitorConfig
 }
 
 func (c *Config) Convert() {
@@ -108,6 +115,10 @@ func (c *Config) SetPodClusterInternalIPToIngester(value int) {
 	c.PodClusterInternalIPToIngester = value
 }
 
+func (c *Config) SetMonitorConfig(monitorCfg monitorconfig.MonitorConfig) {
+	c.MonitorCfg = monitorCfg
+}
+
 func (c *Config) SetGrpcMaxMessageLength(maxLen int) {
 	c.GrpcMaxMessageLength = maxLen
 }
@@ -41,6 +41,7 @@ type MetaData struct {
 	chTapType      chan struct{}
 	chPolicy       chan struct{}
 	chGroup        chan struct{}
+	chVMMigration  chan vmMigration
 	config         *config.Config
 	db             *gorm.DB
 }
@@ -55,6 +56,7 @@ func NewMetaData(db *gorm.DB, cfg *config.Config) *MetaData {
 		chTapType:      make(chan struct{}, 1),
 		chPolicy:       make(chan struct{}, 1),
 		chGroup:        make(chan struct{}, 1),
+		chVMMigration:  make(chan vmMigration, VM_MIGRATION_QUEUE_SIZE),
 		config:         cfg,
 		db:             db,
 	}
@@ -99,6 +101,23 @@ func (m *MetaData) PutChGroup() {
 	}
 }
 
+const VM_MIGRATION_QUEUE_SIZE = 64
+
+type vmMigration struct {
+	vmID         int
+	launchServer string
+}
+
+func (m *MetaData) PutChVMMigration(vmID int, launchServer string) {
+	select {
+	case m.chVMMigration <- vmMigration{vmID: vmID, launchServer: launchServer}:
+	default:
+		// 队列满时退化为全量刷新平台数据
+		log.Warningf("vm migration queue full, drop vm(%d) migration to %s", vmID, launchServer)
+		m.PutChPlatformData()
+	}
+}
+
 func (m *MetaData) PutChTapType() {
 	select {
 	case m.chTapType <- struct{}{}:
@@ -192,6 +211,8 @@ func (m *MetaData) timedRefreshMetaData() {
 			m.groupDataOP.generateGroupData()
 			log.Info("end generate group from rpc")
 			pushmanager.Broadcast()
+		case migration := <-m.chVMMigration:
+			m.platformDataOP.migrateVM(migration.vmID, migration.launchServer)
 		}
 	}
 }
@@ -54,7 +54,8 @@ type PlatformDataOP struct {
 
 	metaData *MetaData
 
-	*Segment
+	// 仅在timedRefreshMetaData中生成新的segment后整体替换，读取方始终看到一致的segment
+	segment *atomic.Value // *Segment
 
 	podIPs *atomic.Value // []*trident.PodIp
 }
@@ -78,6 +79,13 @@ func newPlatformDataOP(db *gorm.DB, metaData *MetaData) *PlatformDataOP {
 	allPlatformDataForIngester := &atomic.Value{}
 	allPlatformDataForIngester.Store(NewPlatformData("", "", 0, INGESTER_ALL_PLATFORM_DATA))
 
+	segment := newSegment()
+	segment.SetStaleGracePeriod(time.Duration(metaData.config.SegmentStaleGracePeriod) * time.Second)
+	segment.SetGlobalNetworkIDs(metaData.config.GlobalSegmentNetworkIDs)
+	segment.SetSegmentCompaction(metaData.config.SegmentCompaction)
+	segment.SetOrphanVMSegments(metaData.config.SegmentOrphanVMs)
+	segmentValue := &atomic.Value{}
+	segmentValue.Store(segment)
 	return &PlatformDataOP{
 		rawData:                    rawData,
 		domainInterfaceProto:       domainInterfaceProto,
@@ -88,7 +96,7 @@ func newPlatformDataOP(db *gorm.DB, metaData *MetaData) *PlatformDataOP {
 		DomainToPlatformData:       newDomainToPlatformData(),
 		db:                         db,
 		chDataChanged:              make(chan struct{}, 1),
-		Segment:                    newSegment(),
+		segment:                    segmentValue,
 		metaData:                   metaData,
 		podIPs:                     &atomic.Value{},
 	}
@@ -675,7 +683,23 @@ func (p *PlatformDataOP) updateAllPlatformDataForIngester(d *PlatformData) {
 }
 
 func (p *PlatformDataOP) GetSegment() *Segment {
-	return p.Segment
+	return p.segment.Load().(*Segment)
+}
+
+func (p *PlatformDataOP) updateSegment(s *Segment) {
+	old := p.GetSegment()
+	p.segment.Store(s)
+	old.serverSegmentsCache.reset()
+}
+
+// 在当前segment的副本上重新生成，原始数据变化时替换当前segment
+func (p *PlatformDataOP) generateBaseSegments(rawData *PlatformRawData) {
+	old := p.GetSegment()
+	segment := old.next()
+	segment.generateBaseSegments(rawData)
+	if segment.GetDataVersion() != old.GetDataVersion() {
+		p.updateSegment(segment)
+	}
 }
 
 // 保证所有遍历都是有序的
@@ -711,6 +735,14 @@ func (p *PlatformDataOP) putPlatformDataChange() {
 	}
 }
 
+func (p *PlatformDataOP) migrateVM(vmID int, launchServer string) {
+	segment := p.GetSegment().next()
+	if segment.MigrateVM(p.GetRawData(), vmID, launchServer) {
+		p.updateSegment(segment)
+		p.putPlatformDataChange()
+	}
+}
+
 func (p *PlatformDataOP) GeneratePlatformData() {
 	oldRawData := p.GetRawData()
 	p.generateRawData()
@@ -719,5 +751,8 @@ func (p *PlatformDataOP) GeneratePlatformData() {
 		p.generateBasePlatformData()
 		p.generateBaseSegments(newRawData)
 		p.putPlatformDataChange()
+	} else if segment := p.GetSegment().next(); segment.EvictStaleSegments(time.Now()) {
+		p.updateSegment(segment)
+		p.putPlatformDataChange()
 	}
 }
@@ -139,6 +139,7 @@ type PlatformRawData struct {
 	idToPodGroup        map[int]*models.PodGroup
 
 	vmIDToVifs            map[int]mapset.Set
+	vmIDToFloatingIPVifs  map[int]mapset.Set // 浮动IP所在的独立MAC接口，按浮动IP关联的vm记录
 	vRouterIDToVifs       map[int]mapset.Set
 	dhcpIDToVifs          map[int]mapset.Set
 	podIDToVifs           map[int]mapset.Set
@@ -227,6 +228,7 @@ func NewPlatformRawData() *PlatformRawData {
 		idToPodGroup:           make(map[int]*models.PodGroup),
 
 		vmIDToVifs:                    make(map[int]mapset.Set),
+		vmIDToFloatingIPVifs:          make(map[int]mapset.Set),
 		vRouterIDToVifs:               make(map[int]mapset.Set),
 		dhcpIDToVifs:                  make(map[int]mapset.Set),
 		podIDToVifs:                   make(map[int]mapset.Set),
@@ -648,6 +650,47 @@ func (r *PlatformRawData) ConvertDBIPs(dbDataCache *DBDataCache) {
 	}
 }
 
+// 部分云平台中浮动IP配置在独立MAC的接口上，该接口不属于vm，需要按浮动IP关联的vm合并到vm的segment中
+func (r *PlatformRawData) ConvertDBFloatingIPVifs(dbDataCache *DBDataCache) {
+	floatingIPs := dbDataCache.GetFloatingIPs()
+	if len(floatingIPs) == 0 {
+		return
+	}
+	ipToVifIDs := make(map[string][]int)
+	for _, wanIP := range dbDataCache.GetWANIPs() {
+		ipToVifIDs[wanIP.IP] = append(ipToVifIDs[wanIP.IP], wanIP.VInterfaceID)
+	}
+	for _, lanIP := range dbDataCache.GetLANIPs() {
+		ipToVifIDs[lanIP.IP] = append(ipToVifIDs[lanIP.IP], lanIP.VInterfaceID)
+	}
+	idToVif := make(map[int]*models.VInterface)
+	for _, vif := range dbDataCache.GetVInterfaces() {
+		idToVif[vif.ID] = vif
+	}
+	for _, fip := range floatingIPs {
+		if fip.VMID == 0 {
+			continue
+		}
+		for _, vifID := range ipToVifIDs[fip.IP] {
+			vif, ok := idToVif[vifID]
+			if ok == false || (vif.DeviceType == VIF_DEVICE_TYPE_VM && vif.DeviceID == fip.VMID) {
+				continue
+			}
+			// segment按浮动IP所属的网络生成
+			if fip.NetworkID != 0 && fip.NetworkID != vif.NetworkID {
+				fipVif := *vif
+				fipVif.NetworkID = fip.NetworkID
+				vif = &fipVif
+			}
+			if vifs, ok := r.vmIDToFloatingIPVifs[fip.VMID]; ok {
+				vifs.Add(vif)
+			} else {
+				r.vmIDToFloatingIPVifs[fip.VMID] = mapset.NewSet(vif)
+			}
+		}
+	}
+}
+
 func (r *PlatformRawData) ConvertHost(dbDataCache *DBDataCache) {
 	hosts := dbDataCache.GetHostDevices()
 	if hosts == nil {
@@ -1148,6 +1191,7 @@ func (r *PlatformRawData) ConvertDBCache(dbDataCache *DBDataCache) {
 	r.ConvertDBPod(dbDataCache)
 	r.ConvertDBVInterface(dbDataCache)
 	r.ConvertDBIPs(dbDataCache)
+	r.ConvertDBFloatingIPVifs(dbDataCache)
 	r.ConvertDBNetwork(dbDataCache)
 	r.ConvertDBRegion(dbDataCache)
 	r.ConvertDBAZ(dbDataCache)
@@ -1380,6 +1424,27 @@ func (r *PlatformRawData) GetPod(podID int) *models.Pod {
 	return r.idToPod[podID]
 }
 
+// 获取接口所在宿主机ID，vm/vrouter取launch server，pod/pod_node通过所在vm获取，未知时返回0
+func (r *PlatformRawData) getVifHostID(vif *models.VInterface) int {
+	device, ok := r.typeIDToDevice[TypeIDKey{Type: vif.DeviceType, ID: vif.DeviceID}]
+	if ok == false {
+		return 0
+	}
+	switch vif.DeviceType {
+	case VIF_DEVICE_TYPE_HOST, VIF_DEVICE_TYPE_VM, VIF_DEVICE_TYPE_VROUTER:
+		return device.LaunchServerID
+	case VIF_DEVICE_TYPE_POD, VIF_DEVICE_TYPE_POD_NODE:
+		vmID, ok := r.podNodeIDToVmID[device.PodNodeID]
+		if ok == false {
+			return 0
+		}
+		if vmDevice, ok := r.typeIDToDevice[TypeIDKey{Type: VIF_DEVICE_TYPE_VM, ID: vmID}]; ok {
+			return vmDevice.LaunchServerID
+		}
+	}
+	return 0
+}
+
 func (r *PlatformRawData) GetSkipInterface(server string) []*trident.SkipInterface {
 	if result, ok := r.launchServerToSkipInterface[server]; ok {
 		return result
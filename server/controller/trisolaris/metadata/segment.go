@@ -17,25 +17,47 @@
 package metadata
 
 import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
 	mapset "github.com/deckarep/golang-set"
 	"github.com/golang/protobuf/proto"
 
 	"github.com/deepflowio/deepflow/message/trident"
 	"github.com/deepflowio/deepflow/server/controller/common"
 	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	"github.com/deepflowio/deepflow/server/controller/grpc/statsd"
+)
+
+const (
+	NO_VTAP_USED_SEGMENT_ID    = 1
+	NO_VTAP_USED_SEGMENT_V6_ID = 2
+
+	// segment持续为空时告警日志的最小间隔
+	EMPTY_SEGMENTS_WARNING_INTERVAL = 5 * time.Minute
 )
 
 type MacID struct {
-	Mac  string
-	VMac string
-	ID   int
+	Mac        string
+	VMac       string
+	ID         int
+	DeviceType int
+	Domain     string
+	SubDomain  string
 }
 
 func newMacID(vif *models.VInterface) *MacID {
 	return &MacID{
-		Mac:  vif.Mac,
-		ID:   vif.ID,
-		VMac: vif.VMac,
+		Mac:        vif.Mac,
+		ID:         vif.ID,
+		VMac:       vif.VMac,
+		DeviceType: vif.DeviceType,
+		Domain:     vif.Domain,
+		SubDomain:  vif.SubDomain,
 	}
 }
 
@@ -74,6 +96,108 @@ func (n NetworkMacs) get(id int) []*MacID {
 	return n[id]
 }
 
+// 返回未出现在其所属网络中的接口ID(MAC为空或默认值的接口不生成segment，不计入)
+func (n NetworkMacs) missingVifIDs(vifs mapset.Set) []int {
+	missing := []int{}
+	for data := range vifs.Iter() {
+		vif := data.(*models.VInterface)
+		if isMacNullOrDefault(vif.Mac) {
+			continue
+		}
+		found := false
+		for _, macID := range n[vif.NetworkID] {
+			if macID.ID == vif.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, vif.ID)
+		}
+	}
+	sort.Ints(missing)
+	return missing
+}
+
+// 按网络ID排序，保证生成的segment顺序稳定
+func (n NetworkMacs) sortedNetworkIDs() []int {
+	networkIDs := make([]int, 0, len(n))
+	for networkID := range n {
+		networkIDs = append(networkIDs, networkID)
+	}
+	sort.Ints(networkIDs)
+	return networkIDs
+}
+
+// 返回按MAC(相同时按接口ID)排序的副本，保证segment内MAC顺序稳定
+func sortedMacIDs(macIDs []*MacID) []*MacID {
+	sorted := make([]*MacID, len(macIDs))
+	copy(sorted, macIDs)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Mac != sorted[j].Mac {
+			return sorted[i].Mac < sorted[j].Mac
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// 按网络生成segment，多个domain复用同一网络ID时按domain拆分为不同的segment
+func (n NetworkMacs) toSegments(s *Segment) []*trident.Segment {
+	segments := make([]*trident.Segment, 0, len(n))
+	for _, networkID := range n.sortedNetworkIDs() {
+		s.rangeNetworkSegmentIDs(networkID, n[networkID], func(segmentID uint32, macIDs []*MacID) {
+			segments = append(segments, newSegmentByMacIDs(segmentID, macIDs, s))
+		})
+	}
+	return segments
+}
+
+// 按segment id遍历网络中的接口，未被多个domain复用时segment id即为网络ID，否则按domain拆分
+func (s *Segment) rangeNetworkSegmentIDs(networkID int, macIDs []*MacID, fn func(segmentID uint32, macIDs []*MacID)) {
+	if _, ok := s.overlappedNetworkIDs[networkID]; !ok {
+		fn(uint32(networkID), macIDs)
+		return
+	}
+	domainToMacIDs := make(map[string][]*MacID)
+	for _, macID := range macIDs {
+		domainToMacIDs[macID.Domain] = append(domainToMacIDs[macID.Domain], macID)
+	}
+	domains := make([]string, 0, len(domainToMacIDs))
+	for domain := range domainToMacIDs {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	for _, domain := range domains {
+		fn(s.getSegmentID(networkID, domain), domainToMacIDs[domain])
+	}
+}
+
+func newSegmentByMacIDs(segmentID uint32, macIDs []*MacID, s *Segment) *trident.Segment {
+	for _, macID := range macIDs {
+		s.vtapUsedVInterfaceIDs.Add(macID.ID)
+	}
+	return buildSegmentByMacIDs(segmentID, macIDs)
+}
+
+// 按接口顺序生成segment，不记录采集器使用的接口
+func buildSegmentByMacIDs(segmentID uint32, macIDs []*MacID) *trident.Segment {
+	macs := make([]string, 0, len(macIDs))
+	vmacs := make([]string, 0, len(macIDs))
+	vifIDs := make([]uint32, 0, len(macIDs))
+	for _, macID := range sortedMacIDs(macIDs) {
+		macs = append(macs, macID.Mac)
+		vmacs = append(vmacs, macID.Mac)
+		vifIDs = append(vifIDs, uint32(macID.ID))
+	}
+	return &trident.Segment{
+		Id:          proto.Uint32(segmentID),
+		Mac:         macs,
+		Vmac:        vmacs,
+		InterfaceId: vifIDs,
+	}
+}
+
 func newIDToNetworkMacs() IDToNetworkMacs {
 	return make(IDToNetworkMacs)
 }
@@ -91,27 +215,7 @@ func (t IDToNetworkMacs) getSegmentsByID(id int, s *Segment) []*trident.Segment
 	if ok == false {
 		return nil
 	}
-	segments := make([]*trident.Segment, 0, len(networkMacs))
-	for networkID, macIDs := range networkMacs {
-		macs := make([]string, 0, len(macIDs))
-		vmacs := make([]string, 0, len(macIDs))
-		vifIDs := make([]uint32, 0, len(macIDs))
-		for _, macID := range macIDs {
-			macs = append(macs, macID.Mac)
-			vmacs = append(vmacs, macID.Mac)
-			vifIDs = append(vifIDs, uint32(macID.ID))
-			s.vtapUsedVInterfaceIDs.Add(macID.ID)
-		}
-		segment := &trident.Segment{
-			Id:          proto.Uint32(uint32(networkID)),
-			Mac:         macs,
-			Vmac:        vmacs,
-			InterfaceId: vifIDs,
-		}
-		segments = append(segments, segment)
-	}
-
-	return segments
+	return networkMacs.toSegments(s)
 }
 
 func (t ServerToNetworkMacs) add(server string, macs NetworkMacs) {
@@ -123,27 +227,7 @@ func (t ServerToNetworkMacs) getSegmentsByServer(server string, s *Segment) []*t
 	if ok == false {
 		return nil
 	}
-	segments := make([]*trident.Segment, 0, len(networkMacs))
-	for networkID, macIDs := range networkMacs {
-		macs := make([]string, 0, len(macIDs))
-		vmacs := make([]string, 0, len(macIDs))
-		vifIDs := make([]uint32, 0, len(macIDs))
-		for _, macID := range macIDs {
-			macs = append(macs, macID.Mac)
-			vmacs = append(vmacs, macID.Mac)
-			vifIDs = append(vifIDs, uint32(macID.ID))
-			s.vtapUsedVInterfaceIDs.Add(macID.ID)
-		}
-		segment := &trident.Segment{
-			Id:          proto.Uint32(uint32(networkID)),
-			Mac:         macs,
-			Vmac:        vmacs,
-			InterfaceId: vifIDs,
-		}
-		segments = append(segments, segment)
-	}
-
-	return segments
+	return networkMacs.toSegments(s)
 }
 
 type IDToVifs map[int]mapset.Set
@@ -162,13 +246,83 @@ func (v IDToVifs) add(id int, vifs mapset.Set) {
 	}
 }
 
+type ServerToVifs map[string]mapset.Set
+
+func newServerToVifs() ServerToVifs {
+	return make(ServerToVifs)
+}
+
+func (v ServerToVifs) add(server string, vifs mapset.Set) {
+	if _, ok := v[server]; ok {
+		for vif := range vifs.Iter() {
+			v[server].Add(vif)
+		}
+	} else {
+		v[server] = vifs.Clone()
+	}
+}
+
+type serverSegmentsKey struct {
+	launchServer string
+	hostID       int
+}
+
+// 同一宿主机上的采集器local segment相同，按(launchServer, hostID)缓存，平台数据刷新时清空
+type serverSegmentsCache struct {
+	sync.RWMutex
+	keyToSegments map[serverSegmentsKey][]*trident.Segment
+	// 实际计算segment的次数
+	computeCount int
+	// 命中/未命中/失效计数，通过trisolaris统计输出
+	counter *statsd.GetSegmentCacheCounter
+}
+
+func newServerSegmentsCache(counter *statsd.GetSegmentCacheCounter) *serverSegmentsCache {
+	return &serverSegmentsCache{
+		keyToSegments: make(map[serverSegmentsKey][]*trident.Segment),
+		counter:       counter,
+	}
+}
+
+func (c *serverSegmentsCache) get(key serverSegmentsKey) ([]*trident.Segment, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	segments, ok := c.keyToSegments[key]
+	if ok {
+		c.counter.AddHitCount(1)
+	} else {
+		c.counter.AddMissCount(1)
+	}
+	return segments, ok
+}
+
+func (c *serverSegmentsCache) set(key serverSegmentsKey, segments []*trident.Segment) {
+	c.Lock()
+	defer c.Unlock()
+	c.keyToSegments[key] = segments
+	c.computeCount++
+}
+
+func (c *serverSegmentsCache) reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.counter.AddEvictionCount(uint64(len(c.keyToSegments)))
+	c.keyToSegments = make(map[serverSegmentsKey][]*trident.Segment)
+}
+
 type Segment struct {
 	launchServerToSegments  ServerToNetworkMacs
 	hostIDToSegments        IDToNetworkMacs
 	gatewayHostIDToSegments IDToNetworkMacs
 	allGatewayHostSegments  []*trident.Segment
-	vtapUsedVInterfaceIDs   mapset.Set
-	notVtapUsedSegments     []*trident.Segment
+	// SEGMENT_VERSION_NETWORK_ID版本的gateway宿主机segment，id为网络ID
+	allGatewayHostNetworkSegments []*trident.Segment
+	vtapUsedVInterfaceIDs         mapset.Set
+	notVtapUsedSegments           []*trident.Segment
+	// 只配置了IPv6地址的接口单独放在一个segment中下发
+	notVtapUsedSegmentsV6 []*trident.Segment
+	// 按宿主机分组的没有采集器覆盖的segment，宿主机未知的接口放在0中
+	hostIDToNotVtapUsedSegments map[int][]*trident.Segment
 	// vm所有vif的segment，包含vm上的pod pod_node
 	vmIDToSegments IDToNetworkMacs
 	// pod所有vif的segment
@@ -179,8 +333,48 @@ type Segment struct {
 
 	vmIDToPodNodeAllVifs IDToVifs
 	podNodeIDToAllVifs   IDToVifs
+	// 没有关联vm的pod_node(容器直接运行在宿主机上)所有vif，按pod_node所在的launch server聚合
+	launchServerToPodNodeAllVifs ServerToVifs
 
 	vRouterLaunchServerToSegments ServerToNetworkMacs
+
+	serverSegmentsCache *serverSegmentsCache
+	// 最近一次生成segment时跳过的非法launch server个数
+	invalidLaunchServerCount int
+	// 全量生成segment后发生迁移的vm及其当前所在launch server
+	vmIDToMigratedServer map[int]string
+	// segment中所有接口，用于按domain过滤
+	vifIDToMacID map[int]*MacID
+	// 被多个domain复用的网络ID(如VNI重叠)，按(domain, networkID)重新分配segment id
+	overlappedNetworkIDs     map[int]struct{}
+	networkDomainToSegmentID map[networkDomainKey]uint32
+
+	// 上次生成基础segment时原始数据的摘要，及生成次数作为数据版本
+	dataHash    segmentDataHash
+	dataVersion uint64
+
+	// 原始数据中有接口但生成结果为空的范围，非空表示segment生成可能有误
+	emptySegmentScopes    []string
+	emptySegmentsWarnedAt time.Time
+
+	// 原始数据中不再存在的条目保留的时间，及保留中的条目首次缺失的时间
+	staleGracePeriod time.Duration
+	staleSince       map[segmentEntryKey]time.Time
+
+	// 对所有采集器可见的网络，及其中所有接口生成的segment，追加到每个采集器的local segments
+	globalNetworkIDs map[int]struct{}
+	globalSegments   []*trident.Segment
+
+	// 下发前合并只有一个MAC的segment
+	segmentCompaction bool
+
+	// 最近一次生成基础segment使用的原始数据，仅用于解释segment中MAC的来源
+	explainRawData *PlatformRawData
+
+	// 没有合法launch server的vm，开启时其接口单独生成segment
+	orphanVMSegmentsEnabled bool
+	orphanVMIDs             []int
+	orphanVMSegments        NetworkMacs
 }
 
 func newSegment() *Segment {
@@ -189,25 +383,154 @@ func newSegment() *Segment {
 		hostIDToSegments:              newIDToNetworkMacs(),
 		gatewayHostIDToSegments:       newIDToNetworkMacs(),
 		allGatewayHostSegments:        []*trident.Segment{},
+		allGatewayHostNetworkSegments: []*trident.Segment{},
 		vtapUsedVInterfaceIDs:         mapset.NewSet(),
 		notVtapUsedSegments:           []*trident.Segment{},
+		notVtapUsedSegmentsV6:         []*trident.Segment{},
+		hostIDToNotVtapUsedSegments:   make(map[int][]*trident.Segment),
 		vmIDToSegments:                newIDToNetworkMacs(),
 		bmDedicatedRemoteSegments:     []*trident.Segment{},
 		podNodeIDToSegments:           newIDToNetworkMacs(),
 		vmIDToPodNodeAllVifs:          newIDToVifs(),
 		podNodeIDToAllVifs:            newIDToVifs(),
+		launchServerToPodNodeAllVifs:  newServerToVifs(),
 		vRouterLaunchServerToSegments: newServerToNetworkMacs(),
+		serverSegmentsCache:           newServerSegmentsCache(statsd.GetSegmentCacheCounterSingleton()),
+		vmIDToMigratedServer:          make(map[int]string),
+		vifIDToMacID:                  make(map[int]*MacID),
+		overlappedNetworkIDs:          make(map[int]struct{}),
+		networkDomainToSegmentID:      make(map[networkDomainKey]uint32),
+		staleSince:                    make(map[segmentEntryKey]time.Time),
+		globalNetworkIDs:              make(map[int]struct{}),
+		globalSegments:                []*trident.Segment{},
+		orphanVMIDs:                   []int{},
+		orphanVMSegments:              newNetworkMacs(),
 	}
 }
 
+// 浅拷贝segment，vtapUsedVInterfaceIDs和serverSegmentsCache使用独立副本，调用getter不影响下发数据及缓存统计
+func (s *Segment) Copy() *Segment {
+	segment := *s
+	segment.vtapUsedVInterfaceIDs = mapset.NewSet()
+	segment.serverSegmentsCache = newServerSegmentsCache(statsd.NewGetSegmentCacheCounter())
+	return &segment
+}
+
+// 基于当前segment创建用于重新生成的副本，生成时整体替换的字段不影响仍在读取当前segment的调用方，
+// 原地修改的staleSince、vmIDToMigratedServer及serverSegmentsCache使用独立副本
+func (s *Segment) next() *Segment {
+	segment := *s
+	segment.serverSegmentsCache = newServerSegmentsCache(s.serverSegmentsCache.counter)
+	segment.staleSince = make(map[segmentEntryKey]time.Time, len(s.staleSince))
+	for key, since := range s.staleSince {
+		segment.staleSince[key] = since
+	}
+	segment.vmIDToMigratedServer = make(map[int]string, len(s.vmIDToMigratedServer))
+	for vmID, server := range s.vmIDToMigratedServer {
+		segment.vmIDToMigratedServer[vmID] = server
+	}
+	return &segment
+}
+
 func (s *Segment) GetAllGatewayHostSegments() []*trident.Segment {
 	return s.allGatewayHostSegments
 }
 
+// 按协商的segment版本获取gateway宿主机segments
+func (s *Segment) GetGatewayHostSegmentsByVersion(version uint32) []*trident.Segment {
+	if version >= SEGMENT_VERSION_NETWORK_ID {
+		return s.allGatewayHostNetworkSegments
+	}
+	return s.allGatewayHostSegments
+}
+
 func (s *Segment) GetNotVtapUsedSegments() []*trident.Segment {
 	return s.notVtapUsedSegments
 }
 
+func (s *Segment) GetNotVtapUsedSegmentsV6() []*trident.Segment {
+	return s.notVtapUsedSegmentsV6
+}
+
+// GetNotVtapUsedSegmentsByHost 获取宿主机上没有采集器覆盖的segments(含IPv6)，hostID为0时返回宿主机未知的接口
+func (s *Segment) GetNotVtapUsedSegmentsByHost(hostID int) []*trident.Segment {
+	return s.hostIDToNotVtapUsedSegments[hostID]
+}
+
+// GetAllGatewayHostSegmentsChunk 分批获取gateway宿主机segments，每批最多包含limit个MAC，
+// 返回的token用于获取下一批，token为空表示已全部获取
+func (s *Segment) GetAllGatewayHostSegmentsChunk(token string, limit int) ([]*trident.Segment, string, error) {
+	return GetSegmentsChunk(s.allGatewayHostSegments, token, limit)
+}
+
+// GetNotVtapUsedSegmentsChunk 分批获取没有采集器覆盖的segments，用法同GetAllGatewayHostSegmentsChunk
+func (s *Segment) GetNotVtapUsedSegmentsChunk(token string, limit int) ([]*trident.Segment, string, error) {
+	return GetSegmentsChunk(s.notVtapUsedSegments, token, limit)
+}
+
+func encodeChunkToken(segmentIndex, macIndex int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", segmentIndex, macIndex)))
+}
+
+func decodeChunkToken(token string) (segmentIndex, macIndex int, err error) {
+	if token == "" {
+		return 0, 0, nil
+	}
+	bs, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid chunk token (%s): %v", token, err)
+	}
+	if _, err = fmt.Sscanf(string(bs), "%d:%d", &segmentIndex, &macIndex); err != nil {
+		return 0, 0, fmt.Errorf("invalid chunk token (%s): %v", token, err)
+	}
+	if segmentIndex < 0 || macIndex < 0 {
+		return 0, 0, fmt.Errorf("invalid chunk token (%s)", token)
+	}
+	return segmentIndex, macIndex, nil
+}
+
+// GetSegmentsChunk 按MAC个数切分segments，单个segment超过limit时拆分为多个相同id的segment
+func GetSegmentsChunk(segments []*trident.Segment, token string, limit int) ([]*trident.Segment, string, error) {
+	if limit <= 0 {
+		return nil, "", fmt.Errorf("invalid chunk limit (%d)", limit)
+	}
+	segmentIndex, macIndex, err := decodeChunkToken(token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	chunk := []*trident.Segment{}
+	count := 0
+	for segmentIndex < len(segments) && count < limit {
+		segment := segments[segmentIndex]
+		macs := segment.GetMac()
+		end := macIndex + limit - count
+		if end > len(macs) {
+			end = len(macs)
+		}
+		if macIndex < end {
+			chunk = append(chunk, &trident.Segment{
+				Id:          segment.Id,
+				Mac:         macs[macIndex:end],
+				Vmac:        segment.GetVmac()[macIndex:end],
+				InterfaceId: segment.GetInterfaceId()[macIndex:end],
+			})
+			count += end - macIndex
+		}
+		if end >= len(macs) {
+			segmentIndex++
+			macIndex = 0
+		} else {
+			macIndex = end
+		}
+	}
+
+	if segmentIndex >= len(segments) {
+		return chunk, "", nil
+	}
+	return chunk, encodeChunkToken(segmentIndex, macIndex), nil
+}
+
 func (s *Segment) ClearVTapUsedVInterfaceIDs() {
 	s.vtapUsedVInterfaceIDs = mapset.NewSet()
 }
@@ -221,6 +544,7 @@ func (s *Segment) convertDBInfo(rawData *PlatformRawData) {
 
 	vmIDToPodNodeAllVifs := newIDToVifs()
 	podNodeIDToAllVifs := newIDToVifs()
+	launchServerToPodNodeAllVifs := newServerToVifs()
 
 	for _, podnode := range idToPodNode {
 		podnodeID := podnode.ID
@@ -241,8 +565,20 @@ func (s *Segment) convertDBInfo(rawData *PlatformRawData) {
 			vmIDToPodNodeAllVifs.add(vmID, allVifs)
 		}
 	}
+	// pod_node没有关联vm时，直接归属到pod_node所在的launch server
+	for podnodeID, allVifs := range podNodeIDToAllVifs {
+		if _, ok := podNodeIDToVmID[podnodeID]; ok {
+			continue
+		}
+		podnode, ok := idToPodNode[podnodeID]
+		if ok == false || podnode.IP == "" {
+			continue
+		}
+		launchServerToPodNodeAllVifs.add(podnode.IP, allVifs)
+	}
 	s.podNodeIDToAllVifs = podNodeIDToAllVifs
 	s.vmIDToPodNodeAllVifs = vmIDToPodNodeAllVifs
+	s.launchServerToPodNodeAllVifs = launchServerToPodNodeAllVifs
 }
 
 func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
@@ -254,15 +590,27 @@ func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
 	podNodeIDToSegments := newIDToNetworkMacs()
 	vRouterLaunchServerToSegments := newServerToNetworkMacs()
 
+	invalidLaunchServers := mapset.NewSet()
+	launchedVMIDs := mapset.NewSet()
 	for server, vmids := range rawData.serverToVmIDs {
+		if !isValidLaunchServer(server) {
+			invalidLaunchServers.Add(server)
+			continue
+		}
 		netWorkMacs := newNetworkMacs()
 		for vmid := range vmids.Iter() {
 			id := vmid.(int)
+			launchedVMIDs.Add(id)
 			if vmVifs, ok := rawData.vmIDToVifs[id]; ok {
 				for vmVif := range vmVifs.Iter() {
 					netWorkMacs.add(vmVif)
 				}
 			}
+			if fipVifs, ok := rawData.vmIDToFloatingIPVifs[id]; ok {
+				for fipVif := range fipVifs.Iter() {
+					netWorkMacs.add(fipVif)
+				}
+			}
 
 			if allVifs, ok := s.vmIDToPodNodeAllVifs[id]; ok {
 				for allVif := range allVifs.Iter() {
@@ -273,6 +621,21 @@ func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
 		launchServerToSegments[server] = netWorkMacs
 	}
 
+	for server, podNodeVifs := range s.launchServerToPodNodeAllVifs {
+		if !isValidLaunchServer(server) {
+			invalidLaunchServers.Add(server)
+			continue
+		}
+		netWorkMacs, ok := launchServerToSegments[server]
+		if ok == false {
+			netWorkMacs = newNetworkMacs()
+			launchServerToSegments[server] = netWorkMacs
+		}
+		for podNodeVif := range podNodeVifs.Iter() {
+			netWorkMacs.add(podNodeVif)
+		}
+	}
+
 	for hostID, vifs := range rawData.hostIDToVifs {
 		netWorkMacs := newNetworkMacs()
 		for hVif := range vifs.Iter() {
@@ -289,14 +652,29 @@ func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
 		gatewayHostIDToSegments[hostID] = netWorkMacs
 	}
 
+	// vm的多个接口可能位于不同网络，每个网络分别生成segment
 	for vmID, vifs := range rawData.vmIDToVifs {
 		netWorkMacs := newNetworkMacs()
 		for vif := range vifs.Iter() {
 			netWorkMacs.add(vif)
 		}
+		if missing := netWorkMacs.missingVifIDs(vifs); len(missing) > 0 {
+			log.Warningf("vm(%d) vifs %v not found in its network segments", vmID, missing)
+		}
 		vmIDToSegments[vmID] = netWorkMacs
 	}
 
+	for vmID, fipVifs := range rawData.vmIDToFloatingIPVifs {
+		netWorkMacs, ok := vmIDToSegments[vmID]
+		if ok == false {
+			netWorkMacs = newNetworkMacs()
+			vmIDToSegments[vmID] = netWorkMacs
+		}
+		for fipVif := range fipVifs.Iter() {
+			netWorkMacs.add(fipVif)
+		}
+	}
+
 	for podID, vifs := range rawData.podIDToVifs {
 		netWorkMacs := newNetworkMacs()
 		for vif := range vifs.Iter() {
@@ -327,6 +705,10 @@ func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
 	}
 
 	for server, VRouterIDs := range rawData.launchServerToVRouterIDs {
+		if !isValidLaunchServer(server) {
+			invalidLaunchServers.Add(server)
+			continue
+		}
 		netWorkMacs := newNetworkMacs()
 		for _, VRouterID := range VRouterIDs {
 			if VRouterVifs, ok := rawData.vRouterIDToVifs[VRouterID]; ok {
@@ -338,6 +720,19 @@ func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
 		vRouterLaunchServerToSegments[server] = netWorkMacs
 	}
 
+	if s.staleGracePeriod > 0 {
+		now := time.Now()
+		vifIDToNetworkID := make(map[int]int)
+		addVifNetworkIDs(vifIDToNetworkID, launchServerToSegments)
+		addVifNetworkIDs(vifIDToNetworkID, hostIDToSegments)
+		addVifNetworkIDs(vifIDToNetworkID, vmIDToSegments)
+		addVifNetworkIDs(vifIDToNetworkID, podNodeIDToSegments)
+		launchServerToSegments = retainStaleSegments(s, SEGMENT_SCOPE_LAUNCH_SERVER, s.launchServerToSegments, launchServerToSegments, vifIDToNetworkID, now)
+		hostIDToSegments = retainStaleSegments(s, SEGMENT_SCOPE_HOST, s.hostIDToSegments, hostIDToSegments, vifIDToNetworkID, now)
+		vmIDToSegments = retainStaleSegments(s, SEGMENT_SCOPE_VM, s.vmIDToSegments, vmIDToSegments, vifIDToNetworkID, now)
+		podNodeIDToSegments = retainStaleSegments(s, SEGMENT_SCOPE_POD_NODE, s.podNodeIDToSegments, podNodeIDToSegments, vifIDToNetworkID, now)
+	}
+
 	s.launchServerToSegments = launchServerToSegments
 	s.hostIDToSegments = hostIDToSegments
 	s.gatewayHostIDToSegments = gatewayHostIDToSegments
@@ -345,65 +740,140 @@ func (s *Segment) generateBaseSegmentsFromDB(rawData *PlatformRawData) {
 	s.podIDToSegments = podIDToSegments
 	s.podNodeIDToSegments = podNodeIDToSegments
 	s.vRouterLaunchServerToSegments = vRouterLaunchServerToSegments
+	s.invalidLaunchServerCount = invalidLaunchServers.Cardinality()
+	if s.invalidLaunchServerCount > 0 {
+		log.Warningf("skip %d invalid launch server(s) in segments: %v", s.invalidLaunchServerCount, invalidLaunchServers)
+	}
+	s.generateOrphanVMSegments(rawData, launchedVMIDs)
+}
+
+// launch server为空或不是合法IP时生成的segment无法被采集器使用
+func isValidLaunchServer(server string) bool {
+	return net.ParseIP(server) != nil
+}
+
+func (s *Segment) InvalidLaunchServerCount() int {
+	return s.invalidLaunchServerCount
+}
+
+func newGatewayHostSegment(id uint32, macIDs []*MacID) *trident.Segment {
+	macs := make([]string, 0, len(macIDs))
+	vmacs := make([]string, 0, len(macIDs))
+	vifIDs := make([]uint32, 0, len(macIDs))
+	for _, macID := range sortedMacIDs(macIDs) {
+		if !isMacNullOrDefault(macID.Mac) {
+			macs = append(macs, macID.Mac)
+			vifIDs = append(vifIDs, uint32(macID.ID))
+			if macID.VMac == "" {
+				vmacs = append(vmacs, macID.Mac)
+			} else {
+				vmacs = append(vmacs, macID.VMac)
+			}
+		}
+	}
+	return &trident.Segment{
+		Id:          proto.Uint32(id),
+		Mac:         macs,
+		Vmac:        vmacs,
+		InterfaceId: vifIDs,
+	}
 }
 
 func (s *Segment) generateGatewayHostSegments() {
 	segments := make([]*trident.Segment, 0, 1)
-	for _, hostSegments := range s.gatewayHostIDToSegments {
-		for _, macIDs := range hostSegments {
-			macs := make([]string, 0, len(macIDs))
-			vmacs := make([]string, 0, len(macIDs))
-			vifIDs := make([]uint32, 0, len(macIDs))
-			for _, macID := range macIDs {
-				if !isMacNullOrDefault(macID.Mac) {
-					macs = append(macs, macID.Mac)
-					vifIDs = append(vifIDs, uint32(macID.ID))
-					if macID.VMac == "" {
-						vmacs = append(vmacs, macID.Mac)
-					} else {
-						vmacs = append(vmacs, macID.VMac)
-					}
-				}
-			}
-			segment := &trident.Segment{
-				Id:          proto.Uint32(uint32(1)),
-				Mac:         macs,
-				Vmac:        vmacs,
-				InterfaceId: vifIDs,
-			}
-			segments = append(segments, segment)
+	networkSegments := make([]*trident.Segment, 0, 1)
+	hostIDs := make([]int, 0, len(s.gatewayHostIDToSegments))
+	for hostID := range s.gatewayHostIDToSegments {
+		hostIDs = append(hostIDs, hostID)
+	}
+	sort.Ints(hostIDs)
+	for _, hostID := range hostIDs {
+		hostSegments := s.gatewayHostIDToSegments[hostID]
+		for _, networkID := range hostSegments.sortedNetworkIDs() {
+			macIDs := hostSegments[networkID]
+			segments = append(segments, newGatewayHostSegment(1, macIDs))
+			s.rangeNetworkSegmentIDs(networkID, macIDs, func(segmentID uint32, macIDs []*MacID) {
+				networkSegments = append(networkSegments, newGatewayHostSegment(segmentID, macIDs))
+			})
 		}
 	}
 	s.allGatewayHostSegments = segments
+	s.allGatewayHostNetworkSegments = networkSegments
+}
+
+// 接口上配置的IP全部为IPv6时认为是IPv6接口
+func isIPv6OnlyVif(vifID int, rawData *PlatformRawData) bool {
+	ips, ok := rawData.vInterfaceIDToIP[vifID]
+	if !ok || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		parsedIP := net.ParseIP(ip.GetIp())
+		if parsedIP == nil || parsedIP.To4() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func newNoVTapUsedSegment(id uint32, vifs []*models.VInterface) *trident.Segment {
+	macs := make([]string, 0, len(vifs))
+	vmacs := make([]string, 0, len(vifs))
+	vifIDs := make([]uint32, 0, len(vifs))
+	for _, vif := range vifs {
+		macs = append(macs, vif.Mac)
+		vmacs = append(vmacs, vif.Mac)
+		vifIDs = append(vifIDs, uint32(vif.ID))
+	}
+	return &trident.Segment{
+		Id:          proto.Uint32(id),
+		Mac:         macs,
+		Vmac:        vmacs,
+		InterfaceId: vifIDs,
+	}
 }
 
 func (s *Segment) GenerateNoVTapUsedSegments(rawData *PlatformRawData) {
-	macs := []string{}
-	vmacs := []string{}
-	vifIDs := []uint32{}
-	segments := make([]*trident.Segment, 0, 1)
+	vifs := []*models.VInterface{}
+	v6Vifs := []*models.VInterface{}
+	hostIDToVifs := make(map[int][]*models.VInterface)
+	hostIDToV6Vifs := make(map[int][]*models.VInterface)
 	for _, vif := range rawData.deviceVifs {
 		if !s.vtapUsedVInterfaceIDs.Contains(vif.ID) {
 			if !isMacNullOrDefault(vif.Mac) {
-				macs = append(macs, vif.Mac)
-				vmacs = append(vmacs, vif.Mac)
-				vifIDs = append(vifIDs, uint32(vif.ID))
+				hostID := rawData.getVifHostID(vif)
+				if isIPv6OnlyVif(vif.ID, rawData) {
+					v6Vifs = append(v6Vifs, vif)
+					hostIDToV6Vifs[hostID] = append(hostIDToV6Vifs[hostID], vif)
+				} else {
+					vifs = append(vifs, vif)
+					hostIDToVifs[hostID] = append(hostIDToVifs[hostID], vif)
+				}
 			}
 		}
 	}
 
-	if len(macs) > 0 {
-		segment := &trident.Segment{
-			Id:          proto.Uint32(uint32(1)),
-			Mac:         macs,
-			Vmac:        vmacs,
-			InterfaceId: vifIDs,
-		}
-		segments = append(segments, segment)
+	hostIDToSegments := make(map[int][]*trident.Segment, len(hostIDToVifs))
+	for hostID, hostVifs := range hostIDToVifs {
+		hostIDToSegments[hostID] = append(hostIDToSegments[hostID], newNoVTapUsedSegment(NO_VTAP_USED_SEGMENT_ID, hostVifs))
+	}
+	for hostID, hostVifs := range hostIDToV6Vifs {
+		hostIDToSegments[hostID] = append(hostIDToSegments[hostID], newNoVTapUsedSegment(NO_VTAP_USED_SEGMENT_V6_ID, hostVifs))
+	}
+
+	segments := make([]*trident.Segment, 0, 1)
+	if len(vifs) > 0 {
+		segments = append(segments, newNoVTapUsedSegment(NO_VTAP_USED_SEGMENT_ID, vifs))
 	}
-	log.Infof("vtap about vifs used: %d  not used: %d",
-		s.vtapUsedVInterfaceIDs.Cardinality(), len(macs))
+	v6Segments := make([]*trident.Segment, 0, 1)
+	if len(v6Vifs) > 0 {
+		v6Segments = append(v6Segments, newNoVTapUsedSegment(NO_VTAP_USED_SEGMENT_V6_ID, v6Vifs))
+	}
+	log.Infof("vtap about vifs used: %d  not used: %d (ipv6: %d)",
+		s.vtapUsedVInterfaceIDs.Cardinality(), len(vifs)+len(v6Vifs), len(v6Vifs))
 	s.notVtapUsedSegments = segments
+	s.notVtapUsedSegmentsV6 = v6Segments
+	s.hostIDToNotVtapUsedSegments = hostIDToSegments
 }
 
 func (s *Segment) GetLaunchServerSegments(launchServer string) []*trident.Segment {
@@ -413,6 +883,40 @@ func (s *Segment) GetLaunchServerSegments(launchServer string) []*trident.Segmen
 	return append(segment1, segment2...)
 }
 
+// 批量获取多个launch server的segment，重复的launch server只计算一次，采集器使用的接口统一记录在当前segment
+func (s *Segment) GetSegmentsForServers(servers []string) map[string][]*trident.Segment {
+	serverToSegments := make(map[string][]*trident.Segment, len(servers))
+	for _, server := range servers {
+		if _, ok := serverToSegments[server]; ok {
+			continue
+		}
+		serverToSegments[server] = s.GetLaunchServerSegments(server)
+	}
+	return serverToSegments
+}
+
+// 获取宿主机类型采集器的local segment(launch server + host)，结果缓存至下次平台数据刷新
+func (s *Segment) GetServerSegments(launchServer string, hostID int) []*trident.Segment {
+	key := serverSegmentsKey{launchServer: launchServer, hostID: hostID}
+	if segments, ok := s.serverSegmentsCache.get(key); ok {
+		// vtapUsedVInterfaceIDs每轮下发前会被清空，命中缓存时需重新记录
+		for _, segment := range segments {
+			for _, vifID := range segment.GetInterfaceId() {
+				s.vtapUsedVInterfaceIDs.Add(int(vifID))
+			}
+		}
+		return segments
+	}
+
+	launchServerSegments := s.GetLaunchServerSegments(launchServer)
+	hostIDSegments := s.GetHostIDSegments(hostID)
+	segments := make([]*trident.Segment, 0, len(launchServerSegments)+len(hostIDSegments))
+	segments = append(segments, launchServerSegments...)
+	segments = append(segments, hostIDSegments...)
+	s.serverSegmentsCache.set(key, segments)
+	return segments
+}
+
 func (s *Segment) GetVMIDSegments(vmID int) []*trident.Segment {
 	return s.vmIDToSegments.getSegmentsByID(vmID, s)
 }
@@ -429,13 +933,50 @@ func (s *Segment) GetPodNodeSegments(podNodeID int) []*trident.Segment {
 	return s.podNodeIDToSegments.getSegmentsByID(podNodeID, s)
 }
 
-func (s *Segment) GetTypeVMSegments(launchServer string, hostID int) []*trident.Segment {
+// launch server与宿主机，即宿主机类型采集器的local segment
+const SEGMENT_SCOPE_SERVER = "server"
+
+// segment范围，Server仅用于server类型，ID为宿主机(server类型)、vm或pod_node的ID
+type SegmentScope struct {
+	Type   string
+	Server string
+	ID     int
+}
+
+// MarshalProto 将范围内的segment序列化为全量的SegmentPushResponse，供工具使用与采集器相同的proto定义解析
+// 在副本上获取segment，不影响下发数据及缓存统计
+func (s *Segment) MarshalProto(scope SegmentScope) ([]byte, error) {
+	dump := s.Copy()
+	var segments []*trident.Segment
+	switch scope.Type {
+	case SEGMENT_SCOPE_SERVER:
+		segments = dump.GetServerSegments(scope.Server, scope.ID)
+	case SEGMENT_SCOPE_HOST:
+		segments = dump.GetHostIDSegments(scope.ID)
+	case SEGMENT_SCOPE_VM:
+		segments = dump.GetVMIDSegments(scope.ID)
+	case SEGMENT_SCOPE_POD_NODE:
+		segments = dump.GetPodNodeSegments(scope.ID)
+	default:
+		return nil, fmt.Errorf("invalid segment scope (%s)", scope.Type)
+	}
+	return proto.Marshal(&trident.SegmentPushResponse{
+		Full:          proto.Bool(true),
+		LocalSegments: segments,
+	})
+}
+
+// 获取ESXi采集器的local segment，旧版本采集器将所有接口合并为一个id为1的segment，新版本按网络拆分
+func (s *Segment) GetTypeVMSegments(launchServer string, hostID int, version uint32) []*trident.Segment {
+	if version >= SEGMENT_VERSION_NETWORK_ID {
+		return s.GetServerSegments(launchServer, hostID)
+	}
 	macs := []string{}
 	vmacs := []string{}
 	vifIDs := []uint32{}
 	if networkMacs, ok := s.launchServerToSegments[launchServer]; ok {
-		for _, macIDs := range networkMacs {
-			for _, macID := range macIDs {
+		for _, networkID := range networkMacs.sortedNetworkIDs() {
+			for _, macID := range sortedMacIDs(networkMacs[networkID]) {
 				macs = append(macs, macID.Mac)
 				vmacs = append(vmacs, macID.Mac)
 				vifIDs = append(vifIDs, uint32(macID.ID))
@@ -444,8 +985,8 @@ func (s *Segment) GetTypeVMSegments(launchServer string, hostID int) []*trident.
 		}
 	}
 	if networkMacs, ok := s.vRouterLaunchServerToSegments[launchServer]; ok {
-		for _, macIDs := range networkMacs {
-			for _, macID := range macIDs {
+		for _, networkID := range networkMacs.sortedNetworkIDs() {
+			for _, macID := range sortedMacIDs(networkMacs[networkID]) {
 				macs = append(macs, macID.Mac)
 				vmacs = append(vmacs, macID.Mac)
 				vifIDs = append(vifIDs, uint32(macID.ID))
@@ -454,8 +995,8 @@ func (s *Segment) GetTypeVMSegments(launchServer string, hostID int) []*trident.
 		}
 	}
 	if networkMacs, ok := s.hostIDToSegments[hostID]; ok {
-		for _, macIDs := range networkMacs {
-			for _, macID := range macIDs {
+		for _, networkID := range networkMacs.sortedNetworkIDs() {
+			for _, macID := range sortedMacIDs(networkMacs[networkID]) {
 				macs = append(macs, macID.Mac)
 				vmacs = append(vmacs, macID.Mac)
 				vifIDs = append(vifIDs, uint32(macID.ID))
@@ -473,8 +1014,401 @@ func (s *Segment) GetTypeVMSegments(launchServer string, hostID int) []*trident.
 	return []*trident.Segment{segment}
 }
 
+// 遍历所有范围内的segment，scope为范围类型，key为launch server或资源ID
+func (s *Segment) rangeNetworkMacs(fn func(scope string, key interface{}, networkMacs NetworkMacs)) {
+	for _, scoped := range []struct {
+		scope    string
+		segments ServerToNetworkMacs
+	}{
+		{"launch_server", s.launchServerToSegments},
+		{"vrouter_launch_server", s.vRouterLaunchServerToSegments},
+	} {
+		for server, networkMacs := range scoped.segments {
+			fn(scoped.scope, server, networkMacs)
+		}
+	}
+	for _, scoped := range []struct {
+		scope    string
+		segments IDToNetworkMacs
+	}{
+		{"host", s.hostIDToSegments},
+		{"gateway_host", s.gatewayHostIDToSegments},
+		{"vm", s.vmIDToSegments},
+		{"pod", s.podIDToSegments},
+		{"pod_node", s.podNodeIDToSegments},
+	} {
+		for id, networkMacs := range scoped.segments {
+			fn(scoped.scope, id, networkMacs)
+		}
+	}
+}
+
+// 统计各网络下segment中的MAC数量，同一MAC出现在多个范围内时只计一次
+func (s *Segment) NetworkMacCounts() map[int]int {
+	networkIDToMacs := make(map[int]map[string]struct{})
+	s.rangeNetworkMacs(func(_ string, _ interface{}, networkMacs NetworkMacs) {
+		for networkID, macIDs := range networkMacs {
+			macs, ok := networkIDToMacs[networkID]
+			if !ok {
+				macs = make(map[string]struct{})
+				networkIDToMacs[networkID] = macs
+			}
+			for _, macID := range macIDs {
+				macs[macID.Mac] = struct{}{}
+			}
+		}
+	})
+
+	networkIDToCount := make(map[int]int, len(networkIDToMacs))
+	for networkID, macs := range networkIDToMacs {
+		networkIDToCount[networkID] = len(macs)
+	}
+	return networkIDToCount
+}
+
+// 检查segment数据的一致性，返回所有违反的约束，用于排查采集器MAC缺失问题
+func (s *Segment) Validate() []string {
+	violations := []string{}
+	countVifs := func(idToNetworkMacs IDToNetworkMacs) map[int]int {
+		vifIDToCount := make(map[int]int)
+		for _, networkMacs := range idToNetworkMacs {
+			for _, macIDs := range networkMacs {
+				for _, macID := range macIDs {
+					vifIDToCount[macID.ID]++
+				}
+			}
+		}
+		return vifIDToCount
+	}
+
+	// launch server中的接口属于且仅属于一个vm，不在vm上的(pod_node直接运行在宿主机上)属于且仅属于一个pod_node
+	vifIDToVMCount := countVifs(s.vmIDToSegments)
+	vifIDToPodNodeCount := countVifs(s.podNodeIDToSegments)
+	for server, networkMacs := range s.launchServerToSegments {
+		for _, macIDs := range networkMacs {
+			for _, macID := range macIDs {
+				count, scope := vifIDToVMCount[macID.ID], "vm"
+				if count == 0 {
+					count, scope = vifIDToPodNodeCount[macID.ID], "vm/pod_node"
+				}
+				if count != 1 {
+					violations = append(violations, fmt.Sprintf(
+						"launch_server(%s) mac(%s) vif(%d) found in %d %s scope(s), expected 1",
+						server, macID.Mac, macID.ID, count, scope))
+				}
+			}
+		}
+	}
+
+	// 采集器使用的接口均为平台数据中存在的接口
+	for vifID := range s.vtapUsedVInterfaceIDs.Iter() {
+		if _, ok := s.vifIDToMacID[vifID.(int)]; !ok {
+			violations = append(violations, fmt.Sprintf("vtap used vif(%d) not found", vifID))
+		}
+	}
+
+	// 不存在没有MAC的网络
+	s.rangeNetworkMacs(func(scope string, key interface{}, networkMacs NetworkMacs) {
+		for networkID, macIDs := range networkMacs {
+			if len(macIDs) == 0 {
+				violations = append(violations, fmt.Sprintf("%s(%v) network(%d) has no mac", scope, key, networkID))
+			}
+		}
+	})
+
+	sort.Strings(violations)
+	return violations
+}
+
+// 基础segment的数据版本，每次重新生成后加1，未生成时为0
+func (s *Segment) GetDataVersion() uint64 {
+	return s.dataVersion
+}
+
 func (s *Segment) generateBaseSegments(rawData *PlatformRawData) {
+	// 原始数据未变化时复用上次生成的segment
+	dataHash := hashSegmentData(rawData)
+	if s.dataVersion > 0 && dataHash == s.dataHash {
+		log.Debugf("segment raw data not changed, skip generating (version: %d)", s.dataVersion)
+		return
+	}
+	s.serverSegmentsCache.reset()
+	s.vmIDToMigratedServer = make(map[int]string)
 	s.convertDBInfo(rawData)
 	s.generateBaseSegmentsFromDB(rawData)
+	s.generateVifIDToMacID(rawData)
+	s.generateOverlappedNetworkSegmentIDs()
 	s.generateGatewayHostSegments()
+	s.generateGlobalSegments(rawData)
+	s.checkEmptySegments(rawData)
+	s.explainRawData = rawData
+	s.dataHash = dataHash
+	s.dataVersion++
+}
+
+func hasValidMacVif(idToVifs map[int]mapset.Set) bool {
+	for _, vifs := range idToVifs {
+		for data := range vifs.Iter() {
+			if !isMacNullOrDefault(data.(*models.VInterface).Mac) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasMac(idToNetworkMacs IDToNetworkMacs) bool {
+	for _, networkMacs := range idToNetworkMacs {
+		for _, macIDs := range networkMacs {
+			if len(macIDs) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 检查原始数据中有有效MAC的接口但生成的segment为空的范围，原始数据本身没有接口时视为正常；
+// 返回是否输出了告警，告警按EMPTY_SEGMENTS_WARNING_INTERVAL限频
+func (s *Segment) checkEmptySegments(rawData *PlatformRawData) bool {
+	scopes := []string{}
+	for _, item := range []struct {
+		scope    string
+		vifs     map[int]mapset.Set
+		segments IDToNetworkMacs
+	}{
+		{"vm", rawData.vmIDToVifs, s.vmIDToSegments},
+		{"host", rawData.hostIDToVifs, s.hostIDToSegments},
+		{"pod", rawData.podIDToVifs, s.podIDToSegments},
+		{"pod_node", rawData.podNodeIDToVifs, s.podNodeIDToSegments},
+	} {
+		if hasValidMacVif(item.vifs) && !hasMac(item.segments) {
+			scopes = append(scopes, item.scope)
+		}
+	}
+	s.emptySegmentScopes = scopes
+	if len(scopes) == 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Sub(s.emptySegmentsWarnedAt) < EMPTY_SEGMENTS_WARNING_INTERVAL {
+		return false
+	}
+	s.emptySegmentsWarnedAt = now
+	log.Warningf("%v segments are empty while platform data has %d vifs, segment generation may be broken",
+		scopes, len(rawData.deviceVifs))
+	return true
+}
+
+// GetEmptySegmentScopes 返回最近一次生成时原始数据有接口但segment为空的范围，为空表示正常
+func (s *Segment) GetEmptySegmentScopes() []string {
+	return s.emptySegmentScopes
+}
+
+type networkDomainKey struct {
+	networkID int
+	domain    string
+}
+
+// 重新分配的segment id从该值开始，不与网络ID冲突
+const REMAPPED_SEGMENT_ID_BASE = 1 << 31
+
+// 检测被多个domain复用的网络ID，按(networkID, domain)排序依次分配segment id，保证平台数据不变时id稳定
+func (s *Segment) generateOverlappedNetworkSegmentIDs() {
+	networkIDToDomains := make(map[int]map[string]struct{})
+	s.rangeNetworkMacs(func(_ string, _ interface{}, networkMacs NetworkMacs) {
+		for networkID, macIDs := range networkMacs {
+			for _, macID := range macIDs {
+				if _, ok := networkIDToDomains[networkID]; !ok {
+					networkIDToDomains[networkID] = make(map[string]struct{})
+				}
+				networkIDToDomains[networkID][macID.Domain] = struct{}{}
+			}
+		}
+	})
+
+	keys := []networkDomainKey{}
+	overlappedNetworkIDs := make(map[int]struct{})
+	for networkID, domains := range networkIDToDomains {
+		if len(domains) <= 1 {
+			continue
+		}
+		overlappedNetworkIDs[networkID] = struct{}{}
+		for domain := range domains {
+			keys = append(keys, networkDomainKey{networkID: networkID, domain: domain})
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].networkID != keys[j].networkID {
+			return keys[i].networkID < keys[j].networkID
+		}
+		return keys[i].domain < keys[j].domain
+	})
+	networkDomainToSegmentID := make(map[networkDomainKey]uint32, len(keys))
+	for i, key := range keys {
+		networkDomainToSegmentID[key] = uint32(REMAPPED_SEGMENT_ID_BASE + i)
+	}
+	if len(keys) > 0 {
+		log.Infof("%d network ids are reused by multiple domains, remap %d segment ids", len(overlappedNetworkIDs), len(keys))
+	}
+	s.overlappedNetworkIDs = overlappedNetworkIDs
+	s.networkDomainToSegmentID = networkDomainToSegmentID
+}
+
+// 返回网络在指定domain下的segment id，未重叠时即为网络ID
+func (s *Segment) getSegmentID(networkID int, domain string) uint32 {
+	if segmentID, ok := s.networkDomainToSegmentID[networkDomainKey{networkID: networkID, domain: domain}]; ok {
+		return segmentID
+	}
+	return uint32(networkID)
+}
+
+func (s *Segment) generateVifIDToMacID(rawData *PlatformRawData) {
+	vifIDToMacID := make(map[int]*MacID, len(rawData.deviceVifs))
+	for _, vif := range rawData.deviceVifs {
+		vifIDToMacID[vif.ID] = newMacID(vif)
+	}
+	s.rangeNetworkMacs(func(_ string, _ interface{}, networkMacs NetworkMacs) {
+		for _, macIDs := range networkMacs {
+			for _, macID := range macIDs {
+				vifIDToMacID[macID.ID] = macID
+			}
+		}
+	})
+	s.vifIDToMacID = vifIDToMacID
+}
+
+// 多租户场景下按采集器可见的domain(或sub_domain)过滤segment，domains为空时不过滤
+func (s *Segment) FilterSegmentsByDomains(segments []*trident.Segment, domains []string) []*trident.Segment {
+	if len(domains) == 0 {
+		return segments
+	}
+	domainSet := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		domainSet[domain] = struct{}{}
+	}
+	return s.filterSegmentsByMacID(segments, func(macID *MacID) bool {
+		if _, ok := domainSet[macID.Domain]; ok {
+			return true
+		}
+		_, ok := domainSet[macID.SubDomain]
+		return ok
+	})
+}
+
+// 按采集器关注的接口设备类型(如仅POD、仅VM)过滤segment，deviceTypes为空时不过滤
+func (s *Segment) FilterSegmentsByDeviceTypes(segments []*trident.Segment, deviceTypes []int) []*trident.Segment {
+	if len(deviceTypes) == 0 {
+		return segments
+	}
+	deviceTypeSet := make(map[int]struct{}, len(deviceTypes))
+	for _, deviceType := range deviceTypes {
+		deviceTypeSet[deviceType] = struct{}{}
+	}
+	return s.filterSegmentsByMacID(segments, func(macID *MacID) bool {
+		_, ok := deviceTypeSet[macID.DeviceType]
+		return ok
+	})
+}
+
+// 仅保留visible返回true的接口，过滤后为空的segment不下发
+func (s *Segment) filterSegmentsByMacID(segments []*trident.Segment, visible func(macID *MacID) bool) []*trident.Segment {
+	result := make([]*trident.Segment, 0, len(segments))
+	for _, segment := range segments {
+		vifIDs := segment.GetInterfaceId()
+		macs := make([]string, 0, len(vifIDs))
+		vmacs := make([]string, 0, len(vifIDs))
+		filteredVifIDs := make([]uint32, 0, len(vifIDs))
+		for i, vifID := range vifIDs {
+			macID, ok := s.vifIDToMacID[int(vifID)]
+			if !ok || !visible(macID) || i >= len(segment.GetMac()) {
+				continue
+			}
+			macs = append(macs, segment.GetMac()[i])
+			if i < len(segment.GetVmac()) {
+				vmacs = append(vmacs, segment.GetVmac()[i])
+			}
+			filteredVifIDs = append(filteredVifIDs, vifID)
+		}
+		if len(filteredVifIDs) == 0 {
+			continue
+		}
+		result = append(result, &trident.Segment{
+			Id:          proto.Uint32(segment.GetId()),
+			Mac:         macs,
+			Vmac:        vmacs,
+			InterfaceId: filteredVifIDs,
+		})
+	}
+	return result
+}
+
+// 从NetworkMacs中移除指定的vif，返回新的NetworkMacs，不修改原有的slice
+func (n NetworkMacs) remove(vifIDs mapset.Set) NetworkMacs {
+	networkMacs := newNetworkMacs()
+	for networkID, macIDs := range n {
+		remained := make([]*MacID, 0, len(macIDs))
+		for _, macID := range macIDs {
+			if !vifIDs.Contains(macID.ID) {
+				remained = append(remained, macID)
+			}
+		}
+		if len(remained) > 0 {
+			networkMacs[networkID] = remained
+		}
+	}
+	return networkMacs
+}
+
+// vm迁移到新的launch server时，将vm及其上pod_node、pod的vif从原launch server的segment移动到新launch server，
+// 无需等待下一次全量生成segment；返回segment是否发生变化
+func (s *Segment) MigrateVM(rawData *PlatformRawData, vmID int, launchServer string) bool {
+	vm, ok := rawData.idToVM[vmID]
+	if !ok || !isValidLaunchServer(launchServer) {
+		return false
+	}
+	oldLaunchServer := vm.LaunchServer
+	if server, ok := s.vmIDToMigratedServer[vmID]; ok {
+		oldLaunchServer = server
+	}
+	if oldLaunchServer == launchServer {
+		return false
+	}
+
+	vifs := mapset.NewSet()
+	if vmVifs, ok := rawData.vmIDToVifs[vmID]; ok {
+		vifs = vifs.Union(vmVifs)
+	}
+	if podNodeVifs, ok := s.vmIDToPodNodeAllVifs[vmID]; ok {
+		vifs = vifs.Union(podNodeVifs)
+	}
+	if vifs.Cardinality() == 0 {
+		return false
+	}
+	vifIDs := mapset.NewSet()
+	for vif := range vifs.Iter() {
+		vifIDs.Add(vif.(*models.VInterface).ID)
+	}
+
+	launchServerToSegments := make(ServerToNetworkMacs, len(s.launchServerToSegments)+1)
+	for server, networkMacs := range s.launchServerToSegments {
+		launchServerToSegments[server] = networkMacs
+	}
+	if networkMacs, ok := launchServerToSegments[oldLaunchServer]; ok {
+		launchServerToSegments[oldLaunchServer] = networkMacs.remove(vifIDs)
+	}
+	networkMacs := newNetworkMacs()
+	if oldNetworkMacs, ok := launchServerToSegments[launchServer]; ok {
+		networkMacs = oldNetworkMacs.remove(vifIDs)
+	}
+	for vif := range vifs.Iter() {
+		networkMacs.add(vif)
+	}
+	launchServerToSegments[launchServer] = networkMacs
+
+	s.launchServerToSegments = launchServerToSegments
+	s.vmIDToMigratedServer[vmID] = launchServer
+	s.serverSegmentsCache.reset()
+	log.Infof("vm(%d) migrated from %s to %s, move %d vifs", vmID, oldLaunchServer, launchServer, vifs.Cardinality())
+	return true
 }
@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/message/trident"
+)
+
+// SetSegmentCompaction 设置是否合并只有一个MAC的segment，用于稀疏网络中减少下发的segment个数
+func (s *Segment) SetSegmentCompaction(enabled bool) {
+	s.segmentCompaction = enabled
+}
+
+func (s *Segment) SegmentCompactionEnabled() bool {
+	return s.segmentCompaction
+}
+
+// CompactSegments 合并只有一个MAC的segment，不修改传入的segment；
+// 旧版本采集器不区分segment id，所有单MAC segment合并为一个并沿用第一个的id，
+// 其他版本segment id为网络ID，只合并id相同的单MAC segment，不跨网络合并
+func CompactSegments(segments []*trident.Segment, version uint32) []*trident.Segment {
+	mergeKey := func(segment *trident.Segment) uint32 {
+		if version < SEGMENT_VERSION_NETWORK_ID {
+			return 0
+		}
+		return segment.GetId()
+	}
+	keyToCount := make(map[uint32]int)
+	for _, segment := range segments {
+		if len(segment.GetMac()) == 1 {
+			keyToCount[mergeKey(segment)]++
+		}
+	}
+
+	result := make([]*trident.Segment, 0, len(segments))
+	keyToMerged := make(map[uint32]*trident.Segment)
+	for _, segment := range segments {
+		key := mergeKey(segment)
+		if len(segment.GetMac()) != 1 || keyToCount[key] < 2 {
+			result = append(result, segment)
+			continue
+		}
+		merged, ok := keyToMerged[key]
+		if !ok {
+			merged = &trident.Segment{Id: proto.Uint32(segment.GetId())}
+			keyToMerged[key] = merged
+			result = append(result, merged)
+		}
+		merged.Mac = append(merged.Mac, segment.GetMac()...)
+		merged.Vmac = append(merged.Vmac, segment.GetVmac()...)
+		merged.InterfaceId = append(merged.InterfaceId, segment.GetInterfaceId()...)
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	"sort"
+)
+
+// segment的确定性快照: scope(如launch_server:10.0.0.1、vm:1) -> 网络ID -> 排序去重后的MAC
+type segmentSnapshot map[string]map[int][]string
+
+func (s *Segment) snapshot() segmentSnapshot {
+	snapshot := make(segmentSnapshot)
+	s.rangeNetworkMacs(func(scope string, key interface{}, networkMacs NetworkMacs) {
+		networkToMacs := make(map[int][]string, len(networkMacs))
+		for networkID, macIDs := range networkMacs {
+			macSet := make(map[string]struct{}, len(macIDs))
+			for _, macID := range macIDs {
+				macSet[macID.Mac] = struct{}{}
+			}
+			networkToMacs[networkID] = sortedMacs(macSet)
+		}
+		snapshot[fmt.Sprintf("%s:%v", scope, key)] = networkToMacs
+	})
+	return snapshot
+}
+
+func sortedMacs(macSet map[string]struct{}) []string {
+	macs := make([]string, 0, len(macSet))
+	for mac := range macSet {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	return macs
+}
+
+type SegmentScopeDiff struct {
+	Scope     string   `json:"SCOPE"`
+	NetworkID int      `json:"NETWORK_ID"`
+	Added     []string `json:"ADDED"`
+	Removed   []string `json:"REMOVED"`
+}
+
+type SegmentDiff struct {
+	Added   map[int][]string    `json:"ADDED"`   // key: 网络ID，任一scope中新增的MAC
+	Removed map[int][]string    `json:"REMOVED"` // key: 网络ID，任一scope中删除的MAC
+	Scopes  []*SegmentScopeDiff `json:"SCOPES"`  // 按scope、网络ID排序
+}
+
+func (d SegmentDiff) IsEmpty() bool {
+	return len(d.Scopes) == 0
+}
+
+// 比较两次平台数据生成的segment，返回b相对于a新增和删除的MAC，用于校验对接变更是否影响采集器可见范围
+func DiffSegments(a, b *Segment) SegmentDiff {
+	aSnapshot, bSnapshot := a.snapshot(), b.snapshot()
+	scopeSet := make(map[string]struct{}, len(aSnapshot)+len(bSnapshot))
+	for scope := range aSnapshot {
+		scopeSet[scope] = struct{}{}
+	}
+	for scope := range bSnapshot {
+		scopeSet[scope] = struct{}{}
+	}
+	scopes := make([]string, 0, len(scopeSet))
+	for scope := range scopeSet {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+
+	diff := SegmentDiff{Scopes: []*SegmentScopeDiff{}}
+	addedSet := make(map[int]map[string]struct{})
+	removedSet := make(map[int]map[string]struct{})
+	for _, scope := range scopes {
+		aNetworks, bNetworks := aSnapshot[scope], bSnapshot[scope]
+		networkIDSet := make(map[int]struct{}, len(aNetworks)+len(bNetworks))
+		for networkID := range aNetworks {
+			networkIDSet[networkID] = struct{}{}
+		}
+		for networkID := range bNetworks {
+			networkIDSet[networkID] = struct{}{}
+		}
+		networkIDs := make([]int, 0, len(networkIDSet))
+		for networkID := range networkIDSet {
+			networkIDs = append(networkIDs, networkID)
+		}
+		sort.Ints(networkIDs)
+
+		for _, networkID := range networkIDs {
+			added := subtractMacs(bNetworks[networkID], aNetworks[networkID])
+			removed := subtractMacs(aNetworks[networkID], bNetworks[networkID])
+			if len(added) == 0 && len(removed) == 0 {
+				continue
+			}
+			diff.Scopes = append(diff.Scopes, &SegmentScopeDiff{
+				Scope:     scope,
+				NetworkID: networkID,
+				Added:     added,
+				Removed:   removed,
+			})
+			addMacsToSet(addedSet, networkID, added)
+			addMacsToSet(removedSet, networkID, removed)
+		}
+	}
+
+	diff.Added = make(map[int][]string, len(addedSet))
+	for networkID, macSet := range addedSet {
+		diff.Added[networkID] = sortedMacs(macSet)
+	}
+	diff.Removed = make(map[int][]string, len(removedSet))
+	for networkID, macSet := range removedSet {
+		diff.Removed[networkID] = sortedMacs(macSet)
+	}
+	return diff
+}
+
+// 返回在from中但不在exclude中的MAC，两者均已排序
+func subtractMacs(from, exclude []string) []string {
+	result := []string{}
+	i := 0
+	for _, mac := range from {
+		for i < len(exclude) && exclude[i] < mac {
+			i++
+		}
+		if i < len(exclude) && exclude[i] == mac {
+			continue
+		}
+		result = append(result, mac)
+	}
+	return result
+}
+
+func addMacsToSet(networkToMacSet map[int]map[string]struct{}, networkID int, macs []string) {
+	if len(macs) == 0 {
+		return
+	}
+	macSet, ok := networkToMacSet[networkID]
+	if !ok {
+		macSet = make(map[string]struct{}, len(macs))
+		networkToMacSet[networkID] = macSet
+	}
+	for _, mac := range macs {
+		macSet[mac] = struct{}{}
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"testing"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/deepflowio/deepflow/server/controller/common"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+func newDiffTestSegment(vifs ...*models.VInterface) *Segment {
+	rawData := NewPlatformRawData()
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	vmVifs := mapset.NewSet()
+	for _, vif := range vifs {
+		vmVifs.Add(vif)
+	}
+	rawData.vmIDToVifs[1] = vmVifs
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	return s
+}
+
+func TestDiffSegments(t *testing.T) {
+	vif1 := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vif2 := newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:02")
+	a := newDiffTestSegment(vif1)
+	b := newDiffTestSegment(vif1, vif2)
+
+	assert.True(t, DiffSegments(a, a).IsEmpty())
+
+	diff := DiffSegments(a, b)
+	assert.Equal(t, map[int][]string{10: {"00:00:00:00:00:02"}}, diff.Added)
+	assert.Empty(t, diff.Removed)
+	assert.Equal(t, []*SegmentScopeDiff{
+		{Scope: "launch_server:10.0.0.1", NetworkID: 10, Added: []string{"00:00:00:00:00:02"}, Removed: []string{}},
+		{Scope: "vm:1", NetworkID: 10, Added: []string{"00:00:00:00:00:02"}, Removed: []string{}},
+	}, diff.Scopes)
+
+	diff = DiffSegments(b, a)
+	assert.Empty(t, diff.Added)
+	assert.Equal(t, map[int][]string{10: {"00:00:00:00:00:02"}}, diff.Removed)
+}
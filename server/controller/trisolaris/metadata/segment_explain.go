@@ -0,0 +1,191 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	mapset "github.com/deckarep/golang-set"
+
+	"github.com/deepflowio/deepflow/message/trident"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+// 原始数据中找不到关联关系的MAC，如保留中的已删除接口
+const SEGMENT_MAC_SOURCE_STALE = "stale"
+
+// SegmentMacSource 说明MAC被加入segment的原因
+type SegmentMacSource struct {
+	VInterfaceID int
+	// 从采集器范围到接口所属资源的关联链路，如[server(10.0.0.1) vm(1) pod_node(2) pod(3)]
+	Relations []string
+}
+
+// ExplainedSegment segment及其中每个MAC的来源
+type ExplainedSegment struct {
+	Segment    *trident.Segment
+	MacSources map[string]*SegmentMacSource
+}
+
+// Explain 获取范围内的segment并说明每个MAC的来源，仅用于排查问题
+// 在副本上获取segment，不影响下发数据及缓存统计
+func (s *Segment) Explain(scope SegmentScope) ([]*ExplainedSegment, error) {
+	rawData := s.explainRawData
+	if rawData == nil {
+		return nil, errors.New("segments not generated")
+	}
+	dump := s.Copy()
+	e := &segmentExplainer{rawData: rawData, segment: s, vifIDToRelations: make(map[int][]string)}
+	var segments []*trident.Segment
+	switch scope.Type {
+	case SEGMENT_SCOPE_SERVER:
+		segments = dump.GetServerSegments(scope.Server, scope.ID)
+		e.addServer(scope.Server)
+		e.addHost(scope.ID)
+	case SEGMENT_SCOPE_HOST:
+		segments = dump.GetHostIDSegments(scope.ID)
+		e.addHost(scope.ID)
+	case SEGMENT_SCOPE_VM:
+		segments = dump.GetVMIDSegments(scope.ID)
+		e.addVM(nil, scope.ID)
+	case SEGMENT_SCOPE_POD_NODE:
+		segments = dump.GetPodNodeSegments(scope.ID)
+		e.addPodNode(nil, scope.ID)
+	default:
+		return nil, fmt.Errorf("invalid segment scope (%s)", scope.Type)
+	}
+
+	explained := make([]*ExplainedSegment, 0, len(segments))
+	for _, segment := range segments {
+		macSources := make(map[string]*SegmentMacSource, len(segment.GetMac()))
+		vifIDs := segment.GetInterfaceId()
+		for i, mac := range segment.GetMac() {
+			source := &SegmentMacSource{Relations: []string{SEGMENT_MAC_SOURCE_STALE}}
+			if i < len(vifIDs) {
+				source.VInterfaceID = int(vifIDs[i])
+				if relations, ok := e.vifIDToRelations[source.VInterfaceID]; ok {
+					source.Relations = relations
+				}
+			}
+			macSources[mac] = source
+		}
+		explained = append(explained, &ExplainedSegment{Segment: segment, MacSources: macSources})
+	}
+	return explained, nil
+}
+
+// 按生成segment时的索引记录每个接口的关联链路，同一接口有多条链路时保留最先找到的
+type segmentExplainer struct {
+	rawData          *PlatformRawData
+	segment          *Segment
+	vifIDToRelations map[int][]string
+}
+
+func appendRelation(relations []string, relation string) []string {
+	result := make([]string, 0, len(relations)+1)
+	result = append(result, relations...)
+	return append(result, relation)
+}
+
+func (e *segmentExplainer) addVifs(relations []string, vifs mapset.Set) {
+	if vifs == nil {
+		return
+	}
+	for vif := range vifs.Iter() {
+		vifID := vif.(*models.VInterface).ID
+		if _, ok := e.vifIDToRelations[vifID]; !ok {
+			e.vifIDToRelations[vifID] = relations
+		}
+	}
+}
+
+func (e *segmentExplainer) addServer(server string) {
+	relations := []string{fmt.Sprintf("server(%s)", server)}
+	for _, vmID := range e.serverVMIDs(server) {
+		e.addVM(relations, vmID)
+	}
+	// 没有关联vm的pod_node归属到pod_node所在的launch server
+	podNodeIDs := make([]int, 0, len(e.rawData.idToPodNode))
+	for podNodeID, podNode := range e.rawData.idToPodNode {
+		if _, ok := e.rawData.podNodeIDToVmID[podNodeID]; !ok && podNode.IP == server {
+			podNodeIDs = append(podNodeIDs, podNodeID)
+		}
+	}
+	sort.Ints(podNodeIDs)
+	for _, podNodeID := range podNodeIDs {
+		e.addPodNode(relations, podNodeID)
+	}
+	for _, vRouterID := range e.rawData.launchServerToVRouterIDs[server] {
+		e.addVifs(appendRelation(relations, fmt.Sprintf("vrouter(%d)", vRouterID)), e.rawData.vRouterIDToVifs[vRouterID])
+	}
+}
+
+// launch server上的vm，包含生成segment后迁移至该launch server的vm
+func (e *segmentExplainer) serverVMIDs(server string) []int {
+	vmIDs := []int{}
+	if ids, ok := e.rawData.serverToVmIDs[server]; ok {
+		for _, vmID := range sortedSetIDs(ids) {
+			if migratedServer, ok := e.segment.vmIDToMigratedServer[vmID]; ok && migratedServer != server {
+				continue
+			}
+			vmIDs = append(vmIDs, vmID)
+		}
+	}
+	migratedVMIDs := []int{}
+	for vmID, migratedServer := range e.segment.vmIDToMigratedServer {
+		if migratedServer == server {
+			migratedVMIDs = append(migratedVMIDs, vmID)
+		}
+	}
+	sort.Ints(migratedVMIDs)
+	return append(vmIDs, migratedVMIDs...)
+}
+
+func (e *segmentExplainer) addHost(hostID int) {
+	e.addVifs([]string{fmt.Sprintf("host(%d)", hostID)}, e.rawData.hostIDToVifs[hostID])
+}
+
+func (e *segmentExplainer) addVM(relations []string, vmID int) {
+	relations = appendRelation(relations, fmt.Sprintf("vm(%d)", vmID))
+	e.addVifs(relations, e.rawData.vmIDToVifs[vmID])
+	e.addVifs(appendRelation(relations, "floating_ip"), e.rawData.vmIDToFloatingIPVifs[vmID])
+	podNodeIDs := []int{}
+	for podNodeID, podNodeVMID := range e.rawData.podNodeIDToVmID {
+		if podNodeVMID == vmID {
+			podNodeIDs = append(podNodeIDs, podNodeID)
+		}
+	}
+	sort.Ints(podNodeIDs)
+	for _, podNodeID := range podNodeIDs {
+		e.addPodNode(relations, podNodeID)
+	}
+}
+
+func (e *segmentExplainer) addPodNode(relations []string, podNodeID int) {
+	if _, ok := e.rawData.idToPodNode[podNodeID]; !ok {
+		return
+	}
+	relations = appendRelation(relations, fmt.Sprintf("pod_node(%d)", podNodeID))
+	e.addVifs(relations, e.rawData.podNodeIDToVifs[podNodeID])
+	if podIDs, ok := e.rawData.podNodeIDtoPodIDs[podNodeID]; ok {
+		for _, podID := range sortedSetIDs(podIDs) {
+			e.addVifs(appendRelation(relations, fmt.Sprintf("pod(%d)", podID)), e.rawData.podIDToVifs[podID])
+		}
+	}
+}
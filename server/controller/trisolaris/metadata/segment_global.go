@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"github.com/golang/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/message/trident"
+)
+
+// 设置对所有采集器可见的网络(如管理网、存储网)，下次生成segment时生效
+func (s *Segment) SetGlobalNetworkIDs(networkIDs []int) {
+	s.globalNetworkIDs = make(map[int]struct{}, len(networkIDs))
+	for _, networkID := range networkIDs {
+		s.globalNetworkIDs[networkID] = struct{}{}
+	}
+}
+
+// 按网络生成全局segment，生成时不记录采集器使用的接口，下发时由GetGlobalSegments记录
+func (s *Segment) generateGlobalSegments(rawData *PlatformRawData) {
+	globalSegments := []*trident.Segment{}
+	if len(s.globalNetworkIDs) > 0 {
+		networkMacs := newNetworkMacs()
+		for _, vif := range rawData.deviceVifs {
+			if _, ok := s.globalNetworkIDs[vif.NetworkID]; ok {
+				networkMacs.add(vif)
+			}
+		}
+		for _, networkID := range networkMacs.sortedNetworkIDs() {
+			s.rangeNetworkSegmentIDs(networkID, networkMacs[networkID], func(segmentID uint32, macIDs []*MacID) {
+				globalSegments = append(globalSegments, buildSegmentByMacIDs(segmentID, macIDs))
+			})
+		}
+	}
+	s.globalSegments = globalSegments
+}
+
+// GetGlobalSegments 返回对所有采集器可见的segment
+func (s *Segment) GetGlobalSegments() []*trident.Segment {
+	for _, segment := range s.globalSegments {
+		for _, vifID := range segment.GetInterfaceId() {
+			s.vtapUsedVInterfaceIDs.Add(int(vifID))
+		}
+	}
+	return s.globalSegments
+}
+
+// 将全局segment追加到采集器的local segments，已下发的接口不重复下发，
+// id相同的segment合并为一个，segments本身不会被修改
+func (s *Segment) AppendGlobalSegments(segments []*trident.Segment) []*trident.Segment {
+	globalSegments := s.GetGlobalSegments()
+	if len(globalSegments) == 0 {
+		return segments
+	}
+	vifIDs := make(map[uint32]struct{})
+	idToIndex := make(map[uint32]int, len(segments))
+	for i, segment := range segments {
+		for _, vifID := range segment.GetInterfaceId() {
+			vifIDs[vifID] = struct{}{}
+		}
+		idToIndex[segment.GetId()] = i
+	}
+
+	result := make([]*trident.Segment, len(segments), len(segments)+len(globalSegments))
+	copy(result, segments)
+	for _, globalSegment := range globalSegments {
+		var merged *trident.Segment
+		for i, vifID := range globalSegment.GetInterfaceId() {
+			if _, ok := vifIDs[vifID]; ok {
+				continue
+			}
+			if merged == nil {
+				if index, ok := idToIndex[globalSegment.GetId()]; ok {
+					merged = proto.Clone(result[index]).(*trident.Segment)
+					result[index] = merged
+				} else {
+					merged = &trident.Segment{Id: proto.Uint32(globalSegment.GetId())}
+					idToIndex[globalSegment.GetId()] = len(result)
+					result = append(result, merged)
+				}
+			}
+			merged.Mac = append(merged.Mac, globalSegment.GetMac()[i])
+			merged.Vmac = append(merged.Vmac, globalSegment.GetVmac()[i])
+			merged.InterfaceId = append(merged.InterfaceId, vifID)
+			vifIDs[vifID] = struct{}{}
+		}
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"sort"
+
+	mapset "github.com/deckarep/golang-set"
+
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+type segmentDataHash [sha256.Size]byte
+
+// 计算生成基础segment所依赖的原始数据摘要，仅包含segment用到的字段，遍历均按ID排序
+func hashSegmentData(rawData *PlatformRawData) segmentDataHash {
+	h := sha256.New()
+	writeIDToVifs(h, "vm", rawData.vmIDToVifs)
+	writeIDToVifs(h, "vm_floating_ip", rawData.vmIDToFloatingIPVifs)
+	writeIDToVifs(h, "vrouter", rawData.vRouterIDToVifs)
+	writeIDToVifs(h, "host", rawData.hostIDToVifs)
+	writeIDToVifs(h, "gateway_host", rawData.gatewayHostIDToVifs)
+	writeIDToVifs(h, "pod", rawData.podIDToVifs)
+	writeIDToVifs(h, "pod_node", rawData.podNodeIDToVifs)
+	writeIDToIDs(h, "pod_node_pods", rawData.podNodeIDtoPodIDs)
+
+	servers := make([]string, 0, len(rawData.serverToVmIDs))
+	for server := range rawData.serverToVmIDs {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		fmt.Fprintf(h, "server_vms:%s:%v\n", server, sortedSetIDs(rawData.serverToVmIDs[server]))
+	}
+	servers = servers[:0]
+	for server := range rawData.launchServerToVRouterIDs {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+	for _, server := range servers {
+		vrouterIDs := append([]int{}, rawData.launchServerToVRouterIDs[server]...)
+		sort.Ints(vrouterIDs)
+		fmt.Fprintf(h, "server_vrouters:%s:%v\n", server, vrouterIDs)
+	}
+
+	podNodeIDs := make([]int, 0, len(rawData.idToPodNode))
+	for id := range rawData.idToPodNode {
+		podNodeIDs = append(podNodeIDs, id)
+	}
+	sort.Ints(podNodeIDs)
+	for _, id := range podNodeIDs {
+		fmt.Fprintf(h, "pod_node:%d:%s\n", id, rawData.idToPodNode[id].IP)
+	}
+	podNodeIDs = podNodeIDs[:0]
+	for id := range rawData.podNodeIDToVmID {
+		podNodeIDs = append(podNodeIDs, id)
+	}
+	sort.Ints(podNodeIDs)
+	for _, id := range podNodeIDs {
+		fmt.Fprintf(h, "pod_node_vm:%d:%d\n", id, rawData.podNodeIDToVmID[id])
+	}
+
+	vifs := append([]*models.VInterface{}, rawData.deviceVifs...)
+	sort.Slice(vifs, func(i, j int) bool { return vifs[i].ID < vifs[j].ID })
+	for _, vif := range vifs {
+		writeVif(h, "device", vif)
+	}
+
+	var sum segmentDataHash
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+func writeVif(h hash.Hash, scope string, vif *models.VInterface) {
+	fmt.Fprintf(h, "%s_vif:%d:%s:%s:%d:%d:%d:%s:%s\n", scope, vif.ID, vif.Mac, vif.VMac,
+		vif.NetworkID, vif.DeviceType, vif.DeviceID, vif.Domain, vif.SubDomain)
+}
+
+func writeIDToVifs(h hash.Hash, scope string, idToVifs map[int]mapset.Set) {
+	ids := make([]int, 0, len(idToVifs))
+	for id := range idToVifs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		vifs := []*models.VInterface{}
+		for vif := range idToVifs[id].Iter() {
+			vifs = append(vifs, vif.(*models.VInterface))
+		}
+		sort.Slice(vifs, func(i, j int) bool { return vifs[i].ID < vifs[j].ID })
+		fmt.Fprintf(h, "%s:%d\n", scope, id)
+		for _, vif := range vifs {
+			writeVif(h, scope, vif)
+		}
+	}
+}
+
+func writeIDToIDs(h hash.Hash, scope string, idToIDs map[int]mapset.Set) {
+	ids := make([]int, 0, len(idToIDs))
+	for id := range idToIDs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		fmt.Fprintf(h, "%s:%d:%v\n", scope, id, sortedSetIDs(idToIDs[id]))
+	}
+}
+
+func sortedSetIDs(set mapset.Set) []int {
+	ids := make([]int, 0, set.Cardinality())
+	for id := range set.Iter() {
+		ids = append(ids, id.(int))
+	}
+	sort.Ints(ids)
+	return ids
+}
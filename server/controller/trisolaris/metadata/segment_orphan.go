@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"sort"
+
+	mapset "github.com/deckarep/golang-set"
+
+	"github.com/deepflowio/deepflow/message/trident"
+)
+
+// SetOrphanVMSegments 设置是否为没有合法launch server的vm单独生成segment，下次生成segment时生效
+func (s *Segment) SetOrphanVMSegments(enabled bool) {
+	s.orphanVMSegmentsEnabled = enabled
+}
+
+// 没有出现在合法launch server下的vm为孤立vm，其接口不在任何launch server的segment中
+func (s *Segment) generateOrphanVMSegments(rawData *PlatformRawData, launchedVMIDs mapset.Set) {
+	orphanVMIDs := mapset.NewSet()
+	for vmID := range rawData.vmIDToVifs {
+		orphanVMIDs.Add(vmID)
+	}
+	for vmID := range rawData.vmIDToFloatingIPVifs {
+		orphanVMIDs.Add(vmID)
+	}
+	for vmID := range s.vmIDToPodNodeAllVifs {
+		orphanVMIDs.Add(vmID)
+	}
+	orphanVMIDs = orphanVMIDs.Difference(launchedVMIDs)
+
+	s.orphanVMIDs = make([]int, 0, orphanVMIDs.Cardinality())
+	for vmID := range orphanVMIDs.Iter() {
+		s.orphanVMIDs = append(s.orphanVMIDs, vmID.(int))
+	}
+	sort.Ints(s.orphanVMIDs)
+
+	orphanVMSegments := newNetworkMacs()
+	if s.orphanVMSegmentsEnabled {
+		for _, vmID := range s.orphanVMIDs {
+			for _, vifs := range []mapset.Set{rawData.vmIDToVifs[vmID], rawData.vmIDToFloatingIPVifs[vmID], s.vmIDToPodNodeAllVifs[vmID]} {
+				if vifs == nil {
+					continue
+				}
+				for vif := range vifs.Iter() {
+					orphanVMSegments.add(vif)
+				}
+			}
+		}
+	}
+	s.orphanVMSegments = orphanVMSegments
+	if len(s.orphanVMIDs) > 0 {
+		log.Warningf("%d vm(s) without valid launch server in segments: %v", len(s.orphanVMIDs), s.orphanVMIDs)
+	}
+}
+
+// OrphanVMIDs 返回最近一次生成segment时的孤立vm
+func (s *Segment) OrphanVMIDs() []int {
+	return s.orphanVMIDs
+}
+
+// GetOrphanVMSegments 返回孤立vm所有接口的segment，未开启时为空，不记录采集器使用的接口
+func (s *Segment) GetOrphanVMSegments() []*trident.Segment {
+	segments := make([]*trident.Segment, 0, len(s.orphanVMSegments))
+	for _, networkID := range s.orphanVMSegments.sortedNetworkIDs() {
+		s.rangeNetworkSegmentIDs(networkID, s.orphanVMSegments[networkID], func(segmentID uint32, macIDs []*MacID) {
+			segments = append(segments, buildSegmentByMacIDs(segmentID, macIDs))
+		})
+	}
+	return segments
+}
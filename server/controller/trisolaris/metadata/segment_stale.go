@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+)
+
+const (
+	SEGMENT_SCOPE_LAUNCH_SERVER = "launch_server"
+	SEGMENT_SCOPE_HOST          = "host"
+	SEGMENT_SCOPE_VM            = "vm"
+	SEGMENT_SCOPE_POD_NODE      = "pod_node"
+)
+
+type segmentEntryKey struct {
+	scope string
+	key   interface{}
+}
+
+// 记录entries中各接口所在的网络
+func addVifNetworkIDs[K comparable, M ~map[K]NetworkMacs](vifIDToNetworkID map[int]int, entries M) {
+	for _, networkMacs := range entries {
+		for networkID, macIDs := range networkMacs {
+			for _, macID := range macIDs {
+				vifIDToNetworkID[macID.ID] = networkID
+			}
+		}
+	}
+}
+
+// 从保留的旧条目中移除已切换到其他网络的接口，避免同一MAC同时出现在新旧两个网络中，不修改原有的slice
+func (n NetworkMacs) removeMovedVifs(vifIDToNetworkID map[int]int) NetworkMacs {
+	moved := mapset.NewSet()
+	for networkID, macIDs := range n {
+		for _, macID := range macIDs {
+			if latestNetworkID, ok := vifIDToNetworkID[macID.ID]; ok && latestNetworkID != networkID {
+				moved.Add(macID.ID)
+			}
+		}
+	}
+	if moved.Cardinality() == 0 {
+		return n
+	}
+	return n.remove(moved)
+}
+
+// 原始数据中不再存在的条目在宽限期内保留上次生成的segment，避免刷新部分失败时采集器丢失MAC；
+// vifIDToNetworkID为本次生成时各接口所在的网络，返回保留后的map，latest不会被修改
+func retainStaleSegments[K comparable, M ~map[K]NetworkMacs](
+	s *Segment, scope string, old, latest M, vifIDToNetworkID map[int]int, now time.Time) M {
+
+	result := latest
+	copied := false
+	for key := range latest {
+		delete(s.staleSince, segmentEntryKey{scope, key})
+	}
+	for key, networkMacs := range old {
+		if _, ok := latest[key]; ok {
+			continue
+		}
+		entryKey := segmentEntryKey{scope, key}
+		since, ok := s.staleSince[entryKey]
+		if !ok {
+			since = now
+		}
+		if now.Sub(since) >= s.staleGracePeriod {
+			delete(s.staleSince, entryKey)
+			continue
+		}
+		s.staleSince[entryKey] = since
+		if !copied {
+			result = make(M, len(latest)+1)
+			for k, v := range latest {
+				result[k] = v
+			}
+			copied = true
+		}
+		result[key] = networkMacs.removeMovedVifs(vifIDToNetworkID)
+	}
+	return result
+}
+
+// 删除超过宽限期的map条目，返回新的map，未删除时返回原map
+func evictStaleSegments[K comparable, M ~map[K]NetworkMacs](s *Segment, scope string, entries M, now time.Time) (M, bool) {
+	var result M
+	for entryKey, since := range s.staleSince {
+		key, ok := entryKey.key.(K)
+		if entryKey.scope != scope || !ok || now.Sub(since) < s.staleGracePeriod {
+			continue
+		}
+		if result == nil {
+			result = make(M, len(entries))
+			for k, v := range entries {
+				result[k] = v
+			}
+		}
+		delete(result, key)
+		delete(s.staleSince, entryKey)
+		log.Infof("evict stale %s(%v) segments, absent since %s", scope, key, since.Format(time.RFC3339))
+	}
+	if result == nil {
+		return entries, false
+	}
+	return result, true
+}
+
+// 设置原始数据中不存在的server/host/vm/pod_node segment保留的时间，为0时立即删除
+func (s *Segment) SetStaleGracePeriod(gracePeriod time.Duration) {
+	s.staleGracePeriod = gracePeriod
+}
+
+// EvictStaleSegments 删除超过宽限期的segment，原始数据未变化不重新生成segment时需定期调用，返回是否有删除
+func (s *Segment) EvictStaleSegments(now time.Time) bool {
+	if len(s.staleSince) == 0 {
+		return false
+	}
+	var evicted, ok bool
+	s.launchServerToSegments, ok = evictStaleSegments(s, SEGMENT_SCOPE_LAUNCH_SERVER, s.launchServerToSegments, now)
+	evicted = evicted || ok
+	s.hostIDToSegments, ok = evictStaleSegments(s, SEGMENT_SCOPE_HOST, s.hostIDToSegments, now)
+	evicted = evicted || ok
+	s.vmIDToSegments, ok = evictStaleSegments(s, SEGMENT_SCOPE_VM, s.vmIDToSegments, now)
+	evicted = evicted || ok
+	s.podNodeIDToSegments, ok = evictStaleSegments(s, SEGMENT_SCOPE_POD_NODE, s.podNodeIDToSegments, now)
+	evicted = evicted || ok
+	if evicted {
+		s.serverSegmentsCache.reset()
+		s.dataVersion++
+	}
+	return evicted
+}
@@ -0,0 +1,1053 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mapset "github.com/deckarep/golang-set"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/message/trident"
+	. "github.com/deepflowio/deepflow/server/controller/common"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	"github.com/deepflowio/deepflow/server/controller/grpc/statsd"
+)
+
+func newTestVif(id, deviceType, deviceID, networkID int, mac string) *models.VInterface {
+	return &models.VInterface{
+		Base:       models.Base{ID: id},
+		Mac:        mac,
+		NetworkID:  networkID,
+		DeviceType: deviceType,
+		DeviceID:   deviceID,
+	}
+}
+
+func segmentMacs(segments []*trident.Segment) []string {
+	macs := []string{}
+	for _, segment := range segments {
+		macs = append(macs, segment.GetMac()...)
+	}
+	return macs
+}
+
+func TestPodNodeWithoutVMInLaunchServerSegments(t *testing.T) {
+	rawData := NewPlatformRawData()
+
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+
+	podNodeVif := newTestVif(2, VIF_DEVICE_TYPE_POD_NODE, 1, 20, "00:00:00:00:00:02")
+	podVif := newTestVif(3, VIF_DEVICE_TYPE_POD, 1, 30, "00:00:00:00:00:03")
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}, IP: "10.0.0.2"}
+	rawData.podNodeIDToVifs[1] = mapset.NewSet(podNodeVif)
+	rawData.podNodeIDtoPodIDs[1] = mapset.NewSet(1)
+	rawData.podIDToVifs[1] = mapset.NewSet(podVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	podNodeServerMacs := segmentMacs(s.GetLaunchServerSegments("10.0.0.2"))
+	assert.ElementsMatch(t, []string{podNodeVif.Mac, podVif.Mac}, podNodeServerMacs)
+
+	vmServerMacs := segmentMacs(s.GetLaunchServerSegments("10.0.0.1"))
+	assert.ElementsMatch(t, []string{vmVif.Mac}, vmServerMacs)
+}
+
+func newTestSegment(id uint32, macNum int) *trident.Segment {
+	segment := &trident.Segment{Id: proto.Uint32(id)}
+	for i := 0; i < macNum; i++ {
+		mac := fmt.Sprintf("00:00:00:00:%02x:%02x", id, i)
+		segment.Mac = append(segment.Mac, mac)
+		segment.Vmac = append(segment.Vmac, mac)
+		segment.InterfaceId = append(segment.InterfaceId, id*100+uint32(i))
+	}
+	return segment
+}
+
+func TestGetNotVtapUsedSegmentsChunk(t *testing.T) {
+	s := newSegment()
+	s.notVtapUsedSegments = []*trident.Segment{newTestSegment(1, 5), newTestSegment(2, 1), newTestSegment(3, 4)}
+
+	macToID := make(map[string]uint32)
+	token := ""
+	for round := 0; ; round++ {
+		chunk, nextToken, err := s.GetNotVtapUsedSegmentsChunk(token, 3)
+		assert.Nil(t, err)
+		assert.LessOrEqual(t, len(segmentMacs(chunk)), 3)
+		for _, segment := range chunk {
+			for _, mac := range segment.GetMac() {
+				_, exists := macToID[mac]
+				assert.False(t, exists, "mac %s returned more than once", mac)
+				macToID[mac] = segment.GetId()
+			}
+		}
+		if nextToken == "" {
+			break
+		}
+		token = nextToken
+		assert.Less(t, round, 10)
+	}
+
+	for _, segment := range s.GetNotVtapUsedSegments() {
+		for _, mac := range segment.GetMac() {
+			assert.Equal(t, segment.GetId(), macToID[mac])
+		}
+	}
+	assert.Equal(t, 10, len(macToID))
+
+	_, _, err := s.GetNotVtapUsedSegmentsChunk("invalid", 3)
+	assert.NotNil(t, err)
+}
+
+func TestGetServerSegmentsCache(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	first := s.GetServerSegments("10.0.0.1", 1)
+	assert.ElementsMatch(t, []string{vmVif.Mac}, segmentMacs(first))
+	assert.Equal(t, 1, s.serverSegmentsCache.computeCount)
+
+	s.ClearVTapUsedVInterfaceIDs()
+	second := s.GetServerSegments("10.0.0.1", 1)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, s.serverSegmentsCache.computeCount)
+	assert.True(t, s.vtapUsedVInterfaceIDs.Contains(vmVif.ID))
+
+	// 平台数据未变化时不重新生成，缓存保留
+	s.generateBaseSegments(rawData)
+	s.GetServerSegments("10.0.0.1", 1)
+	assert.Equal(t, 1, s.serverSegmentsCache.computeCount)
+
+	rawData.vmIDToVifs[1].Add(newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:02"))
+	s.generateBaseSegments(rawData)
+	s.GetServerSegments("10.0.0.1", 1)
+	assert.Equal(t, 2, s.serverSegmentsCache.computeCount)
+}
+
+func TestGenerateNoVTapUsedSegmentsByAddressFamily(t *testing.T) {
+	rawData := NewPlatformRawData()
+	v4Vif := newTestVif(1, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:01")
+	v6Vif := newTestVif(2, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:02")
+	dualVif := newTestVif(3, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:03")
+	noIPVif := newTestVif(4, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:04")
+	rawData.deviceVifs = []*models.VInterface{v4Vif, v6Vif, dualVif, noIPVif}
+	rawData.vInterfaceIDToIP[v4Vif.ID] = []*trident.IpResource{{Ip: proto.String("10.0.0.1")}}
+	rawData.vInterfaceIDToIP[v6Vif.ID] = []*trident.IpResource{{Ip: proto.String("fd00::1")}, {Ip: proto.String("fd00::2")}}
+	rawData.vInterfaceIDToIP[dualVif.ID] = []*trident.IpResource{{Ip: proto.String("10.0.0.3")}, {Ip: proto.String("fd00::3")}}
+
+	s := newSegment()
+	s.GenerateNoVTapUsedSegments(rawData)
+
+	v4Segments := s.GetNotVtapUsedSegments()
+	assert.Equal(t, 1, len(v4Segments))
+	assert.Equal(t, uint32(NO_VTAP_USED_SEGMENT_ID), v4Segments[0].GetId())
+	assert.ElementsMatch(t, []string{v4Vif.Mac, dualVif.Mac, noIPVif.Mac}, segmentMacs(v4Segments))
+
+	v6Segments := s.GetNotVtapUsedSegmentsV6()
+	assert.Equal(t, 1, len(v6Segments))
+	assert.Equal(t, uint32(NO_VTAP_USED_SEGMENT_V6_ID), v6Segments[0].GetId())
+	assert.ElementsMatch(t, []string{v6Vif.Mac}, segmentMacs(v6Segments))
+	assert.ElementsMatch(t, []uint32{uint32(v6Vif.ID)}, v6Segments[0].GetInterfaceId())
+}
+
+func TestGetNotVtapUsedSegmentsByHost(t *testing.T) {
+	rawData := NewPlatformRawData()
+	hostVif := newTestVif(1, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:01")
+	vmVif := newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:02")
+	v6VMVif := newTestVif(3, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:03")
+	podVif := newTestVif(4, VIF_DEVICE_TYPE_POD, 1, 10, "00:00:00:00:00:04")
+	unknownVif := newTestVif(5, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:05")
+	usedVif := newTestVif(6, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:06")
+	rawData.deviceVifs = []*models.VInterface{hostVif, vmVif, v6VMVif, podVif, unknownVif, usedVif}
+	rawData.vInterfaceIDToIP[v6VMVif.ID] = []*trident.IpResource{{Ip: proto.String("fd00::3")}}
+	rawData.typeIDToDevice[TypeIDKey{Type: VIF_DEVICE_TYPE_HOST, ID: 1}] = &TypeIDData{LaunchServerID: 1}
+	rawData.typeIDToDevice[TypeIDKey{Type: VIF_DEVICE_TYPE_VM, ID: 1}] = &TypeIDData{LaunchServerID: 2}
+	rawData.typeIDToDevice[TypeIDKey{Type: VIF_DEVICE_TYPE_POD, ID: 1}] = &TypeIDData{PodNodeID: 1}
+	rawData.podNodeIDToVmID[1] = 1
+
+	s := newSegment()
+	s.vtapUsedVInterfaceIDs.Add(usedVif.ID)
+	s.GenerateNoVTapUsedSegments(rawData)
+
+	assert.ElementsMatch(t, []string{hostVif.Mac}, segmentMacs(s.GetNotVtapUsedSegmentsByHost(1)))
+	assert.ElementsMatch(t, []string{vmVif.Mac, v6VMVif.Mac, podVif.Mac}, segmentMacs(s.GetNotVtapUsedSegmentsByHost(2)))
+	assert.ElementsMatch(t, []string{unknownVif.Mac}, segmentMacs(s.GetNotVtapUsedSegmentsByHost(0)))
+	assert.Equal(t, 0, len(s.GetNotVtapUsedSegmentsByHost(3)))
+
+	hostMacs := []string{}
+	for _, hostID := range []int{0, 1, 2} {
+		hostMacs = append(hostMacs, segmentMacs(s.GetNotVtapUsedSegmentsByHost(hostID))...)
+	}
+	globalMacs := append(segmentMacs(s.GetNotVtapUsedSegments()), segmentMacs(s.GetNotVtapUsedSegmentsV6())...)
+	assert.ElementsMatch(t, globalMacs, hostMacs)
+}
+
+func TestMultiNetworkVMSegments(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vif1 := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vif2 := newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 20, "00:00:00:00:00:02")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vif1, vif2)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	assert.Equal(t, 2, len(s.vmIDToSegments[1]))
+	assert.Empty(t, s.vmIDToSegments[1].missingVifIDs(rawData.vmIDToVifs[1]))
+
+	segments := s.GetVMIDSegments(1)
+	if assert.Equal(t, 2, len(segments)) {
+		assert.Equal(t, uint32(10), segments[0].GetId())
+		assert.Equal(t, []string{vif1.Mac}, segments[0].GetMac())
+		assert.Equal(t, []uint32{uint32(vif1.ID)}, segments[0].GetInterfaceId())
+		assert.Equal(t, uint32(20), segments[1].GetId())
+		assert.Equal(t, []string{vif2.Mac}, segments[1].GetMac())
+		assert.Equal(t, []uint32{uint32(vif2.ID)}, segments[1].GetInterfaceId())
+	}
+
+	// 丢失一个网络时能检查出缺失的接口
+	delete(s.vmIDToSegments[1], 20)
+	assert.Equal(t, []int{vif2.ID}, s.vmIDToSegments[1].missingVifIDs(rawData.vmIDToVifs[1]))
+}
+
+func TestFloatingIPVifSegments(t *testing.T) {
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	// 浮动IP所在接口不属于vm，网络以浮动IP为准
+	fipVif := newTestVif(2, VIF_DEVICE_TYPE_VROUTER, 5, 0, "00:00:00:00:00:02")
+	dbDataCache := &DBDataCache{
+		vInterfaces: []*models.VInterface{vmVif, fipVif},
+		wanIPs: []*models.WANIP{
+			{IP: "192.168.0.1", VInterfaceID: vmVif.ID},
+			{IP: "100.64.0.1", VInterfaceID: fipVif.ID},
+		},
+		floatingIPs: []*models.FloatingIP{{VMID: 1, NetworkID: 10, IP: "100.64.0.1"}},
+	}
+	rawData := NewPlatformRawData()
+	rawData.ConvertDBVInterface(dbDataCache)
+	rawData.ConvertDBFloatingIPVifs(dbDataCache)
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	segments := s.GetVMIDSegments(1)
+	if assert.Equal(t, 1, len(segments)) {
+		assert.Equal(t, uint32(10), segments[0].GetId())
+		assert.ElementsMatch(t, []string{vmVif.Mac, fipVif.Mac}, segments[0].GetMac())
+	}
+	assert.ElementsMatch(t, []string{vmVif.Mac, fipVif.Mac}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	// 原接口不受影响
+	assert.Equal(t, 0, fipVif.NetworkID)
+}
+
+func TestCheckEmptySegments(t *testing.T) {
+	rawData := NewPlatformRawData()
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	// 原始数据本身为空时不告警
+	assert.Empty(t, s.GetEmptySegmentScopes())
+
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	hostVif := newTestVif(2, VIF_DEVICE_TYPE_HOST, 1, 10, "00:00:00:00:00:02")
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+	rawData.hostIDToVifs[1] = mapset.NewSet(hostVif)
+	s.generateBaseSegments(rawData)
+	assert.Empty(t, s.GetEmptySegmentScopes())
+
+	// 模拟生成出错：vm范围为空
+	s.vmIDToSegments = newIDToNetworkMacs()
+	assert.True(t, s.checkEmptySegments(rawData))
+	assert.Equal(t, []string{"vm"}, s.GetEmptySegmentScopes())
+	// 告警限频，状态仍保留
+	assert.False(t, s.checkEmptySegments(rawData))
+	assert.Equal(t, []string{"vm"}, s.GetEmptySegmentScopes())
+
+	s.emptySegmentsWarnedAt = time.Now().Add(-EMPTY_SEGMENTS_WARNING_INTERVAL)
+	assert.True(t, s.checkEmptySegments(rawData))
+}
+
+func TestNetworkMacCounts(t *testing.T) {
+	rawData := NewPlatformRawData()
+
+	// vm的vif同时出现在launch server和vm范围内
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vmVif2 := newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 20, "00:00:00:00:00:02")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif, vmVif2)
+
+	// pod_node和pod的vif同时出现在launch server、pod_node和pod范围内
+	podNodeVif := newTestVif(3, VIF_DEVICE_TYPE_POD_NODE, 1, 10, "00:00:00:00:00:03")
+	podVif := newTestVif(4, VIF_DEVICE_TYPE_POD, 1, 30, "00:00:00:00:00:04")
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}, IP: "10.0.0.2"}
+	rawData.podNodeIDToVifs[1] = mapset.NewSet(podNodeVif)
+	rawData.podNodeIDtoPodIDs[1] = mapset.NewSet(1)
+	rawData.podIDToVifs[1] = mapset.NewSet(podVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	assert.Equal(t, map[int]int{10: 2, 20: 1, 30: 1}, s.NetworkMacCounts())
+}
+
+func TestInvalidLaunchServerSkipped(t *testing.T) {
+	rawData := NewPlatformRawData()
+	for i, server := range []string{"10.0.0.1", "", "not-an-ip"} {
+		vmID := i + 1
+		vif := newTestVif(vmID, VIF_DEVICE_TYPE_VM, vmID, 10, fmt.Sprintf("00:00:00:00:00:%02x", vmID))
+		rawData.idToVM[vmID] = &models.VM{Base: models.Base{ID: vmID}, LaunchServer: server}
+		rawData.serverToVmIDs[server] = mapset.NewSet(vmID)
+		rawData.vmIDToVifs[vmID] = mapset.NewSet(vif)
+	}
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	assert.Equal(t, 2, s.InvalidLaunchServerCount())
+	assert.Equal(t, []string{"00:00:00:00:00:01"}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	_, ok := s.launchServerToSegments[""]
+	assert.False(t, ok)
+	_, ok = s.launchServerToSegments["not-an-ip"]
+	assert.False(t, ok)
+}
+
+func TestSegmentCopyDoesNotMutateVTapUsedVInterfaceIDs(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+
+	podNodeVif := newTestVif(2, VIF_DEVICE_TYPE_POD_NODE, 1, 20, "00:00:00:00:00:02")
+	podVif := newTestVif(3, VIF_DEVICE_TYPE_POD, 1, 30, "00:00:00:00:00:03")
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}, IP: "10.0.0.2"}
+	rawData.podNodeIDToVifs[1] = mapset.NewSet(podNodeVif)
+	rawData.podNodeIDtoPodIDs[1] = mapset.NewSet(1)
+	rawData.podIDToVifs[1] = mapset.NewSet(podVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	dump := s.Copy()
+	dumpServerSegments := dump.GetServerSegments("10.0.0.1", 1)
+	dumpVMSegments := dump.GetVMIDSegments(1)
+	dumpPodNodeSegments := dump.GetPodNodeSegments(1)
+	assert.Equal(t, 0, s.vtapUsedVInterfaceIDs.Cardinality())
+	assert.Equal(t, 0, s.serverSegmentsCache.computeCount)
+
+	assert.ElementsMatch(t, s.GetServerSegments("10.0.0.1", 1), dumpServerSegments)
+	assert.ElementsMatch(t, s.GetVMIDSegments(1), dumpVMSegments)
+	assert.ElementsMatch(t, s.GetPodNodeSegments(1), dumpPodNodeSegments)
+	assert.True(t, dump.vtapUsedVInterfaceIDs.Equal(s.vtapUsedVInterfaceIDs))
+}
+
+func TestMigrateVMMovesPodNodeVifs(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+	otherVmVif := newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:02")
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.2"}
+	rawData.serverToVmIDs["10.0.0.2"] = mapset.NewSet(2)
+	rawData.vmIDToVifs[2] = mapset.NewSet(otherVmVif)
+
+	// vm 1上运行的pod_node及pod
+	podNodeVif := newTestVif(3, VIF_DEVICE_TYPE_POD_NODE, 1, 20, "00:00:00:00:00:03")
+	podVif := newTestVif(4, VIF_DEVICE_TYPE_POD, 1, 30, "00:00:00:00:00:04")
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}, IP: "10.0.1.1"}
+	rawData.podNodeIDToVmID[1] = 1
+	rawData.podNodeIDToVifs[1] = mapset.NewSet(podNodeVif)
+	rawData.podNodeIDtoPodIDs[1] = mapset.NewSet(1)
+	rawData.podIDToVifs[1] = mapset.NewSet(podVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	assert.ElementsMatch(t, []string{vmVif.Mac, podNodeVif.Mac, podVif.Mac}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	s.GetServerSegments("10.0.0.2", 0)
+
+	assert.True(t, s.MigrateVM(rawData, 1, "10.0.0.2"))
+	assert.Empty(t, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	assert.ElementsMatch(t, []string{otherVmVif.Mac, vmVif.Mac, podNodeVif.Mac, podVif.Mac}, segmentMacs(s.GetLaunchServerSegments("10.0.0.2")))
+	// 缓存的宿主机segment同时失效
+	assert.ElementsMatch(t, []string{otherVmVif.Mac, vmVif.Mac, podNodeVif.Mac, podVif.Mac}, segmentMacs(s.GetServerSegments("10.0.0.2", 0)))
+
+	// 重复的迁移事件不做处理，迁回原launch server时再次移动
+	assert.False(t, s.MigrateVM(rawData, 1, "10.0.0.2"))
+	assert.True(t, s.MigrateVM(rawData, 1, "10.0.0.1"))
+	assert.ElementsMatch(t, []string{vmVif.Mac, podNodeVif.Mac, podVif.Mac}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	assert.ElementsMatch(t, []string{otherVmVif.Mac}, segmentMacs(s.GetLaunchServerSegments("10.0.0.2")))
+
+	assert.False(t, s.MigrateVM(rawData, 100, "10.0.0.2"))
+	assert.False(t, s.MigrateVM(rawData, 1, "invalid"))
+}
+
+func TestFilterSegmentsByDomains(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vifA := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vifA.Domain = "domain-a"
+	vifB := newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:02")
+	vifB.Domain = "domain-b"
+	vifSubA := newTestVif(3, VIF_DEVICE_TYPE_VM, 2, 20, "00:00:00:00:00:03")
+	vifSubA.Domain = "domain-b"
+	vifSubA.SubDomain = "sub-domain-a"
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1, 2)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vifA)
+	rawData.vmIDToVifs[2] = mapset.NewSet(vifB, vifSubA)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	segments := s.GetServerSegments("10.0.0.1", 0)
+
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03"},
+		segmentMacs(s.FilterSegmentsByDomains(segments, nil)))
+	filtered := s.FilterSegmentsByDomains(segments, []string{"domain-a"})
+	assert.Equal(t, []string{"00:00:00:00:00:01"}, segmentMacs(filtered))
+	assert.Equal(t, []uint32{1}, filtered[0].GetInterfaceId())
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:03"},
+		segmentMacs(s.FilterSegmentsByDomains(segments, []string{"domain-a", "sub-domain-a"})))
+	assert.Empty(t, s.FilterSegmentsByDomains(segments, []string{"domain-c"}))
+}
+
+func TestFilterSegmentsByDeviceTypes(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	podVif := newTestVif(2, VIF_DEVICE_TYPE_POD, 1, 10, "00:00:00:00:00:02")
+	hostVif := newTestVif(3, VIF_DEVICE_TYPE_HOST, 1, 20, "00:00:00:00:00:03")
+	gatewayVif := newTestVif(4, VIF_DEVICE_TYPE_VROUTER, 1, 20, "00:00:00:00:00:04")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}}
+	rawData.podNodeIDToVmID[1] = 1
+	rawData.podNodeIDtoPodIDs[1] = mapset.NewSet(1)
+	rawData.podIDToVifs[1] = mapset.NewSet(podVif)
+	rawData.hostIDToVifs[1] = mapset.NewSet(hostVif)
+	rawData.launchServerToVRouterIDs["10.0.0.1"] = []int{1}
+	rawData.vRouterIDToVifs[1] = mapset.NewSet(gatewayVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	segments := s.GetServerSegments("10.0.0.1", 1)
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:02", "00:00:00:00:00:03", "00:00:00:00:00:04"},
+		segmentMacs(s.FilterSegmentsByDeviceTypes(segments, nil)))
+
+	podOnly := s.FilterSegmentsByDeviceTypes(segments, []int{VIF_DEVICE_TYPE_POD})
+	assert.Equal(t, []string{"00:00:00:00:00:02"}, segmentMacs(podOnly))
+	assert.Equal(t, []uint32{2}, podOnly[0].GetInterfaceId())
+	assert.Equal(t, uint32(10), podOnly[0].GetId())
+
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:02"},
+		segmentMacs(s.FilterSegmentsByDeviceTypes(segments, []int{VIF_DEVICE_TYPE_VM, VIF_DEVICE_TYPE_POD})))
+	assert.Empty(t, s.FilterSegmentsByDeviceTypes(segments, []int{VIF_DEVICE_TYPE_POD_NODE}))
+}
+
+func TestSegmentValidate(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	podNodeVif := newTestVif(2, VIF_DEVICE_TYPE_POD_NODE, 1, 10, "00:00:00:00:00:02")
+	rawData.deviceVifs = []*models.VInterface{vmVif, podNodeVif}
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}, IP: "10.0.0.2"}
+	rawData.podNodeIDToVifs[1] = mapset.NewSet(podNodeVif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	s.GetServerSegments("10.0.0.1", 0)
+	assert.Empty(t, s.Validate())
+
+	// 破坏约束：vm范围丢失接口、采集器使用了不存在的接口、网络下MAC为空
+	delete(s.vmIDToSegments[1], 10)
+	s.vtapUsedVInterfaceIDs.Add(100)
+	s.hostIDToSegments[1] = NetworkMacs{20: []*MacID{}}
+	assert.Equal(t, []string{
+		"host(1) network(20) has no mac",
+		"launch_server(10.0.0.1) mac(00:00:00:00:00:01) vif(1) found in 0 vm/pod_node scope(s), expected 1",
+		"vtap used vif(100) not found",
+	}, s.Validate())
+}
+
+func TestSegmentsStableOrdering(t *testing.T) {
+	newRawData := func() *PlatformRawData {
+		rawData := NewPlatformRawData()
+		vmIDs := mapset.NewSet()
+		for vmID := 1; vmID <= 8; vmID++ {
+			vifs := mapset.NewSet()
+			for i := 0; i < 4; i++ {
+				vifID := vmID*10 + i
+				// 接口ID与MAC顺序不一致，分布在多个网络中
+				mac := fmt.Sprintf("00:00:00:00:%02x:%02x", 10-i, vmID)
+				vifs.Add(newTestVif(vifID, VIF_DEVICE_TYPE_VM, vmID, 100+vifID%3, mac))
+			}
+			rawData.idToVM[vmID] = &models.VM{Base: models.Base{ID: vmID}, LaunchServer: "10.0.0.1"}
+			rawData.vmIDToVifs[vmID] = vifs
+			vmIDs.Add(vmID)
+		}
+		rawData.serverToVmIDs["10.0.0.1"] = vmIDs
+		for hostID := 1; hostID <= 3; hostID++ {
+			vifs := mapset.NewSet()
+			for i := 0; i < 3; i++ {
+				vifID := 1000 + hostID*10 + i
+				vifs.Add(newTestVif(vifID, VIF_DEVICE_TYPE_HOST, hostID, 200+i, fmt.Sprintf("00:00:00:01:%02x:%02x", 3-i, hostID)))
+			}
+			rawData.gatewayHostIDToVifs[hostID] = vifs
+		}
+		return rawData
+	}
+
+	var firstServer, firstVM, firstGateway []*trident.Segment
+	for i := 0; i < 20; i++ {
+		s := newSegment()
+		s.generateBaseSegments(newRawData())
+		server := s.GetLaunchServerSegments("10.0.0.1")
+		vm := s.GetVMIDSegments(1)
+		gateway := s.GetAllGatewayHostSegments()
+		if i == 0 {
+			firstServer, firstVM, firstGateway = server, vm, gateway
+			for _, segments := range [][]*trident.Segment{server, vm} {
+				for j, segment := range segments {
+					if j > 0 {
+						assert.Less(t, segments[j-1].GetId(), segment.GetId())
+					}
+					assert.IsNonDecreasing(t, segment.GetMac())
+				}
+			}
+			continue
+		}
+		assert.Equal(t, firstServer, server)
+		assert.Equal(t, firstVM, vm)
+		assert.Equal(t, firstGateway, gateway)
+	}
+}
+
+func TestServerSegmentsCacheCounter(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+
+	s := newSegment()
+	counter := statsd.NewGetSegmentCacheCounter()
+	s.serverSegmentsCache.counter = counter
+	s.generateBaseSegments(rawData)
+
+	s.GetServerSegments("10.0.0.1", 1)
+	s.GetServerSegments("10.0.0.1", 1)
+	assert.Equal(t, uint64(1), counter.Hit)
+	assert.Equal(t, uint64(1), counter.Miss)
+	assert.Equal(t, uint64(0), counter.Eviction)
+
+	// 平台数据变化后缓存失效，再次获取未命中
+	rawData.vmIDToVifs[1].Add(newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:02"))
+	s.generateBaseSegments(rawData)
+	assert.Equal(t, uint64(1), counter.Eviction)
+	s.GetServerSegments("10.0.0.1", 1)
+	assert.Equal(t, uint64(1), counter.Hit)
+	assert.Equal(t, uint64(2), counter.Miss)
+}
+
+func TestSegmentRemapOverlappedNetworkID(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vif1 := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vif1.Domain = "domain-1"
+	vif2 := newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:02")
+	vif2.Domain = "domain-2"
+	vif3 := newTestVif(3, VIF_DEVICE_TYPE_VM, 1, 20, "00:00:00:00:00:03")
+	vif3.Domain = "domain-1"
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1, 2)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vif1, vif3)
+	rawData.vmIDToVifs[2] = mapset.NewSet(vif2)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	// 两个domain复用网络10，分别分配segment id；网络20未重叠，保持原id
+	idToMacs := make(map[uint32][]string)
+	for _, segment := range s.GetLaunchServerSegments("10.0.0.1") {
+		idToMacs[segment.GetId()] = segment.GetMac()
+	}
+	assert.Equal(t, map[uint32][]string{
+		REMAPPED_SEGMENT_ID_BASE:     {vif1.Mac},
+		REMAPPED_SEGMENT_ID_BASE + 1: {vif2.Mac},
+		20:                           {vif3.Mac},
+	}, idToMacs)
+
+	vmSegments := s.GetVMIDSegments(2)
+	if assert.Equal(t, 1, len(vmSegments)) {
+		assert.Equal(t, uint32(REMAPPED_SEGMENT_ID_BASE+1), vmSegments[0].GetId())
+	}
+}
+
+func TestGenerateBaseSegmentsSkipUnchanged(t *testing.T) {
+	newRawData := func(mac string) *PlatformRawData {
+		rawData := NewPlatformRawData()
+		rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+		rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+		rawData.vmIDToVifs[1] = mapset.NewSet(
+			newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01"),
+			newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 10, mac),
+		)
+		return rawData
+	}
+
+	s := newSegment()
+	assert.Equal(t, uint64(0), s.GetDataVersion())
+	s.generateBaseSegments(newRawData("00:00:00:00:00:02"))
+	assert.Equal(t, uint64(1), s.GetDataVersion())
+	segments := s.GetLaunchServerSegments("10.0.0.1")
+
+	// 内容相同的新原始数据跳过重新生成
+	s.generateBaseSegments(newRawData("00:00:00:00:00:02"))
+	assert.Equal(t, uint64(1), s.GetDataVersion())
+	assert.Equal(t, segments, s.GetLaunchServerSegments("10.0.0.1"))
+
+	s.generateBaseSegments(newRawData("00:00:00:00:00:03"))
+	assert.Equal(t, uint64(2), s.GetDataVersion())
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:03"}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+}
+
+func TestNegotiateSegmentVersion(t *testing.T) {
+	assert.Equal(t, SEGMENT_VERSION_LEGACY, NegotiateSegmentVersion(0))
+	assert.Equal(t, SEGMENT_VERSION_LEGACY, NegotiateSegmentVersion(SEGMENT_VERSION_LEGACY))
+	assert.Equal(t, SEGMENT_VERSION_NETWORK_ID, NegotiateSegmentVersion(SEGMENT_VERSION_NETWORK_ID))
+	assert.Equal(t, SEGMENT_VERSION_LATEST, NegotiateSegmentVersion(SEGMENT_VERSION_LATEST+1))
+}
+
+func TestSegmentIDByVersion(t *testing.T) {
+	rawData := NewPlatformRawData()
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(
+		newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01"),
+		newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 20, "00:00:00:00:00:02"),
+	)
+	rawData.gatewayHostIDToVifs[1] = mapset.NewSet(
+		newTestVif(3, VIF_DEVICE_TYPE_HOST, 1, 30, "00:00:00:00:00:03"),
+		newTestVif(4, VIF_DEVICE_TYPE_HOST, 1, 40, "00:00:00:00:00:04"),
+	)
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	// 旧版本: ESXi采集器所有接口合并为一个id为1的segment
+	legacy := s.GetTypeVMSegments("10.0.0.1", 0, SEGMENT_VERSION_LEGACY)
+	assert.Equal(t, 1, len(legacy))
+	assert.Equal(t, uint32(1), legacy[0].GetId())
+	assert.Equal(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:02"}, legacy[0].GetMac())
+	// 新版本: 按网络拆分，id为网络ID
+	segments := s.GetTypeVMSegments("10.0.0.1", 0, SEGMENT_VERSION_NETWORK_ID)
+	assert.Equal(t, 2, len(segments))
+	assert.Equal(t, uint32(10), segments[0].GetId())
+	assert.Equal(t, []string{"00:00:00:00:00:01"}, segments[0].GetMac())
+	assert.Equal(t, uint32(20), segments[1].GetId())
+	assert.Equal(t, []string{"00:00:00:00:00:02"}, segments[1].GetMac())
+
+	legacyGateway := s.GetGatewayHostSegmentsByVersion(SEGMENT_VERSION_LEGACY)
+	assert.Equal(t, s.GetAllGatewayHostSegments(), legacyGateway)
+	assert.Equal(t, 2, len(legacyGateway))
+	for _, segment := range legacyGateway {
+		assert.Equal(t, uint32(1), segment.GetId())
+	}
+	gateway := s.GetGatewayHostSegmentsByVersion(SEGMENT_VERSION_NETWORK_ID)
+	assert.Equal(t, 2, len(gateway))
+	assert.Equal(t, uint32(30), gateway[0].GetId())
+	assert.Equal(t, uint32(40), gateway[1].GetId())
+	assert.Equal(t, segmentMacs(legacyGateway), segmentMacs(gateway))
+}
+
+func newStaleTestRawData(withServer2 bool) *PlatformRawData {
+	rawData := NewPlatformRawData()
+	vif1 := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vif1)
+	if withServer2 {
+		vif2 := newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:02")
+		rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.2"}
+		rawData.serverToVmIDs["10.0.0.2"] = mapset.NewSet(2)
+		rawData.vmIDToVifs[2] = mapset.NewSet(vif2)
+	}
+	return rawData
+}
+
+func TestStaleSegmentsGracePeriod(t *testing.T) {
+	s := newSegment()
+	s.SetStaleGracePeriod(time.Minute)
+	s.generateBaseSegments(newStaleTestRawData(true))
+	assert.Equal(t, 1, len(s.GetLaunchServerSegments("10.0.0.2")))
+
+	// 宽限期内保留已不存在的server和vm
+	s.generateBaseSegments(newStaleTestRawData(false))
+	assert.Equal(t, 1, len(s.GetLaunchServerSegments("10.0.0.2")))
+	assert.Equal(t, 1, len(s.GetVMIDSegments(2)))
+	assert.False(t, s.EvictStaleSegments(time.Now()))
+
+	// 超过宽限期后删除
+	version := s.dataVersion
+	assert.True(t, s.EvictStaleSegments(time.Now().Add(2*time.Minute)))
+	assert.Equal(t, 0, len(s.GetLaunchServerSegments("10.0.0.2")))
+	assert.Equal(t, 0, len(s.GetVMIDSegments(2)))
+	assert.Equal(t, 1, len(s.GetLaunchServerSegments("10.0.0.1")))
+	assert.Equal(t, version+1, s.dataVersion)
+	assert.Empty(t, s.staleSince)
+
+	// 重新出现的条目不再计时
+	s.generateBaseSegments(newStaleTestRawData(true))
+	assert.Empty(t, s.staleSince)
+
+	// 宽限期为0时立即删除
+	s = newSegment()
+	s.generateBaseSegments(newStaleTestRawData(true))
+	s.generateBaseSegments(newStaleTestRawData(false))
+	assert.Equal(t, 0, len(s.GetLaunchServerSegments("10.0.0.2")))
+	assert.Empty(t, s.staleSince)
+}
+
+func TestStaleSegmentsVifMovedNetwork(t *testing.T) {
+	s := newSegment()
+	s.SetStaleGracePeriod(time.Minute)
+	rawData := NewPlatformRawData()
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(
+		newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01"),
+		newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:02"),
+	)
+	s.generateBaseSegments(rawData)
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:02"}, segmentMacs(s.GetVMIDSegments(1)))
+
+	// vm 1 本次刷新缺失，其接口1切换到vm 2所在的网络B
+	rawData = NewPlatformRawData()
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.2"}
+	rawData.serverToVmIDs["10.0.0.2"] = mapset.NewSet(2)
+	rawData.vmIDToVifs[2] = mapset.NewSet(newTestVif(1, VIF_DEVICE_TYPE_VM, 2, 20, "00:00:00:00:00:01"))
+	s.generateBaseSegments(rawData)
+
+	// 宽限期内保留的旧条目中不再包含切换网络的接口
+	assert.Equal(t, []string{"00:00:00:00:00:02"}, segmentMacs(s.GetVMIDSegments(1)))
+	assert.Equal(t, []string{"00:00:00:00:00:02"}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	segments := s.GetVMIDSegments(2)
+	if assert.Equal(t, 1, len(segments)) {
+		assert.Equal(t, uint32(20), segments[0].GetId())
+		assert.Equal(t, []string{"00:00:00:00:00:01"}, segments[0].GetMac())
+	}
+	for _, segment := range append(s.GetVMIDSegments(1), s.GetLaunchServerSegments("10.0.0.1")...) {
+		assert.Equal(t, uint32(10), segment.GetId())
+	}
+}
+
+func TestSegmentSwapConsistentSnapshot(t *testing.T) {
+	newRawData := func(mac string) *PlatformRawData {
+		rawData := NewPlatformRawData()
+		rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+		rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+		rawData.vmIDToVifs[1] = mapset.NewSet(newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, mac))
+		rawData.hostIDToVifs[1] = mapset.NewSet(newTestVif(2, VIF_DEVICE_TYPE_HOST, 1, 10, mac))
+		return rawData
+	}
+	segmentValue := &atomic.Value{}
+	segmentValue.Store(newSegment())
+	p := &PlatformDataOP{segment: segmentValue}
+	p.generateBaseSegments(newRawData("00:00:00:00:00:01"))
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// 同一个segment中server、vm和host的segment来自同一份原始数据
+				s := p.GetSegment()
+				serverMacs := segmentMacs(s.GetLaunchServerSegments("10.0.0.1"))
+				vmMacs := segmentMacs(s.GetVMIDSegments(1))
+				hostMacs := segmentMacs(s.GetHostIDSegments(1))
+				if !assert.Equal(t, serverMacs, vmMacs) || !assert.Equal(t, serverMacs, hostMacs) {
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		p.generateBaseSegments(newRawData(fmt.Sprintf("00:00:00:00:01:%02x", i)))
+	}
+	close(stop)
+	wg.Wait()
+	assert.Equal(t, uint64(201), p.GetSegment().GetDataVersion())
+	assert.Equal(t, []string{"00:00:00:00:01:c7"}, segmentMacs(p.GetSegment().GetVMIDSegments(1)))
+}
+
+func TestSegmentMarshalProto(t *testing.T) {
+	rawData := NewPlatformRawData()
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(
+		newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01"),
+		newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 20, "00:00:00:00:00:02"),
+	)
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+
+	bytes, err := s.MarshalProto(SegmentScope{Type: SEGMENT_SCOPE_VM, ID: 1})
+	assert.Nil(t, err)
+	resp := &trident.SegmentPushResponse{}
+	assert.Nil(t, proto.Unmarshal(bytes, resp))
+	assert.True(t, resp.GetFull())
+	expected := s.Copy().GetVMIDSegments(1)
+	if assert.Len(t, resp.GetLocalSegments(), len(expected)) {
+		for i, segment := range resp.GetLocalSegments() {
+			assert.True(t, proto.Equal(expected[i], segment))
+		}
+	}
+	// 序列化不影响下发时记录的采集器使用的接口
+	assert.Equal(t, 0, s.vtapUsedVInterfaceIDs.Cardinality())
+
+	_, err = s.MarshalProto(SegmentScope{Type: "unknown"})
+	assert.NotNil(t, err)
+}
+
+func TestSegmentExplain(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vmVif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vmVif)
+	podNodeVif := newTestVif(2, VIF_DEVICE_TYPE_POD_NODE, 2, 20, "00:00:00:00:00:02")
+	podVif := newTestVif(3, VIF_DEVICE_TYPE_POD, 3, 30, "00:00:00:00:00:03")
+	rawData.idToPodNode[2] = &models.PodNode{Base: models.Base{ID: 2}, IP: "10.0.1.1"}
+	rawData.podNodeIDToVmID[2] = 1
+	rawData.podNodeIDToVifs[2] = mapset.NewSet(podNodeVif)
+	rawData.podNodeIDtoPodIDs[2] = mapset.NewSet(3)
+	rawData.podIDToVifs[3] = mapset.NewSet(podVif)
+	hostVif := newTestVif(4, VIF_DEVICE_TYPE_HOST, 5, 10, "00:00:00:00:00:04")
+	rawData.hostIDToVifs[5] = mapset.NewSet(hostVif)
+
+	s := newSegment()
+	_, err := s.Explain(SegmentScope{Type: SEGMENT_SCOPE_SERVER, Server: "10.0.0.1", ID: 5})
+	assert.NotNil(t, err)
+	s.generateBaseSegments(rawData)
+
+	explained, err := s.Explain(SegmentScope{Type: SEGMENT_SCOPE_SERVER, Server: "10.0.0.1", ID: 5})
+	assert.Nil(t, err)
+	sources := map[string]*SegmentMacSource{}
+	segments := []*trident.Segment{}
+	for _, e := range explained {
+		assert.Len(t, e.MacSources, len(e.Segment.GetMac()))
+		for mac, source := range e.MacSources {
+			sources[mac] = source
+		}
+		segments = append(segments, e.Segment)
+	}
+	assert.ElementsMatch(t, segmentMacs(s.Copy().GetServerSegments("10.0.0.1", 5)), segmentMacs(segments))
+	// pod的MAC经由pod_node、vm关联到launch server
+	if assert.Contains(t, sources, podVif.Mac) {
+		assert.Equal(t, podVif.ID, sources[podVif.Mac].VInterfaceID)
+		assert.Equal(t, []string{"server(10.0.0.1)", "vm(1)", "pod_node(2)", "pod(3)"}, sources[podVif.Mac].Relations)
+	}
+	assert.Equal(t, []string{"server(10.0.0.1)", "vm(1)", "pod_node(2)"}, sources[podNodeVif.Mac].Relations)
+	assert.Equal(t, []string{"server(10.0.0.1)", "vm(1)"}, sources[vmVif.Mac].Relations)
+	assert.Equal(t, []string{"host(5)"}, sources[hostVif.Mac].Relations)
+	// 解释不影响下发时记录的采集器使用的接口
+	assert.Equal(t, 0, s.vtapUsedVInterfaceIDs.Cardinality())
+
+	explained, err = s.Explain(SegmentScope{Type: SEGMENT_SCOPE_POD_NODE, ID: 2})
+	assert.Nil(t, err)
+	for _, e := range explained {
+		for mac, source := range e.MacSources {
+			if mac == podVif.Mac {
+				assert.Equal(t, []string{"pod_node(2)", "pod(3)"}, source.Relations)
+			}
+		}
+	}
+
+	_, err = s.Explain(SegmentScope{Type: "unknown"})
+	assert.NotNil(t, err)
+}
+
+func TestGlobalSegments(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vm1Vif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vm1MgmtVif := newTestVif(2, VIF_DEVICE_TYPE_VM, 1, 100, "00:00:00:00:00:02")
+	vm2Vif := newTestVif(3, VIF_DEVICE_TYPE_VM, 2, 20, "00:00:00:00:00:03")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.2"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.serverToVmIDs["10.0.0.2"] = mapset.NewSet(2)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vm1Vif, vm1MgmtVif)
+	rawData.vmIDToVifs[2] = mapset.NewSet(vm2Vif)
+	rawData.deviceVifs = []*models.VInterface{vm1Vif, vm1MgmtVif, vm2Vif}
+
+	s := newSegment()
+	s.SetGlobalNetworkIDs([]int{100})
+	s.generateBaseSegments(rawData)
+	assert.Equal(t, []string{"00:00:00:00:00:02"}, segmentMacs(s.GetGlobalSegments()))
+
+	// 其他服务器上的采集器也能获取全局网络的接口
+	segments := s.AppendGlobalSegments(s.GetServerSegments("10.0.0.2", 0))
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:03", "00:00:00:00:00:02"}, segmentMacs(segments))
+
+	// 已在local segments中的接口不重复下发
+	localSegments := s.GetServerSegments("10.0.0.1", 0)
+	segments = s.AppendGlobalSegments(localSegments)
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:01", "00:00:00:00:00:02"}, segmentMacs(segments))
+	assert.Len(t, segments, len(localSegments))
+}
+
+func TestCompactSegments(t *testing.T) {
+	newCompactTestSegment := func(id uint32, vifIDs ...uint32) *trident.Segment {
+		segment := &trident.Segment{Id: proto.Uint32(id), InterfaceId: vifIDs}
+		for _, vifID := range vifIDs {
+			mac := fmt.Sprintf("00:00:00:00:00:%02x", vifID)
+			segment.Mac = append(segment.Mac, mac)
+			segment.Vmac = append(segment.Vmac, mac)
+		}
+		return segment
+	}
+	segments := []*trident.Segment{
+		newCompactTestSegment(10, 1),
+		newCompactTestSegment(20, 2),
+		newCompactTestSegment(10, 3),
+		newCompactTestSegment(30, 4, 5),
+	}
+	allMacs := segmentMacs(segments)
+
+	// segment id为网络ID时只合并同一网络的单MAC segment
+	compacted := CompactSegments(segments, SEGMENT_VERSION_NETWORK_ID)
+	if assert.Equal(t, 3, len(compacted)) {
+		assert.Equal(t, uint32(10), compacted[0].GetId())
+		assert.Equal(t, []uint32{1, 3}, compacted[0].GetInterfaceId())
+		assert.Equal(t, uint32(20), compacted[1].GetId())
+		assert.Equal(t, uint32(30), compacted[2].GetId())
+	}
+	assert.ElementsMatch(t, allMacs, segmentMacs(compacted))
+
+	// 旧版本不区分segment id，所有单MAC segment合并为一个
+	compacted = CompactSegments(segments, SEGMENT_VERSION_LEGACY)
+	if assert.Equal(t, 2, len(compacted)) {
+		assert.Equal(t, uint32(10), compacted[0].GetId())
+		assert.Equal(t, []uint32{1, 2, 3}, compacted[0].GetInterfaceId())
+		assert.Equal(t, 2, len(compacted[1].GetMac()))
+	}
+	assert.ElementsMatch(t, allMacs, segmentMacs(compacted))
+
+	// 不修改传入的segment
+	assert.Equal(t, 4, len(segments))
+	assert.Equal(t, []string{"00:00:00:00:00:01"}, segments[0].GetMac())
+}
+
+func TestOrphanVMSegments(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vm1Vif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vm2Vif := newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:02")
+	vm3Vif := newTestVif(3, VIF_DEVICE_TYPE_VM, 3, 20, "00:00:00:00:00:03")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}}
+	rawData.idToVM[3] = &models.VM{Base: models.Base{ID: 3}, LaunchServer: "invalid"}
+	// vm2不在serverToVmIDs中，vm3的launch server不合法
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.serverToVmIDs["invalid"] = mapset.NewSet(3)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vm1Vif)
+	rawData.vmIDToVifs[2] = mapset.NewSet(vm2Vif)
+	rawData.vmIDToVifs[3] = mapset.NewSet(vm3Vif)
+
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	assert.Equal(t, []int{2, 3}, s.OrphanVMIDs())
+	assert.Empty(t, s.GetOrphanVMSegments())
+
+	s = newSegment()
+	s.SetOrphanVMSegments(true)
+	s.generateBaseSegments(rawData)
+	assert.Equal(t, []int{2, 3}, s.OrphanVMIDs())
+	segments := s.GetOrphanVMSegments()
+	assert.ElementsMatch(t, []string{"00:00:00:00:00:02", "00:00:00:00:00:03"}, segmentMacs(segments))
+	assert.Equal(t, []string{"00:00:00:00:00:01"}, segmentMacs(s.GetLaunchServerSegments("10.0.0.1")))
+	// 获取孤立vm的segment不影响没有采集器覆盖的接口统计
+	assert.False(t, s.vtapUsedVInterfaceIDs.Contains(2))
+	assert.False(t, s.vtapUsedVInterfaceIDs.Contains(3))
+}
+
+func TestGetSegmentsForServers(t *testing.T) {
+	rawData := NewPlatformRawData()
+	vm1Vif := newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01")
+	vm2Vif := newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 20, "00:00:00:00:00:02")
+	rawData.idToVM[1] = &models.VM{Base: models.Base{ID: 1}, LaunchServer: "10.0.0.1"}
+	rawData.idToVM[2] = &models.VM{Base: models.Base{ID: 2}, LaunchServer: "10.0.0.2"}
+	rawData.serverToVmIDs["10.0.0.1"] = mapset.NewSet(1)
+	rawData.serverToVmIDs["10.0.0.2"] = mapset.NewSet(2)
+	rawData.vmIDToVifs[1] = mapset.NewSet(vm1Vif)
+	rawData.vmIDToVifs[2] = mapset.NewSet(vm2Vif)
+
+	podNodeVif := newTestVif(3, VIF_DEVICE_TYPE_POD_NODE, 1, 30, "00:00:00:00:00:03")
+	rawData.idToPodNode[1] = &models.PodNode{Base: models.Base{ID: 1}, IP: "10.0.0.3"}
+	rawData.podNodeIDToVifs[1] = mapset.NewSet(podNodeVif)
+
+	servers := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.1", "10.0.0.9"}
+	s := newSegment()
+	s.generateBaseSegments(rawData)
+	batch := s.GetSegmentsForServers(servers)
+
+	expected := newSegment()
+	expected.generateBaseSegments(rawData)
+	assert.Equal(t, 4, len(batch))
+	for _, server := range servers {
+		assert.Equal(t, expected.GetLaunchServerSegments(server), batch[server], server)
+	}
+	assert.Empty(t, batch["10.0.0.9"])
+	assert.True(t, expected.vtapUsedVInterfaceIDs.Equal(s.vtapUsedVInterfaceIDs))
+	assert.Equal(t, 3, s.vtapUsedVInterfaceIDs.Cardinality())
+}
+
+func TestHashSegmentDataFloatingIPMoved(t *testing.T) {
+	rawData := NewPlatformRawData()
+	rawData.vmIDToVifs[1] = mapset.NewSet(newTestVif(1, VIF_DEVICE_TYPE_VM, 1, 10, "00:00:00:00:00:01"))
+	rawData.vmIDToVifs[2] = mapset.NewSet(newTestVif(2, VIF_DEVICE_TYPE_VM, 2, 10, "00:00:00:00:00:02"))
+	fipVif := newTestVif(3, VIF_DEVICE_TYPE_VM, 3, 20, "00:00:00:00:00:03")
+	rawData.vmIDToFloatingIPVifs[1] = mapset.NewSet(fipVif)
+	hash := hashSegmentData(rawData)
+
+	// 浮动IP从vm 1迁移到vm 2，其余数据不变时摘要也需变化
+	delete(rawData.vmIDToFloatingIPVifs, 1)
+	rawData.vmIDToFloatingIPVifs[2] = mapset.NewSet(fipVif)
+	assert.NotEqual(t, hash, hashSegmentData(rawData))
+}
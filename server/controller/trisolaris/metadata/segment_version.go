@@ -0,0 +1,42 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+// segment下发格式的版本，由采集器在同步请求中携带，用于兼容不同版本采集器对trident.Segment字段的解释
+const (
+	// 旧版本采集器: ESXi采集器的local segment合并为一个，gateway宿主机segment的id固定为1
+	SEGMENT_VERSION_LEGACY uint32 = 1
+	// segment id为网络ID，网络被多个domain复用时为重新分配的segment id
+	SEGMENT_VERSION_NETWORK_ID uint32 = 2
+
+	SEGMENT_VERSION_LATEST = SEGMENT_VERSION_NETWORK_ID
+)
+
+// 所有支持的segment版本，按版本号递增
+var SEGMENT_VERSIONS = []uint32{SEGMENT_VERSION_LEGACY, SEGMENT_VERSION_NETWORK_ID}
+
+// 根据采集器支持的segment版本协商下发的版本，未携带版本的旧采集器使用SEGMENT_VERSION_LEGACY，
+// 高于服务端支持的版本时使用SEGMENT_VERSION_LATEST
+func NegotiateSegmentVersion(agentVersion uint32) uint32 {
+	if agentVersion < SEGMENT_VERSION_LEGACY {
+		return SEGMENT_VERSION_LEGACY
+	}
+	if agentVersion > SEGMENT_VERSION_LATEST {
+		return SEGMENT_VERSION_LATEST
+	}
+	return agentVersion
+}
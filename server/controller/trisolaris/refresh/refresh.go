@@ -19,6 +19,7 @@ package refresh
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/op/go-logging"
@@ -50,6 +51,7 @@ func NewRefreshOP(db *gorm.DB, nodeIP string) *RefreshOP {
 }
 
 var urlFormat = "http://%s:%d/v1/caches/?"
+var vmMigrationURLFormat = "http://%s:%d/v1/caches/vm-migration/?"
 
 func RefreshCache(dataTypes []common.DataChanged) {
 	if refreshOP != nil {
@@ -57,25 +59,45 @@ func RefreshCache(dataTypes []common.DataChanged) {
 	}
 }
 
+// 通知trisolaris vm迁移，立即更新launch server的segment
+func RefreshVMMigration(vmID int, launchServer string) {
+	if refreshOP != nil {
+		go refreshOP.refreshVMMigration(vmID, launchServer)
+	}
+}
+
 func (r *RefreshOP) refreshCache(dataTypes []common.DataChanged) {
-	localControllerIPs := r.localRefreshIPs
-	remoteControllerIPs := r.remoteRefreshIPs
-	if len(dataTypes) == 0 || (len(localControllerIPs) == 0 && len(remoteControllerIPs) == 0) {
+	if len(dataTypes) == 0 {
 		return
 	}
-	log.Infof("refresh cache for trisolaris(%v %v)", localControllerIPs, remoteControllerIPs)
 	params := url.Values{}
 	for _, dataType := range dataTypes {
 		params.Add("type", string(dataType))
 	}
-	paramsEncode := params.Encode()
+	r.request(urlFormat, params.Encode())
+}
+
+func (r *RefreshOP) refreshVMMigration(vmID int, launchServer string) {
+	params := url.Values{}
+	params.Add("vm_id", strconv.Itoa(vmID))
+	params.Add("launch_server", launchServer)
+	r.request(vmMigrationURLFormat, params.Encode())
+}
+
+func (r *RefreshOP) request(format string, paramsEncode string) {
+	localControllerIPs := r.localRefreshIPs
+	remoteControllerIPs := r.remoteRefreshIPs
+	if len(localControllerIPs) == 0 && len(remoteControllerIPs) == 0 {
+		return
+	}
+	log.Infof("refresh cache for trisolaris(%v %v)", localControllerIPs, remoteControllerIPs)
 	for _, controllerIP := range localControllerIPs {
 		err := common.IsTCPActive(controllerIP, common.GConfig.HTTPPort)
 		if err != nil {
 			log.Errorf("%s:%d unreachable, err(%s)", controllerIP, common.GConfig.HTTPPort, err)
 			continue
 		}
-		trisolaris_url := fmt.Sprintf(urlFormat, controllerIP, common.GConfig.HTTPPort) + paramsEncode
+		trisolaris_url := fmt.Sprintf(format, controllerIP, common.GConfig.HTTPPort) + paramsEncode
 		resp, err := common.CURLPerform("PUT", trisolaris_url, nil)
 		if err != nil {
 			log.Errorf("request trisolaris failed: %s, URL: %s", resp, trisolaris_url)
@@ -87,7 +109,7 @@ func (r *RefreshOP) refreshCache(dataTypes []common.DataChanged) {
 			log.Errorf("%s:%d unreachable, err(%s)", controllerIP, common.GConfig.HTTPNodePort, err)
 			continue
 		}
-		trisolaris_url := fmt.Sprintf(urlFormat, controllerIP, common.GConfig.HTTPNodePort) + paramsEncode
+		trisolaris_url := fmt.Sprintf(format, controllerIP, common.GConfig.HTTPNodePort) + paramsEncode
 		resp, err := common.CURLPerform("PUT", trisolaris_url, nil)
 		if err != nil {
 			log.Errorf("request trisolaris failed: %s, URL: %s", resp, trisolaris_url)
@@ -29,6 +29,7 @@ import (
 	. "github.com/deepflowio/deepflow/server/controller/common"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris"
 	. "github.com/deepflowio/deepflow/server/controller/trisolaris/common"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/metadata"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/pushmanager"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/vtap"
 )
@@ -67,6 +68,9 @@ func (e *VTapEvent) generateConfigInfo(c *vtap.VTapCache, clusterID string) *api
 	if vtapConfig == nil {
 		return &api.Config{}
 	}
+	if c.IsAwaitingApproval() {
+		return e.generateHoldingConfig(c, vtapConfig)
+	}
 
 	collectorSocketType, ok := SOCKET_TYPE_TO_MESSAGE[vtapConfig.CollectorSocketType]
 	if ok == false {
@@ -101,7 +105,7 @@ func (e *VTapEvent) generateConfigInfo(c *vtap.VTapCache, clusterID string) *api
 		Mtu:                           proto.Uint32(uint32(vtapConfig.Mtu)),
 		OutputVlan:                    proto.Uint32(uint32(vtapConfig.OutputVlan)),
 		RsyslogEnabled:                proto.Bool(Int2Bool(vtapConfig.RsyslogEnabled)),
-		ServerTxBandwidthThreshold:    proto.Uint64(uint64(vtapConfig.MaxTxBandwidth)),
+		ServerTxBandwidthThreshold:    proto.Uint64(uint64(c.GetTxBandwidthThreshold())),
 		BandwidthProbeInterval:        proto.Uint64(uint64(vtapConfig.BandwidthProbeInterval)),
 		MaxEscapeSeconds:              proto.Uint32(uint32(vtapConfig.MaxEscapeSeconds)),
 		NpbVlanMode:                   &npbVlanMode,
@@ -339,6 +343,7 @@ func (e *VTapEvent) Sync(ctx context.Context, in *api.SyncRequest) (*api.SyncRes
 	if vtapCache.GetRevision() != in.GetRevision() {
 		vtapCache.UpdateRevision(in.GetRevision())
 	}
+	gVTapInfo.UpdateVTapSegmentVersion(vtapCache, metadata.NegotiateSegmentVersion(in.GetSegmentVersion()))
 	tridentException := vtapCache.GetExceptions() & VTAP_TRIDENT_EXCEPTIONS_MASK
 	if tridentException != int64(in.GetException()) {
 		vtapCache.UpdateExceptions(int64(in.GetException()))
@@ -400,8 +405,9 @@ func (e *VTapEvent) Sync(ctx context.Context, in *api.SyncRequest) (*api.SyncRes
 			configInfo.KubernetesApiEnabled = proto.Bool(true)
 		}
 	}
-	localSegments := vtapCache.GetVTapLocalSegments()
-	remoteSegments := vtapCache.GetVTapRemoteSegments()
+	// 采集器携带的segments版本未变化时不重复下发，采集器支持分批接收时按token分批下发remote segments
+	localSegments, remoteSegments, versionSegments, remoteSegmentsToken := vtapCache.GetVTapSegmentsPage(
+		in.GetVersionSegments(), in.GetRemoteSegmentsToken(), int(in.GetRemoteSegmentsChunkSize()))
 	upgradeRevision := vtapCache.GetExpectedRevision()
 	skipInterface := gVTapInfo.GetSkipInterface(vtapCache)
 	Containers := gVTapInfo.GetContainers(int(vtapCache.GetVTapID()))
@@ -421,9 +427,37 @@ func (e *VTapEvent) Sync(ctx context.Context, in *api.SyncRequest) (*api.SyncRes
 		SkipInterface:       skipInterface,
 		SelfUpdateUrl:       proto.String(gVTapInfo.GetSelfUpdateUrl()),
 		Revision:            proto.String(upgradeRevision),
+		SegmentVersion:      proto.Uint32(vtapCache.GetSegmentVersion()),
+		VersionSegments:     proto.Uint64(versionSegments),
+		RemoteSegmentsToken: proto.String(remoteSegmentsToken),
 	}, nil
 }
 
+// generateHoldingConfig 待审批的采集器仅下发保持同步所需的配置，审批通过后再下发完整配置
+func (e *VTapEvent) generateHoldingConfig(c *vtap.VTapCache, vtapConfig *vtap.VTapConfig) *api.Config {
+	vtapID := uint32(c.GetVTapID())
+	tridentType := common.TridentType(c.GetVTapType())
+	return &api.Config{
+		Enabled:              proto.Bool(false),
+		CollectorEnabled:     proto.Bool(false),
+		PlatformEnabled:      proto.Bool(false),
+		KubernetesApiEnabled: proto.Bool(false),
+		MaxCpus:              proto.Uint32(uint32(vtapConfig.MaxCPUs)),
+		MaxMemory:            proto.Uint32(uint32(vtapConfig.MaxMemory)),
+		SyncInterval:         proto.Uint32(uint32(vtapConfig.SyncInterval)),
+		MaxEscapeSeconds:     proto.Uint32(uint32(vtapConfig.MaxEscapeSeconds)),
+		LogThreshold:         proto.Uint32(uint32(vtapConfig.LogThreshold)),
+		LogLevel:             proto.String(vtapConfig.LogLevel),
+		LogRetention:         proto.Uint32(uint32(vtapConfig.LogRetention)),
+		LogFileSize:          proto.Uint32(uint32(vtapConfig.LogFileSize)),
+		ProxyControllerIp:    proto.String(c.GetControllerIP()),
+		ProxyControllerPort:  proto.Uint32(uint32(vtapConfig.ProxyControllerPort)),
+		Host:                 proto.String(c.GetVTapHost()),
+		VtapId:               &vtapID,
+		TridentType:          &tridentType,
+	}
+}
+
 func (e *VTapEvent) generateNoVTapCacheConfig(groupID string) *api.Config {
 	vtapConfig := trisolaris.GetGVTapInfo().GetVTapConfigFromShortID(groupID)
 	if vtapConfig == nil {
@@ -687,8 +721,8 @@ func (e *VTapEvent) pushResponse(in *api.SyncRequest) (*api.SyncResponse, error)
 			configInfo.KubernetesApiEnabled = proto.Bool(true)
 		}
 	}
-	localSegments := vtapCache.GetVTapLocalSegments()
-	remoteSegments := vtapCache.GetVTapRemoteSegments()
+	localSegments, remoteSegments, versionSegments, remoteSegmentsToken := vtapCache.GetVTapSegmentsPage(
+		0, "", int(in.GetRemoteSegmentsChunkSize()))
 	skipInterface := gVTapInfo.GetSkipInterface(vtapCache)
 	Containers := gVTapInfo.GetContainers(int(vtapCache.GetVTapID()))
 	return &api.SyncResponse{
@@ -705,6 +739,9 @@ func (e *VTapEvent) pushResponse(in *api.SyncRequest) (*api.SyncResponse, error)
 		VersionAcls:         proto.Uint64(versionPolicy),
 		TapTypes:            tapTypes,
 		Containers:          Containers,
+		SegmentVersion:      proto.Uint32(vtapCache.GetSegmentVersion()),
+		VersionSegments:     proto.Uint64(versionSegments),
+		RemoteSegmentsToken: proto.String(remoteSegmentsToken),
 	}, nil
 }
 
@@ -725,3 +762,45 @@ func (e *VTapEvent) Push(r *api.SyncRequest, in api.Synchronizer_PushServer) err
 	log.Info("exit push", r.GetCtrlIp(), r.GetCtrlMac())
 	return err
 }
+
+// SegmentPush 首次推送全量local segment，之后仅推送变化的segment，缓冲区溢出时重新推送全量
+func (e *VTapEvent) SegmentPush(r *api.SyncRequest, in api.Synchronizer_SegmentPushServer) error {
+	vtapCache, err := e.getVTapCache(r)
+	if err != nil {
+		return err
+	}
+	if vtapCache == nil {
+		return fmt.Errorf("no find vtap(%s %s) cache", r.GetCtrlIp(), r.GetCtrlMac())
+	}
+	gVTapInfo := trisolaris.GetGVTapInfo()
+	vtapCacheKey := r.GetCtrlIp() + "-" + r.GetCtrlMac()
+	stream := gVTapInfo.SubscribeSegments(vtapCacheKey)
+	defer gVTapInfo.UnsubscribeSegments(vtapCacheKey, stream)
+
+	fullResponse := func() *api.SegmentPushResponse {
+		return &api.SegmentPushResponse{
+			Full:          proto.Bool(true),
+			LocalSegments: vtapCache.GetVTapLocalSegments(),
+		}
+	}
+	if err = in.Send(fullResponse()); err != nil {
+		log.Error(err)
+		return err
+	}
+	for {
+		select {
+		case <-in.Context().Done():
+			log.Info("exit segment push", r.GetCtrlIp(), r.GetCtrlMac())
+			return nil
+		case response := <-stream.C():
+			if stream.NeedResync() || response.GetFull() {
+				log.Infof("segment push resync vtap(%s %s)", r.GetCtrlIp(), r.GetCtrlMac())
+				response = fullResponse()
+			}
+			if err = in.Send(response); err != nil {
+				log.Error(err)
+				return err
+			}
+		}
+	}
+}
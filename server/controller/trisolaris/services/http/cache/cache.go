@@ -17,6 +17,8 @@
 package cache
 
 import (
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	"github.com/op/go-logging"
 
@@ -61,6 +63,18 @@ func PutCache(c *gin.Context) {
 	common.Response(c, nil, common.NewReponse("SUCCESS", "", nil, ""))
 }
 
+func PutVMMigration(c *gin.Context) {
+	vmID, err := strconv.Atoi(c.Query("vm_id"))
+	launchServer := c.Query("launch_server")
+	if err != nil || launchServer == "" {
+		common.Response(c, nil, common.NewReponse("FAILED", "", nil, "invalid vm_id or launch_server param"))
+		return
+	}
+	trisolaris.PutVMMigration(vmID, launchServer)
+	common.Response(c, nil, common.NewReponse("SUCCESS", "", nil, ""))
+}
+
 func (*CacheService) Register(mux *gin.Engine) {
 	mux.PUT("v1/caches/", PutCache)
+	mux.PUT("v1/caches/vm-migration/", PutVMMigration)
 }
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package segment
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/op/go-logging"
+
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/dbmgr"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/server/http"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/server/http/common"
+)
+
+var log = logging.MustGetLogger("trisolaris/segment")
+
+func init() {
+	http.Register(NewSegmentService())
+}
+
+type SegmentService struct{}
+
+func NewSegmentService() *SegmentService {
+	return &SegmentService{}
+}
+
+// 导出采集器当前的local segments，用于排查segment下发问题
+func DumpVTapSegments(c *gin.Context) {
+	lcuuid := c.Param("lcuuid")
+	if lcuuid == "" {
+		common.Response(c, nil, common.NewReponse("FAILED", "", nil, "not find lcuuid param"))
+		return
+	}
+
+	vtap, err := dbmgr.DBMgr[models.VTap](trisolaris.GetDB()).GetFromLcuuid(lcuuid)
+	if err != nil {
+		log.Error(err)
+		common.Response(c, nil, common.NewReponse("FAILED", "", nil, fmt.Sprintf("%s", err)))
+		return
+	}
+	key := vtap.CtrlIP + "-" + vtap.CtrlMac
+	vTapInfo := trisolaris.GetGVTapInfo()
+	vTapCache := vTapInfo.GetVTapCache(key)
+	if vTapCache == nil {
+		common.Response(c, nil, common.NewReponse("FAILED", "", nil, "not found vtap cache"))
+		return
+	}
+	data := map[string]interface{}{
+		"LCUUID":         lcuuid,
+		"NAME":           vtap.Name,
+		"LOCAL_SEGMENTS": vTapInfo.DumpVTapLocalSegments(vTapCache),
+	}
+	common.Response(c, nil, common.NewReponse("SUCCESS", "", data, ""))
+}
+
+// 检查segment数据一致性，返回违反的约束
+func ValidateSegments(c *gin.Context) {
+	violations := trisolaris.GetMetaData().GetPlatformDataOP().GetSegment().Validate()
+	data := map[string]interface{}{
+		"VALID":      len(violations) == 0,
+		"VIOLATIONS": violations,
+	}
+	common.Response(c, nil, common.NewReponse("SUCCESS", "", data, ""))
+}
+
+func (*SegmentService) Register(mux *gin.Engine) {
+	mux.GET("v1/segments/vtap/:lcuuid/", DumpVTapSegments)
+	mux.GET("v1/segments/validate/", ValidateSegments)
+}
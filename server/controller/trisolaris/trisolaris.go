@@ -82,6 +82,10 @@ func PutPlatformData() {
 	trisolaris.metaData.PutChPlatformData()
 }
 
+func PutVMMigration(vmID int, launchServer string) {
+	trisolaris.metaData.PutChVMMigration(vmID, launchServer)
+}
+
 func PutTapType() {
 	trisolaris.metaData.PutChTapType()
 }
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// 采集器配置模板中可引用的变量，按采集器自身属性解析
+const (
+	VTAP_CONFIG_VAR_REGION        = "region"
+	VTAP_CONFIG_VAR_AZ            = "az"
+	VTAP_CONFIG_VAR_LAUNCH_SERVER = "launch_server"
+)
+
+var vtapConfigVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// VTapConfigTemplateVars 采集器配置模板变量的取值，值为空视为无法解析
+func VTapConfigTemplateVars(region, az, launchServer string) map[string]string {
+	return map[string]string{
+		VTAP_CONFIG_VAR_REGION:        region,
+		VTAP_CONFIG_VAR_AZ:            az,
+		VTAP_CONFIG_VAR_LAUNCH_SERVER: launchServer,
+	}
+}
+
+func (c *VTapCache) configTemplateVars() map[string]string {
+	return VTapConfigTemplateVars(c.GetRegion(), c.GetAZ(), c.GetLaunchServer())
+}
+
+// CheckConfigTemplate 校验模板中引用的变量均为支持的变量
+func CheckConfigTemplate(template string) error {
+	supported := VTapConfigTemplateVars("", "", "")
+	unsupportedSet := make(map[string]struct{})
+	for _, match := range vtapConfigVarPattern.FindAllStringSubmatch(template, -1) {
+		if _, ok := supported[match[1]]; !ok {
+			unsupportedSet[match[1]] = struct{}{}
+		}
+	}
+	if len(unsupportedSet) == 0 {
+		return nil
+	}
+	return fmt.Errorf("config template variables %v unsupported", sortedNames(unsupportedSet))
+}
+
+// RenderConfigTemplate 替换模板中的${var}，无法解析的变量保持原样
+func RenderConfigTemplate(template string, vars map[string]string) string {
+	return renderConfigTemplate(template, vars, make(map[string]struct{}))
+}
+
+// 替换模板中的${var}，无法解析的变量保持原样并记录到unresolved
+func renderConfigTemplate(template string, vars map[string]string, unresolved map[string]struct{}) string {
+	return vtapConfigVarPattern.ReplaceAllStringFunc(template, func(match string) string {
+		name := vtapConfigVarPattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok && value != "" {
+			return value
+		}
+		unresolved[name] = struct{}{}
+		return match
+	})
+}
+
+// 按采集器属性渲染配置中的模板字段，存在无法解析的变量时返回错误
+func (c *VTapCache) renderVTapConfigTemplate(configure *VTapConfig) error {
+	if configure == nil {
+		return nil
+	}
+	vars := c.configTemplateVars()
+	unresolvedSet := make(map[string]struct{})
+	for _, field := range []*string{&configure.YamlConfig, &configure.AnalyzerIP, &configure.ProxyControllerIP} {
+		*field = renderConfigTemplate(*field, vars, unresolvedSet)
+	}
+	if len(unresolvedSet) == 0 {
+		return nil
+	}
+	return fmt.Errorf("vtap(%s) config template variables %v unresolved", c.GetKey(), sortedNames(unresolvedSet))
+}
+
+func sortedNames(nameSet map[string]struct{}) []string {
+	names := make([]string, 0, len(nameSet))
+	for name := range nameSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
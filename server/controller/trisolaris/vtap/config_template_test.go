@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/config"
+)
+
+func newTemplateTestVTapCache(region, az string) *VTapCache {
+	return &VTapCache{
+		config:          &atomic.Value{},
+		ctrlIP:          proto.String("10.0.0.1"),
+		vTapGroupLcuuid: proto.String("group-1"),
+		region:          proto.String(region),
+		az:              proto.String(az),
+	}
+}
+
+func TestRenderVTapConfigTemplate(t *testing.T) {
+	groupConfig := &VTapConfig{RVTapGroupConfiguration: models.RVTapGroupConfiguration{
+		VTapGroupLcuuid: "group-1",
+		AnalyzerIP:      "collector.${region}.example.com",
+		YamlConfig:      "region: ${region}\nzone: ${az}\n",
+	}}
+	v := &VTapInfo{
+		config:                         &config.Config{},
+		vtapGroupLcuuidToConfiguration: map[string]*VTapConfig{"group-1": groupConfig},
+	}
+
+	c1 := newTemplateTestVTapCache("region-1", "az-1")
+	c1.initVTapConfig(v)
+	c2 := newTemplateTestVTapCache("region-2", "az-2")
+	c2.initVTapConfig(v)
+
+	assert.Equal(t, "collector.region-1.example.com", c1.GetVTapConfig().AnalyzerIP)
+	assert.Equal(t, "region: region-1\nzone: az-1\n", c1.GetLocalConfig())
+	assert.Equal(t, "collector.region-2.example.com", c2.GetVTapConfig().AnalyzerIP)
+	assert.Equal(t, "region: region-2\nzone: az-2\n", c2.GetLocalConfig())
+	// 按采集器渲染不修改采集器组的配置
+	assert.Equal(t, "collector.${region}.example.com", groupConfig.AnalyzerIP)
+}
+
+func TestRenderVTapConfigTemplateUnresolved(t *testing.T) {
+	c := newTemplateTestVTapCache("region-1", "")
+	configure := &VTapConfig{RVTapGroupConfiguration: models.RVTapGroupConfiguration{
+		ProxyControllerIP: "${launch_server}",
+		YamlConfig:        "region: ${region}\nzone: ${az}\nhost: ${hostname}\n",
+	}}
+
+	err := c.renderVTapConfigTemplate(configure)
+	assert.EqualError(t, err, "vtap(10.0.0.1) config template variables [az hostname launch_server] unresolved")
+	assert.Equal(t, "${launch_server}", configure.ProxyControllerIP)
+	assert.Equal(t, "region: region-1\nzone: ${az}\nhost: ${hostname}\n", configure.YamlConfig)
+
+	configure = &VTapConfig{RVTapGroupConfiguration: models.RVTapGroupConfiguration{YamlConfig: "region: ${region}\n"}}
+	assert.NoError(t, c.renderVTapConfigTemplate(configure))
+}
+
+func TestCheckConfigTemplate(t *testing.T) {
+	assert.NoError(t, CheckConfigTemplate("region: ${region}\nzone: ${az}\nhost: ${launch_server}\n"))
+	assert.NoError(t, CheckConfigTemplate("10.0.0.1"))
+	assert.EqualError(t, CheckConfigTemplate("${hostname}.${region}.${zone}"), "config template variables [hostname zone] unsupported")
+}
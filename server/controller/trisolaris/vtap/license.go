@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	. "github.com/deepflowio/deepflow/server/controller/common"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	monitorconfig "github.com/deepflowio/deepflow/server/controller/monitor/config"
+	"github.com/deepflowio/deepflow/server/controller/monitor/license"
+)
+
+const VTAP_DEFAULT_LICENSE_SKIPPED = "采集器(%s)未分配默认授权类型(%d): %s"
+
+// GetVTapDefaultLicenseType 按采集器类型获取新建采集器的默认授权类型，类型不支持或授权已达到上限时不分配，由用户后续修改
+// 供接口创建及采集器自动注册共用，db可传入事务以保证上限检查与插入的一致性
+func GetVTapDefaultLicenseType(db *gorm.DB, vtap *models.VTap, monitorCfg monitorconfig.MonitorConfig) int {
+	licenseType, ok := monitorCfg.VTapDefaultLicenseTypes[vtap.Type]
+	if !ok || licenseType == VTAP_LICENSE_TYPE_NONE {
+		return VTAP_LICENSE_TYPE_NONE
+	}
+	supportedLicenseTypes := license.GetSupportedLicenseType(vtap.Type)
+	sort.Ints(supportedLicenseTypes)
+	index := sort.SearchInts(supportedLicenseTypes, licenseType)
+	if index >= len(supportedLicenseTypes) || supportedLicenseTypes[index] != licenseType {
+		log.Warningf(VTAP_DEFAULT_LICENSE_SKIPPED, vtap.Name, licenseType, fmt.Sprintf("not supported by vtap type (%d)", vtap.Type))
+		return VTAP_LICENSE_TYPE_NONE
+	}
+	if limit := getVTapLicenseLimit(monitorCfg.VTapLicenseLimit, licenseType); limit > 0 {
+		var used int64
+		if err := db.Model(&models.VTap{}).Where("license_type = ?", licenseType).Count(&used).Error; err != nil {
+			log.Warningf(VTAP_DEFAULT_LICENSE_SKIPPED, vtap.Name, licenseType, err)
+			return VTAP_LICENSE_TYPE_NONE
+		}
+		if int(used) >= limit {
+			log.Warningf(VTAP_DEFAULT_LICENSE_SKIPPED, vtap.Name, licenseType, fmt.Sprintf("limit (%d) exhausted", limit))
+			return VTAP_LICENSE_TYPE_NONE
+		}
+	}
+	return licenseType
+}
+
+// 授权类型对应的采集器数量上限，0表示不限制
+func getVTapLicenseLimit(licenseLimit monitorconfig.VTapLicenseLimit, licenseType int) int {
+	switch licenseType {
+	case VTAP_LICENSE_TYPE_A:
+		return licenseLimit.TypeA
+	case VTAP_LICENSE_TYPE_B:
+		return licenseLimit.TypeB
+	case VTAP_LICENSE_TYPE_C:
+		return licenseLimit.TypeC
+	}
+	return 0
+}
@@ -17,10 +17,13 @@
 package vtap
 
 import (
+	"sync/atomic"
+
 	"github.com/deepflowio/deepflow/message/trident"
 
 	. "github.com/deepflowio/deepflow/server/controller/common"
 	. "github.com/deepflowio/deepflow/server/controller/trisolaris/common"
+	"github.com/deepflowio/deepflow/server/controller/trisolaris/metadata"
 	. "github.com/deepflowio/deepflow/server/controller/trisolaris/utils"
 )
 
@@ -44,6 +47,7 @@ import (
    - 向K8s Sidecar类型的采集器下发的local_segment
      - 所在运行环境（POD）的接口列表
    - 向隧道解封装类型的采集器无需下发local_segment和remote_egment
+   - 除上述无需下发local_segment的采集器外，local_segment均追加全局网络(如管理网、存储网)的接口列表
 */
 
 var serverVTap []int = []int{VTAP_TYPE_KVM, VTAP_TYPE_HYPER_V, VTAP_TYPE_HYPER_V_NETWORK}
@@ -52,22 +56,28 @@ var workloadVTap []int = []int{VTAP_TYPE_WORKLOAD_P, VTAP_TYPE_WORKLOAD_V}
 var noLocalSegments []int = []int{VTAP_TYPE_DEDICATED, VTAP_TYPE_TUNNEL_DECAPSULATION}
 
 func (v *VTapInfo) GenerateVTapLocalSegments(c *VTapCache) []*trident.Segment {
+	rawData := v.metaData.GetPlatformDataOP().GetRawData()
+	segment := v.metaData.GetPlatformDataOP().GetSegment()
+	return generateVTapLocalSegments(c, segment, rawData.GetPodNodeIDToVmID())
+}
+
+// 按当前平台数据计算采集器的local segments，基于segment副本计算，不影响下发时记录的vtapUsedVInterfaceIDs
+func (v *VTapInfo) DumpVTapLocalSegments(c *VTapCache) []*trident.Segment {
+	rawData := v.metaData.GetPlatformDataOP().GetRawData()
+	segment := v.metaData.GetPlatformDataOP().GetSegment().Copy()
+	return generateVTapLocalSegments(c, segment, rawData.GetPodNodeIDToVmID())
+}
+
+func generateVTapLocalSegments(c *VTapCache, segment *metadata.Segment, podNodeIDToVmID map[int]int) []*trident.Segment {
 	var localSegments []*trident.Segment
 	vtapType := c.GetVTapType()
 	launchServer := c.GetLaunchServer()
 	launchServerID := c.GetLaunchServerID()
-	rawData := v.metaData.GetPlatformDataOP().GetRawData()
-	segment := v.metaData.GetPlatformDataOP().GetSegment()
-	podNodeIDToVmID := rawData.GetPodNodeIDToVmID()
 
 	if vtapType == VTAP_TYPE_ESXI {
-		localSegments = segment.GetTypeVMSegments(launchServer, launchServerID)
+		localSegments = segment.GetTypeVMSegments(launchServer, launchServerID, c.GetSegmentVersion())
 	} else if Find[int](serverVTap, vtapType) {
-		launchServerSegments := segment.GetLaunchServerSegments(launchServer)
-		hostIDSegments := segment.GetHostIDSegments(launchServerID)
-		localSegments = make([]*trident.Segment, 0, len(launchServerSegments)+len(hostIDSegments))
-		localSegments = append(localSegments, launchServerSegments...)
-		localSegments = append(localSegments, hostIDSegments...)
+		localSegments = segment.GetServerSegments(launchServer, launchServerID)
 	} else if Find[int](workloadVTap, vtapType) {
 		if launchServerID != 0 {
 			localSegments = segment.GetVMIDSegments(launchServerID)
@@ -89,18 +99,63 @@ func (v *VTapInfo) GenerateVTapLocalSegments(c *VTapCache) []*trident.Segment {
 		log.Errorf("vtap type(%d) not found", vtapType)
 	}
 
+	localSegments = segment.FilterSegmentsByDomains(localSegments, getVTapSegmentDomains(c))
+	localSegments = segment.FilterSegmentsByDeviceTypes(localSegments, getVTapSegmentDeviceTypes(c))
+	// 全局segment对所有采集器可见，不按采集器组配置过滤
+	localSegments = segment.AppendGlobalSegments(localSegments)
+	if segment.SegmentCompactionEnabled() {
+		localSegments = metadata.CompactSegments(localSegments, c.GetSegmentVersion())
+	}
 	return localSegments
 }
 
-func (v *VTapInfo) GenerateRemoteSegments() []*trident.Segment {
+// 采集器组配置了segment接口设备类型(如仅POD、仅VM)时，local segments仅保留这些类型的接口
+func getVTapSegmentDeviceTypes(c *VTapCache) []int {
+	vtapConfig := c.GetVTapConfig()
+	if vtapConfig == nil {
+		return nil
+	}
+	return vtapConfig.ConvertedSegmentDeviceTypes
+}
+
+// 采集器组配置了下发的云平台列表时，local segments仅保留这些云平台(及采集器所在容器集群)的接口
+func getVTapSegmentDomains(c *VTapCache) []string {
+	vtapConfig := c.GetVTapConfig()
+	if vtapConfig == nil || len(vtapConfig.ConvertedDomains) == 0 ||
+		SliceEqual[string](vtapConfig.ConvertedDomains, ALL_DOMAIMS) {
+		return nil
+	}
+	domains := make([]string, 0, len(vtapConfig.ConvertedDomains)+len(c.getPodDomains()))
+	domains = append(domains, vtapConfig.ConvertedDomains...)
+	return append(domains, c.getPodDomains()...)
+}
+
+// 按segment版本生成专属采集器的remote segments
+func (v *VTapInfo) GenerateRemoteSegments() map[uint32][]*trident.Segment {
 	rawData := v.metaData.GetPlatformDataOP().GetRawData()
 	segment := v.metaData.GetPlatformDataOP().GetSegment()
-	allGatewayHostSegments := segment.GetAllGatewayHostSegments()
-	if len(allGatewayHostSegments) > 0 {
-		return allGatewayHostSegments
+	return generateRemoteSegments(segment, rawData)
+}
+
+func generateRemoteSegments(segment *metadata.Segment, rawData *metadata.PlatformRawData) map[uint32][]*trident.Segment {
+	versionToSegments := make(map[uint32][]*trident.Segment, len(metadata.SEGMENT_VERSIONS))
+	if len(segment.GetAllGatewayHostSegments()) > 0 {
+		for _, version := range metadata.SEGMENT_VERSIONS {
+			versionToSegments[version] = segment.GetGatewayHostSegmentsByVersion(version)
+		}
+		return versionToSegments
 	}
 	segment.GenerateNoVTapUsedSegments(rawData)
-	return segment.GetNotVtapUsedSegments()
+	notVtapUsedSegments := segment.GetNotVtapUsedSegments()
+	notVtapUsedSegmentsV6 := segment.GetNotVtapUsedSegmentsV6()
+	remoteSegments := make([]*trident.Segment, 0, len(notVtapUsedSegments)+len(notVtapUsedSegmentsV6))
+	remoteSegments = append(remoteSegments, notVtapUsedSegments...)
+	remoteSegments = append(remoteSegments, notVtapUsedSegmentsV6...)
+	// 没有采集器覆盖的segment使用固定id，与版本无关
+	for _, version := range metadata.SEGMENT_VERSIONS {
+		versionToSegments[version] = remoteSegments
+	}
+	return versionToSegments
 }
 
 func (v *VTapInfo) GetRemoteSegment(c *VTapCache) []*trident.Segment {
@@ -108,11 +163,29 @@ func (v *VTapInfo) GetRemoteSegment(c *VTapCache) []*trident.Segment {
 		return nil
 	}
 
-	return v.remoteSegments
+	remoteSegments, ok := v.remoteSegments.Load().(map[uint32][]*trident.Segment)
+	if ok {
+		return remoteSegments[c.GetSegmentVersion()]
+	}
+	return nil
+}
+
+// 采集器同步时协商的segment版本变化后，按新版本重新生成该采集器的segments
+func (v *VTapInfo) UpdateVTapSegmentVersion(c *VTapCache, version uint32) {
+	if c.GetSegmentVersion() == version {
+		return
+	}
+	atomic.StoreUint32(&c.segmentVersion, version)
+	localSegments := v.GenerateVTapLocalSegments(c)
+	v.segmentStreams.publishDiff(c.GetKey(), c.GetVTapLocalSegments(), localSegments)
+	c.setVTapLocalSegments(localSegments)
+	c.setVTapRemoteSegments(v.GetRemoteSegment(c))
 }
 
 func (v *VTapInfo) generateAllVTapSegements() {
 	bmDedicatedVTaps := []*VTapCache{}
+	// 整轮下发使用同一个segment及原始数据，期间segment被替换不影响本轮结果
+	rawData := v.metaData.GetPlatformDataOP().GetRawData()
 	segment := v.metaData.GetPlatformDataOP().GetSegment()
 	segment.ClearVTapUsedVInterfaceIDs()
 	cacheKeys := v.vTapCaches.List()
@@ -124,16 +197,17 @@ func (v *VTapInfo) generateAllVTapSegements() {
 		if cacheVTap.GetVTapType() == VTAP_TYPE_DEDICATED {
 			bmDedicatedVTaps = append(bmDedicatedVTaps, cacheVTap)
 		}
-		localSegments := v.GenerateVTapLocalSegments(cacheVTap)
+		localSegments := generateVTapLocalSegments(cacheVTap, segment, rawData.GetPodNodeIDToVmID())
+		v.segmentStreams.publishDiff(cacheKey, cacheVTap.GetVTapLocalSegments(), localSegments)
 		cacheVTap.setVTapLocalSegments(localSegments)
 	}
 
-	remoteSegments := v.GenerateRemoteSegments()
+	remoteSegments := generateRemoteSegments(segment, rawData)
 	// 专属采集器下发本区域所有采集器(除专属采集器)下发的local_segment，作为专属采集器的remote_segment
 	for _, bmVTap := range bmDedicatedVTaps {
-		bmVTap.setVTapRemoteSegments(remoteSegments)
+		bmVTap.setVTapRemoteSegments(remoteSegments[bmVTap.GetSegmentVersion()])
 	}
-	v.remoteSegments = remoteSegments
+	v.remoteSegments.Store(remoteSegments)
 }
 
 func (v *VTapInfo) generateAllVTapRemoteSegements() {
@@ -151,9 +225,9 @@ func (v *VTapInfo) generateAllVTapRemoteSegements() {
 	remoteSegments := v.GenerateRemoteSegments()
 	// 专属采集器下发本区域所有采集器(除专属采集器)下发的local_segment，作为专属采集器的remote_segment
 	for _, bmVTap := range dedicatedVTaps {
-		bmVTap.setVTapRemoteSegments(remoteSegments)
+		bmVTap.setVTapRemoteSegments(remoteSegments[bmVTap.GetSegmentVersion()])
 	}
-	v.remoteSegments = remoteSegments
+	v.remoteSegments.Store(remoteSegments)
 }
 
 func (v *VTapInfo) setVTapChangedForSegment() {
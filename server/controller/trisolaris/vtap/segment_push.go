@@ -0,0 +1,200 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/deepflowio/deepflow/message/trident"
+)
+
+const SEGMENT_STREAM_BUFFER_SIZE = 16
+
+// SegmentStream 订阅某个采集器local segment变化的推送流
+// 缓冲区满时丢弃增量并标记需要全量重新同步
+type SegmentStream struct {
+	ch     chan *trident.SegmentPushResponse
+	mutex  sync.Mutex
+	resync bool
+}
+
+func newSegmentStream(bufferSize int) *SegmentStream {
+	return &SegmentStream{ch: make(chan *trident.SegmentPushResponse, bufferSize)}
+}
+
+func (s *SegmentStream) C() <-chan *trident.SegmentPushResponse {
+	return s.ch
+}
+
+func (s *SegmentStream) send(resp *trident.SegmentPushResponse) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.resync {
+		return
+	}
+	select {
+	case s.ch <- resp:
+	default:
+		s.resync = true
+		// 唤醒消费者进行全量同步
+		for len(s.ch) > 0 {
+			<-s.ch
+		}
+		s.ch <- &trident.SegmentPushResponse{Full: proto.Bool(true)}
+	}
+}
+
+// NeedResync 返回是否因缓冲区溢出需要全量同步，并清除标记
+func (s *SegmentStream) NeedResync() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	resync := s.resync
+	s.resync = false
+	return resync
+}
+
+type SegmentStreamHub struct {
+	mutex sync.RWMutex
+	// key: ctrlIP+ctrlMac
+	keyToStreams map[string]map[*SegmentStream]struct{}
+}
+
+func newSegmentStreamHub() *SegmentStreamHub {
+	return &SegmentStreamHub{keyToStreams: make(map[string]map[*SegmentStream]struct{})}
+}
+
+func (h *SegmentStreamHub) subscribe(key string, bufferSize int) *SegmentStream {
+	stream := newSegmentStream(bufferSize)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if _, ok := h.keyToStreams[key]; !ok {
+		h.keyToStreams[key] = make(map[*SegmentStream]struct{})
+	}
+	h.keyToStreams[key][stream] = struct{}{}
+	return stream
+}
+
+func (h *SegmentStreamHub) unsubscribe(key string, stream *SegmentStream) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if streams, ok := h.keyToStreams[key]; ok {
+		delete(streams, stream)
+		if len(streams) == 0 {
+			delete(h.keyToStreams, key)
+		}
+	}
+}
+
+func (h *SegmentStreamHub) hasSubscriber(key string) bool {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.keyToStreams[key]) > 0
+}
+
+func (h *SegmentStreamHub) publish(key string, resp *trident.SegmentPushResponse) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for stream := range h.keyToStreams[key] {
+		stream.send(resp)
+	}
+}
+
+// 对比新旧local segment，有变化时向订阅该采集器的推送流发送增量
+func (h *SegmentStreamHub) publishDiff(key string, oldSegments, newSegments []*trident.Segment) {
+	if !h.hasSubscriber(key) {
+		return
+	}
+	changed, removedIDs := diffSegments(oldSegments, newSegments)
+	if len(changed) == 0 && len(removedIDs) == 0 {
+		return
+	}
+	h.publish(key, &trident.SegmentPushResponse{
+		Full:                   proto.Bool(false),
+		LocalSegments:          changed,
+		RemovedLocalSegmentIds: removedIDs,
+	})
+}
+
+// 按segment id合并，同一id可能来自launch server和host等多个范围
+func mergeSegmentsByID(segments []*trident.Segment) map[uint32]*trident.Segment {
+	idToSegment := make(map[uint32]*trident.Segment, len(segments))
+	for _, segment := range segments {
+		merged, ok := idToSegment[segment.GetId()]
+		if !ok {
+			merged = &trident.Segment{Id: proto.Uint32(segment.GetId())}
+			idToSegment[segment.GetId()] = merged
+		}
+		merged.Mac = append(merged.Mac, segment.GetMac()...)
+		merged.Vmac = append(merged.Vmac, segment.GetVmac()...)
+		merged.InterfaceId = append(merged.InterfaceId, segment.GetInterfaceId()...)
+	}
+	return idToSegment
+}
+
+func segmentEqual(a, b *trident.Segment) bool {
+	if len(a.GetMac()) != len(b.GetMac()) {
+		return false
+	}
+	macToVIF := make(map[string]uint32, len(a.GetMac()))
+	for i, mac := range a.GetMac() {
+		macToVIF[mac] = a.GetInterfaceId()[i]
+	}
+	for i, mac := range b.GetMac() {
+		if vifID, ok := macToVIF[mac]; !ok || vifID != b.GetInterfaceId()[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func segmentsChanged(oldSegments, newSegments []*trident.Segment) bool {
+	changed, removedIDs := diffSegments(oldSegments, newSegments)
+	return len(changed) > 0 || len(removedIDs) > 0
+}
+
+// 返回新增或变化的segment(同一id合并后整体替换)及被删除的segment id
+func diffSegments(oldSegments, newSegments []*trident.Segment) ([]*trident.Segment, []uint32) {
+	oldIDToSegment := mergeSegmentsByID(oldSegments)
+	newIDToSegment := mergeSegmentsByID(newSegments)
+
+	changed := []*trident.Segment{}
+	for id, newSegment := range newIDToSegment {
+		if oldSegment, ok := oldIDToSegment[id]; !ok || !segmentEqual(oldSegment, newSegment) {
+			changed = append(changed, newSegment)
+		}
+	}
+	removedIDs := []uint32{}
+	for id := range oldIDToSegment {
+		if _, ok := newIDToSegment[id]; !ok {
+			removedIDs = append(removedIDs, id)
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].GetId() < changed[j].GetId() })
+	sort.Slice(removedIDs, func(i, j int) bool { return removedIDs[i] < removedIDs[j] })
+	return changed, removedIDs
+}
+
+func (v *VTapInfo) SubscribeSegments(key string) *SegmentStream {
+	return v.segmentStreams.subscribe(key, SEGMENT_STREAM_BUFFER_SIZE)
+}
+
+func (v *VTapInfo) UnsubscribeSegments(key string, stream *SegmentStream) {
+	v.segmentStreams.unsubscribe(key, stream)
+}
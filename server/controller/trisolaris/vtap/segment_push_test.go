@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/message/trident"
+)
+
+func newTestSegment(id uint32, macs []string, vifIDs []uint32) *trident.Segment {
+	return &trident.Segment{Id: proto.Uint32(id), Mac: macs, Vmac: macs, InterfaceId: vifIDs}
+}
+
+func TestSegmentStreamIncrementalPush(t *testing.T) {
+	hub := newSegmentStreamHub()
+	key := "10.0.0.1-00:00:00:00:00:01"
+	stream := hub.subscribe(key, SEGMENT_STREAM_BUFFER_SIZE)
+
+	oldSegments := []*trident.Segment{
+		newTestSegment(1, []string{"00:00:00:00:01:01"}, []uint32{11}),
+		newTestSegment(2, []string{"00:00:00:00:02:01"}, []uint32{21}),
+		newTestSegment(3, []string{"00:00:00:00:03:01"}, []uint32{31}),
+	}
+	// segment 2 新增一个vif，segment 3 被删除，segment 1 不变
+	newSegments := []*trident.Segment{
+		newTestSegment(1, []string{"00:00:00:00:01:01"}, []uint32{11}),
+		newTestSegment(2, []string{"00:00:00:00:02:01", "00:00:00:00:02:02"}, []uint32{21, 22}),
+	}
+	hub.publishDiff(key, oldSegments, newSegments)
+
+	select {
+	case resp := <-stream.C():
+		assert.False(t, resp.GetFull())
+		if assert.Equal(t, 1, len(resp.GetLocalSegments())) {
+			assert.Equal(t, uint32(2), resp.GetLocalSegments()[0].GetId())
+			assert.ElementsMatch(t, []uint32{21, 22}, resp.GetLocalSegments()[0].GetInterfaceId())
+		}
+		assert.Equal(t, []uint32{3}, resp.GetRemovedLocalSegmentIds())
+	default:
+		t.Fatal("no incremental push received")
+	}
+
+	// 没有变化时不推送
+	hub.publishDiff(key, newSegments, newSegments)
+	assert.Equal(t, 0, len(stream.C()))
+
+	hub.unsubscribe(key, stream)
+	assert.False(t, hub.hasSubscriber(key))
+}
+
+func TestSegmentStreamOverflowResync(t *testing.T) {
+	hub := newSegmentStreamHub()
+	key := "10.0.0.1-00:00:00:00:00:01"
+	stream := hub.subscribe(key, 1)
+
+	segments := []*trident.Segment{}
+	for i := uint32(1); i <= 3; i++ {
+		newSegments := append(segments, newTestSegment(i, []string{fmt.Sprintf("00:00:00:00:00:%02x", i)}, []uint32{i}))
+		hub.publishDiff(key, segments, newSegments)
+		segments = newSegments
+	}
+
+	assert.Equal(t, 1, len(stream.C()))
+	resp := <-stream.C()
+	assert.True(t, resp.GetFull())
+	assert.True(t, stream.NeedResync())
+	assert.False(t, stream.NeedResync())
+}
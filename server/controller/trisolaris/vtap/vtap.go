@@ -89,7 +89,7 @@ type VTapInfo struct {
 	chVTapCacheRefresh chan struct{}
 
 	// 保存remote segment 只有专属采集器有，并且所有专属采集器数据一样
-	remoteSegments []*trident.Segment
+	remoteSegments *atomic.Value // map[uint32][]*trident.Segment
 
 	// vtapregister
 	registerMU        sync.Mutex
@@ -108,6 +108,12 @@ type VTapInfo struct {
 
 	processInfo *ProcessInfo
 	dbVTapIDs   mapset.Set
+
+	// 订阅local segment增量推送的流
+	segmentStreams *SegmentStreamHub
+
+	// 采集器连接状态变化时通知注册的webhook
+	webhookNotifier *vtapWebhookNotifier
 }
 
 func NewVTapInfo(db *gorm.DB, metaData *metadata.MetaData, cfg *config.Config) *VTapInfo {
@@ -145,8 +151,11 @@ func NewVTapInfo(db *gorm.DB, metaData *metadata.MetaData, cfg *config.Config) *
 		db:                             db,
 		config:                         cfg,
 		vTapIPs:                        &atomic.Value{},
+		remoteSegments:                 &atomic.Value{},
 		processInfo:                    NewProcessInfo(db, cfg),
 		dbVTapIDs:                      mapset.NewSet(),
+		segmentStreams:                 newSegmentStreamHub(),
+		webhookNotifier:                newVTapWebhookNotifier(db),
 	}
 }
 
@@ -929,6 +938,7 @@ func (v *VTapInfo) updateCacheToDB() {
 	}
 	hostIP := config.NodeIP
 	updateVTaps := []*models.VTap{}
+	connectionEvents := []*VTapConnectionEvent{}
 	keytoDBVTap := make(map[string]*models.VTap)
 
 	dbVTaps, err := dbmgr.DBMgr[models.VTap](v.db).Gets()
@@ -1014,21 +1024,20 @@ func (v *VTapInfo) updateCacheToDB() {
 
 		cacheVTap.ResetControllerSyncFlag()
 		cacheVTap.ResetTSDBSyncFlag()
-		if (dbVTap.State != VTAP_STATE_PENDING && controller.IP == dbVTap.ControllerIP) || (dbVTap.Type == VTAP_TYPE_TUNNEL_DECAPSULATION && controller.NodeType == CONTROLLER_NODE_TYPE_MASTER) {
+		if (dbVTap.State != VTAP_STATE_PENDING && dbVTap.State != VTAP_STATE_REJECTED && controller.IP == dbVTap.ControllerIP) || (dbVTap.Type == VTAP_TYPE_TUNNEL_DECAPSULATION && controller.NodeType == CONTROLLER_NODE_TYPE_MASTER) {
 			now := time.Now()
 			if now.Sub(cacheVTap.GetCachedAt()).Seconds() < float64(cacheVTap.GetConfigSyncInterval()*2) {
 				// 如果时间差小于同步时间间隔，则认为刚启动,
 				// 或新添加vtap，不进行状态更新
-			} else if now.Sub(vtapSyncedControllerAt).Seconds() > float64(cacheVTap.GetConfigSyncInterval()*8) {
-				if dbVTap.State != VTAP_STATE_NOT_CONNECTED {
-					dbVTap.State = VTAP_STATE_NOT_CONNECTED
+			} else {
+				state := dbVTap.State
+				event := updateVTapConnectionState(dbVTap, now.Sub(vtapSyncedControllerAt).Seconds() > float64(cacheVTap.GetConfigSyncInterval()*8))
+				if dbVTap.State != state {
 					filterFlag = true
-					log.Infof("set vTap (%s) on (%s) to not connected", dbVTap.Name, dbVTap.LaunchServer)
 				}
-			} else if dbVTap.State == VTAP_STATE_NOT_CONNECTED {
-				dbVTap.State = VTAP_STATE_NORMAL
-				filterFlag = true
-				log.Infof("set vTap (%s) on (%s) to normal", dbVTap.Name, dbVTap.LaunchServer)
+				if event != nil {
+					connectionEvents = append(connectionEvents, event)
+				}
 			}
 		}
 
@@ -1042,6 +1051,8 @@ func (v *VTapInfo) updateCacheToDB() {
 		err = vTapmgr.UpdateBulk(updateVTaps)
 		if err != nil {
 			log.Error(err)
+		} else {
+			v.webhookNotifier.notify(connectionEvents)
 		}
 	}
 }
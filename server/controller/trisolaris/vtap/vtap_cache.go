@@ -47,6 +47,7 @@ type VTapConfig struct {
 	ConvertedL7LogStoreTapTypes  []uint32
 	ConvertedDecapType           []uint32
 	ConvertedDomains             []string
+	ConvertedSegmentDeviceTypes  []int
 }
 
 func (f *VTapConfig) convertData() {
@@ -75,6 +76,13 @@ func (f *VTapConfig) convertData() {
 		f.ConvertedDomains = strings.Split(f.Domains, ",")
 	}
 	sort.Strings(f.ConvertedDomains)
+	segmentDeviceTypes, err := ConvertStrToU32List(f.SegmentDeviceTypes)
+	if err != nil {
+		log.Error(err)
+	}
+	for _, deviceType := range segmentDeviceTypes {
+		f.ConvertedSegmentDeviceTypes = append(f.ConvertedSegmentDeviceTypes, int(deviceType))
+	}
 
 	if f.HTTPLogProxyClient == SHUT_DOWN_STR {
 		f.HTTPLogProxyClient = ""
@@ -134,6 +142,7 @@ type VTapCache struct {
 	processName        *string
 	licenseType        int
 	tapMode            int
+	dataQuota          int64
 	lcuuid             *string
 	licenseFunctions   *string
 	licenseFunctionSet mapset.Set
@@ -158,9 +167,14 @@ type VTapCache struct {
 	// Container cluster domain where the vtap is located
 	podDomains []string
 
-	// segments
-	localSegments  []*trident.Segment
-	remoteSegments []*trident.Segment
+	// segments，采集器同步协程与segment生成协程均会更新，setter通过segmentsMutex串行化比较与替换
+	segmentsMutex  sync.Mutex
+	localSegments  *atomic.Value // []*trident.Segment
+	remoteSegments *atomic.Value // []*trident.Segment
+	// 与采集器协商的segment版本，见metadata.SEGMENT_VERSION_*
+	segmentVersion uint32
+	// 下发的local/remote segment内容版本，内容变化时加1，采集器同步时携带上次收到的版本
+	segmentsDataVersion uint64
 
 	// vtap version
 	pushVersionPlatformData uint64
@@ -212,6 +226,7 @@ func NewVTapCache(vtap *models.VTap) *VTapCache {
 	vTapCache.processName = proto.String(vtap.ProcessName)
 	vTapCache.licenseType = vtap.LicenseType
 	vTapCache.tapMode = vtap.TapMode
+	vTapCache.dataQuota = vtap.DataQuota
 	vTapCache.lcuuid = proto.String(vtap.Lcuuid)
 	vTapCache.licenseFunctions = proto.String(vtap.LicenseFunctions)
 	vTapCache.licenseFunctionSet = mapset.NewSet()
@@ -225,8 +240,12 @@ func NewVTapCache(vtap *models.VTap) *VTapCache {
 	vTapCache.cachedAt = time.Now()
 	vTapCache.config = &atomic.Value{}
 	vTapCache.podDomains = []string{}
-	vTapCache.localSegments = []*trident.Segment{}
-	vTapCache.remoteSegments = []*trident.Segment{}
+	vTapCache.localSegments = &atomic.Value{}
+	vTapCache.localSegments.Store([]*trident.Segment{})
+	vTapCache.remoteSegments = &atomic.Value{}
+	vTapCache.remoteSegments.Store([]*trident.Segment{})
+	vTapCache.segmentVersion = metadata.SEGMENT_VERSION_LEGACY
+	vTapCache.segmentsDataVersion = uint64(time.Now().Unix())
 	vTapCache.pushVersionPlatformData = 0
 	vTapCache.pushVersionPolicy = 0
 	vTapCache.pushVersionGroups = 0
@@ -483,6 +502,11 @@ func (c *VTapCache) GetVTapEnabled() int {
 	return c.enable
 }
 
+// IsAwaitingApproval 待审批或已拒绝的采集器仅下发保持连接的配置
+func (c *VTapCache) IsAwaitingApproval() bool {
+	return c.state == VTAP_STATE_PENDING || c.state == VTAP_STATE_REJECTED
+}
+
 func (c *VTapCache) GetVTapHost() string {
 	if c.name != nil {
 		return *c.name
@@ -754,6 +778,27 @@ func (c *VTapCache) updateTapMode(tapMode int) {
 	c.tapMode = tapMode
 }
 
+func (c *VTapCache) GetDataQuota() int64 {
+	return c.dataQuota
+}
+
+// 下发给采集器的发送带宽阈值(bps)，设置了采集器数据配额时不超过配额，0表示不限制
+func (c *VTapCache) GetTxBandwidthThreshold() int64 {
+	var maxTxBandwidth int64
+	if config := c.GetVTapConfig(); config != nil {
+		maxTxBandwidth = config.MaxTxBandwidth
+	}
+	return TxBandwidthThreshold(maxTxBandwidth, c.dataQuota)
+}
+
+// TxBandwidthThreshold 合并采集器组配置的发送带宽与采集器数据配额，取两者中较小的非0值
+func TxBandwidthThreshold(maxTxBandwidth, dataQuota int64) int64 {
+	if dataQuota > 0 && (maxTxBandwidth == 0 || dataQuota < maxTxBandwidth) {
+		return dataQuota
+	}
+	return maxTxBandwidth
+}
+
 func (c *VTapCache) UpdateRevision(revision string) {
 	c.revision = &revision
 }
@@ -858,7 +903,7 @@ func (c *VTapCache) init(v *VTapInfo) {
 }
 
 func (c *VTapCache) modifyVTapCache(v *VTapInfo) {
-	if c.state == VTAP_STATE_PENDING {
+	if c.IsAwaitingApproval() {
 		c.enable = 0
 	}
 	var ok bool
@@ -912,6 +957,9 @@ func (c *VTapCache) initVTapConfig(v *VTapInfo) {
 			realConfig = *v.realDefaultConfig
 		}
 	}
+	if err := c.renderVTapConfigTemplate(&realConfig); err != nil {
+		log.Error(err)
+	}
 	if v.config.BillingMethod == BILLING_METHOD_LICENSE {
 		c.modifyVTapConfigByLicense(&realConfig)
 	}
@@ -934,8 +982,14 @@ func (c *VTapCache) updateVTapConfigFromDB(v *VTapInfo) {
 		if newConfig.Domains != oldConfig.Domains || newConfig.PodClusterInternalIP != oldConfig.PodClusterInternalIP {
 			v.setVTapChangedForPD()
 		}
+		if newConfig.SegmentDeviceTypes != oldConfig.SegmentDeviceTypes {
+			v.setVTapChangedForSegment()
+		}
 	}
 
+	if err := c.renderVTapConfigTemplate(&newConfig); err != nil {
+		log.Error(err)
+	}
 	if v.config.BillingMethod == BILLING_METHOD_LICENSE {
 		c.modifyVTapConfigByLicense(&newConfig)
 	}
@@ -954,10 +1008,14 @@ func (c *VTapCache) updateVTapCacheFromDB(vtap *models.VTap, v *VTapInfo) {
 	c.updateCtrlMacFromDB(vtap.CtrlMac)
 	c.state = vtap.State
 	c.enable = vtap.Enable
+	if c.IsAwaitingApproval() {
+		c.enable = 0
+	}
 	if v.config.BillingMethod == BILLING_METHOD_LICENSE {
 		c.updateLicenseFunctions(vtap.LicenseFunctions)
 	}
 	c.updateTapMode(vtap.TapMode)
+	c.dataQuota = vtap.DataQuota
 	if c.vTapType != vtap.Type {
 		c.vTapType = vtap.Type
 		v.setVTapChangedForSegment()
@@ -1072,19 +1130,82 @@ func (c *VTapCache) GetVTapPlatformData() *metadata.PlatformData {
 }
 
 func (c *VTapCache) setVTapLocalSegments(segments []*trident.Segment) {
-	c.localSegments = segments
+	c.segmentsMutex.Lock()
+	defer c.segmentsMutex.Unlock()
+	changed := segmentsChanged(c.GetVTapLocalSegments(), segments)
+	c.localSegments.Store(segments)
+	if changed {
+		atomic.AddUint64(&c.segmentsDataVersion, 1)
+	}
+}
+
+func (c *VTapCache) GetSegmentVersion() uint32 {
+	return atomic.LoadUint32(&c.segmentVersion)
 }
 
 func (c *VTapCache) GetVTapLocalSegments() []*trident.Segment {
-	return c.localSegments
+	segments, ok := c.localSegments.Load().([]*trident.Segment)
+	if ok {
+		return segments
+	}
+	return nil
 }
 
 func (c *VTapCache) setVTapRemoteSegments(segments []*trident.Segment) {
-	c.remoteSegments = segments
+	c.segmentsMutex.Lock()
+	defer c.segmentsMutex.Unlock()
+	changed := segmentsChanged(c.GetVTapRemoteSegments(), segments)
+	c.remoteSegments.Store(segments)
+	if changed {
+		atomic.AddUint64(&c.segmentsDataVersion, 1)
+	}
 }
 
 func (c *VTapCache) GetVTapRemoteSegments() []*trident.Segment {
-	return c.remoteSegments
+	segments, ok := c.remoteSegments.Load().([]*trident.Segment)
+	if ok {
+		return segments
+	}
+	return nil
+}
+
+func (c *VTapCache) GetSegmentsDataVersion() uint64 {
+	return atomic.LoadUint64(&c.segmentsDataVersion)
+}
+
+// 采集器携带的segment内容版本与当前一致时不返回segments，否则返回全量local/remote segment
+// 先读版本再读segments，并发更新时最多多下发一次全量
+func (c *VTapCache) GetVTapSegmentsSince(version uint64) (localSegments, remoteSegments []*trident.Segment, currentVersion uint64) {
+	currentVersion = c.GetSegmentsDataVersion()
+	if version != 0 && version == currentVersion {
+		return nil, nil, currentVersion
+	}
+	return c.GetVTapLocalSegments(), c.GetVTapRemoteSegments(), currentVersion
+}
+
+// 分批获取segments，limit为0时同GetVTapSegmentsSince；token非空且内容版本未变化时仅返回下一批remote segments，
+// 内容版本已变化或token非法时从第一批重新下发，nextToken为空表示remote segments已下发完毕
+func (c *VTapCache) GetVTapSegmentsPage(version uint64, token string, limit int) (
+	localSegments, remoteSegments []*trident.Segment, currentVersion uint64, nextToken string) {
+	if limit <= 0 {
+		localSegments, remoteSegments, currentVersion = c.GetVTapSegmentsSince(version)
+		return
+	}
+	currentVersion = c.GetSegmentsDataVersion()
+	if token != "" && version == currentVersion {
+		chunk, next, err := metadata.GetSegmentsChunk(c.GetVTapRemoteSegments(), token, limit)
+		if err == nil {
+			return nil, chunk, currentVersion, next
+		}
+		log.Warningf("vtap(%s) get remote segments chunk failed: %s, resend from the first chunk", c.GetKey(), err)
+		version = 0
+	}
+	localSegments, remoteSegments, currentVersion = c.GetVTapSegmentsSince(version)
+	if len(remoteSegments) == 0 {
+		return
+	}
+	remoteSegments, nextToken, _ = metadata.GetSegmentsChunk(remoteSegments, "", limit)
+	return
 }
 
 type VTapCacheMap struct {
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/message/trident"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+func TestGetTxBandwidthThreshold(t *testing.T) {
+	newCache := func(maxTxBandwidth, dataQuota int64) *VTapCache {
+		c := &VTapCache{config: &atomic.Value{}, dataQuota: dataQuota}
+		c.updateVTapConfig(&VTapConfig{RVTapGroupConfiguration: models.RVTapGroupConfiguration{MaxTxBandwidth: maxTxBandwidth}})
+		return c
+	}
+	testCases := []struct {
+		maxTxBandwidth int64
+		dataQuota      int64
+		want           int64
+	}{
+		{0, 0, 0},
+		{1000, 0, 1000},
+		{0, 500, 500},
+		{1000, 500, 500},
+		{1000, 2000, 1000},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, newCache(tc.maxTxBandwidth, tc.dataQuota).GetTxBandwidthThreshold(), "%+v", tc)
+	}
+
+	c := &VTapCache{config: &atomic.Value{}, dataQuota: 500}
+	assert.Equal(t, int64(500), c.GetTxBandwidthThreshold())
+}
+
+func TestGetVTapSegmentsSince(t *testing.T) {
+	c := &VTapCache{segmentsDataVersion: 100, localSegments: &atomic.Value{}, remoteSegments: &atomic.Value{}}
+	segments := []*trident.Segment{newTestSegment(1, []string{"00:00:00:00:00:01"}, []uint32{1})}
+	c.setVTapLocalSegments(segments)
+	version := c.GetSegmentsDataVersion()
+	assert.Equal(t, uint64(101), version)
+
+	// 首次同步不携带版本时下发全量
+	localSegments, _, currentVersion := c.GetVTapSegmentsSince(0)
+	assert.Equal(t, segments, localSegments)
+	assert.Equal(t, version, currentVersion)
+
+	// 平台数据未变化，重新生成的segments内容相同，版本不变且不下发segments
+	c.setVTapLocalSegments([]*trident.Segment{newTestSegment(1, []string{"00:00:00:00:00:01"}, []uint32{1})})
+	localSegments, remoteSegments, currentVersion := c.GetVTapSegmentsSince(version)
+	assert.Nil(t, localSegments)
+	assert.Nil(t, remoteSegments)
+	assert.Equal(t, version, currentVersion)
+
+	// segments变化后返回新版本及全量数据
+	newSegments := append(segments, newTestSegment(2, []string{"00:00:00:00:00:02"}, []uint32{2}))
+	c.setVTapLocalSegments(newSegments)
+	localSegments, _, currentVersion = c.GetVTapSegmentsSince(version)
+	assert.Equal(t, newSegments, localSegments)
+	assert.Greater(t, currentVersion, version)
+
+	remoteSegments = []*trident.Segment{newTestSegment(3, []string{"00:00:00:00:00:03"}, []uint32{3})}
+	c.setVTapRemoteSegments(remoteSegments)
+	_, gotRemoteSegments, remoteVersion := c.GetVTapSegmentsSince(currentVersion)
+	assert.Equal(t, remoteSegments, gotRemoteSegments)
+	assert.Greater(t, remoteVersion, currentVersion)
+}
+
+func TestGetVTapSegmentsPage(t *testing.T) {
+	c := &VTapCache{localSegments: &atomic.Value{}, remoteSegments: &atomic.Value{}}
+	localSegments := []*trident.Segment{newTestSegment(1, []string{"00:00:00:00:00:01"}, []uint32{1})}
+	remoteSegments := []*trident.Segment{
+		newTestSegment(2, []string{"00:00:00:00:02:01", "00:00:00:00:02:02", "00:00:00:00:02:03"}, []uint32{21, 22, 23}),
+		newTestSegment(3, []string{"00:00:00:00:03:01", "00:00:00:00:03:02"}, []uint32{31, 32}),
+	}
+	c.setVTapLocalSegments(localSegments)
+	c.setVTapRemoteSegments(remoteSegments)
+
+	// 不分批时与GetVTapSegmentsSince一致
+	gotLocal, gotRemote, version, token := c.GetVTapSegmentsPage(0, "", 0)
+	assert.Equal(t, localSegments, gotLocal)
+	assert.Equal(t, remoteSegments, gotRemote)
+	assert.Empty(t, token)
+
+	// 首批包含local segments，后续批次仅包含remote segments，合并后与全量一致
+	gotLocal, chunk, version, token := c.GetVTapSegmentsPage(0, "", 2)
+	assert.Equal(t, localSegments, gotLocal)
+	macs := chunk[0].GetMac()
+	for token != "" {
+		var currentVersion uint64
+		gotLocal, chunk, currentVersion, token = c.GetVTapSegmentsPage(version, token, 2)
+		assert.Nil(t, gotLocal)
+		assert.Equal(t, version, currentVersion)
+		count := 0
+		for _, segment := range chunk {
+			macs = append(macs, segment.GetMac()...)
+			count += len(segment.GetMac())
+		}
+		assert.LessOrEqual(t, count, 2)
+	}
+	assert.Equal(t, []string{
+		"00:00:00:00:02:01", "00:00:00:00:02:02", "00:00:00:00:02:03", "00:00:00:00:03:01", "00:00:00:00:03:02",
+	}, macs)
+
+	// 分批过程中segments变化时从第一批重新下发
+	_, _, _, token = c.GetVTapSegmentsPage(version, "", 2)
+	assert.Empty(t, token)
+	_, _, _, token = c.GetVTapSegmentsPage(0, "", 2)
+	c.setVTapLocalSegments(append(localSegments, newTestSegment(4, []string{"00:00:00:00:04:01"}, []uint32{41})))
+	gotLocal, chunk, currentVersion, _ := c.GetVTapSegmentsPage(version, token, 2)
+	assert.Greater(t, currentVersion, version)
+	assert.Len(t, gotLocal, 2)
+	assert.Equal(t, []string{"00:00:00:00:02:01", "00:00:00:00:02:02"}, chunk[0].GetMac())
+
+	// token非法时同样从第一批重新下发
+	gotLocal, chunk, _, _ = c.GetVTapSegmentsPage(currentVersion, "invalid", 2)
+	assert.Len(t, gotLocal, 2)
+	assert.Equal(t, []string{"00:00:00:00:02:01", "00:00:00:00:02:02"}, chunk[0].GetMac())
+}
+
+// 采集器同步协程与segment生成协程并发更新segments，需配合-race运行
+func TestSetVTapSegmentsConcurrently(t *testing.T) {
+	c := &VTapCache{localSegments: &atomic.Value{}, remoteSegments: &atomic.Value{}}
+	segments := [][]*trident.Segment{
+		{newTestSegment(1, []string{"00:00:00:00:00:01"}, []uint32{1})},
+		{newTestSegment(2, []string{"00:00:00:00:00:02"}, []uint32{2})},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.setVTapLocalSegments(segments[(i+j)%2])
+				c.setVTapRemoteSegments(segments[(i+j+1)%2])
+				c.GetVTapSegmentsSince(0)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 每次内容变化都会增加版本，最终内容与版本对应
+	version := c.GetSegmentsDataVersion()
+	c.setVTapLocalSegments(c.GetVTapLocalSegments())
+	assert.Equal(t, version, c.GetSegmentsDataVersion())
+	assert.NotZero(t, version)
+}
@@ -26,6 +26,7 @@ import (
 
 	. "github.com/deepflowio/deepflow/server/controller/common"
 	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	monitorconfig "github.com/deepflowio/deepflow/server/controller/monitor/config"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/dbmgr"
 	"github.com/deepflowio/deepflow/server/controller/trisolaris/utils"
 	. "github.com/deepflowio/deepflow/server/controller/trisolaris/utils"
@@ -37,6 +38,7 @@ type VTapRegister struct {
 	defaultVTapGroup      string
 	vTapAutoRegister      bool
 	agentUniqueIdentifier int
+	monitorCfg            monitorconfig.MonitorConfig
 	VTapLKData
 }
 
@@ -164,6 +166,7 @@ func (r *VTapRegister) insertToDB(dbVTap *models.VTap, db *gorm.DB) bool {
 		dbVTap.State = VTAP_STATE_NORMAL
 	}
 	err = db.Transaction(func(tx *gorm.DB) error {
+		dbVTap.LicenseType = GetVTapDefaultLicenseType(tx, dbVTap, r.monitorCfg)
 		if err := tx.Create(dbVTap).Error; err != nil {
 			log.Errorf("insert agent(%s) to DB faild, err: %s", r, err)
 			return err
@@ -875,6 +878,7 @@ func (r *VTapRegister) registerVTap(v *VTapInfo, done func()) {
 	r.region = v.getRegion()
 	r.defaultVTapGroup = v.getDefaultVTapGroup()
 	r.vTapAutoRegister = v.getVTapAutoRegister()
+	r.monitorCfg = v.config.MonitorCfg
 	log.Infof("register vtap: %s", r)
 	var vtap *models.VTap
 	ok := false
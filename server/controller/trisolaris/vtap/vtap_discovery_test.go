@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	. "github.com/deepflowio/deepflow/server/controller/common"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+	monitorconfig "github.com/deepflowio/deepflow/server/controller/monitor/config"
+)
+
+const TEST_VTAP_DISCOVERY_DB_FILE = "vtap_discovery_test.db"
+
+func newTestVTapDiscoveryDB(t *testing.T) *gorm.DB {
+	os.Remove(TEST_VTAP_DISCOVERY_DB_FILE)
+	db, err := gorm.Open(
+		sqlite.Open(TEST_VTAP_DISCOVERY_DB_FILE),
+		&gorm.Config{NamingStrategy: schema.NamingStrategy{SingularTable: true}},
+	)
+	if err != nil {
+		t.Fatalf("create sqlite database failed: %s", err)
+	}
+	db.AutoMigrate(&models.VTap{})
+	t.Cleanup(func() { os.Remove(TEST_VTAP_DISCOVERY_DB_FILE) })
+	return db
+}
+
+func TestInsertToDBDefaultLicenseType(t *testing.T) {
+	db := newTestVTapDiscoveryDB(t)
+	r := newVTapRegister(TAPMODE_LOCAL, "10.0.0.1", "00:00:00:00:00:01", nil, "host-1", "", AGENT_IDENTIFIE_IP_AND_MAC)
+	r.monitorCfg = monitorconfig.MonitorConfig{
+		VTapDefaultLicenseTypes: map[int]int{VTAP_TYPE_KVM: VTAP_LICENSE_TYPE_A},
+		VTapLicenseLimit:        monitorconfig.VTapLicenseLimit{TypeA: 1},
+	}
+	newDBVTap := func(name string, vtapType int) *models.VTap {
+		return &models.VTap{Name: name, Type: vtapType, CtrlIP: name, Lcuuid: uuid.NewString()}
+	}
+
+	vtap1 := newDBVTap("vtap-1", VTAP_TYPE_KVM)
+	assert.True(t, r.insertToDB(vtap1, db))
+	assert.Equal(t, VTAP_LICENSE_TYPE_A, vtap1.LicenseType)
+
+	// 未配置默认授权的采集器类型不分配
+	vtap2 := newDBVTap("vtap-2", VTAP_TYPE_DEDICATED)
+	assert.True(t, r.insertToDB(vtap2, db))
+	assert.Equal(t, VTAP_LICENSE_TYPE_NONE, vtap2.LicenseType)
+
+	// 授权已达到上限时仍注册采集器，但不分配授权
+	vtap3 := newDBVTap("vtap-3", VTAP_TYPE_KVM)
+	assert.True(t, r.insertToDB(vtap3, db))
+	assert.Equal(t, VTAP_LICENSE_TYPE_NONE, vtap3.LicenseType)
+
+	var count int64
+	db.Model(&models.VTap{}).Where("license_type = ?", VTAP_LICENSE_TYPE_A).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+
+	. "github.com/deepflowio/deepflow/server/controller/common"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+const (
+	VTAP_EVENT_DISCONNECTED = "vtap_disconnected"
+	VTAP_EVENT_RECONNECTED  = "vtap_reconnected"
+
+	VTAP_WEBHOOK_EVENT_HEADER     = "X-DeepFlow-Event"
+	VTAP_WEBHOOK_SIGNATURE_HEADER = "X-DeepFlow-Signature"
+
+	vtapWebhookTimeout       = 5 * time.Second
+	vtapWebhookRetries       = 3
+	vtapWebhookRetryInterval = time.Second
+)
+
+// VTapConnectionEvent 采集器连接状态变化时推送给webhook的事件
+type VTapConnectionEvent struct {
+	Event        string `json:"EVENT"`
+	VTapName     string `json:"VTAP_NAME"`
+	VTapLcuuid   string `json:"VTAP_LCUUID"`
+	CtrlIP       string `json:"CTRL_IP"`
+	CtrlMac      string `json:"CTRL_MAC"`
+	LaunchServer string `json:"LAUNCH_SERVER"`
+	State        int    `json:"STATE"`
+	Time         int64  `json:"TIME"`
+}
+
+// 按心跳超时与否更新采集器连接状态，状态变化时返回对应的事件，维护中的采集器仅更新状态不返回事件
+func updateVTapConnectionState(dbVTap *models.VTap, lost bool) *VTapConnectionEvent {
+	var event string
+	if lost {
+		if dbVTap.State == VTAP_STATE_NOT_CONNECTED {
+			return nil
+		}
+		dbVTap.State = VTAP_STATE_NOT_CONNECTED
+		event = VTAP_EVENT_DISCONNECTED
+		log.Infof("set vTap (%s) on (%s) to not connected", dbVTap.Name, dbVTap.LaunchServer)
+	} else {
+		if dbVTap.State != VTAP_STATE_NOT_CONNECTED {
+			return nil
+		}
+		dbVTap.State = VTAP_STATE_NORMAL
+		event = VTAP_EVENT_RECONNECTED
+		log.Infof("set vTap (%s) on (%s) to normal", dbVTap.Name, dbVTap.LaunchServer)
+	}
+	if dbVTap.Maintenance {
+		return nil
+	}
+	return &VTapConnectionEvent{
+		Event:        event,
+		VTapName:     dbVTap.Name,
+		VTapLcuuid:   dbVTap.Lcuuid,
+		CtrlIP:       dbVTap.CtrlIP,
+		CtrlMac:      dbVTap.CtrlMac,
+		LaunchServer: dbVTap.LaunchServer,
+		State:        dbVTap.State,
+		Time:         time.Now().Unix(),
+	}
+}
+
+// 使用secret对body做HMAC-SHA256签名，接收方用相同secret校验
+func signVTapWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type vtapWebhookNotifier struct {
+	getWebhooks   func() ([]*models.VTapWebhook, error)
+	client        *http.Client
+	retries       int
+	retryInterval time.Duration
+}
+
+func newVTapWebhookNotifier(db *gorm.DB) *vtapWebhookNotifier {
+	return &vtapWebhookNotifier{
+		getWebhooks: func() ([]*models.VTapWebhook, error) {
+			var webhooks []*models.VTapWebhook
+			err := db.Find(&webhooks).Error
+			return webhooks, err
+		},
+		client:        &http.Client{Timeout: vtapWebhookTimeout},
+		retries:       vtapWebhookRetries,
+		retryInterval: vtapWebhookRetryInterval,
+	}
+}
+
+// 异步向所有webhook推送事件，每个webhook按事件顺序推送，不阻塞心跳处理
+func (n *vtapWebhookNotifier) notify(events []*VTapConnectionEvent) {
+	if len(events) == 0 {
+		return
+	}
+	webhooks, err := n.getWebhooks()
+	if err != nil {
+		log.Errorf("get vtap webhooks failed: %s", err)
+		return
+	}
+	for _, webhook := range webhooks {
+		go func(webhook *models.VTapWebhook) {
+			for _, event := range events {
+				if err := n.send(webhook, event); err != nil {
+					log.Warningf("notify webhook (%s) of %s (%s) failed: %s", webhook.Name, event.Event, event.VTapName, err)
+				}
+			}
+		}(webhook)
+	}
+}
+
+// 推送失败或返回5xx时重试，返回4xx时不重试
+func (n *vtapWebhookNotifier) send(webhook *models.VTapWebhook, event *VTapConnectionEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(webhook, event.Event, body)
+		if err == nil || !retry || attempt >= n.retries {
+			return err
+		}
+		time.Sleep(n.retryInterval * time.Duration(attempt+1))
+	}
+}
+
+// 返回推送失败时是否可重试
+func (n *vtapWebhookNotifier) post(webhook *models.VTapWebhook, event string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(VTAP_WEBHOOK_EVENT_HEADER, event)
+	if webhook.Secret != "" {
+		req.Header.Set(VTAP_WEBHOOK_SIGNATURE_HEADER, signVTapWebhookBody(webhook.Secret, body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("response status code %d", resp.StatusCode)
+	}
+	return false, nil
+}
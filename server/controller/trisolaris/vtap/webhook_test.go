@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package vtap
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/deepflowio/deepflow/server/controller/common"
+	models "github.com/deepflowio/deepflow/server/controller/db/mysql"
+)
+
+func newTestWebhookNotifier(webhooks ...*models.VTapWebhook) *vtapWebhookNotifier {
+	return &vtapWebhookNotifier{
+		getWebhooks:   func() ([]*models.VTapWebhook, error) { return webhooks, nil },
+		client:        &http.Client{Timeout: time.Second},
+		retries:       vtapWebhookRetries,
+		retryInterval: time.Millisecond,
+	}
+}
+
+func TestUpdateVTapConnectionState(t *testing.T) {
+	dbVTap := &models.VTap{Name: "vtap", State: VTAP_STATE_NORMAL}
+	assert.Nil(t, updateVTapConnectionState(dbVTap, false))
+
+	event := updateVTapConnectionState(dbVTap, true)
+	assert.Equal(t, VTAP_EVENT_DISCONNECTED, event.Event)
+	assert.Equal(t, VTAP_STATE_NOT_CONNECTED, dbVTap.State)
+	assert.Nil(t, updateVTapConnectionState(dbVTap, true))
+
+	event = updateVTapConnectionState(dbVTap, false)
+	assert.Equal(t, VTAP_EVENT_RECONNECTED, event.Event)
+	assert.Equal(t, VTAP_STATE_NORMAL, dbVTap.State)
+}
+
+func TestUpdateVTapConnectionStateInMaintenance(t *testing.T) {
+	// 维护中的采集器仍更新连接状态，但不产生断连/重连事件
+	dbVTap := &models.VTap{Name: "vtap", State: VTAP_STATE_NORMAL, Maintenance: true}
+	assert.Nil(t, updateVTapConnectionState(dbVTap, true))
+	assert.Equal(t, VTAP_STATE_NOT_CONNECTED, dbVTap.State)
+	assert.Nil(t, updateVTapConnectionState(dbVTap, false))
+	assert.Equal(t, VTAP_STATE_NORMAL, dbVTap.State)
+}
+
+func TestVTapWebhookNotify(t *testing.T) {
+	var requests int32
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次返回5xx，之后成功
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	dbVTap := &models.VTap{Name: "vtap", Lcuuid: "vtap-lcuuid", CtrlIP: "10.0.0.1", State: VTAP_STATE_NORMAL}
+	event := updateVTapConnectionState(dbVTap, true)
+	n := newTestWebhookNotifier(&models.VTapWebhook{Name: "hook", URL: server.URL, Secret: "secret"})
+	n.notify([]*VTapConnectionEvent{event})
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+		assert.Equal(t, VTAP_EVENT_DISCONNECTED, r.Header.Get(VTAP_WEBHOOK_EVENT_HEADER))
+		assert.Equal(t, signVTapWebhookBody("secret", body), r.Header.Get(VTAP_WEBHOOK_SIGNATURE_HEADER))
+		var got VTapConnectionEvent
+		assert.Nil(t, json.Unmarshal(body, &got))
+		assert.Equal(t, *event, got)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not received")
+	}
+}
+
+func TestVTapWebhookNoRetryOn4xx(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		assert.Empty(t, r.Header.Get(VTAP_WEBHOOK_SIGNATURE_HEADER))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	n := newTestWebhookNotifier()
+	err := n.send(&models.VTapWebhook{Name: "hook", URL: server.URL}, &VTapConnectionEvent{Event: VTAP_EVENT_RECONNECTED})
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
@@ -33,6 +33,14 @@ var log = logging.MustGetLogger("config")
 const (
 	DefaultESHostPort      = "elasticsearch:20042"
 	DefaultSyslogDirectory = "/var/log/deepflow-agent"
+
+	DefaultSyslogMaxOpenFiles     = 1024
+	DefaultSyslogCompressionCodec = "gzip"
+	DefaultSyslogFileLayout       = "flat"
+
+	DefaultESSyslogRequestTimeout = 10 // 秒
+	DefaultESSyslogMaxIdleConns   = 4
+	DefaultSyslogHostnameCacheTTL = 300 // 秒
 )
 
 type ESAuth struct {
@@ -41,17 +49,37 @@ type ESAuth struct {
 }
 
 type Config struct {
-	Base            *config.Config
-	ESHostPorts     []string      `yaml:"es-host-port"`
-	ESAuth          ESAuth        `yaml:"es-auth"`
-	Adapter         AdapterConfig `yaml:"adapter"`
-	Labeler         LabelerConfig `yaml:"labeler"`
-	Queue           QueueConfig   `yaml:"queue"`
-	RpcTimeout      time.Duration `yaml:"rpc-timeout"`
-	PCap            PCapConfig    `yaml:"pcap"`
-	AgentLogToFile  bool          `yaml:"agent-log-to-file"`
-	SyslogDirectory string        `yaml:"syslog-directory"`
-	ESSyslog        bool          `yaml:"es-syslog"`
+	Base                   *config.Config
+	ESHostPorts            []string          `yaml:"es-host-port"`
+	ESAuth                 ESAuth            `yaml:"es-auth"`
+	Adapter                AdapterConfig     `yaml:"adapter"`
+	Labeler                LabelerConfig     `yaml:"labeler"`
+	Queue                  QueueConfig       `yaml:"queue"`
+	RpcTimeout             time.Duration     `yaml:"rpc-timeout"`
+	PCap                   PCapConfig        `yaml:"pcap"`
+	AgentLogToFile         bool              `yaml:"agent-log-to-file"`
+	SyslogDirectory        string            `yaml:"syslog-directory"`
+	ESSyslog               bool              `yaml:"es-syslog"`
+	ESSyslogIndex          string            `yaml:"es-syslog-index"`
+	ESSyslogGzip           bool              `yaml:"es-syslog-gzip"`
+	ESSyslogRequestTimeout int               `yaml:"es-syslog-request-timeout"`
+	ESSyslogMaxIdleConns   int               `yaml:"es-syslog-max-idle-conns"`
+	ESSyslogRouting        string            `yaml:"es-syslog-routing"`
+	ESSyslogWALMaxDocs     int               `yaml:"es-syslog-wal-max-docs"`
+	SyslogRateLimit        int               `yaml:"syslog-rate-limit"`
+	SyslogLevelMapping     map[string]string `yaml:"syslog-level-mapping"`
+	SyslogMaxOpenFiles     int               `yaml:"syslog-max-open-files"`
+	SyslogRecentLogs       int               `yaml:"syslog-recent-logs"`
+	SyslogSinkBufferSize   int               `yaml:"syslog-sink-buffer-size"`
+	SyslogSyncOnFlush      bool              `yaml:"syslog-sync-on-flush"`
+	SyslogCompressionCodec string            `yaml:"syslog-compression-codec"`
+	SyslogFileLayout       string            `yaml:"syslog-file-layout"`
+	SyslogResolveHostname  bool              `yaml:"syslog-resolve-hostname"`
+	SyslogHostnameCacheTTL int               `yaml:"syslog-hostname-cache-ttl"`
+	SyslogParseErrorLog    bool              `yaml:"syslog-parse-error-log"`
+	SyslogBundlePort       int               `yaml:"syslog-bundle-port"`
+	SyslogBundleAddress    string            `yaml:"syslog-bundle-listen-address"`
+	SyslogPurgeEnabled     bool              `yaml:"syslog-purge-enabled"`
 }
 
 type DropletConfig struct {
@@ -157,6 +185,55 @@ func (c *Config) Validate() error {
 	if c.SyslogDirectory == "" {
 		c.SyslogDirectory = DefaultSyslogDirectory
 	}
+	if c.ESSyslogRequestTimeout <= 0 {
+		c.ESSyslogRequestTimeout = DefaultESSyslogRequestTimeout
+	}
+	if c.ESSyslogMaxIdleConns <= 0 {
+		c.ESSyslogMaxIdleConns = DefaultESSyslogMaxIdleConns
+	}
+	if c.ESSyslogWALMaxDocs < 0 {
+		c.ESSyslogWALMaxDocs = 0
+	}
+	switch c.ESSyslogRouting {
+	case "", "host", "ip":
+	default:
+		log.Warningf("invalid es-syslog-routing %s, disable routing", c.ESSyslogRouting)
+		c.ESSyslogRouting = ""
+	}
+	if c.SyslogHostnameCacheTTL <= 0 {
+		c.SyslogHostnameCacheTTL = DefaultSyslogHostnameCacheTTL
+	}
+	if c.SyslogRateLimit < 0 {
+		c.SyslogRateLimit = 0
+	}
+	if c.SyslogMaxOpenFiles <= 0 {
+		c.SyslogMaxOpenFiles = DefaultSyslogMaxOpenFiles
+	}
+	if c.SyslogRecentLogs < 0 {
+		c.SyslogRecentLogs = 0
+	}
+	if c.SyslogSinkBufferSize < 0 {
+		c.SyslogSinkBufferSize = 0
+	}
+	if c.SyslogBundlePort < 0 {
+		c.SyslogBundlePort = 0
+	}
+	switch c.SyslogCompressionCodec {
+	case "gzip", "zstd", "none":
+	case "":
+		c.SyslogCompressionCodec = DefaultSyslogCompressionCodec
+	default:
+		log.Warningf("invalid syslog-compression-codec %s, use %s", c.SyslogCompressionCodec, DefaultSyslogCompressionCodec)
+		c.SyslogCompressionCodec = DefaultSyslogCompressionCodec
+	}
+	switch c.SyslogFileLayout {
+	case "flat", "date":
+	case "":
+		c.SyslogFileLayout = DefaultSyslogFileLayout
+	default:
+		log.Warningf("invalid syslog-file-layout %s, use %s", c.SyslogFileLayout, DefaultSyslogFileLayout)
+		c.SyslogFileLayout = DefaultSyslogFileLayout
+	}
 	return nil
 }
 
@@ -72,7 +72,7 @@ func Start(cfg *config.Config, recv *receiver.Receiver) (closers []io.Closer) {
 	recv.RegistHandler(datatype.MESSAGE_TYPE_SYSLOG, syslogRecvQueues, 1)
 	recv.RegistHandler(datatype.MESSAGE_TYPE_COMPRESS, compressedPacketRecvQueues, 1)
 
-	syslog.NewSyslogWriter(syslogRecvQueues.Readers()[0], cfg.AgentLogToFile, cfg.ESSyslog, cfg.SyslogDirectory, cfg.ESHostPorts, cfg.ESAuth.User, cfg.ESAuth.Password)
+	syslog.NewSyslogWriter(syslogRecvQueues.Readers()[0], cfg)
 
 	releaseMetaPacketBlock := func(x interface{}) {
 		datatype.ReleaseMetaPacketBlock(x.(*datatype.MetaPacketBlock))
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// 输出缓冲占用百分比达到高水位时开启背压，降到低水位以下时解除
+	BACKPRESSURE_HIGH_WATER = 80
+	BACKPRESSURE_LOW_WATER  = 50
+
+	_BACKPRESSURE_SLEEP = 10 * time.Millisecond
+	// 每批数据最多等待的时间，保证flush等消息仍能被及时处理
+	_BACKPRESSURE_MAX_WAIT = time.Second
+)
+
+type WriterCounter struct {
+	PressureLevel     uint64 `statsd:"pressure_level"` // 输出缓冲最大占用百分比
+	Backpressure      uint64 `statsd:"backpressure"`   // 1表示处于背压状态
+	BackpressureTrips uint64 `statsd:"backpressure_trips"`
+	BackpressureWaits uint64 `statsd:"backpressure_wait_ms"`
+	ESWALDropped      uint64 `statsd:"es_wal_dropped"`     // ES WAL写满后丢弃的文档数
+	ESConnected       uint64 `statsd:"es_connected"`       // 1表示已连接ES
+	ESPendingDropped  uint64 `statsd:"es_pending_dropped"` // 未连接ES且缓存已满时丢弃的日志数
+	OpenFiles         uint64 `statsd:"open_files"`         // 当前打开的日志文件数，即有活跃写入的采集器IP数
+	FileRotations     uint64 `statsd:"file_rotations"`
+	FileEvictions     uint64 `statsd:"file_evictions"` // 打开文件数达到上限时关闭的文件数
+}
+
+// 返回文件/ES输出缓冲中较高的占用百分比，同步写入时为0
+func (w *syslogWriter) pressureLevel() uint64 {
+	level := uint64(0)
+	for _, sink := range []*asyncSink{w.fileSink, w.esSink} {
+		if sink == nil || cap(sink.ch) == 0 {
+			continue
+		}
+		if l := uint64(len(sink.ch) * 100 / cap(sink.ch)); l > level {
+			level = l
+		}
+	}
+	return level
+}
+
+// 根据当前缓冲占用更新背压状态，返回是否处于背压
+func (w *syslogWriter) updatePressure() bool {
+	level := w.pressureLevel()
+	atomic.StoreUint64(&w.pressure, level)
+	if level >= BACKPRESSURE_HIGH_WATER {
+		if atomic.CompareAndSwapUint32(&w.backpressure, 0, 1) {
+			atomic.AddUint64(&w.backpressureTrips, 1)
+			log.Warningf("syslog writer backpressure on, buffer usage %d%%", level)
+		}
+	} else if level < BACKPRESSURE_LOW_WATER {
+		if atomic.CompareAndSwapUint32(&w.backpressure, 1, 0) {
+			log.Infof("syslog writer backpressure off, buffer usage %d%%", level)
+		}
+	}
+	return atomic.LoadUint32(&w.backpressure) == 1
+}
+
+// 背压时暂停从队列读取，使上游队列积压并由接收端流控/丢弃，而不是在输出缓冲无感知地丢弃
+func (w *syslogWriter) throttle() {
+	start := time.Now()
+	for w.updatePressure() {
+		if time.Since(start) >= _BACKPRESSURE_MAX_WAIT {
+			break
+		}
+		time.Sleep(_BACKPRESSURE_SLEEP)
+	}
+	if waited := time.Since(start); waited >= _BACKPRESSURE_SLEEP {
+		atomic.AddUint64(&w.backpressureWaits, uint64(waited/time.Millisecond))
+	}
+}
+
+func (w *syslogWriter) GetCounter() interface{} {
+	esConnected := uint64(0)
+	if w.esLogger.Connected() {
+		esConnected = 1
+	}
+	return &WriterCounter{
+		PressureLevel:     atomic.LoadUint64(&w.pressure),
+		Backpressure:      uint64(atomic.LoadUint32(&w.backpressure)),
+		BackpressureTrips: atomic.SwapUint64(&w.backpressureTrips, 0),
+		BackpressureWaits: atomic.SwapUint64(&w.backpressureWaits, 0),
+		ESWALDropped:      w.esLogger.WALDropped(),
+		ESConnected:       esConnected,
+		ESPendingDropped:  w.esLogger.PendingDropped(),
+		OpenFiles:         atomic.LoadUint64(&w.openFiles),
+		FileRotations:     atomic.SwapUint64(&w.fileRotations, 0),
+		FileEvictions:     atomic.SwapUint64(&w.fileEvictions, 0),
+	}
+}
+
+func (w *syslogWriter) Closed() bool {
+	return false
+}
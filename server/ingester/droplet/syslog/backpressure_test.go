@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackpressureTripsAndClears(t *testing.T) {
+	w := &syslogWriter{}
+	release := make(chan struct{})
+	w.esSink = newAsyncSink("es", 10, func(_ net.IP, _ []byte) { <-release })
+
+	ip := net.ParseIP("10.0.0.1")
+	// 第一条被写入goroutine取走并阻塞，其余留在缓冲中
+	w.esSink.put(ip, []byte("line"))
+	assert.Eventually(t, func() bool { return len(w.esSink.ch) == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 7; i++ {
+		w.esSink.put(ip, []byte("line"))
+		assert.False(t, w.updatePressure())
+	}
+	w.esSink.put(ip, []byte("line"))
+	assert.Eventually(t, w.updatePressure, time.Second, time.Millisecond)
+	counter := w.GetCounter().(*WriterCounter)
+	assert.Equal(t, uint64(1), counter.Backpressure)
+	assert.Equal(t, uint64(1), counter.BackpressureTrips)
+	assert.True(t, counter.PressureLevel >= BACKPRESSURE_HIGH_WATER)
+
+	close(release)
+	assert.Eventually(t, func() bool { return !w.updatePressure() }, time.Second, time.Millisecond)
+	w.throttle()
+	counter = w.GetCounter().(*WriterCounter)
+	assert.Equal(t, uint64(0), counter.Backpressure)
+	assert.Equal(t, uint64(0), counter.BackpressureTrips)
+	w.esSink.close()
+}
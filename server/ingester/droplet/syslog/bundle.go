@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_BUNDLE_PATH         = "/v1/syslog/bundle/"
+	_BUNDLE_DEFAULT_DAYS = 1
+	_BUNDLE_DATE_FORMAT  = "2006-01-02"
+)
+
+// 打包时选取的日志文件: 当前文件<ip>.log及最近days天(含今天)内按天切分的文件
+// <ip>.log是指向当天文件的软链接，当天文件只以<ip>.log的名字打包一次；
+// 按日期分目录时选取最近days天目录中的文件
+func bundleFilesOf(directory, layout, key string, days int, now time.Time) ([]string, error) {
+	files, err := logFilesOf(directory, layout, key)
+	if err != nil {
+		return nil, err
+	}
+	year, month, day := now.Date()
+	cutoff := time.Date(year, month, day-days+1, 0, 0, 0, 0, now.Location())
+	selected := []string{}
+	if layout == SYSLOG_LAYOUT_DATE {
+		for _, file := range files {
+			if date, ok := dateOfLogDir(directory, filepath.Dir(file), now.Location()); ok && !date.Before(cutoff) {
+				selected = append(selected, file)
+			}
+		}
+		return selected, nil
+	}
+	base := key + ".log"
+	current := ""
+	if linked, err := os.Readlink(filepath.Join(directory, base)); err == nil {
+		current = filepath.Base(linked)
+	}
+	for _, file := range files {
+		name := filepath.Base(file)
+		if name == base {
+			selected = append(selected, file)
+			continue
+		}
+		if name == current {
+			continue
+		}
+		suffix := strings.TrimPrefix(name, base+".")
+		if len(suffix) < len(_BUNDLE_DATE_FORMAT) {
+			continue
+		}
+		date, err := time.ParseInLocation(_BUNDLE_DATE_FORMAT, suffix[:len(_BUNDLE_DATE_FORMAT)], now.Location())
+		if err != nil || date.Before(cutoff) {
+			continue
+		}
+		selected = append(selected, file)
+	}
+	return selected, nil
+}
+
+// 文件在包中的名字为相对directory的路径，按日期分目录时保留日期目录
+func addBundleFile(tw *tar.Writer, directory, file string) error {
+	name, err := filepath.Rel(directory, file)
+	if err != nil {
+		name = filepath.Base(file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:    filepath.ToSlash(name),
+		Mode:    0644,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	// 当前文件打包期间可能仍在写入，只读取Stat时的长度
+	_, err = io.CopyN(tw, f, info.Size())
+	return err
+}
+
+// 将files打包为tar.gz写入w
+func writeBundle(w io.Writer, directory string, files []string) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		if err := addBundleFile(tw, directory, file); err != nil {
+			return fmt.Errorf("add %s to bundle failed: %v", file, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// 打包前将ip对应文件缓冲中的日志写入磁盘
+func (w *syslogWriter) flushFile(key string) {
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	if writer, ok := w.fileMap[key]; ok {
+		writer.fileBuffer.Flush()
+	}
+}
+
+// GET /v1/syslog/bundle/?ip=<ip>&days=<days>，返回ip对应日志文件的tar.gz
+func (w *syslogWriter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !w.logToFileEnabled {
+		http.Error(rw, "syslog file logging is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	ip := net.ParseIP(r.URL.Query().Get("ip"))
+	if ip == nil {
+		http.Error(rw, "invalid ip: "+r.URL.Query().Get("ip"), http.StatusBadRequest)
+		return
+	}
+	days := _BUNDLE_DEFAULT_DAYS
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		if days, err = strconv.Atoi(value); err != nil || days < 1 {
+			http.Error(rw, "invalid days: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+
+	key := ip.String()
+	w.flushFile(key)
+	files, err := bundleFilesOf(w.directory, w.fileLayout, key, days, timeNow())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(files) == 0 {
+		http.Error(rw, "no syslog files for "+key, http.StatusNotFound)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/gzip")
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar.gz", key))
+	// 响应头已发出，出错时只能中断传输
+	if err := writeBundle(rw, w.directory, files); err != nil {
+		log.Warningf("write syslog bundle of %s failed: %v", key, err)
+	}
+}
+
+// 在address:port上提供日志打包下载，接口没有认证，port为0(默认)时不启动，address为空时监听所有地址
+func (w *syslogWriter) startBundleServer(address string, port int) {
+	if port <= 0 {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(_BUNDLE_PATH, w)
+	addr := net.JoinHostPort(address, strconv.Itoa(port))
+	server := &http.Server{Addr: addr, Handler: mux}
+	log.Infof("start syslog bundle server on http %s", addr)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Warningf("syslog bundle server failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readBundle(t *testing.T, r io.Reader) map[string]string {
+	gr, err := gzip.NewReader(r)
+	assert.Nil(t, err)
+	tr := tar.NewReader(gr)
+	contents := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		data, err := io.ReadAll(tr)
+		assert.Nil(t, err)
+		contents[header.Name] = string(data)
+	}
+	return contents
+}
+
+func TestBundleFilesOf(t *testing.T) {
+	directory := t.TempDir()
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.Local)
+	for _, name := range []string{"10.0.0.1.log.2023-05-10", "10.0.0.1.log.2023-05-09.gz", "10.0.0.1.log.2023-05-01.zst", "10.0.0.10.log.2023-05-10"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(directory, name), []byte(name), 0644))
+	}
+	assert.Nil(t, os.Symlink(filepath.Join(directory, "10.0.0.1.log.2023-05-10"), filepath.Join(directory, "10.0.0.1.log")))
+
+	files, err := bundleFilesOf(directory, SYSLOG_LAYOUT_FLAT, "10.0.0.1", 2, now)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(directory, "10.0.0.1.log"),
+		filepath.Join(directory, "10.0.0.1.log.2023-05-09.gz"),
+	}, files)
+
+	files, err = bundleFilesOf(directory, SYSLOG_LAYOUT_FLAT, "10.0.0.1", 1, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(directory, "10.0.0.1.log")}, files)
+}
+
+func TestServeBundle(t *testing.T) {
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	ip := net.ParseIP("10.0.0.1")
+	w.writeLog(ip, []byte("line 1\n"))
+
+	server := httptest.NewServer(w)
+	defer server.Close()
+
+	// 打包前刷新文件缓冲，未刷新的日志也包含在内
+	resp, err := http.Get(server.URL + _BUNDLE_PATH + "?ip=10.0.0.1")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/gzip", resp.Header.Get("Content-Type"))
+	assert.Equal(t, map[string]string{"10.0.0.1.log": "line 1\n"}, readBundle(t, resp.Body))
+
+	resp, err = http.Get(server.URL + _BUNDLE_PATH + "?ip=10.0.0.2")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + _BUNDLE_PATH + "?ip=10.0.0.1&days=0")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	recorder := httptest.NewRecorder()
+	(&syslogWriter{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, _BUNDLE_PATH+"?ip=10.0.0.1", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
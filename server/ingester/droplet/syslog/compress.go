@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TCP分帧的syslog，帧首字节为压缩标记时，其余部分为压缩后的多行日志；否则为未压缩的单条日志
+const (
+	FRAME_FLAG_GZIP byte = 0x01
+	FRAME_FLAG_ZSTD byte = 0x02
+)
+
+// 单帧解压后的最大长度，避免异常数据占用过多内存
+const MAX_DECOMPRESSED_FRAME_SIZE = 16 << 20
+
+var errFrameTooLarge = errors.New("decompressed frame too large")
+
+type frameDecompressor struct {
+	gzipBuffer  bytes.Buffer
+	gzipReader  *gzip.Reader
+	zstdBuffer  []byte
+	zstdDecoder *zstd.Decoder
+}
+
+func isCompressedFrame(frame []byte) bool {
+	return len(frame) > 0 && (frame[0] == FRAME_FLAG_GZIP || frame[0] == FRAME_FLAG_ZSTD)
+}
+
+func (d *frameDecompressor) decompress(frame []byte) ([]byte, error) {
+	switch frame[0] {
+	case FRAME_FLAG_GZIP:
+		d.gzipBuffer.Reset()
+		if d.gzipReader == nil {
+			reader, err := gzip.NewReader(bytes.NewReader(frame[1:]))
+			if err != nil {
+				return nil, err
+			}
+			d.gzipReader = reader
+		} else if err := d.gzipReader.Reset(bytes.NewReader(frame[1:])); err != nil {
+			return nil, err
+		}
+		n, err := io.Copy(&d.gzipBuffer, io.LimitReader(d.gzipReader, MAX_DECOMPRESSED_FRAME_SIZE+1))
+		if err != nil {
+			return nil, err
+		}
+		if n > MAX_DECOMPRESSED_FRAME_SIZE {
+			return nil, errFrameTooLarge
+		}
+		return d.gzipBuffer.Bytes(), nil
+	case FRAME_FLAG_ZSTD:
+		if d.zstdDecoder == nil {
+			decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(MAX_DECOMPRESSED_FRAME_SIZE))
+			if err != nil {
+				return nil, err
+			}
+			d.zstdDecoder = decoder
+		}
+		out, err := d.zstdDecoder.DecodeAll(frame[1:], d.zstdBuffer[:0])
+		if err != nil {
+			return nil, err
+		}
+		d.zstdBuffer = out
+		return out, nil
+	}
+	return frame, nil
+}
+
+// 解析一帧日志，压缩帧解压后按行拆分，每行(包含行尾换行符)回调一次
+func (d *frameDecompressor) decodeFrame(frame []byte, fn func(line []byte)) error {
+	if !isCompressedFrame(frame) {
+		fn(frame)
+		return nil
+	}
+	batch, err := d.decompress(frame)
+	if err != nil {
+		return err
+	}
+	for len(batch) > 0 {
+		end := bytes.IndexByte(batch, '\n') + 1
+		if end == 0 {
+			end = len(batch)
+		}
+		if line := batch[:end]; len(bytes.TrimSpace(line)) > 0 {
+			fn(line)
+		}
+		batch = batch[end:]
+	}
+	return nil
+}
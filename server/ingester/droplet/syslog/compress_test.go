@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/libs/codec"
+)
+
+var compressTestLines = []string{
+	"2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] synchronizer.go:397 line 1\n",
+	"2020-11-23T16:56:36+08:00 dfi-153 trident[8642]: [WARN] synchronizer.go:398 line 2\n",
+	"2020-11-23T16:56:37+08:00 dfi-153 trident[8642]: [ERRO] synchronizer.go:399 line 3\n",
+}
+
+func gzipCompress(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	_, err := writer.Write(data)
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Close())
+	return buf.Bytes()
+}
+
+func zstdCompress(t *testing.T, data []byte) []byte {
+	encoder, err := zstd.NewWriter(nil)
+	assert.Nil(t, err)
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil)
+}
+
+func decodeFrames(t *testing.T, bs []byte) []string {
+	d := &frameDecompressor{}
+	decoder := &codec.SimpleDecoder{}
+	decoder.Init(bs)
+	lines := []string{}
+	for !decoder.IsEnd() {
+		frame := decoder.ReadBytes()
+		assert.NotNil(t, frame)
+		err := d.decodeFrame(frame, func(line []byte) {
+			lines = append(lines, string(line))
+		})
+		assert.Nil(t, err)
+	}
+	return lines
+}
+
+func TestDecodeCompressedFrame(t *testing.T) {
+	batch := []byte{}
+	for _, line := range compressTestLines {
+		batch = append(batch, line...)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		flag     byte
+		compress func(*testing.T, []byte) []byte
+	}{
+		{"gzip", FRAME_FLAG_GZIP, gzipCompress},
+		{"zstd", FRAME_FLAG_ZSTD, zstdCompress},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			encoder := &codec.SimpleEncoder{}
+			encoder.WriteBytes(append([]byte{tc.flag}, tc.compress(t, batch)...))
+			// 未压缩帧与压缩帧混合发送
+			encoder.WriteBytes([]byte(compressTestLines[0]))
+			encoder.WriteBytes(append([]byte{tc.flag}, tc.compress(t, batch)...))
+
+			expected := append(append(append([]string{}, compressTestLines...), compressTestLines[0]), compressTestLines...)
+			assert.Equal(t, expected, decodeFrames(t, encoder.Bytes()))
+		})
+	}
+}
+
+func TestDecodeUncompressedFrame(t *testing.T) {
+	encoder := &codec.SimpleEncoder{}
+	for _, line := range compressTestLines {
+		encoder.WriteBytes([]byte(line))
+	}
+	assert.Equal(t, compressTestLines, decodeFrames(t, encoder.Bytes()))
+}
+
+func TestDecodeInvalidCompressedFrame(t *testing.T) {
+	d := &frameDecompressor{}
+	called := false
+	err := d.decodeFrame([]byte{FRAME_FLAG_GZIP, 'b', 'a', 'd'}, func([]byte) { called = true })
+	assert.NotNil(t, err)
+	assert.False(t, called)
+
+	// 解压失败后仍可继续处理后续帧
+	frame := append([]byte{FRAME_FLAG_GZIP}, gzipCompress(t, []byte(compressTestLines[1]))...)
+	lines := []string{}
+	err = d.decodeFrame(frame, func(line []byte) { lines = append(lines, string(line)) })
+	assert.Nil(t, err)
+	assert.Equal(t, compressTestLines[1:2], lines)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	_PARSE_ERROR_LOG = "parse-errors.log"
+)
+
+// 将解析失败的日志原样记录到输出目录下的parse-errors.log，与其他日志文件一样按天切分
+// 每行格式为: <时间> <来源IP> <解析错误> <原始日志>，错误和原始日志经strconv.Quote转义，可用strconv.Unquote还原
+type deadLetterWriter struct {
+	writer *DailyRotateWriter
+
+	now func() time.Time
+}
+
+func newDeadLetterWriter(enabled bool, directory string, syncOnFlush bool, compressionCodec string) *deadLetterWriter {
+	if !enabled {
+		return nil
+	}
+	if err := os.MkdirAll(directory, os.ModePerm); err != nil {
+		log.Warningf("cannot output syslog parse errors to directory %s: %v", directory, err)
+		return nil
+	}
+	return &deadLetterWriter{
+		writer: NewRotateWriter(filepath.Join(directory, _PARSE_ERROR_LOG), syncOnFlush, compressionCodec),
+		now:    time.Now,
+	}
+}
+
+func (d *deadLetterWriter) write(ip net.IP, raw []byte, parseErr error) {
+	if d == nil {
+		return
+	}
+	source := "-"
+	if ip != nil {
+		source = ip.String()
+	}
+	line := fmt.Sprintf("%s %s %s %s\n", d.now().Format(time.RFC3339), source,
+		strconv.Quote(parseErr.Error()), strconv.Quote(string(raw)))
+	if _, err := d.writer.Write([]byte(line)); err != nil {
+		log.Debugf("write syslog parse error failed: %v", err)
+	}
+}
+
+func (d *deadLetterWriter) flush() {
+	if d == nil {
+		return
+	}
+	d.writer.Flush()
+}
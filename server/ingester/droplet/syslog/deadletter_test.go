@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterCapturesParseErrors(t *testing.T) {
+	es := newMockES()
+	defer es.server.Close()
+	directory := t.TempDir()
+	deadLetter := newDeadLetterWriter(true, directory, false, COMPRESSION_NONE)
+	deadLetter.now = func() time.Time { return time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC) }
+	w := &syslogWriter{
+		levelToSeverity: newLevelToSeverity(nil),
+		esLogger:        NewESLogger([]string{strings.TrimPrefix(es.server.URL, "http://")}, "", "", "test", false, 0, 0, ES_ROUTING_NONE, "", 0),
+		deadLetter:      deadLetter,
+	}
+	malformed := []byte("garbage \x00\xff line\nwith newline")
+	w.writeES(net.ParseIP("10.0.0.1"), malformed)
+	w.writeES(net.ParseIP("10.0.0.1"), []byte("2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] a.go:1 ok\n"))
+	w.writeES(nil, nil)
+
+	content, err := os.ReadFile(filepath.Join(directory, _PARSE_ERROR_LOG))
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if !assert.Len(t, lines, 1) {
+		return
+	}
+	columns := strings.SplitN(lines[0], " ", 3)
+	assert.Equal(t, "2023-01-02T03:04:05Z", columns[0])
+	assert.Equal(t, "10.0.0.1", columns[1])
+	parseErr, rest, err := unquotePrefix(columns[2])
+	assert.Nil(t, err)
+	assert.Equal(t, "not enough columns in log", parseErr)
+	raw, err := strconv.Unquote(strings.TrimPrefix(rest, " "))
+	assert.Nil(t, err)
+	assert.Equal(t, string(malformed), raw)
+}
+
+func TestDeadLetterDisabled(t *testing.T) {
+	assert.Nil(t, newDeadLetterWriter(false, t.TempDir(), false, COMPRESSION_NONE))
+	var d *deadLetterWriter
+	d.write(nil, []byte("x"), os.ErrInvalid)
+	d.flush()
+}
+
+// 从s开头解析一个带引号的字符串，返回其内容及剩余部分
+func unquotePrefix(s string) (string, string, error) {
+	prefix, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", err
+	}
+	value, err := strconv.Unquote(prefix)
+	return value, s[len(prefix):], err
+}
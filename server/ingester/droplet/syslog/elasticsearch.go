@@ -18,7 +18,11 @@ package syslog
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/olivere/elastic"
@@ -31,83 +35,329 @@ const (
 	BULK_SIZE = 8192
 
 	RECONNECT_INTERVAL = time.Minute
+	// 批次写入失败后，间隔一段时间再重试，期间的flush不再发送请求
+	BULK_RETRY_INTERVAL = 10 * time.Second
+	// 重试时保留的最大日志条数，超出时丢弃整个批次
+	BULK_RETRY_MAX_ACTIONS = 4 * BULK_SIZE
+	// 未连接ES时最多缓存的日志条数，超出时丢弃新日志
+	ES_PENDING_MAX_LOGS = BULK_RETRY_MAX_ACTIONS
+)
+
+// 写入ES时文档_routing的取值来源，为空时由ES按文档id分片
+const (
+	ES_ROUTING_NONE = ""
+	ES_ROUTING_HOST = "host"
+	ES_ROUTING_IP   = "ip"
 )
 
 type ESLog struct {
 	Timestamp uint32 `json:"timestamp"`
 	Type      string `json:"type"`
 	Host      string `json:"host"`
+	// 开启主机名解析时为采集器IP对应的FQDN，解析失败时与host相同
+	HostFQDN  string `json:"host_fqdn,omitempty"`
 	Module    string `json:"module"`
 	Severity  string `json:"severity"`
 	SyslogTag string `json:"syslogtag"`
 	Message   string `json:"message"`
+	// JSON格式日志中除ts/level/msg外的其他字段
+	StructuredData map[string]json.RawMessage `json:"structured_data,omitempty"`
+	// 发送日志的采集器IP，仅用于按ip路由，不写入文档
+	SourceIP string `json:"-"`
 }
 
 type ESLogger struct {
 	addresses []string
 	username  string
 	password  string
+	// 为空时使用默认索引名
+	indexName *indexNameTemplate
+	// 是否对_bulk请求体进行gzip压缩
+	gzipEnabled bool
+	// 每个请求的超时时间，为0时不超时
+	requestTimeout time.Duration
+	maxIdleConns   int
+	// 取值为ES_ROUTING_*
+	routing string
 
+	// 保护以下字段，Log和Flush可在不同goroutine中调用
+	lock          sync.Mutex
 	client        *elastic.Client
 	lastReconnect time.Time
+	// 后台正在连接ES，连接不阻塞日志写入
+	connecting bool
+	// 为0时使用RECONNECT_INTERVAL
+	reconnectInterval time.Duration
 
 	bulk *elastic.BulkService
+	// 上次写入失败后，早于此时间的flush不重试
+	retryAfter time.Time
+
+	// 为nil时不缓存未写入ES的文档
+	wal *esWAL
+	// 未连接ES时缓存的文档，包含启动时从WAL读取的文档，连接ES后加入批次
+	pending []*ESLog
+	// 未连接ES且缓存已满时丢弃的日志数
+	pendingDropped uint64
+}
+
+// walFilename为空或walMaxDocs为0时不开启WAL
+func NewESLogger(addresses []string, username, password, indexTemplate string, gzipEnabled bool, requestTimeout time.Duration, maxIdleConns int, routing string, walFilename string, walMaxDocs int) *ESLogger {
+	l := &ESLogger{
+		addresses:      addresses,
+		username:       username,
+		password:       password,
+		indexName:      newIndexNameTemplate(indexTemplate),
+		gzipEnabled:    gzipEnabled,
+		requestTimeout: requestTimeout,
+		maxIdleConns:   maxIdleConns,
+		routing:        routing,
+	}
+	if walFilename != "" && walMaxDocs > 0 {
+		wal, replay, err := openESWAL(walFilename, walMaxDocs)
+		if err != nil {
+			log.Warningf("open es wal %s failed: %v", walFilename, err)
+		} else {
+			l.wal, l.pending = wal, replay
+		}
+	}
+	return l
 }
 
-func NewESLogger(addresses []string, username, password string) *ESLogger {
-	return &ESLogger{addresses: addresses, username: username, password: password}
+func (l *ESLogger) newHTTPClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if l.maxIdleConns > 0 {
+		transport.MaxIdleConns = l.maxIdleConns
+		transport.MaxIdleConnsPerHost = l.maxIdleConns
+	}
+	return &http.Client{Transport: transport, Timeout: l.requestTimeout}
 }
 
-func (l *ESLogger) connect() error {
+func (l *ESLogger) connect() (*elastic.Client, error) {
 	// 第一次连上之后客户端会自动保活，不需要再处理
 	urls := make([]string, 0, len(l.addresses))
 	for _, a := range l.addresses {
 		urls = append(urls, "http://"+a)
 	}
 	log.Infof("Syslog ESWriter connects to %s", strings.Join(urls, ", "))
-	var err error
-	l.client, err = elastic.NewClient(elastic.SetURL(urls...), elastic.SetBasicAuth(l.username, l.password))
+	client, err := elastic.NewClient(elastic.SetURL(urls...), elastic.SetBasicAuth(l.username, l.password), elastic.SetGzip(l.gzipEnabled),
+		elastic.SetHttpClient(l.newHTTPClient()))
 	if err != nil {
-		l.client = nil
 		log.Warning("failed connecting to elasticsearch:", err)
-		return err
+		return nil, err
 	}
-	return nil
+	return client, nil
 }
 
-func (l *ESLogger) Log(esLog *ESLog) {
-	if l.client == nil {
-		now := time.Now()
-		if now.Sub(l.lastReconnect) < RECONNECT_INTERVAL {
-			return
-		}
-		l.lastReconnect = now
-		if l.connect() != nil {
-			return
+// 距上次连接超过重连间隔时在后台连接ES，ES不可达时不影响写文件
+func (l *ESLogger) startConnect() {
+	interval := l.reconnectInterval
+	if interval == 0 {
+		interval = RECONNECT_INTERVAL
+	}
+	now := time.Now()
+	if l.connecting || now.Sub(l.lastReconnect) < interval {
+		return
+	}
+	l.lastReconnect = now
+	l.connecting = true
+	go func() {
+		client, err := l.connect()
+		l.lock.Lock()
+		l.connecting = false
+		if err == nil {
+			l.client = client
+			log.Infof("Syslog ESWriter connected, %d pending logs", len(l.pending))
 		}
+		l.lock.Unlock()
+	}()
+}
+
+// 创建批次并加入未连接时缓存的文档，未连接时触发重连并返回false
+func (l *ESLogger) ensureBulk() bool {
+	if l.client == nil {
+		l.startConnect()
+		return false
 	}
 	if l.bulk == nil {
 		l.bulk = l.client.Bulk().Type(ES_TYPE)
 	}
-	l.bulk.Add(elastic.NewBulkIndexRequest().Index(getIndexName(esLog.Timestamp)).Type(ES_TYPE).Doc(esLog))
+	// 缓存的文档已在WAL中，不再追加
+	for _, esLog := range l.pending {
+		l.addToBulk(esLog)
+	}
+	l.pending = nil
+	return true
+}
+
+func (l *ESLogger) addToBulk(esLog *ESLog) {
+	request := elastic.NewBulkIndexRequest().Index(l.indexName.format(esLog.Timestamp)).Type(ES_TYPE).Doc(esLog)
+	if routing := l.routingKey(esLog); routing != "" {
+		request.Routing(routing)
+	}
+	l.bulk.Add(request)
+}
+
+func (l *ESLogger) Log(esLog *ESLog) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.ensureBulk() {
+		if len(l.pending) >= ES_PENDING_MAX_LOGS {
+			atomic.AddUint64(&l.pendingDropped, 1)
+			return
+		}
+		l.wal.append(esLog)
+		l.pending = append(l.pending, esLog)
+		return
+	}
+	l.wal.append(esLog)
+	l.addToBulk(esLog)
 	if l.bulk.NumberOfActions() >= BULK_SIZE {
-		l.Flush()
+		l.flush()
 	}
 }
 
+// WAL写满后丢弃的文档数，读取后清零
+func (l *ESLogger) WALDropped() uint64 {
+	if l == nil {
+		return 0
+	}
+	return l.wal.droppedCount()
+}
+
+// 是否已连接ES
+func (l *ESLogger) Connected() bool {
+	if l == nil {
+		return false
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.client != nil
+}
+
+// 未连接ES且缓存已满时丢弃的日志数，读取后清零
+func (l *ESLogger) PendingDropped() uint64 {
+	if l == nil {
+		return 0
+	}
+	return atomic.SwapUint64(&l.pendingDropped, 0)
+}
+
+// 按配置返回文档的_routing，为空时不设置
+func (l *ESLogger) routingKey(esLog *ESLog) string {
+	switch l.routing {
+	case ES_ROUTING_HOST:
+		return esLog.Host
+	case ES_ROUTING_IP:
+		return esLog.SourceIP
+	}
+	return ""
+}
+
 func (l *ESLogger) Flush() {
-	if l.bulk == nil || l.bulk.NumberOfActions() <= 0 {
+	l.lock.Lock()
+	l.flush()
+	l.lock.Unlock()
+}
+
+func (l *ESLogger) flush() {
+	// WAL缓冲随定时flush落盘，未连接ES时同样落盘
+	l.wal.flush()
+	// 未连接时由定时flush触发重连，连接后发送缓存的文档
+	if !l.ensureBulk() || l.bulk.NumberOfActions() <= 0 {
+		return
+	}
+	now := time.Now()
+	if now.Before(l.retryAfter) {
 		return
 	}
-	resp, err := l.bulk.Do(context.TODO())
+	ctx := context.Background()
+	if l.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.requestTimeout)
+		defer cancel()
+	}
+	// 请求失败时bulk不会被重置，保留到BULK_RETRY_INTERVAL后重试
+	resp, err := l.bulk.Do(ctx)
 	if err != nil {
-		log.Warning("batch request has error:", err)
+		l.retryAfter = now.Add(BULK_RETRY_INTERVAL)
+		if n := l.bulk.NumberOfActions(); n > BULK_RETRY_MAX_ACTIONS {
+			log.Warningf("batch request has error: %s, dropped %d logs", err, n)
+			l.bulk.Reset()
+			l.wal.clear()
+		} else {
+			log.Warningf("batch request has error: %s, retry %d logs after %s", err, n, BULK_RETRY_INTERVAL)
+		}
 		return
 	}
-	// TODO: do something with resp
-	_ = resp
+	l.retryAfter = time.Time{}
+	l.wal.clear()
+	// 压缩仅作用于请求体，响应仍按json解析
+	if resp.Errors {
+		failed := resp.Failed()
+		if len(failed) > 0 && failed[0].Error != nil {
+			log.Warningf("batch request has %d failed items, first error: %s %s", len(failed), failed[0].Error.Type, failed[0].Error.Reason)
+		}
+	}
 }
 
 func getIndexName(timestamp uint32) string {
 	return ES_APP + time.Unix(int64(timestamp), 0).Format("06010200")
 }
+
+type indexNamePart struct {
+	literal string
+	layout  string // 非空时按日志时间格式化
+}
+
+// 索引名模板，如trident-logs-%{+yyyy.MM.dd}，%{+...}中的日期格式按每条日志的时间解析
+type indexNameTemplate struct {
+	parts []indexNamePart
+}
+
+var dateFormatReplacer = strings.NewReplacer(
+	"yyyy", "2006", "yy", "06", "MM", "01", "dd", "02", "HH", "15", "mm", "04", "ss", "05",
+)
+
+func newIndexNameTemplate(template string) *indexNameTemplate {
+	if template == "" {
+		return nil
+	}
+	t := &indexNameTemplate{}
+	for len(template) > 0 {
+		start := strings.Index(template, "%{+")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(template[start:], "}")
+		if end < 0 {
+			break
+		}
+		end += start
+		if start > 0 {
+			t.parts = append(t.parts, indexNamePart{literal: template[:start]})
+		}
+		t.parts = append(t.parts, indexNamePart{layout: dateFormatReplacer.Replace(template[start+3 : end])})
+		template = template[end+1:]
+	}
+	if len(template) > 0 {
+		t.parts = append(t.parts, indexNamePart{literal: template})
+	}
+	return t
+}
+
+func (t *indexNameTemplate) format(timestamp uint32) string {
+	if t == nil {
+		return getIndexName(timestamp)
+	}
+	datetime := time.Unix(int64(timestamp), 0)
+	var sb strings.Builder
+	for _, part := range t.parts {
+		if part.layout != "" {
+			sb.WriteString(datetime.Format(part.layout))
+		} else {
+			sb.WriteString(part.literal)
+		}
+	}
+	return sb.String()
+}
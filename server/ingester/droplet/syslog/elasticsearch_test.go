@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexNameTemplate(t *testing.T) {
+	day1 := uint32(time.Date(2023, 3, 1, 23, 59, 0, 0, time.Local).Unix())
+	day2 := uint32(time.Date(2023, 3, 2, 0, 1, 0, 0, time.Local).Unix())
+
+	template := newIndexNameTemplate("trident-logs-%{+yyyy.MM.dd}")
+	assert.Equal(t, "trident-logs-2023.03.01", template.format(day1))
+	assert.Equal(t, "trident-logs-2023.03.02", template.format(day2))
+
+	template = newIndexNameTemplate("logs-%{+yy}-x-%{+MM.dd}-y")
+	assert.Equal(t, "logs-23-x-03.01-y", template.format(day1))
+
+	template = newIndexNameTemplate("fixed-index")
+	assert.Equal(t, "fixed-index", template.format(day1))
+	assert.Equal(t, "fixed-index", template.format(day2))
+
+	// 未配置模板时使用默认索引名
+	template = newIndexNameTemplate("")
+	assert.Equal(t, getIndexName(day1), template.format(day1))
+	assert.NotEqual(t, template.format(day1), template.format(day2))
+}
+
+// 模拟ES，记录解压后的_bulk请求体，并返回包含失败条目的响应
+type mockES struct {
+	server          *httptest.Server
+	contentEncoding string
+	bulkBody        string
+	// 非nil时_bulk请求阻塞，直到关闭或请求被取消
+	hang chan struct{}
+}
+
+func newMockES() *mockES {
+	m := &mockES{}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+	return m
+}
+
+func (m *mockES) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/_nodes/http":
+		address := strings.TrimPrefix(m.server.URL, "http://")
+		fmt.Fprintf(w, `{"nodes":{"node-1":{"http":{"publish_address":"%s"}}}}`, address)
+	case strings.HasSuffix(r.URL.Path, "/_bulk"):
+		if m.hang != nil {
+			select {
+			case <-m.hang:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		m.contentEncoding = r.Header.Get("Content-Encoding")
+		var body io.Reader = r.Body
+		if m.contentEncoding == "gzip" {
+			reader, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = reader
+		}
+		data, _ := io.ReadAll(body)
+		m.bulkBody = string(data)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"took":1,"errors":true,"items":[{"index":{"_index":"test","_type":"events","status":400,` +
+			`"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`))
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// 连接在后台进行，触发连接并等待连接成功
+func waitESConnected(t *testing.T, l *ESLogger) {
+	assert.Eventually(t, func() bool {
+		l.Flush()
+		return l.Connected()
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestESLoggerGzip(t *testing.T) {
+	es := newMockES()
+	defer es.server.Close()
+
+	esLog := &ESLog{Timestamp: uint32(time.Now().Unix()), Type: "log", Host: "vtap-1", Message: "hello gzip"}
+	for _, gzipEnabled := range []bool{true, false} {
+		logger := NewESLogger([]string{strings.TrimPrefix(es.server.URL, "http://")}, "", "", "test", gzipEnabled, 0, 0, ES_ROUTING_NONE, "", 0)
+		waitESConnected(t, logger)
+		logger.Log(esLog)
+		logger.Flush()
+
+		if gzipEnabled {
+			assert.Equal(t, "gzip", es.contentEncoding)
+		} else {
+			assert.Equal(t, "", es.contentEncoding)
+		}
+		lines := strings.Split(strings.TrimSpace(es.bulkBody), "\n")
+		if assert.Equal(t, 2, len(lines)) {
+			received := &ESLog{}
+			assert.Nil(t, json.Unmarshal([]byte(lines[1]), received))
+			assert.Equal(t, esLog, received)
+		}
+		// 响应解析成功后bulk被重置
+		assert.Equal(t, 0, logger.bulk.NumberOfActions())
+	}
+}
+
+func TestESLoggerRouting(t *testing.T) {
+	es := newMockES()
+	defer es.server.Close()
+
+	timestamp := uint32(time.Now().Unix())
+	for routing, want := range map[string][]string{
+		ES_ROUTING_HOST: {`"routing":"vtap-1"`, `"routing":"vtap-2"`},
+		ES_ROUTING_IP:   {`"routing":"10.0.0.1"`, `"routing":"10.0.0.2"`},
+		ES_ROUTING_NONE: {"", ""},
+	} {
+		logger := NewESLogger([]string{strings.TrimPrefix(es.server.URL, "http://")}, "", "", "test", false, 0, 0, routing, "", 0)
+		waitESConnected(t, logger)
+		logger.Log(&ESLog{Timestamp: timestamp, Type: "log", Host: "vtap-1", SourceIP: "10.0.0.1", Message: "first"})
+		logger.Log(&ESLog{Timestamp: timestamp, Type: "log", Host: "vtap-2", SourceIP: "10.0.0.2", Message: "second"})
+		logger.Flush()
+
+		// 每条日志的action行中带有各自的routing
+		lines := strings.Split(strings.TrimSpace(es.bulkBody), "\n")
+		if assert.Equal(t, 4, len(lines), routing) {
+			for i, action := range []string{lines[0], lines[2]} {
+				if want[i] == "" {
+					assert.NotContains(t, action, "routing", routing)
+				} else {
+					assert.Contains(t, action, want[i], routing)
+				}
+			}
+			// 源IP不写入文档
+			assert.NotContains(t, lines[1], "10.0.0.1")
+		}
+	}
+}
+
+func TestESLoggerRequestTimeout(t *testing.T) {
+	es := &mockES{hang: make(chan struct{})}
+	es.server = httptest.NewServer(http.HandlerFunc(es.serveHTTP))
+	defer es.server.Close()
+
+	logger := NewESLogger([]string{strings.TrimPrefix(es.server.URL, "http://")}, "", "", "test", false, 100*time.Millisecond, 2, ES_ROUTING_NONE, "", 0)
+	waitESConnected(t, logger)
+	logger.Log(&ESLog{Timestamp: uint32(time.Now().Unix()), Type: "log", Host: "vtap-1", Message: "hello timeout"})
+
+	start := time.Now()
+	logger.Flush()
+	assert.True(t, time.Since(start) < 5*time.Second)
+	// 超时的批次保留，重试间隔内不再发送
+	assert.Equal(t, 1, logger.bulk.NumberOfActions())
+	assert.True(t, logger.retryAfter.After(time.Now()))
+	start = time.Now()
+	logger.Flush()
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	// ES恢复后重试成功
+	close(es.hang)
+	logger.retryAfter = time.Time{}
+	logger.Flush()
+	assert.Equal(t, 0, logger.bulk.NumberOfActions())
+	assert.True(t, logger.retryAfter.IsZero())
+	assert.Contains(t, es.bulkBody, "hello timeout")
+}
+
+func TestESLoggerWALReplay(t *testing.T) {
+	es := newMockES()
+	defer es.server.Close()
+	address := strings.TrimPrefix(es.server.URL, "http://")
+	walFilename := filepath.Join(t.TempDir(), _ES_WAL_LOG)
+
+	esLog := &ESLog{Timestamp: uint32(time.Now().Unix()), Type: "log", Host: "vtap-1", Message: "before restart", SourceIP: "10.0.0.1"}
+	logger := NewESLogger([]string{address}, "", "", "test", false, 0, 0, ES_ROUTING_IP, walFilename, 100)
+	waitESConnected(t, logger)
+	logger.Log(esLog)
+	// WAL已由定时flush落盘，但批次未发送即重启，从WAL重放
+	logger.wal.flush()
+	logger = NewESLogger([]string{address}, "", "", "test", false, 0, 0, ES_ROUTING_IP, walFilename, 100)
+	assert.Equal(t, []*ESLog{esLog}, logger.pending)
+	waitESConnected(t, logger)
+	logger.Flush()
+
+	lines := strings.Split(strings.TrimSpace(es.bulkBody), "\n")
+	if assert.Equal(t, 2, len(lines)) {
+		assert.Contains(t, lines[0], `"routing":"10.0.0.1"`)
+		received := &ESLog{}
+		assert.Nil(t, json.Unmarshal([]byte(lines[1]), received))
+		assert.Equal(t, "before restart", received.Message)
+	}
+	// 写入成功后WAL被清空，再次重启不会重复写入
+	info, err := os.Stat(walFilename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+	logger = NewESLogger([]string{address}, "", "", "test", false, 0, 0, ES_ROUTING_IP, walFilename, 100)
+	assert.Empty(t, logger.pending)
+}
+
+func TestESWALDropOldest(t *testing.T) {
+	walFilename := filepath.Join(t.TempDir(), _ES_WAL_LOG)
+	wal, replay, err := openESWAL(walFilename, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, replay)
+	for i := 0; i < 12; i++ {
+		wal.append(&ESLog{Message: fmt.Sprintf("log %d", i)})
+	}
+	assert.Equal(t, uint64(2), wal.droppedCount())
+	assert.Equal(t, uint64(0), wal.droppedCount())
+
+	_, replay, err = openESWAL(walFilename, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, replay, 10) {
+		assert.Equal(t, "log 2", replay[0].Message)
+		assert.Equal(t, "log 11", replay[9].Message)
+	}
+}
+
+func TestESWALBuffered(t *testing.T) {
+	walFilename := filepath.Join(t.TempDir(), _ES_WAL_LOG)
+	wal, _, err := openESWAL(walFilename, 10)
+	assert.Nil(t, err)
+	wal.append(&ESLog{Message: "log 0"})
+	wal.append(&ESLog{Message: "log 1"})
+
+	// flush前文档仅在缓冲中
+	_, replay, err := openESWAL(walFilename, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, replay)
+
+	wal.flush()
+	_, replay, err = openESWAL(walFilename, 10)
+	assert.Nil(t, err)
+	assert.Len(t, replay, 2)
+
+	// 清空时丢弃缓冲中的文档，之后flush不会写入已确认的文档
+	wal.append(&ESLog{Message: "log 2"})
+	wal.clear()
+	wal.flush()
+	info, err := os.Stat(walFilename)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+)
+
+const (
+	_ES_WAL_LOG = "es-wal.log"
+	// WAL写满时一次丢弃的最早文档占比，避免每条新文档都重写整个文件
+	_ES_WAL_DROP_RATIO = 10
+)
+
+// WAL中的一条记录，SourceIP不写入ES文档但按ip路由时需要，单独保存
+type esWALRecord struct {
+	Log      *ESLog `json:"log"`
+	SourceIP string `json:"source_ip,omitempty"`
+}
+
+// 写入ES前的文档先追加到磁盘上的WAL，批次写入成功后清空，进程重启后重放未确认的文档
+// ES已写入但清空WAL前进程退出时，重放会产生重复的文档
+// 追加的文档先写入缓冲，随定时flush落盘，进程异常退出时最多丢失一个flush周期内的文档
+type esWAL struct {
+	file    *os.File
+	writer  *bufio.Writer
+	maxDocs int
+	// 与文件内容一致的全部记录，每条为一行json
+	records [][]byte
+	// 写满后丢弃的文档数
+	dropped uint64
+}
+
+// 打开WAL并读取其中未确认的文档，超过maxDocs时只保留最新的文档
+func openESWAL(filename string, maxDocs int) (*esWAL, []*ESLog, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &esWAL{file: file, writer: bufio.NewWriter(file), maxDocs: maxDocs}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if json.Valid(line) {
+			w.records = append(w.records, append([]byte(nil), line...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warningf("read es wal %s failed: %v", filename, err)
+	}
+	if len(w.records) > maxDocs {
+		w.dropped += uint64(len(w.records) - maxDocs)
+		w.records = w.records[len(w.records)-maxDocs:]
+		if err := w.rewrite(); err != nil {
+			log.Warningf("rewrite es wal %s failed: %v", filename, err)
+		}
+	}
+
+	esLogs := make([]*ESLog, 0, len(w.records))
+	for _, line := range w.records {
+		record := &esWALRecord{}
+		if err := json.Unmarshal(line, record); err != nil || record.Log == nil {
+			continue
+		}
+		record.Log.SourceIP = record.SourceIP
+		esLogs = append(esLogs, record.Log)
+	}
+	if len(esLogs) > 0 {
+		log.Infof("replay %d logs from es wal %s", len(esLogs), filename)
+	}
+	return w, esLogs, nil
+}
+
+// 按records重写整个文件，缓冲中未落盘的文档已包含在records中，直接丢弃
+func (w *esWAL) rewrite() error {
+	w.writer.Reset(w.file)
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	if len(w.records) == 0 {
+		return nil
+	}
+	_, err := w.file.Write(append(bytes.Join(w.records, []byte{'\n'}), '\n'))
+	return err
+}
+
+// 追加文档，写满时先丢弃最早的文档
+func (w *esWAL) append(esLog *ESLog) {
+	if w == nil {
+		return
+	}
+	line, err := json.Marshal(&esWALRecord{Log: esLog, SourceIP: esLog.SourceIP})
+	if err != nil {
+		return
+	}
+	if len(w.records) >= w.maxDocs {
+		n := w.maxDocs / _ES_WAL_DROP_RATIO
+		if n < 1 {
+			n = 1
+		}
+		w.records = w.records[n:]
+		atomic.AddUint64(&w.dropped, uint64(n))
+		w.records = append(w.records, line)
+		if err := w.rewrite(); err != nil {
+			log.Warningf("rewrite es wal failed: %v", err)
+		}
+		return
+	}
+	w.records = append(w.records, line)
+	if _, err := w.writer.Write(append(line, '\n')); err != nil {
+		log.Warningf("write es wal failed: %v", err)
+	}
+}
+
+// 将缓冲中的文档写入文件
+func (w *esWAL) flush() {
+	if w == nil {
+		return
+	}
+	if err := w.writer.Flush(); err != nil {
+		log.Warningf("flush es wal failed: %v", err)
+	}
+}
+
+// 批次写入成功或被丢弃后清空，缓冲中的文档同属该批次，一并丢弃
+func (w *esWAL) clear() {
+	if w == nil {
+		return
+	}
+	w.records = nil
+	w.writer.Reset(w.file)
+	if err := w.file.Truncate(0); err != nil {
+		log.Warningf("truncate es wal failed: %v", err)
+	}
+}
+
+func (w *esWAL) droppedCount() uint64 {
+	if w == nil {
+		return 0
+	}
+	return atomic.SwapUint64(&w.dropped, 0)
+}
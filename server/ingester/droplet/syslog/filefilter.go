@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+)
+
+// 按源ip过滤写入文件的日志：allow非空时仅写入其中的ip，deny中的ip不写入；写入ES不受影响
+type ipFileFilter struct {
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+func parseIPSet(ips []string) (map[string]struct{}, error) {
+	set := make(map[string]struct{}, len(ips))
+	for _, s := range ips {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip %s", s)
+		}
+		// 与日志文件名保持一致
+		set[ip.String()] = struct{}{}
+	}
+	return set, nil
+}
+
+// allowIPs和denyIPs均为空时返回nil，表示不过滤
+func newIPFileFilter(allowIPs, denyIPs []string) (*ipFileFilter, error) {
+	if len(allowIPs) == 0 && len(denyIPs) == 0 {
+		return nil, nil
+	}
+	allow, err := parseIPSet(allowIPs)
+	if err != nil {
+		return nil, err
+	}
+	deny, err := parseIPSet(denyIPs)
+	if err != nil {
+		return nil, err
+	}
+	return &ipFileFilter{allow: allow, deny: deny}, nil
+}
+
+func (f *ipFileFilter) enabled(key string) bool {
+	if f == nil {
+		return true
+	}
+	if _, in := f.deny[key]; in {
+		return false
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	_, in := f.allow[key]
+	return in
+}
+
+// SetFileFilter 运行时设置写入文件的源ip白名单及黑名单，均为空时所有ip都写入文件
+func (w *syslogWriter) SetFileFilter(allowIPs, denyIPs []string) error {
+	filter, err := newIPFileFilter(allowIPs, denyIPs)
+	if err != nil {
+		return err
+	}
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	w.fileFilter = filter
+	// 关闭不再允许写入的文件
+	for key, writer := range w.fileMap {
+		if !filter.enabled(key) {
+			w.closeFile(key, writer)
+		}
+	}
+	log.Infof("syslog file filter set, allow: %v, deny: %v", allowIPs, denyIPs)
+	return nil
+}
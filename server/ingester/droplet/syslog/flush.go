@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+// FlushNow 立即将已收到的日志写入文件和ES，不等待flush周期，可与run并发调用
+func (w *syslogWriter) FlushNow() {
+	// 异步写入时先等待缓冲中的日志写完
+	if w.fileSink != nil {
+		w.fileSink.sync()
+	}
+	if w.esSink != nil {
+		w.esSink.sync()
+	}
+	if w.logToFileEnabled {
+		w.fileLock.Lock()
+		for _, writer := range w.fileMap {
+			writer.fileBuffer.Flush()
+		}
+		w.fileLock.Unlock()
+	}
+	if w.esLogger != nil {
+		w.esLogger.Flush()
+	}
+}
+
+type flushCommand struct {
+	writer *syslogWriter
+}
+
+func (c *flushCommand) HandleSimpleCommand(operate uint16, arg string) string {
+	c.writer.FlushNow()
+	return "syslog flushed"
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushNow(t *testing.T) {
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	w.fileSink = newAsyncSink("file", 100, w.writeFile)
+	defer w.fileSink.close()
+
+	ip := net.ParseIP("10.0.0.1")
+	fileName := filepath.Join(directory, ip.String()+".log")
+	expected := ""
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// 与写入并发调用
+		for i := 0; i < 10; i++ {
+			w.FlushNow()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf("line %d\n", i)
+		w.writeLog(ip, []byte(line))
+		expected += line
+	}
+	wg.Wait()
+
+	// 不经过flush周期，FlushNow返回后数据已写入文件
+	w.FlushNow()
+	content, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, string(content))
+	assert.Equal(t, "syslog flushed", (&flushCommand{writer: w}).HandleSimpleCommand(0, ""))
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ip对应的当前日志文件
+func (w *syslogWriter) currentLogFile(key string) string {
+	if w.fileLayout == SYSLOG_LAYOUT_DATE {
+		return datePartitionedPath(w.directory, key+".log", timeNow())
+	}
+	return filepath.Join(w.directory, key+".log")
+}
+
+// ip对应的日志文件: 当前文件<ip>.log，按天切分的<ip>.log.<date>及其压缩文件；
+// 按日期分目录时为各日期目录中的<ip>.log及其压缩文件
+func logFilesOf(directory, layout, key string) ([]string, error) {
+	directories := []string{directory}
+	if layout == SYSLOG_LAYOUT_DATE {
+		var err error
+		if directories, err = dateLogDirs(directory); err != nil {
+			return nil, err
+		}
+	}
+	base := key + ".log"
+	files := []string{}
+	for _, dir := range directories {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if name == base || strings.HasPrefix(name, base+".") {
+				files = append(files, filepath.Join(dir, name))
+			}
+		}
+	}
+	return files, nil
+}
+
+// 按日期分目录时directory下所有YYYY/MM/DD格式的目录，按日期排序
+func dateLogDirs(directory string) ([]string, error) {
+	dirs := []string{directory}
+	for depth := 0; depth < 3; depth++ {
+		children := []string{}
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					children = append(children, filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+		dirs = children
+	}
+	dateDirs := []string{}
+	for _, dir := range dirs {
+		if _, ok := dateOfLogDir(directory, dir, time.Local); ok {
+			dateDirs = append(dateDirs, dir)
+		}
+	}
+	return dateDirs, nil
+}
+
+// 解析日期目录对应的日期
+func dateOfLogDir(directory, dir string, loc *time.Location) (time.Time, bool) {
+	rel, err := filepath.Rel(directory, dir)
+	if err != nil {
+		return time.Time{}, false
+	}
+	date, err := time.ParseInLocation(_DATE_LAYOUT_FORMAT, filepath.ToSlash(rel), loc)
+	return date, err == nil
+}
+
+// 删除文件后清理空的日期目录，非空目录删除失败时忽略
+func removeEmptyDateDirs(directory string, files []string) {
+	directory = filepath.Clean(directory)
+	for _, file := range files {
+		for dir := filepath.Dir(file); dir != directory && strings.HasPrefix(dir, directory); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+}
+
+// 删除ip对应的全部日志文件，返回已删除的文件
+// 持有fileLock期间先关闭打开的文件再删除，删除完成前不会有新的写入
+func (w *syslogWriter) PurgeLog(ip net.IP) ([]string, error) {
+	removed := []string{}
+	if !w.logToFileEnabled {
+		return removed, nil
+	}
+	key := ip.String()
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
+	if writer, ok := w.fileMap[key]; ok {
+		w.closeFile(key, writer)
+	}
+	files, err := logFilesOf(w.directory, w.fileLayout, key)
+	if err != nil {
+		return removed, err
+	}
+	if w.fileLayout == SYSLOG_LAYOUT_DATE {
+		defer func() { removeEmptyDateDirs(w.directory, removed) }()
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, file)
+	}
+	return removed, nil
+}
+
+const PURGE_CONFIRM = "confirm"
+
+type purgeCommand struct {
+	writer  *syslogWriter
+	enabled bool
+}
+
+// 命令参数为"<ip>,confirm"，也可用空格分隔，未开启syslog-purge-enabled时不执行
+func (c *purgeCommand) HandleSimpleCommand(operate uint16, arg string) string {
+	if !c.enabled {
+		return "syslog purge is disabled, set syslog-purge-enabled to enable it"
+	}
+	fields := strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) != 2 || fields[1] != PURGE_CONFIRM {
+		return "usage: <ip>," + PURGE_CONFIRM
+	}
+	ip := net.ParseIP(fields[0])
+	if ip == nil {
+		return fmt.Sprintf("invalid ip %s", fields[0])
+	}
+	removed, err := c.writer.PurgeLog(ip)
+	if err != nil {
+		return fmt.Sprintf("purge syslog of %s failed after removing %d files: %s", ip, len(removed), err)
+	}
+	log.Infof("purged %d syslog files of %s by debug command", len(removed), ip)
+	return fmt.Sprintf("purged %d syslog files of %s", len(removed), ip)
+}
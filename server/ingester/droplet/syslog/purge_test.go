@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func listDir(t *testing.T, directory string) []string {
+	entries, err := os.ReadDir(directory)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPurgeLog(t *testing.T) {
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	ip := net.ParseIP("10.0.0.1")
+	otherIP := net.ParseIP("10.0.0.10")
+	w.writeLog(ip, []byte("line 1\n"))
+	w.writeLog(otherIP, []byte("line 1\n"))
+	for _, name := range []string{"10.0.0.1.log.2020-01-01.gz", "10.0.0.1.log.2020-01-02.zst", "10.0.0.1.log.2020-01-03"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(directory, name), []byte("old\n"), 0644))
+	}
+	otherFiles := []string{}
+	for _, name := range listDir(t, directory) {
+		if name[:len("10.0.0.10.")] == "10.0.0.10." {
+			otherFiles = append(otherFiles, name)
+		}
+	}
+	assert.Len(t, otherFiles, 2)
+
+	removed, err := w.PurgeLog(ip)
+	assert.Nil(t, err)
+	assert.Len(t, removed, 5)
+	assert.Equal(t, otherFiles, listDir(t, directory))
+	_, ok := w.fileMap[ip.String()]
+	assert.False(t, ok)
+	assert.Equal(t, 1, w.fileLRU.Len())
+
+	// 清理后再次写入重新创建文件
+	w.writeLog(ip, []byte("line 2\n"))
+	lines, err := w.TailLog(ip, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"line 2"}, lines)
+
+	removed, err = w.PurgeLog(net.ParseIP("10.0.0.2"))
+	assert.Nil(t, err)
+	assert.Empty(t, removed)
+}
+
+func TestPurgeLogDateLayout(t *testing.T) {
+	directory := t.TempDir()
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.Local)
+	withMockNow(t, &now)
+	w := newTestFileWriter(directory)
+	w.fileLayout = SYSLOG_LAYOUT_DATE
+	ip := net.ParseIP("10.0.0.1")
+	w.writeLog(ip, []byte("line 1\n"))
+	w.writeLog(net.ParseIP("10.0.0.10"), []byte("line 1\n"))
+	oldDir := filepath.Join(directory, "2023", "05", "01")
+	assert.Nil(t, os.MkdirAll(oldDir, os.ModePerm))
+	assert.Nil(t, os.WriteFile(filepath.Join(oldDir, "10.0.0.1.log.gz"), []byte("old\n"), 0644))
+
+	lines, err := w.TailLog(ip, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"line 1"}, lines)
+
+	files, err := bundleFilesOf(directory, SYSLOG_LAYOUT_DATE, ip.String(), 1, now)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(directory, "2023", "05", "10", "10.0.0.1.log")}, files)
+
+	removed, err := w.PurgeLog(ip)
+	assert.Nil(t, err)
+	assert.Len(t, removed, 2)
+	// 清理后删除空的日期目录，其他ip的文件保留
+	assert.Equal(t, []string{"10"}, listDir(t, filepath.Join(directory, "2023", "05")))
+	assert.Equal(t, []string{"10.0.0.10.log"}, listDir(t, filepath.Join(directory, "2023", "05", "10")))
+}
+
+func TestPurgeCommand(t *testing.T) {
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	ip := net.ParseIP("10.0.0.1")
+	w.writeLog(ip, []byte("line 1\n"))
+
+	disabled := &purgeCommand{writer: w}
+	assert.Contains(t, disabled.HandleSimpleCommand(0, "10.0.0.1,confirm"), "disabled")
+	assert.Len(t, listDir(t, directory), 2)
+
+	c := &purgeCommand{writer: w, enabled: true}
+	// 缺少confirm参数时不执行
+	assert.Equal(t, "usage: <ip>,confirm", c.HandleSimpleCommand(0, "10.0.0.1"))
+	assert.Equal(t, "usage: <ip>,confirm", c.HandleSimpleCommand(0, "10.0.0.1,yes"))
+	assert.Len(t, listDir(t, directory), 2)
+	assert.Equal(t, "invalid ip 10.0.0", c.HandleSimpleCommand(0, "10.0.0,confirm"))
+
+	assert.Equal(t, "purged 2 syslog files of 10.0.0.1", c.HandleSimpleCommand(0, "10.0.0.1 confirm"))
+	assert.Empty(t, listDir(t, directory))
+}
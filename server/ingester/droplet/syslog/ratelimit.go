@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	_RATE_LIMIT_REPORT_INTERVAL = time.Minute
+	_RATE_LIMIT_TOP_N           = 5
+)
+
+type ipBucket struct {
+	ip      net.IP
+	tokens  float64
+	last    time.Time
+	dropped uint64
+}
+
+// 按采集器IP进行令牌桶限速，超出速率的日志直接丢弃并计数
+type ipRateLimiter struct {
+	rate    float64 // 每秒允许的日志条数
+	burst   float64
+	buckets map[string]*ipBucket
+
+	lastReport time.Time
+	now        func() time.Time
+}
+
+func newIPRateLimiter(rate int) *ipRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &ipRateLimiter{
+		rate:       float64(rate),
+		burst:      float64(rate),
+		buckets:    make(map[string]*ipBucket),
+		lastReport: time.Now(),
+		now:        time.Now,
+	}
+}
+
+func (l *ipRateLimiter) allow(ip net.IP) bool {
+	if l == nil {
+		return true
+	}
+	now := l.now()
+	key := ip.String()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &ipBucket{ip: append(net.IP(nil), ip...), tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+	if elapsed := now.Sub(bucket.last).Seconds(); elapsed > 0 {
+		bucket.tokens += elapsed * l.rate
+		if bucket.tokens > l.burst {
+			bucket.tokens = l.burst
+		}
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		bucket.dropped++
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (l *ipRateLimiter) droppedCount(ip net.IP) uint64 {
+	if l == nil {
+		return 0
+	}
+	if bucket, ok := l.buckets[ip.String()]; ok {
+		return bucket.dropped
+	}
+	return 0
+}
+
+// 定期打印丢弃日志最多的采集器，并清理空闲的令牌桶
+func (l *ipRateLimiter) report() {
+	if l == nil {
+		return
+	}
+	now := l.now()
+	if now.Sub(l.lastReport) < _RATE_LIMIT_REPORT_INTERVAL {
+		return
+	}
+	l.lastReport = now
+
+	offenders := make([]*ipBucket, 0)
+	for key, bucket := range l.buckets {
+		if bucket.dropped > 0 {
+			offenders = append(offenders, bucket)
+		} else if now.Sub(bucket.last) >= _RATE_LIMIT_REPORT_INTERVAL {
+			delete(l.buckets, key)
+		}
+	}
+	if len(offenders) == 0 {
+		return
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		return offenders[i].dropped > offenders[j].dropped
+	})
+	if len(offenders) > _RATE_LIMIT_TOP_N {
+		offenders = offenders[:_RATE_LIMIT_TOP_N]
+	}
+	tops := make([]string, 0, len(offenders))
+	for _, bucket := range offenders {
+		tops = append(tops, bucket.ip.String()+":"+strconv.FormatUint(bucket.dropped, 10))
+	}
+	log.Warningf("syslog rate limit(%d/s) exceeded, top dropped agents: %s", int(l.rate), strings.Join(tops, ", "))
+	for _, bucket := range l.buckets {
+		bucket.dropped = 0
+	}
+}
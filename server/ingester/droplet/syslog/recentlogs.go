@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 超过该时间未收到日志的采集器，清理其最近日志
+const _RECENT_LOGS_IDLE_TIMEOUT = 10 * time.Minute
+
+// 单个采集器最近日志的环形缓冲，写满后覆盖最旧的日志
+type logRing struct {
+	lines [][]byte
+	next  int
+	full  bool
+	last  time.Time
+}
+
+func (r *logRing) add(line []byte) {
+	// 接收缓冲会被复用，需要拷贝
+	r.lines[r.next] = append(r.lines[r.next][:0], line...)
+	r.next++
+	if r.next == len(r.lines) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// 按时间从旧到新返回拷贝
+func (r *logRing) get() [][]byte {
+	var ordered [][]byte
+	if r.full {
+		ordered = append(r.lines[r.next:len(r.lines):len(r.lines)], r.lines[:r.next]...)
+	} else {
+		ordered = r.lines[:r.next]
+	}
+	result := make([][]byte, 0, len(ordered))
+	for _, line := range ordered {
+		result = append(result, append([]byte(nil), line...))
+	}
+	return result
+}
+
+// 按ip保存最近size条日志，由run写入，由调试命令等其他goroutine读取
+type recentLogs struct {
+	sync.RWMutex
+	size  int
+	rings map[string]*logRing
+
+	lastEvict time.Time
+}
+
+func newRecentLogs(size int) *recentLogs {
+	if size <= 0 {
+		return nil
+	}
+	return &recentLogs{size: size, rings: make(map[string]*logRing), lastEvict: timeNow()}
+}
+
+func (l *recentLogs) add(ip net.IP, line []byte) {
+	if l == nil {
+		return
+	}
+	key := ip.String()
+	l.Lock()
+	ring, ok := l.rings[key]
+	if !ok {
+		ring = &logRing{lines: make([][]byte, l.size)}
+		l.rings[key] = ring
+	}
+	ring.add(line)
+	ring.last = timeNow()
+	l.Unlock()
+}
+
+// 由run在flush周期调用，每分钟清理一次空闲的采集器
+func (l *recentLogs) evictIdle() {
+	if l == nil {
+		return
+	}
+	now := timeNow()
+	if now.Sub(l.lastEvict) < time.Minute {
+		return
+	}
+	l.lastEvict = now
+	l.Lock()
+	for key, ring := range l.rings {
+		if now.Sub(ring.last) >= _RECENT_LOGS_IDLE_TIMEOUT {
+			delete(l.rings, key)
+		}
+	}
+	l.Unlock()
+}
+
+func (l *recentLogs) get(ip net.IP) [][]byte {
+	if l == nil {
+		return nil
+	}
+	l.RLock()
+	defer l.RUnlock()
+	ring, ok := l.rings[ip.String()]
+	if !ok {
+		return nil
+	}
+	return ring.get()
+}
+
+// 返回ip最近的日志，按时间从旧到新排列，未开启时返回nil
+func (w *syslogWriter) RecentLogs(ip net.IP) [][]byte {
+	return w.recentLogs.get(ip)
+}
+
+type recentCommand struct {
+	writer *syslogWriter
+}
+
+// 命令参数为"<ip>[,lines]"，也可用空格分隔，lines为0或未指定时返回保留的所有日志
+func (c *recentCommand) HandleSimpleCommand(operate uint16, arg string) string {
+	if c.writer.recentLogs == nil {
+		return "syslog recent logs is disabled, set syslog-recent-logs to enable it"
+	}
+	fields := strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 || len(fields) > 2 {
+		return "usage: <ip>[,lines]"
+	}
+	ip := net.ParseIP(fields[0])
+	if ip == nil {
+		return fmt.Sprintf("invalid ip %s", fields[0])
+	}
+	n := 0
+	if len(fields) == 2 {
+		var err error
+		if n, err = strconv.Atoi(fields[1]); err != nil || n < 0 {
+			return fmt.Sprintf("invalid lines %s", fields[1])
+		}
+	}
+	lines := c.writer.RecentLogs(ip)
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		result = append(result, strings.TrimSuffix(string(line), "\n"))
+	}
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentLogsKeepLastLines(t *testing.T) {
+	w := &syslogWriter{recentLogs: newRecentLogs(3)}
+	ip := net.ParseIP("10.0.0.1")
+	assert.Nil(t, w.RecentLogs(ip))
+
+	buffer := make([]byte, 0, 16)
+	for i := 1; i <= 2; i++ {
+		// 复用同一块缓冲，模拟接收缓冲被回收
+		buffer = append(buffer[:0], fmt.Sprintf("line %d", i)...)
+		w.writeLog(ip, buffer)
+	}
+	assert.Equal(t, [][]byte{[]byte("line 1"), []byte("line 2")}, w.RecentLogs(ip))
+
+	for i := 3; i <= 7; i++ {
+		buffer = append(buffer[:0], fmt.Sprintf("line %d", i)...)
+		w.writeLog(ip, buffer)
+	}
+	assert.Equal(t, [][]byte{[]byte("line 5"), []byte("line 6"), []byte("line 7")}, w.RecentLogs(ip))
+	assert.Nil(t, w.RecentLogs(net.ParseIP("10.0.0.2")))
+
+	disabled := &syslogWriter{recentLogs: newRecentLogs(0)}
+	disabled.writeLog(ip, []byte("line 1"))
+	assert.Nil(t, disabled.RecentLogs(ip))
+}
+
+func TestRecentLogsReadWhileWriting(t *testing.T) {
+	w := &syslogWriter{recentLogs: newRecentLogs(10)}
+	ip := net.ParseIP("10.0.0.1")
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			w.writeLog(ip, []byte(fmt.Sprintf("line %d", i)))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		lines := w.RecentLogs(ip)
+		assert.LessOrEqual(t, len(lines), 10)
+	}
+	wg.Wait()
+
+	lines := w.RecentLogs(ip)
+	assert.Len(t, lines, 10)
+	assert.Equal(t, []byte("line 990"), lines[0])
+	assert.Equal(t, []byte("line 999"), lines[9])
+}
+
+func TestRecentLogsEvictIdle(t *testing.T) {
+	now := time.Date(2023, 5, 10, 12, 0, 0, 0, time.Local)
+	withMockNow(t, &now)
+	w := &syslogWriter{recentLogs: newRecentLogs(3)}
+	idleIP, activeIP := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	w.writeLog(idleIP, []byte("line 1"))
+	w.writeLog(activeIP, []byte("line 1"))
+
+	now = now.Add(_RECENT_LOGS_IDLE_TIMEOUT - time.Minute)
+	w.writeLog(activeIP, []byte("line 2"))
+	w.recentLogs.evictIdle()
+	assert.Len(t, w.recentLogs.rings, 2)
+
+	now = now.Add(time.Minute)
+	w.recentLogs.evictIdle()
+	assert.Nil(t, w.RecentLogs(idleIP))
+	assert.Equal(t, [][]byte{[]byte("line 1"), []byte("line 2")}, w.RecentLogs(activeIP))
+	assert.Len(t, w.recentLogs.rings, 1)
+}
+
+func TestRecentCommand(t *testing.T) {
+	w := &syslogWriter{recentLogs: newRecentLogs(3)}
+	ip := net.ParseIP("10.0.0.1")
+	for i := 1; i <= 4; i++ {
+		w.writeLog(ip, []byte(fmt.Sprintf("line %d\n", i)))
+	}
+	c := &recentCommand{writer: w}
+	assert.Equal(t, "line 2\nline 3\nline 4", c.HandleSimpleCommand(0, "10.0.0.1"))
+	assert.Equal(t, "line 4", c.HandleSimpleCommand(0, "10.0.0.1,1"))
+	assert.Equal(t, "", c.HandleSimpleCommand(0, "10.0.0.2"))
+	assert.Equal(t, "usage: <ip>[,lines]", c.HandleSimpleCommand(0, ""))
+	assert.Equal(t, "invalid lines x", c.HandleSimpleCommand(0, "10.0.0.1 x"))
+
+	disabled := &recentCommand{writer: &syslogWriter{}}
+	assert.Contains(t, disabled.HandleSimpleCommand(0, "10.0.0.1"), "disabled")
+}
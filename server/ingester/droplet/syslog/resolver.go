@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	_HOSTNAME_CACHE_SIZE     = 4096
+	_HOSTNAME_LOOKUP_TIMEOUT = time.Second
+)
+
+type addrLookuper interface {
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+type hostnameEntry struct {
+	fqdn     string // 解析失败时为空
+	expireAt time.Time
+}
+
+// 将采集器IP反向解析为FQDN，结果(包括失败)缓存ttl时间，避免每条日志都查询DNS
+type hostnameResolver struct {
+	lookuper addrLookuper
+	ttl      time.Duration
+	entries  map[string]hostnameEntry
+
+	now func() time.Time
+}
+
+func newHostnameResolver(enabled bool, ttl time.Duration) *hostnameResolver {
+	if !enabled {
+		return nil
+	}
+	return &hostnameResolver{
+		lookuper: net.DefaultResolver,
+		ttl:      ttl,
+		entries:  make(map[string]hostnameEntry),
+		now:      time.Now,
+	}
+}
+
+// 返回ip对应的FQDN，未开启或解析失败时返回日志中的host
+func (r *hostnameResolver) resolve(ip net.IP, host string) string {
+	if r == nil || ip == nil {
+		return host
+	}
+	now := r.now()
+	key := ip.String()
+	entry, ok := r.entries[key]
+	if !ok || now.After(entry.expireAt) {
+		entry = hostnameEntry{fqdn: r.lookup(key), expireAt: now.Add(r.ttl)}
+		if !ok && len(r.entries) >= _HOSTNAME_CACHE_SIZE {
+			r.evict(now)
+		}
+		r.entries[key] = entry
+	}
+	if entry.fqdn == "" {
+		return host
+	}
+	return entry.fqdn
+}
+
+func (r *hostnameResolver) lookup(addr string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), _HOSTNAME_LOOKUP_TIMEOUT)
+	defer cancel()
+	names, err := r.lookuper.LookupAddr(ctx, addr)
+	if err != nil || len(names) == 0 {
+		log.Debugf("resolve hostname of %s failed: %v", addr, err)
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
+
+// 缓存满时先清理过期的条目，仍然不足时随机删除一个
+func (r *hostnameResolver) evict(now time.Time) {
+	for key, entry := range r.entries {
+		if now.After(entry.expireAt) {
+			delete(r.entries, key)
+		}
+	}
+	if len(r.entries) < _HOSTNAME_CACHE_SIZE {
+		return
+	}
+	for key := range r.entries {
+		delete(r.entries, key)
+		return
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLookuper struct {
+	names map[string][]string
+	calls map[string]int
+}
+
+func (l *mockLookuper) LookupAddr(_ context.Context, addr string) ([]string, error) {
+	l.calls[addr]++
+	if names, ok := l.names[addr]; ok {
+		return names, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func newTestHostnameResolver(ttl time.Duration) (*hostnameResolver, *mockLookuper) {
+	lookuper := &mockLookuper{
+		names: map[string][]string{"10.0.0.1": {"dfi-153.cluster-a.example.com."}},
+		calls: make(map[string]int),
+	}
+	r := newHostnameResolver(true, ttl)
+	r.lookuper = lookuper
+	return r, lookuper
+}
+
+func TestHostnameResolverCache(t *testing.T) {
+	now := time.Now()
+	r, lookuper := newTestHostnameResolver(time.Minute)
+	r.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "dfi-153.cluster-a.example.com", r.resolve(net.ParseIP("10.0.0.1"), "dfi-153"))
+		// 解析失败时使用日志中的host，失败结果同样缓存
+		assert.Equal(t, "dfi-153", r.resolve(net.ParseIP("10.0.0.2"), "dfi-153"))
+	}
+	assert.Equal(t, 1, lookuper.calls["10.0.0.1"])
+	assert.Equal(t, 1, lookuper.calls["10.0.0.2"])
+
+	// 过期后重新解析
+	now = now.Add(2 * time.Minute)
+	lookuper.names["10.0.0.2"] = []string{"dfi-153.cluster-b.example.com."}
+	assert.Equal(t, "dfi-153.cluster-b.example.com", r.resolve(net.ParseIP("10.0.0.2"), "dfi-153"))
+	assert.Equal(t, 2, lookuper.calls["10.0.0.2"])
+
+	assert.Nil(t, newHostnameResolver(false, time.Minute))
+	var disabled *hostnameResolver
+	assert.Equal(t, "dfi-153", disabled.resolve(net.ParseIP("10.0.0.1"), "dfi-153"))
+}
+
+func TestHostnameResolverBounded(t *testing.T) {
+	r, _ := newTestHostnameResolver(time.Minute)
+	ip := net.ParseIP("10.1.0.0").To4()
+	for i := 0; i < _HOSTNAME_CACHE_SIZE+10; i++ {
+		ip[2], ip[3] = byte(i>>8), byte(i)
+		r.resolve(ip, "host")
+	}
+	assert.Equal(t, _HOSTNAME_CACHE_SIZE, len(r.entries))
+}
+
+func TestWriteESWithHostFQDN(t *testing.T) {
+	es := newMockES()
+	defer es.server.Close()
+	r, _ := newTestHostnameResolver(time.Minute)
+	w := &syslogWriter{
+		levelToSeverity:  newLevelToSeverity(nil),
+		esLogger:         NewESLogger([]string{strings.TrimPrefix(es.server.URL, "http://")}, "", "", "test", false, 0, 0, ES_ROUTING_NONE, "", 0),
+		hostnameResolver: r,
+	}
+	waitESConnected(t, w.esLogger)
+	line := []byte("2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] a.go:1 started\n")
+	w.writeES(net.ParseIP("10.0.0.1"), line)
+	w.writeES(net.ParseIP("10.0.0.2"), line)
+	w.writeES(nil, nil)
+
+	assert.Contains(t, es.bulkBody, `"host":"dfi-153","host_fqdn":"dfi-153.cluster-a.example.com"`)
+	assert.Contains(t, es.bulkBody, `"host":"dfi-153","host_fqdn":"dfi-153"`)
+}
@@ -22,21 +22,85 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"sync/atomic"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
 	BUFSIZE = 4096
 )
 
+// 日志文件按天切分后的压缩方式
+const (
+	COMPRESSION_GZIP = "gzip"
+	COMPRESSION_ZSTD = "zstd"
+	COMPRESSION_NONE = "none"
+)
+
+var compressionExtensions = map[string]string{
+	COMPRESSION_GZIP: ".gz",
+	COMPRESSION_ZSTD: ".zst",
+}
+
+// 日志文件的目录结构
+const (
+	// 所有文件位于同一目录: <ip>.log -> <ip>.log.<YYYY-MM-DD>
+	SYSLOG_LAYOUT_FLAT = "flat"
+	// 按日期分目录: YYYY/MM/DD/<ip>.log
+	SYSLOG_LAYOUT_DATE = "date"
+
+	_DATE_LAYOUT_FORMAT = "2006/01/02"
+)
+
+type logFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// 打开日志文件，测试时可替换
+var openLogFile = func(filename string) (logFile, error) {
+	return os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+}
+
+// 当前时间，测试时可替换
+var timeNow = time.Now
+
+// 按日期分目录时t当天的日志文件
+func datePartitionedPath(directory, filename string, t time.Time) string {
+	return filepath.Join(directory, filepath.FromSlash(t.Format(_DATE_LAYOUT_FORMAT)), filename)
+}
+
 type DailyRotateWriter struct {
 	filename string
-	fp       *os.File
+	fp       logFile
 	bw       *bufio.Writer
+	// Flush后是否调用fsync落盘，开启后更可靠但会显著降低写入吞吐
+	syncOnFlush      bool
+	compressionCodec string
+	// 非nil时每次按天切分加1
+	rotations *uint64
+	// 非空时按日期分目录，当天的文件为dateDirectory/YYYY/MM/DD/filename
+	dateDirectory string
+	// 按日期分目录时当前打开的文件
+	current string
+}
+
+func NewRotateWriter(filename string, syncOnFlush bool, compressionCodec string) *DailyRotateWriter {
+	if compressionCodec == "" {
+		compressionCodec = COMPRESSION_GZIP
+	}
+	return &DailyRotateWriter{filename: filename, syncOnFlush: syncOnFlush, compressionCodec: compressionCodec}
 }
 
-func NewRotateWriter(filename string) *DailyRotateWriter {
-	return &DailyRotateWriter{filename: filename}
+// NewDateRotateWriter 在directory下按日期分目录写入filename，切分时压缩前一天目录中的文件
+func NewDateRotateWriter(directory, filename string, syncOnFlush bool, compressionCodec string) *DailyRotateWriter {
+	w := NewRotateWriter(filename, syncOnFlush, compressionCodec)
+	w.dateDirectory = directory
+	return w
 }
 
 func (w *DailyRotateWriter) logFilename(t time.Time) string {
@@ -45,7 +109,7 @@ func (w *DailyRotateWriter) logFilename(t time.Time) string {
 
 func (w *DailyRotateWriter) ensureLogFile() error {
 	// 调用前确保filename没打开
-	now := time.Now()
+	now := timeNow()
 	nowFilename := w.logFilename(now)
 	// check file
 	if fs, err := os.Lstat(w.filename); !os.IsNotExist(err) {
@@ -74,13 +138,9 @@ func (w *DailyRotateWriter) ensureLogFile() error {
 					log.Warningf("os.Remove() %s failed: %v", w.filename, err)
 					return err
 				}
-				if err = compressLogFile(linked); err != nil {
-					log.Warningf("compress %s failed: %v", linked, err)
+				if err = w.compressRotated(linked); err != nil {
 					return err
 				}
-				if err = os.Remove(linked); err != nil {
-					log.Warningf("remove %s failed: %v", linked, err)
-				}
 			}
 		} else {
 			// 如果是个文本，改名字
@@ -99,10 +159,60 @@ func (w *DailyRotateWriter) ensureLogFile() error {
 
 func (w *DailyRotateWriter) checkLogFile() bool {
 	linked, err := os.Readlink(w.filename)
-	return err == nil && linked == w.logFilename(time.Now())
+	return err == nil && linked == w.logFilename(timeNow())
 }
 
-func compressLogFile(filename string) error {
+// 压缩已切分的日志文件并删除原文件
+func (w *DailyRotateWriter) compressRotated(filename string) error {
+	if w.rotations != nil {
+		atomic.AddUint64(w.rotations, 1)
+	}
+	if w.compressionCodec == COMPRESSION_NONE {
+		return nil
+	}
+	if err := compressLogFile(filename, w.compressionCodec); err != nil {
+		log.Warningf("compress %s failed: %v", filename, err)
+		return err
+	}
+	if err := os.Remove(filename); err != nil {
+		log.Warningf("remove %s failed: %v", filename, err)
+	}
+	return nil
+}
+
+// 按日期分目录时创建当天的目录，前一天的文件未压缩时(如写入方已关闭)先压缩
+func (w *DailyRotateWriter) ensureDateLogFile() (string, error) {
+	now := timeNow()
+	filename := datePartitionedPath(w.dateDirectory, w.filename, now)
+	previous := w.current
+	if previous == "" {
+		previous = datePartitionedPath(w.dateDirectory, w.filename, now.AddDate(0, 0, -1))
+	}
+	if previous != filename {
+		if _, err := os.Stat(previous); err == nil {
+			w.compressRotated(previous)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		log.Warningf("os.MkdirAll() %s failed: %v", filepath.Dir(filename), err)
+		return "", err
+	}
+	w.current = filename
+	return filename, nil
+}
+
+func newCompressWriter(codec string, w io.Writer) (io.WriteCloser, error) {
+	switch codec {
+	case COMPRESSION_GZIP:
+		return gzip.NewWriter(w), nil
+	case COMPRESSION_ZSTD:
+		return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %s", codec)
+	}
+}
+
+func compressLogFile(filename, codec string) error {
 	// 先关闭文件再调用这个
 	iFile, err := os.Open(filename)
 	if err != nil {
@@ -110,15 +220,21 @@ func compressLogFile(filename string) error {
 	}
 	defer iFile.Close()
 
-	gzFilename := filename + ".gz"
-	oFile, err := os.Create(gzFilename)
+	extension, ok := compressionExtensions[codec]
+	if !ok {
+		return fmt.Errorf("unsupported compression codec %s", codec)
+	}
+	oFile, err := os.Create(filename + extension)
 	if err != nil {
 		return err
 	}
 	defer oFile.Close()
 
 	bufWriter := bufio.NewWriterSize(oFile, _FILE_BUFFER_SIZE)
-	writer := gzip.NewWriter(bufWriter)
+	writer, err := newCompressWriter(codec, bufWriter)
+	if err != nil {
+		return err
+	}
 	buffer := make([]byte, BUFSIZE)
 	for {
 		n, err := iFile.Read(buffer)
@@ -134,16 +250,23 @@ func compressLogFile(filename string) error {
 			return fmt.Errorf("%d of %d bytes written", m, n)
 		}
 	}
-	writer.Close()
+	if err = writer.Close(); err != nil {
+		return err
+	}
 	return bufWriter.Flush()
 }
 
 func (w *DailyRotateWriter) Write(p []byte) (n int, err error) {
 	if w.fp == nil {
-		if err = w.ensureLogFile(); err != nil {
+		filename := w.filename
+		if w.dateDirectory != "" {
+			if filename, err = w.ensureDateLogFile(); err != nil {
+				return 0, err
+			}
+		} else if err = w.ensureLogFile(); err != nil {
 			return 0, err
 		}
-		w.fp, err = os.OpenFile(w.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		w.fp, err = openLogFile(filename)
 		if err != nil {
 			return 0, err
 		}
@@ -157,7 +280,20 @@ func (w *DailyRotateWriter) Flush() error {
 		return nil
 	}
 	w.bw.Flush()
-	w.fp.Sync()
+	if w.syncOnFlush {
+		w.fp.Sync()
+	}
+	if w.dateDirectory != "" {
+		// 跨天后关闭并压缩前一天的文件，再次写入时在新一天的目录中创建
+		if w.current != datePartitionedPath(w.dateDirectory, w.filename, timeNow()) {
+			w.bw = nil
+			w.fp.Close()
+			w.fp = nil
+			_, err := w.ensureDateLogFile()
+			return err
+		}
+		return nil
+	}
 	if !w.checkLogFile() {
 		w.bw = nil
 		w.fp.Close()
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockLogFile struct {
+	bytes.Buffer
+	syncCount  int
+	closeCount int
+}
+
+func (f *mockLogFile) Sync() error {
+	f.syncCount++
+	return nil
+}
+
+func (f *mockLogFile) Close() error {
+	f.closeCount++
+	return nil
+}
+
+func withMockLogFile(t *testing.T) *mockLogFile {
+	file := &mockLogFile{}
+	origin := openLogFile
+	openLogFile = func(string) (logFile, error) {
+		return file, nil
+	}
+	t.Cleanup(func() { openLogFile = origin })
+	return file
+}
+
+func TestRotateWriterSyncOnFlush(t *testing.T) {
+	file := withMockLogFile(t)
+	w := NewRotateWriter(filepath.Join(t.TempDir(), "10.0.0.1.log"), true, COMPRESSION_GZIP)
+	w.Write([]byte("line 1\n"))
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, "line 1\n", file.String())
+	assert.Equal(t, 1, file.syncCount)
+
+	w.Write([]byte("line 2\n"))
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, 2, file.syncCount)
+	assert.Equal(t, 0, file.closeCount)
+}
+
+func TestRotateWriterNoSyncOnFlush(t *testing.T) {
+	file := withMockLogFile(t)
+	w := NewRotateWriter(filepath.Join(t.TempDir(), "10.0.0.1.log"), false, COMPRESSION_GZIP)
+	w.Write([]byte("line 1\n"))
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, "line 1\n", file.String())
+	assert.Equal(t, 0, file.syncCount)
+}
+
+func newTestLogContent() []byte {
+	var content bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&content, "2023-01-01T00:00:00 INFO [trident] line %d\n", i)
+	}
+	return content.Bytes()
+}
+
+func TestCompressLogFileZstd(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "10.0.0.1.log.2023-01-01")
+	content := newTestLogContent()
+	assert.Nil(t, os.WriteFile(filename, content, 0644))
+
+	assert.Nil(t, compressLogFile(filename, COMPRESSION_ZSTD))
+	file, err := os.Open(filename + ".zst")
+	assert.Nil(t, err)
+	defer file.Close()
+	decoder, err := zstd.NewReader(file)
+	assert.Nil(t, err)
+	defer decoder.Close()
+	decompressed, err := io.ReadAll(decoder)
+	assert.Nil(t, err)
+	assert.Equal(t, content, decompressed)
+}
+
+func TestCompressLogFileGzip(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "10.0.0.1.log.2023-01-01")
+	content := newTestLogContent()
+	assert.Nil(t, os.WriteFile(filename, content, 0644))
+
+	assert.Nil(t, compressLogFile(filename, COMPRESSION_GZIP))
+	file, err := os.Open(filename + ".gz")
+	assert.Nil(t, err)
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	assert.Nil(t, err)
+	decompressed, err := io.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content, decompressed)
+
+	assert.NotNil(t, compressLogFile(filename, COMPRESSION_NONE))
+}
+
+func withMockNow(t *testing.T, now *time.Time) {
+	origin := timeNow
+	timeNow = func() time.Time { return *now }
+	t.Cleanup(func() { timeNow = origin })
+}
+
+func TestDateRotateWriter(t *testing.T) {
+	directory := t.TempDir()
+	now := time.Date(2023, 5, 10, 23, 0, 0, 0, time.Local)
+	withMockNow(t, &now)
+	var rotations uint64
+	w := NewDateRotateWriter(directory, "10.0.0.1.log", false, COMPRESSION_GZIP)
+	w.rotations = &rotations
+
+	w.Write([]byte("line 1\n"))
+	assert.Nil(t, w.Flush())
+	content, err := os.ReadFile(filepath.Join(directory, "2023", "05", "10", "10.0.0.1.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, "line 1\n", string(content))
+
+	// 跨天后压缩前一天的文件，并创建新一天的目录
+	now = now.Add(2 * time.Hour)
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, uint64(1), rotations)
+	assert.Equal(t, []string{"10.0.0.1.log.gz"}, listDir(t, filepath.Join(directory, "2023", "05", "10")))
+	assert.Empty(t, listDir(t, filepath.Join(directory, "2023", "05", "11")))
+
+	w.Write([]byte("line 2\n"))
+	assert.Nil(t, w.Close())
+	content, err = os.ReadFile(filepath.Join(directory, "2023", "05", "11", "10.0.0.1.log"))
+	assert.Nil(t, err)
+	assert.Equal(t, "line 2\n", string(content))
+
+	// 写入方关闭后跨天，重新打开时压缩前一天未压缩的文件
+	now = now.AddDate(0, 0, 1)
+	w = NewDateRotateWriter(directory, "10.0.0.1.log", false, COMPRESSION_GZIP)
+	w.Write([]byte("line 3\n"))
+	assert.Nil(t, w.Close())
+	assert.Equal(t, []string{"10.0.0.1.log.gz"}, listDir(t, filepath.Join(directory, "2023", "05", "11")))
+	assert.Equal(t, []string{"10.0.0.1.log"}, listDir(t, filepath.Join(directory, "2023", "05", "12")))
+}
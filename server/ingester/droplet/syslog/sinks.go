@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// 写文件和写ES的一条日志，bytes为nil时表示flush；done非nil时表示同步点，之前的日志写完后关闭
+type sinkMessage struct {
+	ip    net.IP
+	bytes []byte
+	done  chan struct{}
+}
+
+// 独立goroutine消费的输出通道，缓冲满时丢弃日志并计数，避免慢的输出拖慢其他输出
+type asyncSink struct {
+	name    string
+	ch      chan sinkMessage
+	write   func(ip net.IP, bytes []byte)
+	dropped uint64
+	done    chan struct{}
+}
+
+func newAsyncSink(name string, bufferSize int, write func(ip net.IP, bytes []byte)) *asyncSink {
+	s := &asyncSink{
+		name:  name,
+		ch:    make(chan sinkMessage, bufferSize),
+		write: write,
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// 不阻塞调用方，缓冲满时丢弃；flush消息丢弃时不计数，下一个周期会再次flush
+func (s *asyncSink) put(ip net.IP, bytes []byte) {
+	select {
+	case s.ch <- sinkMessage{ip: ip, bytes: bytes}:
+	default:
+		if bytes != nil {
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+func (s *asyncSink) run() {
+	for msg := range s.ch {
+		if msg.done != nil {
+			close(msg.done)
+			continue
+		}
+		s.write(msg.ip, msg.bytes)
+	}
+	close(s.done)
+}
+
+// 阻塞直到调用前已缓冲的日志全部写完
+func (s *asyncSink) sync() {
+	done := make(chan struct{})
+	s.ch <- sinkMessage{done: done}
+	<-done
+}
+
+// 停止接收日志，并等待已缓冲的日志写完
+func (s *asyncSink) close() {
+	close(s.ch)
+	<-s.done
+}
+
+// 返回自上次调用以来丢弃的日志条数
+func (s *asyncSink) takeDropped() uint64 {
+	return atomic.SwapUint64(&s.dropped, 0)
+}
+
+func (s *asyncSink) report() {
+	if dropped := s.takeDropped(); dropped > 0 {
+		log.Warningf("syslog %s sink buffer(%d) full, dropped %d logs", s.name, cap(s.ch), dropped)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncSinksSlowES(t *testing.T) {
+	w := newTestFileWriter(t.TempDir())
+	w.fileSink = newAsyncSink("file", 1000, w.writeFile)
+
+	// ES写入被阻塞，模拟ES变慢
+	release := make(chan struct{})
+	lock := sync.Mutex{}
+	esLines := []string{}
+	w.esSink = newAsyncSink("es", 4, func(_ net.IP, bytes []byte) {
+		<-release
+		lock.Lock()
+		esLines = append(esLines, string(bytes))
+		lock.Unlock()
+	})
+
+	ip := net.ParseIP("10.0.0.1")
+	expected := make([]string, 0, 100)
+	buffer := make([]byte, 0, 16)
+	for i := 0; i < 100; i++ {
+		// 复用同一块缓冲，模拟接收缓冲被回收
+		buffer = append(buffer[:0], fmt.Sprintf("line %d\n", i)...)
+		w.writeLog(ip, buffer)
+		expected = append(expected, fmt.Sprintf("line %d", i))
+	}
+	w.fileSink.close()
+
+	lines, err := w.TailLog(ip, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, lines)
+	assert.Equal(t, uint64(0), w.fileSink.takeDropped())
+
+	close(release)
+	w.esSink.close()
+	dropped := w.esSink.takeDropped()
+	assert.True(t, dropped > 0)
+	assert.Equal(t, 100, len(esLines)+int(dropped))
+	for i, line := range esLines {
+		assert.Equal(t, expected[i]+"\n", line)
+	}
+}
+
+func TestAsyncSinkFlushNotCounted(t *testing.T) {
+	release := make(chan struct{})
+	sink := newAsyncSink("es", 1, func(_ net.IP, _ []byte) { <-release })
+	for i := 0; i < 10; i++ {
+		sink.put(nil, nil)
+	}
+	assert.Equal(t, uint64(0), sink.takeDropped())
+	close(release)
+	sink.close()
+}
@@ -18,20 +18,28 @@ package syslog
 
 import (
 	"bytes"
+	"container/list"
+	"encoding/json"
 	"errors"
 	"log/syslog"
 	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/deepflowio/deepflow/server/libs/codec"
 	logging "github.com/op/go-logging"
 
+	"github.com/deepflowio/deepflow/server/ingester/common"
+	"github.com/deepflowio/deepflow/server/ingester/droplet/config"
+	"github.com/deepflowio/deepflow/server/ingester/ingesterctl"
+	"github.com/deepflowio/deepflow/server/libs/debug"
 	"github.com/deepflowio/deepflow/server/libs/queue"
 	"github.com/deepflowio/deepflow/server/libs/receiver"
-	"github.com/deepflowio/deepflow/server/libs/utils"
 )
 
 var log = logging.MustGetLogger("droplet.syslog")
@@ -50,23 +58,84 @@ const (
 type fileWriter struct {
 	fileBuffer *DailyRotateWriter
 
-	feed int
+	feed    int
+	element *list.Element
 }
 
 type syslogWriter struct {
 	directory        string
 	logToFileEnabled bool
 
-	index   int
-	fileMap map[uint32]*fileWriter
-	in      queue.QueueReader
+	index    int
+	fileLock sync.Mutex
+	fileMap  map[string]*fileWriter
+	// 按最近写入时间排序的文件(ip字符串)，队首最新，打开的文件数达到maxOpenFiles时关闭队尾的文件
+	fileLRU      *list.List
+	maxOpenFiles int
+	syncOnFlush  bool
+	// 按天切分后日志文件的压缩方式: gzip/zstd/none
+	compressionCodec string
+	// 日志文件的目录结构: flat/date
+	fileLayout string
+	// 为nil时所有ip都写入文件，由fileLock保护
+	fileFilter *ipFileFilter
+	in         queue.QueueReader
 
 	esLogger *ESLogger
+
+	rateLimiter     *ipRateLimiter
+	recentLogs      *recentLogs
+	levelToSeverity map[string]syslog.Priority
+	decompressor    *frameDecompressor
+	// 为nil时不解析采集器IP对应的FQDN
+	hostnameResolver *hostnameResolver
+	// 为nil时丢弃写入ES时解析失败的日志
+	deadLetter *deadLetterWriter
+
+	// 非nil时文件和ES分别在独立goroutine中写入，互不阻塞
+	fileSink *asyncSink
+	esSink   *asyncSink
+
+	// 背压状态及统计，由run更新，GetCounter读取
+	pressure          uint64
+	backpressure      uint32
+	backpressureTrips uint64
+	backpressureWaits uint64
+
+	// 打开的日志文件数及按天切分、因打开文件数上限关闭的次数，由fileLock保护的写入方更新，GetCounter读取
+	openFiles     uint64
+	fileRotations uint64
+	fileEvictions uint64
 }
 
 func (w *syslogWriter) create(ip net.IP) *fileWriter {
-	fileName := filepath.Join(w.directory, ip.String()+".log")
-	return &fileWriter{NewRotateWriter(fileName), _FILE_FEED}
+	var fileBuffer *DailyRotateWriter
+	if w.fileLayout == SYSLOG_LAYOUT_DATE {
+		fileBuffer = NewDateRotateWriter(w.directory, ip.String()+".log", w.syncOnFlush, w.compressionCodec)
+	} else {
+		fileBuffer = NewRotateWriter(filepath.Join(w.directory, ip.String()+".log"), w.syncOnFlush, w.compressionCodec)
+	}
+	fileBuffer.rotations = &w.fileRotations
+	return &fileWriter{fileBuffer: fileBuffer, feed: _FILE_FEED}
+}
+
+// 关闭已打开的文件，调用方需持有fileLock
+func (w *syslogWriter) closeFile(key string, writer *fileWriter) {
+	writer.fileBuffer.Close()
+	w.fileLRU.Remove(writer.element)
+	delete(w.fileMap, key)
+	atomic.StoreUint64(&w.openFiles, uint64(len(w.fileMap)))
+}
+
+// 关闭最久未写入的文件，再次写入时重新打开
+func (w *syslogWriter) evictFile() {
+	element := w.fileLRU.Back()
+	if element == nil {
+		return
+	}
+	key := element.Value.(string)
+	w.closeFile(key, w.fileMap[key])
+	atomic.AddUint64(&w.fileEvictions, 1)
 }
 
 func (w *syslogWriter) write(writer *fileWriter, bytes []byte) {
@@ -78,73 +147,297 @@ func (w *syslogWriter) writeFile(ip net.IP, bytes []byte) {
 	if !w.logToFileEnabled {
 		return
 	}
+	w.fileLock.Lock()
+	defer w.fileLock.Unlock()
 	if bytes == nil {
 		// tick
 		for key, value := range w.fileMap {
 			value.fileBuffer.Flush()
 			value.feed--
 			if value.feed == 0 {
-				value.fileBuffer.Close()
-				delete(w.fileMap, key)
+				w.closeFile(key, value)
 			}
 		}
 		return
 	}
-	hash := utils.GetIpHash(ip)
-	if _, in := w.fileMap[hash]; !in {
-		w.fileMap[hash] = w.create(ip)
+	// 以ip字符串为key，与日志文件名保持一致，避免hash冲突时不同ip写入同一文件
+	key := ip.String()
+	if !w.fileFilter.enabled(key) {
+		return
+	}
+	writer, in := w.fileMap[key]
+	if !in {
+		if w.maxOpenFiles > 0 && len(w.fileMap) >= w.maxOpenFiles {
+			w.evictFile()
+		}
+		writer = w.create(ip)
+		writer.element = w.fileLRU.PushFront(key)
+		w.fileMap[key] = writer
+		atomic.StoreUint64(&w.openFiles, uint64(len(w.fileMap)))
+	} else {
+		w.fileLRU.MoveToFront(writer.element)
 	}
-	w.write(w.fileMap[hash], bytes)
+	w.write(writer, bytes)
 }
 
-func (w *syslogWriter) writeES(bytes []byte) {
+func (w *syslogWriter) writeES(ip net.IP, bytes []byte) {
 	if w.esLogger == nil {
 		return
 	}
 	if bytes == nil {
 		// tick
 		w.esLogger.Flush()
+		w.deadLetter.flush()
 		return
 	}
-	if esLog, err := parseSyslog(bytes); err == nil {
+	if esLog, err := parseSyslog(bytes, w.levelToSeverity); err == nil {
+		if w.hostnameResolver != nil {
+			esLog.HostFQDN = w.hostnameResolver.resolve(ip, esLog.Host)
+		}
+		if ip != nil {
+			esLog.SourceIP = ip.String()
+		}
 		w.esLogger.Log(esLog)
 	} else {
 		log.Debug("invalid log message for es:", err)
+		w.deadLetter.write(ip, bytes, err)
 	}
 }
 
-func parseSyslog(bs []byte) (*ESLog, error) {
+func (w *syslogWriter) writeLog(ip net.IP, bytes []byte) {
+	if !w.rateLimiter.allow(ip) {
+		return
+	}
+	w.recentLogs.add(ip, bytes)
+	if w.fileSink == nil && w.esSink == nil {
+		w.writeFile(ip, bytes)
+		w.writeES(ip, bytes)
+		return
+	}
+	// bytes所在的接收缓冲会被立即释放，异步写入前需要复制
+	line := append([]byte(nil), bytes...)
+	if w.fileSink != nil {
+		w.fileSink.put(ip, line)
+	} else {
+		w.writeFile(ip, line)
+	}
+	if w.esSink != nil {
+		w.esSink.put(ip, line)
+	} else {
+		w.writeES(ip, line)
+	}
+}
+
+func (w *syslogWriter) writeFrame(ip net.IP, frame []byte) {
+	err := w.decompressor.decodeFrame(frame, func(line []byte) {
+		w.writeLog(ip, line)
+	})
+	if err != nil {
+		log.Warningf("decompress syslog frame from %s failed: %s", ip, err)
+	}
+}
+
+func (w *syslogWriter) flush() {
+	if w.fileSink != nil {
+		w.fileSink.put(nil, nil)
+		w.fileSink.report()
+	} else {
+		w.writeFile(nil, nil)
+	}
+	if w.esSink != nil {
+		w.esSink.put(nil, nil)
+		w.esSink.report()
+	} else {
+		w.writeES(nil, nil)
+	}
+	w.rateLimiter.report()
+	w.recentLogs.evictIdle()
+}
+
+// 为启用的输出分别创建异步写入通道，bufferSize为0时保持同步写入
+func (w *syslogWriter) startSinks(bufferSize int) {
+	if bufferSize <= 0 {
+		return
+	}
+	if w.logToFileEnabled {
+		w.fileSink = newAsyncSink("file", bufferSize, w.writeFile)
+	}
+	if w.esLogger != nil {
+		w.esSink = newAsyncSink("es", bufferSize, w.writeES)
+	}
+}
+
+var defaultLevelToSeverity = map[string]syslog.Priority{
+	"DEBUG": syslog.LOG_DEBUG,
+	"INFO":  syslog.LOG_INFO,
+	"WARN":  syslog.LOG_WARNING,
+	"ERRO":  syslog.LOG_ERR,
+	"ERROR": syslog.LOG_ERR,
+	"FATAL": syslog.LOG_CRIT,
+	"CRIT":  syslog.LOG_CRIT,
+}
+
+var severityNames = map[string]syslog.Priority{
+	"emerg":   syslog.LOG_EMERG,
+	"alert":   syslog.LOG_ALERT,
+	"crit":    syslog.LOG_CRIT,
+	"err":     syslog.LOG_ERR,
+	"warning": syslog.LOG_WARNING,
+	"notice":  syslog.LOG_NOTICE,
+	"info":    syslog.LOG_INFO,
+	"debug":   syslog.LOG_DEBUG,
+}
+
+// 在默认的日志级别映射上叠加自定义映射，key为日志中的级别字符串(不含[])，value为severity名称(如warning)
+func newLevelToSeverity(levelMapping map[string]string) map[string]syslog.Priority {
+	levelToSeverity := make(map[string]syslog.Priority, len(defaultLevelToSeverity)+len(levelMapping))
+	for level, severity := range defaultLevelToSeverity {
+		levelToSeverity[level] = severity
+	}
+	for level, name := range levelMapping {
+		severity, ok := severityNames[strings.ToLower(name)]
+		if !ok {
+			log.Warningf("invalid syslog severity %s for level %s", name, level)
+			continue
+		}
+		levelToSeverity[level] = severity
+	}
+	return levelToSeverity
+}
+
+// RFC 3164 facility编码对应的名称
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// 解析并去掉行首的PRI(如<30>)，返回facility名称，不存在或非法时返回空字符串
+func parseFacility(bs []byte) (string, []byte) {
+	if len(bs) == 0 || bs[0] != '<' {
+		return "", bs
+	}
+	end := bytes.IndexByte(bs, '>')
+	if end < 2 || end > 4 {
+		return "", bs
+	}
+	pri, err := strconv.Atoi(string(bs[1:end]))
+	if err != nil || pri < 0 || pri/8 >= len(facilityNames) {
+		return "", bs
+	}
+	return facilityNames[pri/8], bs[end+1:]
+}
+
+// 从tag(如trident[8642]:)中提取程序名
+func parseProgram(tag []byte) string {
+	tag = bytes.TrimSuffix(tag, []byte{':'})
+	if i := bytes.IndexByte(tag, '['); i >= 0 {
+		tag = tag[:i]
+	}
+	return string(tag)
+}
+
+func parseSyslog(bs []byte, levelToSeverity map[string]syslog.Priority) (*ESLog, error) {
 	// example log
 	// 2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] synchronizer.go:397 update FlowAcls version  1605685133 to 1605685134
+	// 行首可能带有PRI，如<30>2020-11-23T16:56:35+08:00 ...
+	// 新版本采集器的正文可能为JSON，如 2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"ts":"...","level":"error","msg":"..."}
+	facility, bs := parseFacility(bs)
+	if header := bytes.SplitN(bs, []byte{' '}, 4); len(header) == 4 {
+		if body := bytes.TrimSpace(header[3]); len(body) > 0 && body[0] == '{' {
+			fields := make(map[string]json.RawMessage)
+			if json.Unmarshal(body, &fields) == nil {
+				return parseJSONLog(header, fields, facility, levelToSeverity)
+			}
+		}
+	}
+
 	columns := bytes.SplitN(bs, []byte{' '}, 6)
 	if len(columns) != 6 {
 		return nil, errors.New("not enough columns in log")
 	}
-	esLog := ESLog{Type: LOG_TYPE, Module: LOG_MODULE}
-	datetime, err := time.Parse(time.RFC3339, string(columns[0]))
+	esLog, err := parseSyslogHeader(columns, facility)
 	if err != nil {
 		return nil, err
 	}
-	esLog.Timestamp = uint32(datetime.Unix())
-	esLog.Host = string(columns[1])
-	severity := syslog.Priority(0)
-	switch string(columns[3]) {
-	case "[INFO]":
-		severity = syslog.LOG_INFO
-	case "[WARN]":
-		severity = syslog.LOG_WARNING
-	case "[ERRO]", "[ERROR]":
-		severity = syslog.LOG_ERR
-	default:
+	level := columns[3]
+	if len(level) < 2 || level[0] != '[' || level[len(level)-1] != ']' {
+		return nil, errors.New("invalid log level: " + string(level))
+	}
+	severity, ok := levelToSeverity[string(level[1:len(level)-1])]
+	if !ok {
 		return nil, errors.New("ignored log level: " + string(columns[3]))
 	}
 	esLog.Severity = strconv.Itoa(int(severity))
 	esLog.SyslogTag = string(columns[4])
 	esLog.Message = string(columns[5])
-	return &esLog, nil
+	return esLog, nil
+}
+
+// 解析时间、主机名、程序名三列
+func parseSyslogHeader(columns [][]byte, facility string) (*ESLog, error) {
+	esLog := &ESLog{Type: LOG_TYPE, Module: LOG_MODULE}
+	if facility != "" {
+		esLog.Type = facility
+	}
+	if program := parseProgram(columns[2]); program != "" {
+		esLog.Module = program
+	}
+	datetime, err := time.Parse(time.RFC3339, string(columns[0]))
+	if err != nil {
+		return nil, err
+	}
+	esLog.Timestamp = uint32(datetime.Unix())
+	esLog.Host = string(columns[1])
+	return esLog, nil
 }
 
-func NewSyslogWriter(in queue.QueueReader, logToFileEnabled, esEnabled bool, directory string, esAddresses []string, esUsername, esPassword string) *syslogWriter {
+// ts/level/msg映射到ESLog，其他字段保留在StructuredData中；ts缺失时使用syslog头中的时间
+func parseJSONLog(header [][]byte, fields map[string]json.RawMessage, facility string, levelToSeverity map[string]syslog.Priority) (*ESLog, error) {
+	esLog, err := parseSyslogHeader(header, facility)
+	if err != nil {
+		return nil, err
+	}
+	if raw, ok := fields["ts"]; ok {
+		var ts string
+		var unixTs float64
+		if json.Unmarshal(raw, &ts) == nil {
+			datetime, err := time.Parse(time.RFC3339, ts)
+			if err != nil {
+				return nil, err
+			}
+			esLog.Timestamp = uint32(datetime.Unix())
+		} else if json.Unmarshal(raw, &unixTs) == nil {
+			esLog.Timestamp = uint32(unixTs)
+		} else {
+			return nil, errors.New("invalid log ts: " + string(raw))
+		}
+		delete(fields, "ts")
+	}
+	var level string
+	if err := json.Unmarshal(fields["level"], &level); err != nil {
+		return nil, errors.New("invalid log level: " + string(fields["level"]))
+	}
+	severity, ok := levelToSeverity[strings.ToUpper(level)]
+	if !ok {
+		return nil, errors.New("ignored log level: " + level)
+	}
+	esLog.Severity = strconv.Itoa(int(severity))
+	delete(fields, "level")
+	if raw, ok := fields["msg"]; ok {
+		if err := json.Unmarshal(raw, &esLog.Message); err != nil {
+			return nil, errors.New("invalid log msg: " + string(raw))
+		}
+		delete(fields, "msg")
+	}
+	if len(fields) > 0 {
+		esLog.StructuredData = fields
+	}
+	return esLog, nil
+}
+
+func NewSyslogWriter(in queue.QueueReader, cfg *config.Config) *syslogWriter {
+	logToFileEnabled, esEnabled, directory := cfg.AgentLogToFile, cfg.ESSyslog, cfg.SyslogDirectory
 	if logToFileEnabled {
 		if err := os.MkdirAll(directory, os.ModePerm); err != nil {
 			log.Warningf("cannot output syslog to directory %s: %v", directory, err)
@@ -153,15 +446,43 @@ func NewSyslogWriter(in queue.QueueReader, logToFileEnabled, esEnabled bool, dir
 	}
 	var esLogger *ESLogger
 	if esEnabled {
-		esLogger = NewESLogger(esAddresses, esUsername, esPassword)
+		esLogger = NewESLogger(cfg.ESHostPorts, cfg.ESAuth.User, cfg.ESAuth.Password, cfg.ESSyslogIndex, cfg.ESSyslogGzip,
+			time.Duration(cfg.ESSyslogRequestTimeout)*time.Second, cfg.ESSyslogMaxIdleConns, cfg.ESSyslogRouting,
+			filepath.Join(directory, _ES_WAL_LOG), cfg.ESSyslogWALMaxDocs)
 	}
 	writer := &syslogWriter{
 		logToFileEnabled: logToFileEnabled,
 		directory:        directory,
-		fileMap:          make(map[uint32]*fileWriter, 8),
+		fileMap:          make(map[string]*fileWriter, 8),
+		fileLRU:          list.New(),
+		maxOpenFiles:     cfg.SyslogMaxOpenFiles,
+		syncOnFlush:      cfg.SyslogSyncOnFlush,
+		compressionCodec: cfg.SyslogCompressionCodec,
+		fileLayout:       cfg.SyslogFileLayout,
 		in:               in,
 		esLogger:         esLogger,
+		rateLimiter:      newIPRateLimiter(cfg.SyslogRateLimit),
+		recentLogs:       newRecentLogs(cfg.SyslogRecentLogs),
+		levelToSeverity:  newLevelToSeverity(cfg.SyslogLevelMapping),
+		decompressor:     &frameDecompressor{},
+		hostnameResolver: newHostnameResolver(cfg.SyslogResolveHostname, time.Duration(cfg.SyslogHostnameCacheTTL)*time.Second),
+	}
+	if esEnabled {
+		// 仅写入ES时解析日志
+		writer.deadLetter = newDeadLetterWriter(cfg.SyslogParseErrorLog, directory, cfg.SyslogSyncOnFlush, cfg.SyslogCompressionCodec)
+	}
+
+	writer.startSinks(cfg.SyslogSinkBufferSize)
+	common.RegisterCountableForIngester("syslog_writer", writer)
+
+	debug.ServerRegisterSimple(ingesterctl.CMD_SYSLOG_FLUSH, &flushCommand{writer: writer})
+	debug.ServerRegisterSimple(ingesterctl.CMD_SYSLOG_RECENT, &recentCommand{writer: writer})
+	if logToFileEnabled {
+		debug.ServerRegisterSimple(ingesterctl.CMD_SYSLOG_TAIL, &tailCommand{writer: writer})
+		debug.ServerRegisterSimple(ingesterctl.CMD_SYSLOG_PURGE, &purgeCommand{writer: writer, enabled: cfg.SyslogPurgeEnabled})
 	}
+	// 配置端口后未开启写文件时也启动，以便调用方区分"未写文件"和"服务不可达"
+	writer.startBundleServer(cfg.SyslogBundleAddress, cfg.SyslogBundlePort)
 
 	go writer.run()
 	return writer
@@ -172,28 +493,26 @@ func (w *syslogWriter) run() {
 	decoder := &codec.SimpleDecoder{}
 
 	for {
+		w.throttle()
 		n := w.in.Gets(packets)
 		for i := 0; i < n; i++ {
 			value := packets[i]
 			if receiveBuffer, ok := value.(*receiver.RecvBuffer); ok {
 				bytes := receiveBuffer.Buffer[receiveBuffer.Begin:receiveBuffer.End]
 				if receiveBuffer.SocketType == receiver.UDP {
-					w.writeFile(receiveBuffer.IP, bytes)
-					w.writeES(bytes)
+					w.writeLog(receiveBuffer.IP, bytes)
 				} else {
 					decoder.Init(bytes)
 					for !decoder.IsEnd() {
 						syslog := decoder.ReadBytes()
 						if syslog != nil {
-							w.writeFile(receiveBuffer.IP, syslog)
-							w.writeES(syslog)
+							w.writeFrame(receiveBuffer.IP, syslog)
 						}
 					}
 				}
 				receiver.ReleaseRecvBuffer(receiveBuffer)
 			} else if value == nil { // flush ticker
-				w.writeFile(nil, nil)
-				w.writeES(nil)
+				w.flush()
 			} else {
 				log.Warning("get queue data type wrong")
 			}
@@ -0,0 +1,345 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"encoding/json"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/deepflowio/deepflow/server/libs/utils"
+)
+
+func TestRateLimitPerIP(t *testing.T) {
+	now := time.Now()
+	limiter := newIPRateLimiter(10)
+	limiter.now = func() time.Time { return now }
+	w := &syslogWriter{rateLimiter: limiter}
+
+	noisyIP := net.ParseIP("10.0.0.1")
+	quietIP := net.ParseIP("10.0.0.2")
+	line := []byte("2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] synchronizer.go:397 test")
+	for i := 0; i < 15; i++ {
+		w.writeLog(noisyIP, line)
+	}
+	for i := 0; i < 5; i++ {
+		w.writeLog(quietIP, line)
+	}
+	assert.Equal(t, uint64(5), limiter.droppedCount(noisyIP))
+	assert.Equal(t, uint64(0), limiter.droppedCount(quietIP))
+	assert.True(t, limiter.allow(quietIP))
+
+	// 令牌随时间恢复
+	now = now.Add(500 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		assert.True(t, limiter.allow(noisyIP))
+	}
+	assert.False(t, limiter.allow(noisyIP))
+
+	// 上报后丢弃计数清零
+	now = now.Add(_RATE_LIMIT_REPORT_INTERVAL)
+	limiter.report()
+	assert.Equal(t, uint64(0), limiter.droppedCount(noisyIP))
+}
+
+func TestRateLimitIPv6NoHashCollision(t *testing.T) {
+	now := time.Now()
+	limiter := newIPRateLimiter(1)
+	limiter.now = func() time.Time { return now }
+
+	// 两个地址按32位异或的哈希相同，需使用独立的令牌桶
+	ip1 := net.ParseIP("fd00::1")
+	ip2 := net.ParseIP("fd00::1:0:0")
+	assert.True(t, limiter.allow(ip1))
+	assert.False(t, limiter.allow(ip1))
+	assert.True(t, limiter.allow(ip2))
+	assert.Equal(t, uint64(1), limiter.droppedCount(ip1))
+	assert.Equal(t, uint64(0), limiter.droppedCount(ip2))
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	limiter := newIPRateLimiter(0)
+	assert.Nil(t, limiter)
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.allow(net.ParseIP("10.0.0.1")))
+	}
+}
+
+func TestParseSyslogModuleAndType(t *testing.T) {
+	testCases := []struct {
+		line       string
+		wantModule string
+		wantType   string
+	}{
+		{"2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] synchronizer.go:397 msg", "trident", LOG_TYPE},
+		{"2020-11-23T16:56:35+08:00 dfi-153 deepflow-agent[100]: [WARN] main.go:1 msg", "deepflow-agent", LOG_TYPE},
+		{"2020-11-23T16:56:35+08:00 dfi-153 sidecar: [INFO] main.go:1 msg", "sidecar", LOG_TYPE},
+		{"<134>2020-11-23T16:56:35+08:00 dfi-153 sidecar[1]: [INFO] main.go:1 msg", "sidecar", "local0"},
+		{"<30>2020-11-23T16:56:35+08:00 dfi-153 trident[1]: [ERRO] main.go:1 msg", "trident", "daemon"},
+		{"2020-11-23T16:56:35+08:00 dfi-153 [1]: [INFO] main.go:1 msg", LOG_MODULE, LOG_TYPE},
+	}
+	for _, tc := range testCases {
+		esLog, err := parseSyslog([]byte(tc.line), defaultLevelToSeverity)
+		assert.Nil(t, err, tc.line)
+		assert.Equal(t, tc.wantModule, esLog.Module, tc.line)
+		assert.Equal(t, tc.wantType, esLog.Type, tc.line)
+	}
+
+	// 非法PRI不剥离，时间解析失败
+	_, err := parseSyslog([]byte("<999>2020-11-23T16:56:35+08:00 dfi-153 trident[1]: [INFO] main.go:1 msg"), defaultLevelToSeverity)
+	assert.NotNil(t, err)
+}
+
+func TestParseSyslogLevel(t *testing.T) {
+	levelToSeverity := newLevelToSeverity(map[string]string{"NOTICE": "notice", "WARN": "err", "BAD": "unknown"})
+	testCases := []struct {
+		level        string
+		wantSeverity syslog.Priority
+	}{
+		{"[DEBUG]", syslog.LOG_DEBUG},
+		{"[INFO]", syslog.LOG_INFO},
+		{"[ERROR]", syslog.LOG_ERR},
+		{"[FATAL]", syslog.LOG_CRIT},
+		{"[CRIT]", syslog.LOG_CRIT},
+		{"[NOTICE]", syslog.LOG_NOTICE},
+		{"[WARN]", syslog.LOG_ERR},
+	}
+	for _, tc := range testCases {
+		line := "2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: " + tc.level + " synchronizer.go:397 msg"
+		esLog, err := parseSyslog([]byte(line), levelToSeverity)
+		if assert.Nil(t, err, tc.level) {
+			assert.Equal(t, strconv.Itoa(int(tc.wantSeverity)), esLog.Severity, tc.level)
+		}
+	}
+
+	for _, level := range []string{"[BAD]", "[TRACE]"} {
+		line := "2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: " + level + " synchronizer.go:397 msg"
+		_, err := parseSyslog([]byte(line), levelToSeverity)
+		assert.NotNil(t, err, level)
+	}
+	// 默认映射不受自定义映射影响
+	assert.Equal(t, syslog.LOG_WARNING, defaultLevelToSeverity["WARN"])
+}
+
+func TestParseSyslogJSON(t *testing.T) {
+	textLog, err := parseSyslog([]byte("<30>2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [ERROR] synchronizer.go:397 sync failed"), defaultLevelToSeverity)
+	assert.Nil(t, err)
+	jsonLog, err := parseSyslog([]byte(`<30>2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"ts":"2020-11-23T16:56:35.123+08:00","level":"error","msg":"sync failed","file":"synchronizer.go","line":397}`+"\n"), defaultLevelToSeverity)
+	assert.Nil(t, err)
+	for _, esLog := range []*ESLog{textLog, jsonLog} {
+		assert.Equal(t, "daemon", esLog.Type)
+		assert.Equal(t, "trident", esLog.Module)
+		assert.Equal(t, "dfi-153", esLog.Host)
+		assert.Equal(t, uint32(1606121795), esLog.Timestamp)
+		assert.Equal(t, strconv.Itoa(int(syslog.LOG_ERR)), esLog.Severity)
+		assert.Equal(t, "sync failed", esLog.Message)
+	}
+	assert.Nil(t, textLog.StructuredData)
+	assert.Equal(t, map[string]json.RawMessage{"file": json.RawMessage(`"synchronizer.go"`), "line": json.RawMessage(`397`)}, jsonLog.StructuredData)
+
+	// 缺少ts时使用syslog头中的时间，支持数字时间戳
+	esLog, err := parseSyslog([]byte(`2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"level":"info","msg":"started"}`), defaultLevelToSeverity)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1606121795), esLog.Timestamp)
+	assert.Nil(t, esLog.StructuredData)
+	esLog, err = parseSyslog([]byte(`2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"ts":1606121800,"level":"warn","msg":"slow"}`), defaultLevelToSeverity)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1606121800), esLog.Timestamp)
+	assert.Equal(t, strconv.Itoa(int(syslog.LOG_WARNING)), esLog.Severity)
+
+	for _, line := range []string{
+		`2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"msg":"no level"}`,
+		`2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"level":"trace","msg":"ignored"}`,
+		`2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {"ts":"bad","level":"info","msg":"bad ts"}`,
+		// 非法JSON按文本格式解析
+		`2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: {broken json`,
+	} {
+		_, err := parseSyslog([]byte(line), defaultLevelToSeverity)
+		assert.NotNil(t, err, line)
+	}
+}
+
+func TestWriteFileHashCollision(t *testing.T) {
+	w := newTestFileWriter(t.TempDir())
+	ip1 := net.ParseIP("fd00::1")
+	ip2 := net.ParseIP("::1:fd00:0:0:0")
+	// 两个ip的hash相同
+	assert.Equal(t, utils.GetIpHash(ip1), utils.GetIpHash(ip2))
+
+	w.writeLog(ip1, []byte("from ip1\n"))
+	w.writeLog(ip2, []byte("from ip2\n"))
+	// 同一ip的4字节和16字节形式写入同一文件
+	w.writeLog(net.ParseIP("10.0.0.1").To4(), []byte("from ipv4 1\n"))
+	w.writeLog(net.ParseIP("10.0.0.1").To16(), []byte("from ipv4 2\n"))
+	assert.Equal(t, 3, len(w.fileMap))
+
+	lines, err := w.TailLog(ip1, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"from ip1"}, lines)
+	lines, err = w.TailLog(ip2, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"from ip2"}, lines)
+	lines, err = w.TailLog(net.ParseIP("10.0.0.1"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"from ipv4 1", "from ipv4 2"}, lines)
+}
+
+func TestWriteFileMaxOpenFiles(t *testing.T) {
+	w := newTestFileWriter(t.TempDir())
+	w.maxOpenFiles = 2
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	for _, ip := range ips {
+		w.writeLog(net.ParseIP(ip), []byte("first from "+ip+"\n"))
+	}
+	// 10.0.0.1最久未写入，被关闭
+	assert.Equal(t, 2, len(w.fileMap))
+	assert.Equal(t, 2, w.fileLRU.Len())
+	assert.NotContains(t, w.fileMap, "10.0.0.1")
+
+	// 重新写入时再次打开，10.0.0.2被关闭
+	w.writeLog(net.ParseIP("10.0.0.1"), []byte("second from 10.0.0.1\n"))
+	assert.Equal(t, 2, len(w.fileMap))
+	assert.NotContains(t, w.fileMap, "10.0.0.2")
+
+	for _, ip := range ips {
+		want := []string{"first from " + ip}
+		if ip == "10.0.0.1" {
+			want = append(want, "second from 10.0.0.1")
+		}
+		lines, err := w.TailLog(net.ParseIP(ip), 10)
+		assert.Nil(t, err)
+		assert.Equal(t, want, lines, ip)
+	}
+}
+
+func TestWriteFileCounter(t *testing.T) {
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	w.maxOpenFiles = 2
+	// 10.0.0.1的日志文件链接到之前的日期，首次写入时按天切分
+	oldFilename := filepath.Join(directory, "10.0.0.1.log.2020-01-01")
+	assert.Nil(t, os.WriteFile(oldFilename, []byte("old\n"), 0644))
+	assert.Nil(t, os.Symlink(oldFilename, filepath.Join(directory, "10.0.0.1.log")))
+
+	w.writeLog(net.ParseIP("10.0.0.1").To4(), []byte("from 10.0.0.1\n"))
+	w.writeLog(net.ParseIP("10.0.0.1").To16(), []byte("from 10.0.0.1\n"))
+	w.writeLog(net.ParseIP("10.0.0.2"), []byte("from 10.0.0.2\n"))
+	counter := w.GetCounter().(*WriterCounter)
+	assert.Equal(t, uint64(2), counter.OpenFiles)
+	assert.Equal(t, uint64(1), counter.FileRotations)
+	assert.Equal(t, uint64(0), counter.FileEvictions)
+
+	// 达到打开文件数上限后关闭最久未写入的文件，打开文件数不变
+	w.writeLog(net.ParseIP("10.0.0.3"), []byte("from 10.0.0.3\n"))
+	counter = w.GetCounter().(*WriterCounter)
+	assert.Equal(t, uint64(2), counter.OpenFiles)
+	assert.Equal(t, uint64(0), counter.FileRotations)
+	assert.Equal(t, uint64(1), counter.FileEvictions)
+
+	// 空闲文件关闭后打开文件数减少
+	for i := 0; i < _FILE_FEED; i++ {
+		w.writeFile(nil, nil)
+	}
+	assert.Equal(t, uint64(0), w.GetCounter().(*WriterCounter).OpenFiles)
+}
+
+func TestWriteFileFilterByIP(t *testing.T) {
+	es := newMockES()
+	defer es.server.Close()
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	w.levelToSeverity = newLevelToSeverity(nil)
+	w.esLogger = NewESLogger([]string{strings.TrimPrefix(es.server.URL, "http://")}, "", "", "test", false, 0, 0, ES_ROUTING_NONE, "", 0)
+	waitESConnected(t, w.esLogger)
+
+	assert.NotNil(t, w.SetFileFilter([]string{"invalid"}, nil))
+	assert.Nil(t, w.SetFileFilter([]string{"10.0.0.1"}, nil))
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		w.writeLog(net.ParseIP(ip), []byte("2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] a.go:1 from "+ip+"\n"))
+	}
+	w.writeFile(nil, nil)
+	w.writeES(nil, nil)
+
+	// 仅10.0.0.1写入文件，两个ip都写入ES
+	_, err := os.Stat(filepath.Join(directory, "10.0.0.1.log"))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(directory, "10.0.0.2.log"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Contains(t, es.bulkBody, "from 10.0.0.1")
+	assert.Contains(t, es.bulkBody, "from 10.0.0.2")
+
+	// 运行时修改为黑名单，关闭已打开的10.0.0.1文件
+	assert.Nil(t, w.SetFileFilter(nil, []string{"10.0.0.1"}))
+	assert.Equal(t, 0, len(w.fileMap))
+	w.writeLog(net.ParseIP("10.0.0.2"), []byte("from 10.0.0.2 again\n"))
+	w.writeFile(nil, nil)
+	_, err = os.Stat(filepath.Join(directory, "10.0.0.2.log"))
+	assert.Nil(t, err)
+}
+
+func TestWriteFileWithESUnreachable(t *testing.T) {
+	// 预留端口，ES启动前连接被拒绝
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.Nil(t, err) {
+		return
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	directory := t.TempDir()
+	w := newTestFileWriter(directory)
+	w.levelToSeverity = newLevelToSeverity(nil)
+	w.esLogger = NewESLogger([]string{address}, "", "", "test", false, 0, 0, ES_ROUTING_NONE, "", 0)
+	w.esLogger.reconnectInterval = 10 * time.Millisecond
+	line := []byte("2020-11-23T16:56:35+08:00 dfi-153 trident[8642]: [INFO] a.go:1 before es up\n")
+	w.writeLog(net.ParseIP("10.0.0.1"), line)
+	w.flush()
+
+	// ES不可达时仍写入文件，日志缓存至连接ES
+	lines, err := w.TailLog(net.ParseIP("10.0.0.1"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{strings.TrimSuffix(string(line), "\n")}, lines)
+	assert.False(t, w.esLogger.Connected())
+	assert.Equal(t, uint64(0), w.GetCounter().(*WriterCounter).ESConnected)
+
+	es := &mockES{}
+	es.server = httptest.NewUnstartedServer(http.HandlerFunc(es.serveHTTP))
+	es.server.Listener.Close()
+	if es.server.Listener, err = net.Listen("tcp", address); !assert.Nil(t, err) {
+		return
+	}
+	es.server.Start()
+	defer es.server.Close()
+
+	// 定时flush触发重连，连接后写入缓存的日志
+	assert.Eventually(t, func() bool {
+		w.flush()
+		return strings.Contains(es.bulkBody, "before es up")
+	}, 15*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(1), w.GetCounter().(*WriterCounter).ESConnected)
+	assert.Empty(t, w.esLogger.pending)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	TAIL_DEFAULT_LINES = 10
+	TAIL_MAX_LINES     = 1000
+)
+
+// 从文件末尾向前读取，返回最后n行(不含换行符)
+func tailLines(filename string, n int) ([]string, error) {
+	lines := []string{}
+	if n <= 0 {
+		return lines, nil
+	}
+	fp, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return lines, nil
+		}
+		return nil, err
+	}
+	defer fp.Close()
+
+	offset, err := fp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte{}
+	buffer := make([]byte, BUFSIZE)
+	// 除末尾换行符外读到n个换行符时，最后n行已完整
+	for offset > 0 && bytes.Count(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'}) < n {
+		size := int64(len(buffer))
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+		if _, err := fp.ReadAt(buffer[:size], offset); err != nil {
+			return nil, err
+		}
+		data = append(append(make([]byte, 0, int(size)+len(data)), buffer[:size]...), data...)
+	}
+
+	if len(data) == 0 {
+		return lines, nil
+	}
+	lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines, nil
+}
+
+// 返回ip对应日志文件的最后n行，读取前先刷新缓存，文件不存在时返回空
+func (w *syslogWriter) TailLog(ip net.IP, n int) ([]string, error) {
+	if !w.logToFileEnabled {
+		return []string{}, nil
+	}
+	w.fileLock.Lock()
+	if writer, ok := w.fileMap[ip.String()]; ok {
+		writer.fileBuffer.Flush()
+	}
+	w.fileLock.Unlock()
+	return tailLines(w.currentLogFile(ip.String()), n)
+}
+
+type tailCommand struct {
+	writer *syslogWriter
+}
+
+// 命令参数为"<ip>[,lines]"，也可用空格分隔
+func (c *tailCommand) HandleSimpleCommand(operate uint16, arg string) string {
+	fields := strings.FieldsFunc(arg, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(fields) == 0 || len(fields) > 2 {
+		return "usage: <ip>[,lines]"
+	}
+	ip := net.ParseIP(fields[0])
+	if ip == nil {
+		return fmt.Sprintf("invalid ip %s", fields[0])
+	}
+	n := TAIL_DEFAULT_LINES
+	if len(fields) == 2 {
+		var err error
+		if n, err = strconv.Atoi(fields[1]); err != nil || n <= 0 {
+			return fmt.Sprintf("invalid lines %s", fields[1])
+		}
+		if n > TAIL_MAX_LINES {
+			n = TAIL_MAX_LINES
+		}
+	}
+	lines, err := c.writer.TailLog(ip, n)
+	if err != nil {
+		return fmt.Sprintf("tail syslog of %s failed: %s", ip, err)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2023 Yunshan Networks
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package syslog
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFileWriter(directory string) *syslogWriter {
+	return &syslogWriter{
+		logToFileEnabled: true,
+		directory:        directory,
+		fileMap:          make(map[string]*fileWriter, 8),
+		fileLRU:          list.New(),
+	}
+}
+
+func TestTailLog(t *testing.T) {
+	w := newTestFileWriter(t.TempDir())
+	ip := net.ParseIP("10.0.0.1")
+	for i := 1; i <= 5; i++ {
+		w.writeLog(ip, []byte(fmt.Sprintf("line %d\n", i)))
+	}
+
+	// 日志仍在缓存中，未写入文件
+	content, err := os.ReadFile(filepath.Join(w.directory, "10.0.0.1.log"))
+	assert.Nil(t, err)
+	assert.Empty(t, content)
+
+	lines, err := w.TailLog(ip, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"line 3", "line 4", "line 5"}, lines)
+
+	lines, err = w.TailLog(ip, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"line 1", "line 2", "line 3", "line 4", "line 5"}, lines)
+
+	c := &tailCommand{writer: w}
+	assert.Equal(t, "line 4\nline 5", c.HandleSimpleCommand(0, "10.0.0.1,2"))
+	assert.Equal(t, "line 5", c.HandleSimpleCommand(0, "10.0.0.1 1"))
+}
+
+func TestTailLogMissingFile(t *testing.T) {
+	w := newTestFileWriter(t.TempDir())
+	lines, err := w.TailLog(net.ParseIP("10.0.0.2"), 3)
+	assert.Nil(t, err)
+	assert.Empty(t, lines)
+}
+
+func TestTailLinesAcrossChunks(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	line := strings.Repeat("x", BUFSIZE/3)
+	content := ""
+	for i := 0; i < 10; i++ {
+		content += fmt.Sprintf("%d%s\n", i, line)
+	}
+	assert.Nil(t, os.WriteFile(filename, []byte(content), 0644))
+
+	lines, err := tailLines(filename, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"6" + line, "7" + line, "8" + line, "9" + line}, lines)
+}
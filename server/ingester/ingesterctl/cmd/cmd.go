@@ -84,6 +84,10 @@ func RegisterIngesterCommand(root *cobra.Command) {
 	dropletCmd.AddCommand(adapter.RegisterCommand(ingesterctl.INGESTERCTL_ADAPTER))
 	dropletCmd.AddCommand(labeler.RegisterCommand(ingesterctl.INGESTERCTL_LABELER))
 	dropletCmd.AddCommand(rpc.RegisterRpcCommand())
+	dropletCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_SYSLOG_TAIL, debug.CmdHelper{"syslog-tail <ip>[,lines]", "show last lines of agent syslog file"}, nil))
+	dropletCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_SYSLOG_PURGE, debug.CmdHelper{"syslog-purge <ip>,confirm", "remove all syslog files of agent, requires syslog-purge-enabled"}, nil))
+	dropletCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_SYSLOG_FLUSH, debug.CmdHelper{"syslog-flush", "flush buffered syslog to files and elasticsearch"}, nil))
+	dropletCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_SYSLOG_RECENT, debug.CmdHelper{"syslog-recent <ip>[,lines]", "show recent syslog of agent kept in memory"}, nil))
 
 	flowMetricsCmd.AddCommand(queue.RegisterCommand(ingesterctl.INGESTERCTL_FLOW_METRICS_QUEUE, []string{"1-recv-unmarshall"}))
 	flowMetricsCmd.AddCommand(debug.ClientRegisterSimple(ingesterctl.CMD_PLATFORMDATA_FLOW_METRIC, debug.CmdHelper{"platformData [filter]", "show flow metrics platform data statistics"}, nil))
@@ -52,6 +52,10 @@ const (
 	CMD_OTLP_EXPORTER
 	CMD_EXPORTER_PLATFORMDATA
 	CMD_PLATFORMDATA_PROFILE
+	CMD_SYSLOG_TAIL
+	CMD_SYSLOG_PURGE
+	CMD_SYSLOG_FLUSH
+	CMD_SYSLOG_RECENT
 )
 
 const (
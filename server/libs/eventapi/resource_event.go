@@ -19,13 +19,14 @@ package eventapi
 import "github.com/deepflowio/deepflow/server/libs/pool"
 
 const (
-	RESOURCE_EVENT_TYPE_CREATE       = "create"
-	RESOURCE_EVENT_TYPE_DELETE       = "delete"
-	RESOURCE_EVENT_TYPE_UPDATE_STATE = "update-state"
-	RESOURCE_EVENT_TYPE_MIGRATE      = "migrate"
-	RESOURCE_EVENT_TYPE_RECREATE     = "recreate"
-	RESOURCE_EVENT_TYPE_ADD_IP       = "add-ip"
-	RESOURCE_EVENT_TYPE_REMOVE_IP    = "remove-ip"
+	RESOURCE_EVENT_TYPE_CREATE          = "create"
+	RESOURCE_EVENT_TYPE_DELETE          = "delete"
+	RESOURCE_EVENT_TYPE_UPDATE_STATE    = "update-state"
+	RESOURCE_EVENT_TYPE_MIGRATE         = "migrate"
+	RESOURCE_EVENT_TYPE_RECREATE        = "recreate"
+	RESOURCE_EVENT_TYPE_ADD_IP          = "add-ip"
+	RESOURCE_EVENT_TYPE_REMOVE_IP       = "remove-ip"
+	RESOURCE_EVENT_TYPE_UPDATE_CAPACITY = "update-capacity"
 )
 
 type ResourceEvent struct {